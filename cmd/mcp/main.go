@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -18,6 +20,16 @@ import (
 )
 
 func main() {
+	disablePrompts := flag.Bool("disable-prompts", false, "do not register the built-in MCP prompts")
+	workflowDir := flag.String("workflow-dir", "", "directory for saved workflow files (default: working directory)")
+	mainText := flag.Bool("main-text", false, "include the article-like body of the page as mainText in snapshots")
+	maxHTMLInputMB := flag.Int("max-html-input-mb", 0, "megabytes of page HTML the reducer parses (default 4)")
+	uniqueSelectors := flag.Bool("unique-selectors", false, "replace selectors that match several elements with :nth-of-type paths")
+	stripTracking := flag.Bool("strip-tracking-params", false, "remove tracking query parameters from element hrefs")
+	preserveWhitespace := flag.Bool("preserve-whitespace", false, "keep the whitespace inside pre, code and textarea elements in snapshot text")
+	trackingParams := flag.String("tracking-params", "", "comma-separated query parameters to strip, a trailing * matching by prefix (default: utm_*, gclid, fbclid and others)")
+	flag.Parse()
+
 	bridge := wsbridge.NewBridge(wsbridge.Options{
 		CheckOrigin: func(r *http.Request) bool { return true },
 	})
@@ -37,13 +49,24 @@ func main() {
 		}
 	}()
 
-	store := page.NewStore()
-	reducer := page.NewReducer(page.ReduceOptions{})
+	store := page.NewStoreWithLimit(200)
+	reducer := page.NewReducer(page.ReduceOptions{
+		IncludeMainText:     *mainText,
+		MaxHTMLInput:        *maxHTMLInputMB << 20,
+		UniqueSelectors:     *uniqueSelectors,
+		StripTrackingParams: *stripTracking,
+		TrackingParams:      splitList(*trackingParams),
+		PreserveWhitespace:  *preserveWhitespace,
+	})
 	browser := wsbrowser.NewClient(bridge, reducer, store, wsbrowser.Options{})
 
 	server := mcpserver.New(browser, store, mcpserver.Options{
 		Implementation: &mcp.Implementation{Name: "surfingbro-browser", Version: "v1.0.0"},
+		Reducer:        reducer,
 		Instructions:   "Use browser.snapshot to get an LLM-friendly page view. Use browser.click to interact with elements.",
+		Connect:        &mcpserver.ConnectInfo{WebSocketURL: "ws://127.0.0.1:9099/ws"},
+		DisablePrompts: *disablePrompts,
+		WorkflowDir:    *workflowDir,
 	})
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -60,3 +83,14 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
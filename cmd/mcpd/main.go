@@ -7,17 +7,24 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 
 	"github.com/adityalohuni/mcp-server/internal/admin"
+	"github.com/adityalohuni/mcp-server/internal/browser"
+	"github.com/adityalohuni/mcp-server/internal/browser/replay"
 	"github.com/adityalohuni/mcp-server/internal/browser/wsbrowser"
+	"github.com/adityalohuni/mcp-server/internal/buildinfo"
 	"github.com/adityalohuni/mcp-server/internal/config"
 	"github.com/adityalohuni/mcp-server/internal/httpx"
+	"github.com/adityalohuni/mcp-server/internal/logfile"
 	"github.com/adityalohuni/mcp-server/internal/mcpserver"
 	"github.com/adityalohuni/mcp-server/internal/page"
+	"github.com/adityalohuni/mcp-server/internal/screenshot"
 	"github.com/adityalohuni/mcp-server/internal/session"
 	"github.com/adityalohuni/mcp-server/internal/wsbridge"
 )
@@ -27,122 +34,279 @@ func main() {
 	if err != nil {
 		log.Fatalf("config load failed: %v", err)
 	}
+	if settings.LogFile != "" {
+		logFile, err := logfile.Open(settings.LogFile, int64(settings.LogMaxSize)<<20, settings.LogMaxBackups)
+		if err != nil {
+			log.Fatalf("log file: %v", err)
+		}
+		defer logFile.Close()
+		// slog's default handler writes through the log package, so this covers both.
+		log.SetOutput(logFile)
+	}
+	build := buildinfo.Get()
+	log.Printf("mcpd %s (commit %s, built %s)", build.Version, build.Commit, build.BuildTime)
 	log.Printf("loaded config: %s", settings.Path)
+	if err := mcpserver.ValidateToolTimeouts(settings.ToolTimeouts); err != nil {
+		log.Fatalf("config: tools.timeouts: %v", err)
+	}
+	if err := httpx.ValidateScopes(settings.ScopedTokens); err != nil {
+		log.Fatalf("config: auth.scoped_tokens: %v", err)
+	}
 
 	bridge := wsbridge.NewBridge(wsbridge.Options{
-		CheckOrigin: func(r *http.Request) bool { return true },
+		CheckOrigin:    func(r *http.Request) bool { return true },
+		ActiveStrategy: settings.ActiveSessionStrategy,
+		PendingTTL:     settings.CommandTTL,
+		IdleTimeout:    settings.IdleTimeout,
+		PingInterval:   settings.PingInterval,
+		PongWait:       settings.PongWait,
+		WriteWait:      settings.WriteWait,
+		WriteWaitPerKB: settings.WriteWaitPerKB,
+		MaxWriteWait:   settings.MaxWriteWait,
 	})
 
-	store := page.NewStore()
-	reducer := page.NewReducer(page.ReduceOptions{})
-	browser := wsbrowser.NewClient(bridge, reducer, store, wsbrowser.Options{})
+	store := page.NewStoreWithOptions(page.StoreOptions{
+		MaxSnapshots: settings.MaxSnapshots,
+		MaxBytes:     int64(settings.MaxSnapshotMB) << 20,
+	})
+	if settings.DisableSnapshotStorage {
+		store = page.NewDisabledStore()
+	}
+	reducer := page.NewReducer(page.ReduceOptions{
+		IncludeMainText:     settings.SnapshotMainText,
+		MaxHTMLInput:        settings.SnapshotMaxHTMLInputMB << 20,
+		UniqueSelectors:     settings.SnapshotUniqueSelectors,
+		StripTrackingParams: settings.SnapshotStripTrackingParams,
+		TrackingParams:      settings.SnapshotTrackingParams,
+		PreserveWhitespace:  settings.SnapshotPreserveWhitespace,
+	})
+	var browserClient browser.Browser = wsbrowser.NewClient(bridge, reducer, store, wsbrowser.Options{})
+	if settings.ReplayDir != "" {
+		replayed, err := replay.Load(settings.ReplayDir, reducer)
+		if err != nil {
+			log.Fatalf("config: browser.replay_dir: %v", err)
+		}
+		log.Printf("replaying recorded pages from %s; the browser extension is not used", settings.ReplayDir)
+		browserClient = replayed
+	}
 
-	server := mcpserver.New(browser, store, mcpserver.Options{
-		Implementation: &mcp.Implementation{Name: "surfingbro-browser", Version: "v1.0.0"},
-		Instructions:   "Use browser.snapshot to get an LLM-friendly page view. Use browser.click to interact with elements.",
+	server := mcpserver.New(browserClient, store, mcpserver.Options{
+		Implementation:        &mcp.Implementation{Name: "surfingbro-browser", Version: "v1.0.0"},
+		Reducer:               reducer,
+		Instructions:          "Use browser.snapshot to get an LLM-friendly page view. Use browser.click to interact with elements.",
+		AllowedHosts:          settings.AllowedHosts,
+		AllowEvaluate:         settings.AllowEvaluate,
+		DefaultSnapshotFormat: settings.DefaultSnapshotFormat,
+		ToolTimeouts:          settings.ToolTimeouts,
+		MaxTabsPerSession:     settings.MaxTabsPerSession,
+		ActiveSession:         bridge.ActiveSessionID,
+		ToolRateLimit:         settings.ToolRateLimit,
+		ToolRateBurst:         settings.ToolRateBurst,
+		ClientIDHeaders:       settings.ClientIDHeaders,
+		DisablePrompts:        settings.DisablePrompts,
+		WorkflowDir:           settings.WorkflowDir,
+		Screenshots:           screenshot.NewStore(screenshot.Options{MaxBytes: int64(settings.MaxScreenshotMB) << 20}),
+		// /ws is not behind a token, so AuthRequired stays false.
+		Connect: &mcpserver.ConnectInfo{WebSocketURL: config.WebSocketURL(settings)},
 	})
 	mcpServer := server.MCPServer()
 
 	sseHandler := mcp.NewSSEHandler(func(_ *http.Request) *mcp.Server { return mcpServer }, nil)
 	streamHandler := mcp.NewStreamableHTTPHandler(func(_ *http.Request) *mcp.Server { return mcpServer }, nil)
 
-	registry := session.NewRegistry()
+	registry := session.NewRegistryWithOptions(session.RegistryOptions{
+		OnPrune: func(c session.ClientInfo) {
+			log.Printf("client pruned: id=%s name=%s last_seen=%s", c.ID, c.Name, c.LastSeen.Format(time.RFC3339))
+		},
+	})
 	adminHandlers := &admin.Handlers{
 		StartedAt:  time.Now(),
 		Clients:    registry,
 		Bridge:     bridge,
-		Browser:    browser,
+		Browser:    browserClient,
 		MaxIdle:    settings.ClientMaxIdle,
 		ConfigPath: settings.Path,
+		AuditLog:   admin.NewAuditLog(0),
+	}
+
+	// Each route takes the admin tokens, or a scoped token granted its scope.
+	adminAuth := func(scope string) func(http.Handler) http.Handler {
+		return httpx.RequireScope(settings.ScopedTokens, scope, httpx.RequireAdminToken(settings.AdminToken, settings.AdminReadonlyToken))
+	}
+	// Admin JSON responses (notably /admin/browsers with many tabs) are
+	// compressed, or sent as CBOR, for clients that ask; /ws and the MCP
+	// streams are not.
+	adminJSON := func(scope string, h http.Handler) http.Handler {
+		return httpx.Trace(adminAuth(scope)(httpx.Compress(httpx.CBOR(h))))
+	}
+	mcpAuth := httpx.RequireScope(settings.ScopedTokens, httpx.ScopeMCP, httpx.RequireToken(settings.MCPToken))
+
+	tracker := &clientTracker{
+		reg:            registry,
+		idHeaders:      settings.ClientIDHeaders,
+		assignedHeader: settings.AssignedClientIDHeader,
 	}
 
 	mux := http.NewServeMux()
 	mux.Handle("/ws", http.HandlerFunc(bridge.HandleWS))
-	mux.Handle("/mcp/sse", httpx.RequireToken(settings.MCPToken)(trackSSE(registry, sseHandler)))
-	mux.Handle("/mcp/stream", httpx.RequireToken(settings.MCPToken)(trackStreamable(registry, streamHandler)))
-	mux.Handle("/admin/status", httpx.RequireToken(settings.AdminToken)(http.HandlerFunc(adminHandlers.Status)))
-	mux.Handle("/admin/clients", httpx.RequireToken(settings.AdminToken)(http.HandlerFunc(adminHandlers.ClientsList)))
-	mux.Handle("/admin/browsers", httpx.RequireToken(settings.AdminToken)(http.HandlerFunc(adminHandlers.BrowsersList)))
-	mux.Handle("/admin/clients/disconnect", httpx.RequireToken(settings.AdminToken)(http.HandlerFunc(adminHandlers.DisconnectClient)))
-	mux.Handle("/admin/browsers/disconnect", httpx.RequireToken(settings.AdminToken)(http.HandlerFunc(adminHandlers.DisconnectBrowser)))
-	mux.Handle("/admin/config", httpx.RequireToken(settings.AdminToken)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/mcp/sse", mcpAuth(tracker.trackSSE(sseHandler)))
+	mux.Handle("/mcp/stream", mcpAuth(tracker.trackStreamable(streamHandler)))
+
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/admin/status", adminJSON(httpx.ScopeStatusRead, http.HandlerFunc(adminHandlers.Status)))
+	adminMux.Handle("/admin/version", adminJSON(httpx.ScopeStatusRead, http.HandlerFunc(adminHandlers.Version)))
+	adminMux.Handle("/admin/clients", adminJSON(httpx.ScopeClientsRead, http.HandlerFunc(adminHandlers.ClientsList)))
+	adminMux.Handle("/admin/clients/get", adminJSON(httpx.ScopeClientsRead, http.HandlerFunc(adminHandlers.ClientGet)))
+	adminMux.Handle("/admin/browsers", adminJSON(httpx.ScopeBrowsersRead, http.HandlerFunc(adminHandlers.BrowsersList)))
+	adminMux.Handle("/admin/browsers/get", adminJSON(httpx.ScopeBrowsersRead, http.HandlerFunc(adminHandlers.BrowserGet)))
+	adminMux.Handle("/admin/clients/disconnect", adminJSON(httpx.ScopeClientsWrite, http.HandlerFunc(adminHandlers.DisconnectClient)))
+	adminMux.Handle("/admin/browsers/disconnect", adminJSON(httpx.ScopeBrowsersWrite, http.HandlerFunc(adminHandlers.DisconnectBrowser)))
+	adminMux.Handle("/admin/browsers/broadcast", adminJSON(httpx.ScopeBrowsersWrite, http.HandlerFunc(adminHandlers.Broadcast)))
+	adminMux.Handle("/admin/browsers/active", adminJSON(httpx.ScopeBrowsersWrite, http.HandlerFunc(adminHandlers.SetActiveBrowser)))
+	// A websocket, so not wrapped in the compressing adminJSON.
+	adminMux.Handle("/admin/browsers/events", httpx.Trace(adminAuth(httpx.ScopeBrowsersRead)(http.HandlerFunc(adminHandlers.BrowserEvents))))
+	adminMux.Handle("/admin/audit", adminJSON(httpx.ScopeConfigRead, http.HandlerFunc(adminHandlers.Audit)))
+	configGet := adminJSON(httpx.ScopeConfigRead, http.HandlerFunc(adminHandlers.ConfigGet))
+	configSet := adminJSON(httpx.ScopeConfigWrite, http.HandlerFunc(adminHandlers.ConfigSet))
+	adminMux.Handle("/admin/config", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			adminHandlers.ConfigGet(w, r)
+			configGet.ServeHTTP(w, r)
 		case http.MethodPut:
-			adminHandlers.ConfigSet(w, r)
+			configSet.ServeHTTP(w, r)
 		default:
 			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		}
-	})))
-	mux.Handle("/admin/ui", http.RedirectHandler("/admin/ui/", http.StatusFound))
-	mux.Handle("/admin/ui/", http.StripPrefix("/admin/ui/", admin.UIHandler{Root: filepath.Join("web", "admin-ui", "dist")}))
+	}))
+	adminMux.Handle("/admin/ui", http.RedirectHandler("/admin/ui/", http.StatusFound))
+	ui := &admin.UIHandler{Root: filepath.Join("web", "admin-ui", "dist")}
+	adminMux.Handle("/admin/ui/reload", adminAuth(httpx.ScopeConfigWrite)(http.HandlerFunc(ui.Reload)))
+	adminMux.Handle("/admin/ui/", http.StripPrefix("/admin/ui/", ui))
 
-	httpServer := &http.Server{
-		Addr:    settings.DaemonAddr,
-		Handler: mux,
-	}
+	servers := httpServers(settings, mux, adminMux)
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	go func() {
-		log.Printf("mcp daemon listening on %s", httpServer.Addr)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("http server error: %v", err)
-		}
-	}()
+	for _, srv := range servers {
+		go func() {
+			log.Printf("mcp daemon listening on %s", srv.Addr)
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("http server error: %v", err)
+			}
+		}()
+	}
 
 	<-ctx.Done()
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	_ = httpServer.Shutdown(shutdownCtx)
+	// Close MCP sessions first so clients see their streams end and can
+	// reconnect, rather than waiting out a dropped connection.
+	dropped := tracker.shutdown()
+	closed := server.Shutdown(shutdownCtx)
+	log.Printf("shutting down: closed %d MCP sessions, unregistered %d clients", closed, dropped)
+	// With no MCP client left to issue commands, close the browser sessions;
+	// anything still waiting on one fails with session_closing.
+	log.Printf("shutting down: closed %d browser sessions", bridge.Shutdown(shutdownCtx))
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		wg.Go(func() { _ = srv.Shutdown(shutdownCtx) })
+	}
+	wg.Wait()
+}
+
+// httpServers serves mux on daemon.addr. The admin routes in adminMux join
+// it there, or get their own server when daemon.admin_addr names another
+// address.
+func httpServers(settings config.Settings, mux, adminMux *http.ServeMux) []*http.Server {
+	if settings.AdminAddr == "" || settings.AdminAddr == settings.DaemonAddr {
+		mux.Handle("/admin/", adminMux)
+		return []*http.Server{{Addr: settings.DaemonAddr, Handler: mux}}
+	}
+	return []*http.Server{
+		{Addr: settings.DaemonAddr, Handler: mux},
+		{Addr: settings.AdminAddr, Handler: adminMux},
+	}
+}
+
+// clientTracker keeps the client registry up to date from MCP requests.
+// Clients identify themselves with the first of idHeaders they send; one that
+// sends none is registered and told its id in assignedHeader.
+type clientTracker struct {
+	reg            *session.Registry
+	idHeaders      []string
+	assignedHeader string
+	closing        atomic.Bool
+}
+
+// shutdown refuses further MCP requests and unregisters every client,
+// returning how many there were.
+func (t *clientTracker) shutdown() int {
+	t.closing.Store(true)
+	return t.reg.UnregisterAll()
 }
 
-func trackSSE(reg *session.Registry, next http.Handler) http.Handler {
+// refuse answers 503 once shutdown has begun, so a client reconnecting
+// during shutdown is not registered again.
+func (t *clientTracker) refuse(w http.ResponseWriter) bool {
+	if !t.closing.Load() {
+		return false
+	}
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+	return true
+}
+
+func (t *clientTracker) trackSSE(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t.refuse(w) {
+			return
+		}
 		info := clientInfoFromRequest(r, "sse")
-		clientID := ensureClient(reg, w, r, info)
+		clientID := t.ensureClient(w, r, info)
 		if clientID != "" {
 			go func() {
 				<-r.Context().Done()
-				reg.Unregister(clientID)
+				t.reg.Unregister(clientID)
 			}()
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-func trackStreamable(reg *session.Registry, next http.Handler) http.Handler {
+func (t *clientTracker) trackStreamable(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if t.refuse(w) {
+			return
+		}
 		info := clientInfoFromRequest(r, "streamable")
 		if r.Method == http.MethodGet {
-			clientID := ensureClient(reg, w, r, info)
+			clientID := t.ensureClient(w, r, info)
 			if clientID != "" {
 				go func() {
 					<-r.Context().Done()
-					reg.Unregister(clientID)
+					t.reg.Unregister(clientID)
 				}()
 			}
 			next.ServeHTTP(w, r)
 			return
 		}
-		clientID := clientIDFromRequest(r)
+		clientID := t.clientID(r)
 		if clientID != "" {
-			reg.Touch(clientID, info)
+			t.reg.Touch(clientID, info)
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
-func ensureClient(reg *session.Registry, w http.ResponseWriter, r *http.Request, info session.ClientInfo) string {
-	clientID := clientIDFromRequest(r)
+func (t *clientTracker) ensureClient(w http.ResponseWriter, r *http.Request, info session.ClientInfo) string {
+	clientID := t.clientID(r)
 	if clientID == "" {
-		clientID = reg.Register("", info)
-		w.Header().Set("X-Assigned-Client-Id", clientID)
+		clientID = t.reg.Register("", info)
+		w.Header().Set(t.assignedHeader, clientID)
 		return clientID
 	}
-	reg.Touch(clientID, info)
+	t.reg.Touch(clientID, info)
 	return clientID
 }
 
@@ -152,15 +316,15 @@ func clientInfoFromRequest(r *http.Request, transport string) session.ClientInfo
 		Transport:  transport,
 		RemoteAddr: httpx.ClientIP(r),
 		UserAgent:  r.UserAgent(),
+		Labels:     session.ParseLabels(r.Header.Get("X-Client-Labels")),
 	}
 }
 
-func clientIDFromRequest(r *http.Request) string {
-	if v := r.Header.Get("X-Client-Id"); v != "" {
-		return v
-	}
-	if v := r.Header.Get("X-MCP-Client-Id"); v != "" {
-		return v
+func (t *clientTracker) clientID(r *http.Request) string {
+	for _, h := range t.idHeaders {
+		if v := r.Header.Get(h); v != "" {
+			return v
+		}
 	}
 	return ""
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/adityalohuni/mcp-server/internal/config"
+	"github.com/adityalohuni/mcp-server/internal/session"
+)
+
+func TestHTTPServersFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	settings, err := config.LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	muxes := func() (*http.ServeMux, *http.ServeMux) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/ws", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusTeapot) })
+		adminMux := http.NewServeMux()
+		adminMux.HandleFunc("/admin/status", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusAccepted) })
+		return mux, adminMux
+	}
+	status := func(h http.Handler, path string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	mux, adminMux := muxes()
+	servers := httpServers(settings, mux, adminMux)
+	if len(servers) != 1 || servers[0].Addr != settings.DaemonAddr {
+		t.Fatalf("expected one server on %s without admin_addr, got %d", settings.DaemonAddr, len(servers))
+	}
+	if status(servers[0].Handler, "/ws") != http.StatusTeapot || status(servers[0].Handler, "/admin/status") != http.StatusAccepted {
+		t.Fatalf("expected the single server to serve both /ws and /admin")
+	}
+
+	settings.AdminAddr = "127.0.0.1:9199"
+	saved, err := config.Save(settings)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	settings, err = config.LoadOrCreate(path)
+	if err != nil || settings.AdminAddr != saved.AdminAddr {
+		t.Fatalf("expected admin_addr to survive a reload, got %q (%v)", settings.AdminAddr, err)
+	}
+	mux, adminMux = muxes()
+	servers = httpServers(settings, mux, adminMux)
+	if len(servers) != 2 || servers[0].Addr != settings.DaemonAddr || servers[1].Addr != "127.0.0.1:9199" {
+		t.Fatalf("expected MCP and admin servers, got %d", len(servers))
+	}
+	public, adminSrv := servers[0].Handler, servers[1].Handler
+	if status(public, "/ws") != http.StatusTeapot || status(public, "/admin/status") != http.StatusNotFound {
+		t.Fatalf("expected the MCP server to serve /ws but not /admin")
+	}
+	if status(adminSrv, "/admin/status") != http.StatusAccepted || status(adminSrv, "/ws") != http.StatusNotFound {
+		t.Fatalf("expected the admin server to serve /admin but not /ws")
+	}
+	if got := config.WebSocketURL(settings); got != "ws://127.0.0.1:9099/ws" {
+		t.Fatalf("expected the extension to be pointed at daemon.addr, got %s", got)
+	}
+}
+
+func TestClientTrackerCustomHeaders(t *testing.T) {
+	reg := session.NewRegistry()
+	tracker := &clientTracker{reg: reg, idHeaders: []string{"X-Proxy-Client"}, assignedHeader: "X-Proxy-Assigned"}
+	h := tracker.trackStreamable(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	get := func(header http.Header) *httptest.ResponseRecorder {
+		// The request context ends with the test, so registered clients stay
+		// registered until then.
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/mcp/stream", nil)
+		req.Header = header
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get(http.Header{"X-Proxy-Client": {"client-1"}, "X-Client-Id": {"ignored"}})
+	if _, ok := reg.Get("client-1"); !ok {
+		t.Fatalf("expected the client to be tracked by the configured header")
+	}
+	if _, ok := reg.Get("ignored"); ok || rec.Header().Get("X-Proxy-Assigned") != "" {
+		t.Fatalf("expected the default header to be ignored and no id to be assigned")
+	}
+
+	rec = get(http.Header{"X-Client-Id": {"client-2"}})
+	assigned := rec.Header().Get("X-Proxy-Assigned")
+	if assigned == "" || assigned == "client-2" || rec.Header().Get("X-Assigned-Client-Id") != "" {
+		t.Fatalf("expected a new id in the configured response header, got %q", assigned)
+	}
+	if _, ok := reg.Get(assigned); !ok {
+		t.Fatalf("expected the assigned id %q to be registered", assigned)
+	}
+}
+
+func TestClientTrackerShutdown(t *testing.T) {
+	reg := session.NewRegistry()
+	tracker := &clientTracker{reg: reg, idHeaders: config.DefaultClientIDHeaders, assignedHeader: "X-Assigned-Client-Id"}
+	h := tracker.trackSSE(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	get := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/mcp/sse", nil)
+		req.Header.Set("X-Client-Id", id)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	get("client-1")
+	get("client-2")
+	if n := tracker.shutdown(); n != 2 || len(reg.List()) != 0 {
+		t.Fatalf("expected both clients to be unregistered, got %d with %d left", n, len(reg.List()))
+	}
+	if rec := get("client-3"); rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 during shutdown, got %d", rec.Code)
+	}
+	if _, ok := reg.Get("client-3"); ok {
+		t.Fatalf("expected a client arriving during shutdown not to be registered")
+	}
+}
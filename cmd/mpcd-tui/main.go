@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"sort"
 	"strings"
 	"syscall"
@@ -26,6 +30,8 @@ import (
 
 	"github.com/adityalohuni/mcp-server/internal/admin"
 	"github.com/adityalohuni/mcp-server/internal/adminclient"
+	"github.com/adityalohuni/mcp-server/internal/browser"
+	"github.com/adityalohuni/mcp-server/internal/buildinfo"
 	"github.com/adityalohuni/mcp-server/internal/config"
 	"github.com/adityalohuni/mcp-server/internal/session"
 )
@@ -46,8 +52,18 @@ const (
 type loadResultMsg struct {
 	clients []session.ClientInfo
 	browser []admin.BrowserSession
-	err     error
-	at      time.Time
+	// sameBrowsers is set when the browser list was not refetched; browser
+	// is then nil and the current list stands.
+	sameBrowsers bool
+	status       admin.Status
+	err          error
+	at           time.Time
+}
+
+// versionMsg carries the daemon's build info for the title bar.
+type versionMsg struct {
+	info buildinfo.Info
+	err  error
 }
 
 type disconnectResultMsg struct {
@@ -60,7 +76,24 @@ type serviceActionMsg struct {
 	service string
 	action  string
 	cmd     *exec.Cmd
-	err     error
+	// exit receives the started command's Wait result once it exits.
+	exit <-chan error
+	err  error
+}
+
+// restartMsg fires when an automatic restart's backoff has elapsed.
+type restartMsg struct {
+	service string
+}
+
+type detailMsg struct {
+	text string
+	err  error
+}
+
+type openURLMsg struct {
+	url string
+	err error
 }
 
 type configSavedMsg struct {
@@ -73,6 +106,28 @@ type configReloadedMsg struct {
 	err      error
 }
 
+type remoteConfigMsg struct {
+	config admin.ConfigPayload
+	err    error
+}
+
+// tabStreamMsg reports the outcome of subscribing to a session's tab events.
+type tabStreamMsg struct {
+	sessionID string
+	events    <-chan admin.TabEvent
+	cancel    context.CancelFunc
+	err       error
+}
+
+// tabEventMsg carries one streamed tab event; ok is false once the stream
+// has ended.
+type tabEventMsg struct {
+	sessionID string
+	events    <-chan admin.TabEvent
+	event     admin.TabEvent
+	ok        bool
+}
+
 type tickMsg time.Time
 
 type settingsForm struct {
@@ -91,14 +146,31 @@ type model struct {
 
 	settings config.Settings
 	form     settingsForm
+	// remote is the daemon's config file as GET /admin/config reads it,
+	// shown beside the form when showRemote is set. It is not necessarily
+	// what the running daemon uses: mcpd reads its config once at startup.
+	remote     *admin.ConfigPayload
+	showRemote bool
 
 	clients  []session.ClientInfo
 	browsers []admin.BrowserSession
+	daemon   admin.Status
+	// version is the daemon build, fetched once per connection: it is
+	// cleared when a refresh fails, since a restarted daemon may differ.
+	version *buildinfo.Info
+
+	// The selected browser session's tabs are kept live between polls by an
+	// admin event stream. tabStreamFailed names a session whose subscription
+	// failed, so polling alone covers it until the selection changes.
+	tabStreamID     string
+	tabStreamCancel context.CancelFunc
+	tabStreamFailed string
 
 	mode           uiMode
 	focus          panel
 	clientCursor   int
 	browserCursor  int
+	tabCursor      int
 	settingsCursor int
 	editingSetting bool
 
@@ -108,6 +180,13 @@ type model struct {
 	mcpCmd  *exec.Cmd
 	mcpdLog string
 	mcpLog  string
+	// mcpdExit and mcpExit deliver how a started service exited. They are
+	// cleared when the user stops the service, so only unexpected exits are
+	// reported. restarts counts automatic restarts since the last manual
+	// start.
+	mcpdExit <-chan error
+	mcpExit  <-chan error
+	restarts map[string]int
 
 	spin spinner.Model
 
@@ -123,6 +202,7 @@ type model struct {
 	velC   float64
 	velB   float64
 
+	detail      string
 	status      string
 	lastUpdated time.Time
 	width       int
@@ -163,6 +243,7 @@ func newModel(client *adminclient.Client, refresh time.Duration, repoRoot string
 		status:        "loading...",
 		mcpdLog:       filepath.Join(os.TempDir(), "surfingbro-mcpd.log"),
 		mcpLog:        filepath.Join(os.TempDir(), "surfingbro-mcp.log"),
+		restarts:      map[string]int{},
 		spin:          sp,
 		editor:        ed,
 		clientVP:      viewport.New(40, 20),
@@ -176,7 +257,7 @@ func newModel(client *adminclient.Client, refresh time.Duration, repoRoot string
 }
 
 func (m model) Init() tea.Cmd {
-	return tea.Batch(fetchCmd(m.adminClient), tickCmd(m.refresh), m.spin.Tick)
+	return tea.Batch(fetchCmd(m.adminClient), versionCmd(m.adminClient), tickCmd(m.refresh), m.spin.Tick)
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -196,10 +277,14 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case loadResultMsg:
 		if msg.err != nil {
 			m.status = "refresh failed: " + msg.err.Error()
+			m.version = nil
 			return m, nil
 		}
 		m.clients = msg.clients
-		m.browsers = msg.browser
+		if !msg.sameBrowsers {
+			m.browsers = m.keepStreamedTabs(msg.browser)
+		}
+		m.daemon = msg.status
 		sort.Slice(m.clients, func(i, j int) bool { return m.clients[i].ConnectedAt.Before(m.clients[j].ConnectedAt) })
 		sort.Slice(m.browsers, func(i, j int) bool { return m.browsers[i].ConnectedAt.Before(m.browsers[j].ConnectedAt) })
 		if m.clientCursor >= len(m.clients) {
@@ -208,6 +293,9 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.browserCursor >= len(m.browsers) {
 			m.browserCursor = max(0, len(m.browsers)-1)
 		}
+		if tabs := m.selectedTabs(); m.tabCursor >= len(tabs) {
+			m.tabCursor = max(0, len(tabs)-1)
+		}
 		m.lastUpdated = msg.at
 		m.chartClients.Push(float64(len(m.clients)))
 		m.chartBrowsers.Push(float64(len(m.browsers)))
@@ -215,8 +303,53 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.chartBrowsers.Draw()
 		m.syncViewportContent()
 		m.status = fmt.Sprintf("clients=%d browser_sessions=%d", len(m.clients), len(m.browsers))
+		if m.version == nil {
+			return m, tea.Batch(m.syncTabStream(), versionCmd(m.adminClient))
+		}
+		return m, m.syncTabStream()
+
+	case versionMsg:
+		// An older daemon without /admin/version just leaves the title bare.
+		if msg.err == nil {
+			m.version = &msg.info
+		}
 		return m, nil
 
+	case tabStreamMsg:
+		if msg.sessionID != m.tabStreamID {
+			if msg.cancel != nil {
+				msg.cancel()
+			}
+			return m, nil
+		}
+		if msg.err != nil {
+			m.tabStreamID = ""
+			m.tabStreamFailed = msg.sessionID
+			m.status = "live tab updates unavailable, polling: " + msg.err.Error()
+			return m, nil
+		}
+		m.tabStreamCancel = msg.cancel
+		return m, nextTabEventCmd(msg.sessionID, msg.events)
+
+	case tabEventMsg:
+		if msg.sessionID != m.tabStreamID {
+			return m, nil
+		}
+		if !msg.ok {
+			m.stopTabStream()
+			return m, fetchCmd(m.adminClient)
+		}
+		for i := range m.browsers {
+			if m.browsers[i].ID == msg.sessionID {
+				m.browsers[i].Tabs = applyTabEvent(m.browsers[i].Tabs, msg.event)
+			}
+		}
+		if tabs := m.selectedTabs(); m.tabCursor >= len(tabs) {
+			m.tabCursor = max(0, len(tabs)-1)
+		}
+		m.syncViewportContent()
+		return m, nextTabEventCmd(msg.sessionID, msg.events)
+
 	case disconnectResultMsg:
 		if msg.err != nil {
 			m.status = fmt.Sprintf("disconnect %s %s failed: %v", msg.target, shortID(msg.id), msg.err)
@@ -225,6 +358,22 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.status = fmt.Sprintf("disconnected %s %s", msg.target, shortID(msg.id))
 		return m, fetchCmd(m.adminClient)
 
+	case detailMsg:
+		if msg.err != nil {
+			m.status = "details failed: " + msg.err.Error()
+			return m, nil
+		}
+		m.detail = msg.text
+		return m, nil
+
+	case openURLMsg:
+		if msg.err != nil {
+			m.status = "open url failed: " + msg.err.Error()
+			return m, nil
+		}
+		m.status = "opened " + trimText(msg.url, 70)
+		return m, nil
+
 	case serviceActionMsg:
 		if msg.err != nil {
 			m.status = fmt.Sprintf("%s %s failed: %v", msg.action, msg.service, msg.err)
@@ -232,23 +381,37 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		switch msg.service {
 		case "mcpd":
-			if msg.action == "start" {
-				m.mcpdCmd = msg.cmd
+			if msg.action == "start" || msg.action == "restart" {
+				m.mcpdCmd, m.mcpdExit = msg.cmd, msg.exit
 			}
 			if msg.action == "stop" {
-				m.mcpdCmd = nil
+				m.mcpdCmd, m.mcpdExit = nil, nil
 			}
 		case "mcp":
-			if msg.action == "start" {
-				m.mcpCmd = msg.cmd
+			if msg.action == "start" || msg.action == "restart" {
+				m.mcpCmd, m.mcpExit = msg.cmd, msg.exit
 			}
 			if msg.action == "stop" {
-				m.mcpCmd = nil
+				m.mcpCmd, m.mcpExit = nil, nil
 			}
 		}
+		if msg.action == "start" {
+			delete(m.restarts, msg.service)
+		}
 		m.status = fmt.Sprintf("%s %s ok", msg.action, msg.service)
 		return m, fetchCmd(m.adminClient)
 
+	case restartMsg:
+		cmd, logPath := m.mcpdCmd, m.mcpdLog
+		if msg.service == "mcp" {
+			cmd, logPath = m.mcpCmd, m.mcpLog
+		}
+		if procAlive(cmd) {
+			// Started by hand while the backoff ran.
+			return m, nil
+		}
+		return m, runServiceCmd(m.repoRoot, msg.service, logPath, "restart")
+
 	case configReloadedMsg:
 		if msg.err != nil {
 			m.status = "config reload failed: " + msg.err.Error()
@@ -258,10 +421,32 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.form = formFromSettings(msg.settings)
 		m.refresh = msg.settings.TUIRefreshInterval
 		m.adminClient = adminclient.New(msg.settings.AdminBaseURL, msg.settings.AdminToken, &http.Client{Timeout: 4 * time.Second})
+		// The stream belongs to the old client; the next poll resubscribes.
+		m.stopTabStream()
+		m.tabStreamFailed = ""
 		m.status = "settings reloaded"
+		if m.showRemote {
+			return m, tea.Batch(fetchCmd(m.adminClient), remoteConfigCmd(m.adminClient))
+		}
 		return m, fetchCmd(m.adminClient)
 
+	case remoteConfigMsg:
+		if msg.err != nil {
+			m.showRemote = false
+			m.status = "daemon config fetch failed: " + msg.err.Error()
+			return m, nil
+		}
+		m.remote = &msg.config
+		m.status = fmt.Sprintf("daemon config: %d difference(s) from the local form", countDiffs(configDiff(m.form, msg.config)))
+		return m, nil
+
 	case configSavedMsg:
+		if errors.Is(msg.err, config.ErrConflict) {
+			// Another writer (usually mcpd via PUT /admin/config) got there
+			// first; the form keeps the user's edits until they reload.
+			m.status = "save refused: the config file changed since it was loaded; press r to reload it, then reapply your edits"
+			return m, nil
+		}
 		if msg.err != nil {
 			m.status = "save failed: " + msg.err.Error()
 			return m, nil
@@ -271,9 +456,21 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.refresh = msg.settings.TUIRefreshInterval
 		m.adminClient = adminclient.New(msg.settings.AdminBaseURL, msg.settings.AdminToken, &http.Client{Timeout: 4 * time.Second})
 		m.status = "settings saved"
+		if m.showRemote {
+			return m, tea.Batch(fetchCmd(m.adminClient), remoteConfigCmd(m.adminClient))
+		}
 		return m, fetchCmd(m.adminClient)
 
 	case tickMsg:
+		cmds := []tea.Cmd{m.pollCmd(), tickCmd(m.refresh)}
+		if err, ok := exited(m.mcpdExit); ok {
+			m.mcpdCmd, m.mcpdExit = nil, nil
+			cmds = append(cmds, m.serviceExited("mcpd", err))
+		}
+		if err, ok := exited(m.mcpExit); ok {
+			m.mcpCmd, m.mcpExit = nil, nil
+			cmds = append(cmds, m.serviceExited("mcp", err))
+		}
 		if !procAlive(m.mcpdCmd) {
 			m.mcpdCmd = nil
 		}
@@ -282,7 +479,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		m.animC, m.velC = m.spring.Update(m.animC, m.velC, float64(len(m.clients)))
 		m.animB, m.velB = m.spring.Update(m.animB, m.velB, float64(len(m.browsers)))
-		return m, tea.Batch(fetchCmd(m.adminClient), tickCmd(m.refresh))
+		return m, tea.Batch(cmds...)
 
 	case tea.MouseMsg:
 		if m.mode == dashboardMode && msg.Action == tea.MouseActionPress && msg.Button == tea.MouseButtonLeft {
@@ -297,9 +494,12 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			for i, b := range m.browsers {
 				if z := zone.Get("browser-" + b.ID); z != nil && z.InBounds(msg) {
 					m.focus = browsersPanel
+					if m.browserCursor != i {
+						m.tabCursor = 0
+					}
 					m.browserCursor = i
 					m.syncViewportContent()
-					return m, nil
+					return m, m.syncTabStream()
 				}
 			}
 		}
@@ -334,18 +534,20 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			if m.focus == browsersPanel && m.browserCursor > 0 {
 				m.browserCursor--
+				m.tabCursor = 0
 			}
 			m.syncViewportContent()
-			return m, nil
+			return m, m.syncTabStream()
 		case "down", "j":
 			if m.focus == clientsPanel && m.clientCursor < len(m.clients)-1 {
 				m.clientCursor++
 			}
 			if m.focus == browsersPanel && m.browserCursor < len(m.browsers)-1 {
 				m.browserCursor++
+				m.tabCursor = 0
 			}
 			m.syncViewportContent()
-			return m, nil
+			return m, m.syncTabStream()
 		case "pgup":
 			if m.focus == clientsPanel {
 				m.clientVP.HalfViewUp()
@@ -360,6 +562,30 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.browserVP.HalfViewDown()
 			}
 			return m, nil
+		case "t":
+			if tabs := m.selectedTabs(); m.focus == browsersPanel && len(tabs) > 0 {
+				m.tabCursor = (m.tabCursor + 1) % len(tabs)
+				m.syncViewportContent()
+			}
+			return m, nil
+		case "o":
+			tabs := m.selectedTabs()
+			if m.focus != browsersPanel || len(tabs) == 0 {
+				m.status = "select a browser session with tabs to open a URL"
+				return m, nil
+			}
+			return m, openURLCmd(tabs[m.tabCursor].URL)
+		case "i":
+			if m.focus == clientsPanel && len(m.clients) > 0 {
+				return m, clientDetailCmd(m.adminClient, m.clients[m.clientCursor].ID)
+			}
+			if m.focus == browsersPanel && len(m.browsers) > 0 {
+				return m, browserDetailCmd(m.adminClient, m.browsers[m.browserCursor].ID)
+			}
+			return m, nil
+		case "esc":
+			m.detail = ""
+			return m, nil
 		case "d":
 			if m.focus == clientsPanel && len(m.clients) > 0 {
 				id := m.clients[m.clientCursor].ID
@@ -377,6 +603,8 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, startServiceCmd(m.repoRoot, "mcpd", m.mcpdLog)
 		case "x":
+			// Forget the exit channel now, so the exit is not taken for a crash.
+			m.mcpdExit = nil
 			return m, stopServiceCmd("mcpd", m.mcpdCmd)
 		case "m":
 			if procAlive(m.mcpCmd) {
@@ -385,6 +613,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, startServiceCmd(m.repoRoot, "mcp", m.mcpLog)
 		case "n":
+			m.mcpExit = nil
 			return m, stopServiceCmd("mcp", m.mcpCmd)
 		}
 	}
@@ -433,6 +662,14 @@ func updateSettingsMode(m model, msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, reloadConfigCmd(m.settings.Path)
 	case "s":
 		return m, saveConfigCmd(m.settings, m.form)
+	case "l":
+		m.showRemote = !m.showRemote
+		if !m.showRemote {
+			m.status = "hiding daemon config file"
+			return m, nil
+		}
+		m.status = "fetching daemon config file..."
+		return m, remoteConfigCmd(m.adminClient)
 	case "e", "enter":
 		m.editingSetting = true
 		m.editor.SetValue(m.selectedSettingValue())
@@ -496,6 +733,9 @@ func (m model) renderClientsRows() string {
 		row = zone.Mark("client-"+c.ID, row)
 		lines = append(lines, row)
 		lines = append(lines, fmt.Sprintf("    %s  seen %s", c.RemoteAddr, timeAgo(c.LastSeen)))
+		if len(c.Labels) > 0 {
+			lines = append(lines, "    "+normalStyle.Render("labels: "+session.FormatLabels(c.Labels)))
+		}
 	}
 	return strings.Join(lines, "\n")
 }
@@ -529,12 +769,16 @@ func (m model) renderBrowserRows() string {
 			lines = append(lines, "    "+warnStyle.Render("tabs error: "+s.TabsError))
 			continue
 		}
-		for _, tab := range s.Tabs {
+		for j, tab := range s.Tabs {
 			title := strings.TrimSpace(tab.Title)
 			if title == "" {
 				title = tab.URL
 			}
-			lines = append(lines, fmt.Sprintf("    - [%d] %s", tab.ID, trimText(title, 70)))
+			line := fmt.Sprintf("    - [%d] %s", tab.ID, trimText(title, 70))
+			if i == m.browserCursor && j == m.tabCursor {
+				line = cursorStyle.Render(fmt.Sprintf("    * [%d] %s", tab.ID, trimText(title, 70)))
+			}
+			lines = append(lines, line)
 		}
 	}
 	return strings.Join(lines, "\n")
@@ -577,6 +821,7 @@ func (m model) View() string {
 		lipgloss.Top,
 		lipgloss.NewStyle().Padding(0, 1).Border(lipgloss.RoundedBorder()).Render(fmt.Sprintf("Clients\n%d", statC)),
 		lipgloss.NewStyle().Padding(0, 1).Border(lipgloss.RoundedBorder()).Render(fmt.Sprintf("Browsers\n%d", statB)),
+		lipgloss.NewStyle().Padding(0, 1).Border(lipgloss.RoundedBorder()).Render(activeCardText(m.daemon)),
 		lipgloss.NewStyle().Padding(0, 1).Border(lipgloss.RoundedBorder()).Render(fmt.Sprintf("Updated\n%s", lastUpdatedText(m.lastUpdated))),
 	)
 	chartPanel := lipgloss.JoinHorizontal(lipgloss.Top,
@@ -584,20 +829,25 @@ func (m model) View() string {
 		lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1).Render("Browsers Trend\n"+m.chartBrowsers.View()),
 	)
 
-	help := normalStyle.Render("mouse: click row | tab panel | j/k move | pgup/pgdown scroll | d disconnect | r refresh | s/x mcpd | m/n mcp | c settings | q quit")
+	connect := lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1).Render(connectPanelText(m.settings))
+
+	help := normalStyle.Render("mouse: click row | tab panel | j/k move | pgup/pgdown scroll | t next tab | o open tab url | i details | esc close details | d disconnect | r refresh | s/x mcpd | m/n mcp | c settings | q quit")
 	proc := normalStyle.Render(fmt.Sprintf("mcpd[%s] %s | mcp[%s] %s | %s refreshing", mcpdState, m.mcpdLog, mcpState, m.mcpLog, m.spin.View()))
 	status := titleStyle.Render("status: ") + m.status
 	row := lipgloss.JoinHorizontal(lipgloss.Top, leftPane, rightPane)
 
-	return zone.Scan(strings.Join([]string{
-		titleStyle.Render("SurfingBro mpcd control"),
+	sections := []string{
+		titleStyle.Render("SurfingBro mpcd control") + normalStyle.Render(versionLabel(m.version)),
 		cards,
 		chartPanel,
+		connect,
 		row,
-		proc,
-		status,
-		help,
-	}, "\n"))
+	}
+	if m.detail != "" {
+		sections = append(sections, lipgloss.NewStyle().Width(max(80, m.width-2)).Border(lipgloss.RoundedBorder()).Padding(0, 1).Render(m.detail))
+	}
+	sections = append(sections, proc, status, help)
+	return zone.Scan(strings.Join(sections, "\n"))
 }
 
 func (m model) settingsView(titleStyle, normalStyle lipgloss.Style) string {
@@ -605,12 +855,16 @@ func (m model) settingsView(titleStyle, normalStyle lipgloss.Style) string {
 	keyStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("10")).Bold(true)
 
 	lines := []string{titleStyle.Render("Settings")}
-	for i, name := range settingNames() {
-		prefix := "  "
-		if i == m.settingsCursor {
-			prefix = cursorStyle.Render("> ")
+	if m.showRemote && m.remote != nil {
+		lines = append(lines, renderConfigDiff(configDiff(m.form, *m.remote), m.settingsCursor)...)
+	} else {
+		for i, name := range settingNames() {
+			prefix := "  "
+			if i == m.settingsCursor {
+				prefix = cursorStyle.Render("> ")
+			}
+			lines = append(lines, fmt.Sprintf("%s%s = %s", prefix, name, m.settingValueByIndex(i)))
 		}
-		lines = append(lines, fmt.Sprintf("%s%s = %s", prefix, name, m.settingValueByIndex(i)))
 	}
 
 	editLine := normalStyle.Render("select a field, press e or enter to edit")
@@ -618,13 +872,133 @@ func (m model) settingsView(titleStyle, normalStyle lipgloss.Style) string {
 		editLine = keyStyle.Render("editing") + " " + settingNames()[m.settingsCursor] + "\n" + m.editor.View()
 	}
 
-	help := normalStyle.Render("j/k move | e/enter edit+apply | s save | r reload | c/esc back")
+	help := normalStyle.Render("j/k move | e/enter edit+apply | s save | r reload | l daemon config file | c/esc back")
 	status := titleStyle.Render("status: ") + m.status
 	box := lipgloss.NewStyle().Width(max(80, m.width-2)).Border(lipgloss.RoundedBorder()).Padding(0, 1).Render(strings.Join(lines, "\n"))
 	return strings.Join([]string{box, editLine, status, help}, "\n")
 }
 
+// configDiffRow is one setting as the local form and the daemon's config file have it.
+type configDiffRow struct {
+	Name    string
+	Local   string
+	Remote  string
+	Differs bool
+}
+
+// configDiff lines up the local form with the daemon's config file, in
+// settingNames order. Durations compare by value, so "30m" matches "30m0s";
+// redacted tokens are never reported as different.
+func configDiff(form settingsForm, remote admin.ConfigPayload) []configDiffRow {
+	local := []string{form.DaemonAddr, form.MCPToken, form.AdminToken, form.ClientMaxIdle, form.AdminBaseURL, form.RefreshInterval}
+	onDisk := []string{remote.DaemonAddr, remote.MCPToken, remote.AdminToken, remote.ClientMaxIdle, remote.AdminBaseURL, remote.TUIRefreshInterval}
+	rows := make([]configDiffRow, 0, len(local))
+	for i, name := range settingNames() {
+		rows = append(rows, configDiffRow{
+			Name:    name,
+			Local:   local[i],
+			Remote:  onDisk[i],
+			Differs: !sameSetting(local[i], onDisk[i]),
+		})
+	}
+	return rows
+}
+
+func sameSetting(local, remote string) bool {
+	local, remote = strings.TrimSpace(local), strings.TrimSpace(remote)
+	if local == remote || remote == "<redacted>" {
+		return true
+	}
+	a, errA := time.ParseDuration(local)
+	b, errB := time.ParseDuration(remote)
+	return errA == nil && errB == nil && a == b
+}
+
+func countDiffs(rows []configDiffRow) int {
+	n := 0
+	for _, r := range rows {
+		if r.Differs {
+			n++
+		}
+	}
+	return n
+}
+
+// renderConfigDiff shows each setting as "local | daemon", marking and
+// highlighting the ones that differ.
+func renderConfigDiff(rows []configDiffRow, cursor int) []string {
+	cursorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("11"))
+	diffStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Bold(true)
+	normalStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("245"))
+	lines := []string{normalStyle.Render("  setting = local (this form) | daemon config file")}
+	for i, r := range rows {
+		prefix := "  "
+		if i == cursor {
+			prefix = cursorStyle.Render("> ")
+		}
+		line := fmt.Sprintf("%s = %s | %s", r.Name, emptyDefault(r.Local, "-"), emptyDefault(r.Remote, "-"))
+		if r.Differs {
+			line = diffStyle.Render(line + "  (differs)")
+		}
+		lines = append(lines, prefix+line)
+	}
+	return lines
+}
+
+// activeCardText shows which browser session untargeted commands go to.
+func activeCardText(st admin.Status) string {
+	id := "none"
+	if st.ActiveSession != "" {
+		id = shortID(st.ActiveSession)
+	}
+	return fmt.Sprintf("Active (%s)\n%s", emptyDefault(st.ActiveStrategy, "-"), id)
+}
+
+// connectPanelText tells the user what to enter in the browser extension.
+func connectPanelText(s config.Settings) string {
+	return "Extension connect\n" + config.WebSocketURL(s) + " (no auth required)"
+}
+
+func versionCmd(client *adminclient.Client) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		info, err := client.Version(ctx)
+		return versionMsg{info: info, err: err}
+	}
+}
+
+// versionLabel formats the daemon build for the title bar, e.g.
+// "  mcpd v1.4.0 (3f2a9c1)"; it is empty until the version is known.
+func versionLabel(info *buildinfo.Info) string {
+	if info == nil {
+		return ""
+	}
+	label := "  mcpd " + info.Version
+	if commit := info.Commit; commit != buildinfo.Unset {
+		label += " (" + commit[:min(7, len(commit))] + ")"
+	}
+	return label
+}
+
 func fetchCmd(client *adminclient.Client) tea.Cmd {
+	return loadCmd(client, -1)
+}
+
+// pollCmd is the periodic refresh. While the selected session's tabs are
+// streamed it skips the browser list, which asks every extension for its
+// tabs, unless the daemon reports a different number of browser sessions.
+func (m *model) pollCmd() tea.Cmd {
+	if m.tabStreamCancel == nil {
+		return fetchCmd(m.adminClient)
+	}
+	return loadCmd(m.adminClient, len(m.browsers))
+}
+
+// loadCmd fetches clients, status and, unless the daemon has exactly
+// knownSessions browser sessions, the browser list. A negative knownSessions
+// always fetches it.
+func loadCmd(client *adminclient.Client, knownSessions int) tea.Cmd {
 	return func() tea.Msg {
 		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 		defer cancel()
@@ -632,11 +1006,166 @@ func fetchCmd(client *adminclient.Client) tea.Cmd {
 		if err != nil {
 			return loadResultMsg{err: err}
 		}
+		status, err := client.Status(ctx)
+		if err != nil {
+			return loadResultMsg{err: err}
+		}
+		if status.BrowserSessions == knownSessions {
+			return loadResultMsg{clients: clients, sameBrowsers: true, status: status, at: time.Now()}
+		}
 		browsers, err := client.ListBrowsers(ctx)
 		if err != nil {
 			return loadResultMsg{err: err}
 		}
-		return loadResultMsg{clients: clients, browser: browsers, at: time.Now()}
+		return loadResultMsg{clients: clients, browser: browsers, status: status, at: time.Now()}
+	}
+}
+
+// keepStreamedTabs carries the streamed session's tabs over into a freshly
+// fetched browser list, so a poll that raced an event does not undo it.
+func (m *model) keepStreamedTabs(browsers []admin.BrowserSession) []admin.BrowserSession {
+	if m.tabStreamCancel == nil {
+		return browsers
+	}
+	i := slices.IndexFunc(m.browsers, func(b admin.BrowserSession) bool { return b.ID == m.tabStreamID })
+	if i < 0 {
+		return browsers
+	}
+	for j := range browsers {
+		if browsers[j].ID == m.tabStreamID {
+			browsers[j].Tabs, browsers[j].TabsError = m.browsers[i].Tabs, m.browsers[i].TabsError
+		}
+	}
+	return browsers
+}
+
+// syncTabStream subscribes to the selected browser session's tab events,
+// dropping any stream for a session that is no longer selected.
+func (m *model) syncTabStream() tea.Cmd {
+	id := ""
+	if m.browserCursor >= 0 && m.browserCursor < len(m.browsers) {
+		id = m.browsers[m.browserCursor].ID
+	}
+	if id == m.tabStreamID {
+		return nil
+	}
+	m.stopTabStream()
+	if id == "" || id == m.tabStreamFailed {
+		return nil
+	}
+	m.tabStreamFailed = ""
+	m.tabStreamID = id
+	return subscribeTabsCmd(m.adminClient, id)
+}
+
+func (m *model) stopTabStream() {
+	if m.tabStreamCancel != nil {
+		m.tabStreamCancel()
+	}
+	m.tabStreamID = ""
+	m.tabStreamCancel = nil
+}
+
+func subscribeTabsCmd(client *adminclient.Client, id string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithCancel(context.Background())
+		dialCtx, dialCancel := context.WithTimeout(ctx, 3*time.Second)
+		defer dialCancel()
+		events, err := client.SubscribeTabEvents(dialCtx, id)
+		if err != nil {
+			cancel()
+			return tabStreamMsg{sessionID: id, err: err}
+		}
+		return tabStreamMsg{sessionID: id, events: events, cancel: cancel}
+	}
+}
+
+func nextTabEventCmd(id string, events <-chan admin.TabEvent) tea.Cmd {
+	return func() tea.Msg {
+		ev, ok := <-events
+		return tabEventMsg{sessionID: id, events: events, event: ev, ok: ok}
+	}
+}
+
+// applyTabEvent returns tabs updated by one streamed event.
+func applyTabEvent(tabs []browser.TabInfo, ev admin.TabEvent) []browser.TabInfo {
+	i := slices.IndexFunc(tabs, func(t browser.TabInfo) bool { return t.ID == ev.TabID })
+	switch ev.Kind {
+	case admin.TabEventOpen:
+		if i < 0 {
+			return append(tabs, browser.TabInfo{ID: ev.TabID, URL: ev.URL, Title: ev.Title})
+		}
+	case admin.TabEventClose:
+		if i >= 0 {
+			return slices.Delete(slices.Clone(tabs), i, i+1)
+		}
+	case admin.TabEventNavigate, admin.TabEventTitle:
+		if i < 0 {
+			return tabs
+		}
+		tabs = slices.Clone(tabs)
+		if ev.URL != "" {
+			tabs[i].URL = ev.URL
+		}
+		if ev.Title != "" || ev.Kind == admin.TabEventNavigate {
+			tabs[i].Title = ev.Title
+		}
+	}
+	return tabs
+}
+
+func remoteConfigCmd(client *adminclient.Client) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		cfg, err := client.GetConfig(ctx)
+		return remoteConfigMsg{config: cfg, err: err}
+	}
+}
+
+// clientDetailCmd fetches fresh data for one client for the detail pane.
+func clientDetailCmd(client *adminclient.Client, id string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		c, err := client.GetClient(ctx, id)
+		if err != nil {
+			return detailMsg{err: err}
+		}
+		lines := []string{
+			"Client " + c.ID,
+			fmt.Sprintf("name=%s transport=%s remote=%s", emptyDefault(c.Name, "unnamed"), c.Transport, c.RemoteAddr),
+			"user agent: " + emptyDefault(c.UserAgent, "-"),
+			fmt.Sprintf("connected %s, seen %s", timeAgo(c.ConnectedAt), timeAgo(c.LastSeen)),
+		}
+		if len(c.Labels) > 0 {
+			lines = append(lines, "labels: "+session.FormatLabels(c.Labels))
+		}
+		return detailMsg{text: strings.Join(lines, "\n")}
+	}
+}
+
+// browserDetailCmd fetches fresh data, including tabs, for one browser session.
+func browserDetailCmd(client *adminclient.Client, id string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		b, err := client.GetBrowser(ctx, id)
+		if err != nil {
+			return detailMsg{err: err}
+		}
+		lines := []string{
+			fmt.Sprintf("Browser session %s active=%v", b.ID, b.Active),
+			"remote: " + b.RemoteAddr + "  user agent: " + emptyDefault(b.UserAgent, "-"),
+			fmt.Sprintf("connected %s, seen %s", timeAgo(b.ConnectedAt), timeAgo(b.LastSeen)),
+		}
+		if b.TabsError != "" {
+			lines = append(lines, "tabs error: "+b.TabsError)
+		}
+		for _, tab := range b.Tabs {
+			lines = append(lines, fmt.Sprintf("- [%d] %s  %s", tab.ID, trimText(tab.Title, 50), tab.URL))
+		}
+		return detailMsg{text: strings.Join(lines, "\n")}
 	}
 }
 
@@ -658,6 +1187,30 @@ func disconnectBrowserCmd(client *adminclient.Client, id string) tea.Cmd {
 	}
 }
 
+// openURLCmd opens an http(s) URL with the platform's default browser.
+func openURLCmd(rawURL string) tea.Cmd {
+	return func() tea.Msg {
+		u, err := url.Parse(strings.TrimSpace(rawURL))
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return openURLMsg{url: rawURL, err: fmt.Errorf("not an http(s) url: %q", rawURL)}
+		}
+		var cmd *exec.Cmd
+		switch runtime.GOOS {
+		case "darwin":
+			cmd = exec.Command("open", u.String())
+		case "windows":
+			cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u.String())
+		default:
+			cmd = exec.Command("xdg-open", u.String())
+		}
+		if err := cmd.Start(); err != nil {
+			return openURLMsg{url: u.String(), err: err}
+		}
+		go func() { _ = cmd.Wait() }()
+		return openURLMsg{url: u.String()}
+	}
+}
+
 func saveConfigCmd(current config.Settings, form settingsForm) tea.Cmd {
 	return func() tea.Msg {
 		next, err := formToSettings(current, form)
@@ -683,39 +1236,120 @@ func reloadConfigCmd(path string) tea.Cmd {
 }
 
 func startServiceCmd(repoRoot, service, logPath string) tea.Cmd {
+	return runServiceCmd(repoRoot, service, logPath, "start")
+}
+
+// runServiceCmd starts service, reporting it as action: "start" when the
+// user asked, "restart" when restarting after a crash.
+func runServiceCmd(repoRoot, service, logPath, action string) tea.Cmd {
 	return func() tea.Msg {
 		logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
 		if err != nil {
-			return serviceActionMsg{service: service, action: "start", err: err}
+			return serviceActionMsg{service: service, action: action, err: err}
 		}
 		cmd := exec.Command("go", "run", "./cmd/"+service)
 		cmd.Dir = repoRoot
 		cmd.Stdout = logFile
 		cmd.Stderr = logFile
+		newProcessGroup(cmd)
 		if err := cmd.Start(); err != nil {
 			_ = logFile.Close()
-			return serviceActionMsg{service: service, action: "start", err: err}
+			return serviceActionMsg{service: service, action: action, err: err}
 		}
+		exit := make(chan error, 1)
 		go func() {
-			_ = cmd.Wait()
+			exit <- cmd.Wait()
 			_ = logFile.Close()
 		}()
-		return serviceActionMsg{service: service, action: "start", cmd: cmd}
+		return serviceActionMsg{service: service, action: action, cmd: cmd, exit: exit}
 	}
 }
 
+// exited reports a service's exit once it is available, without blocking.
+func exited(exit <-chan error) (error, bool) {
+	select {
+	case err := <-exit:
+		return err, true
+	default:
+		return nil, false
+	}
+}
+
+// serviceExited reports a service that exited without being stopped from
+// the TUI. While tui.auto_restart allows, it schedules a restart after a
+// backoff; otherwise it tells the user how to restart by hand.
+func (m *model) serviceExited(service string, err error) tea.Cmd {
+	how := "exit status 0"
+	if err != nil {
+		how = err.Error()
+	}
+	logPath, key := m.mcpdLog, "s"
+	if service == "mcp" {
+		logPath, key = m.mcpLog, "m"
+	}
+	if m.restarts == nil {
+		m.restarts = map[string]int{}
+	}
+	attempt := m.restarts[service]
+	if limit := m.settings.TUIAutoRestart; attempt < limit {
+		m.restarts[service] = attempt + 1
+		delay := restartBackoff(attempt)
+		m.status = fmt.Sprintf("%s exited unexpectedly (%s); restarting in %s (attempt %d/%d); log: %s", service, how, delay, attempt+1, limit, logPath)
+		return tea.Tick(delay, func(time.Time) tea.Msg { return restartMsg{service: service} })
+	}
+	m.status = fmt.Sprintf("%s exited unexpectedly (%s); press %s to restart; log: %s", service, how, key, logPath)
+	if attempt > 0 {
+		m.status = fmt.Sprintf("%s exited unexpectedly (%s) after %d automatic restarts; press %s to restart; log: %s", service, how, attempt, key, logPath)
+	}
+	return nil
+}
+
+// restartBackoff is the wait before automatic restart attempt n (from 0):
+// one second, doubling up to 30 seconds.
+func restartBackoff(n int) time.Duration {
+	return min(time.Second<<min(n, 5), 30*time.Second)
+}
+
 func stopServiceCmd(service string, cmd *exec.Cmd) tea.Cmd {
 	return func() tea.Msg {
 		if !procAlive(cmd) {
 			return serviceActionMsg{service: service, action: "stop", err: errors.New("not running")}
 		}
-		if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		if err := signalGroup(cmd, syscall.SIGTERM); err != nil {
 			return serviceActionMsg{service: service, action: "stop", err: err}
 		}
 		return serviceActionMsg{service: service, action: "stop"}
 	}
 }
 
+// stopChildren SIGTERMs the process group of every command the TUI started
+// that is still running, waits up to grace for them to exit and kills any
+// that remain. Signalling the group reaches the service binary behind
+// "go run", which does not pass signals on. Daemons started outside the TUI
+// are never tracked here and are left alone.
+func stopChildren(grace time.Duration, cmds ...*exec.Cmd) {
+	var running []*exec.Cmd
+	for _, cmd := range cmds {
+		if groupAlive(cmd) && signalGroup(cmd, syscall.SIGTERM) == nil {
+			running = append(running, cmd)
+		}
+	}
+	deadline := time.Now().Add(grace)
+	for len(running) > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		alive := running[:0]
+		for _, cmd := range running {
+			if groupAlive(cmd) {
+				alive = append(alive, cmd)
+			}
+		}
+		running = alive
+	}
+	for _, cmd := range running {
+		_ = signalGroup(cmd, syscall.SIGKILL)
+	}
+}
+
 func tickCmd(d time.Duration) tea.Cmd {
 	return tea.Tick(d, func(t time.Time) tea.Msg { return tickMsg(t) })
 }
@@ -767,6 +1401,13 @@ func formToSettings(base config.Settings, form settingsForm) (config.Settings, e
 	return next, nil
 }
 
+func (m model) selectedTabs() []browser.TabInfo {
+	if m.browserCursor < 0 || m.browserCursor >= len(m.browsers) {
+		return nil
+	}
+	return m.browsers[m.browserCursor].Tabs
+}
+
 func (m model) selectedSettingValue() string { return m.settingValueByIndex(m.settingsCursor) }
 
 func (m model) settingValueByIndex(i int) string {
@@ -885,7 +1526,25 @@ func main() {
 	m := newModel(client, settings.TUIRefreshInterval, repoRoot, settings)
 	m.syncLayout()
 	m.syncViewportContent()
-	if _, err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion()).Run(); err != nil {
+	p := tea.NewProgram(m, tea.WithAltScreen(), tea.WithMouseCellMotion())
+
+	// Bubble Tea turns SIGINT/SIGTERM into a quit; SIGHUP (terminal closed)
+	// needs the same treatment so child services are not orphaned.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		if _, ok := <-hup; ok {
+			p.Quit()
+		}
+	}()
+
+	final, err := p.Run()
+	signal.Stop(hup)
+	close(hup)
+	if err != nil {
 		fmt.Printf("tui error: %v\n", err)
 	}
+	if fm, ok := final.(model); ok {
+		stopChildren(3*time.Second, fm.mcpdCmd, fm.mcpCmd)
+	}
 }
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	zone "github.com/lrstanley/bubblezone"
+
+	"github.com/adityalohuni/mcp-server/internal/admin"
+	"github.com/adityalohuni/mcp-server/internal/browser"
+	"github.com/adityalohuni/mcp-server/internal/config"
+)
+
+func startChild(t *testing.T, name string, args ...string) *exec.Cmd {
+	t.Helper()
+	cmd := exec.Command(name, args...)
+	newProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot start %s: %v", name, err)
+	}
+	go func() { _ = cmd.Wait() }()
+	t.Cleanup(func() { _ = cmd.Process.Kill() })
+	return cmd
+}
+
+func TestStopChildren(t *testing.T) {
+	polite := startChild(t, "sleep", "30")
+	stubborn := startChild(t, "sh", "-c", `trap "" TERM; exec sleep 30`)
+
+	start := time.Now()
+	stopChildren(300*time.Millisecond, polite, stubborn, nil)
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("stopChildren took %s", time.Since(start))
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for procAlive(polite) || procAlive(stubborn) {
+		if time.Now().After(deadline) {
+			t.Fatalf("children still running: sleep=%v stubborn=%v", procAlive(polite), procAlive(stubborn))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUpdateReportsServiceCrash(t *testing.T) {
+	crash := func(m model, service string) model {
+		t.Helper()
+		exit := make(chan error, 1)
+		exit <- errors.New("exit status 2")
+		next, _ := m.Update(serviceActionMsg{service: service, action: "restart", cmd: &exec.Cmd{}, exit: exit})
+		next, _ = next.Update(tickMsg(time.Now()))
+		return next.(model)
+	}
+
+	m := newModel(nil, time.Second, t.TempDir(), config.Settings{})
+	m = crash(m, "mcpd")
+	if m.mcpdCmd != nil || m.mcpdExit != nil {
+		t.Fatalf("expected the crashed mcpd to be forgotten")
+	}
+	if !strings.Contains(m.status, "mcpd exited unexpectedly (exit status 2)") || !strings.Contains(m.status, "press s to restart") {
+		t.Fatalf("unexpected status %q", m.status)
+	}
+
+	m = newModel(nil, time.Second, t.TempDir(), config.Settings{TUIAutoRestart: 2})
+	for i, want := range []string{"restarting in 1s (attempt 1/2)", "restarting in 2s (attempt 2/2)", "after 2 automatic restarts; press m to restart"} {
+		m = crash(m, "mcp")
+		if !strings.Contains(m.status, want) {
+			t.Fatalf("crash %d: status %q, want it to mention %q", i+1, m.status, want)
+		}
+	}
+	next, _ := m.Update(serviceActionMsg{service: "mcp", action: "start", cmd: &exec.Cmd{}})
+	if m = next.(model); m.restarts["mcp"] != 0 {
+		t.Fatalf("expected a manual start to reset the restart count, got %d", m.restarts["mcp"])
+	}
+}
+
+func TestStoppedServiceIsNotACrash(t *testing.T) {
+	m := newModel(nil, time.Second, t.TempDir(), config.Settings{TUIAutoRestart: 3})
+	exit := make(chan error, 1)
+	next, _ := m.Update(serviceActionMsg{service: "mcpd", action: "start", cmd: &exec.Cmd{}, exit: exit})
+	next, _ = next.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("x")})
+	exit <- errors.New("signal: terminated")
+	next, _ = next.Update(tickMsg(time.Now()))
+	if m = next.(model); strings.Contains(m.status, "unexpectedly") || m.restarts["mcpd"] != 0 {
+		t.Fatalf("expected a stop from the TUI not to count as a crash, got %q", m.status)
+	}
+}
+
+func TestRestartBackoff(t *testing.T) {
+	for n, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 16 * time.Second, 30 * time.Second, 30 * time.Second} {
+		if got := restartBackoff(n); got != want {
+			t.Fatalf("restartBackoff(%d) = %s, want %s", n, got, want)
+		}
+	}
+}
+
+func TestConfigDiff(t *testing.T) {
+	form := settingsForm{
+		DaemonAddr:      ":9099",
+		MCPToken:        "local-mcp",
+		AdminToken:      "local-admin",
+		ClientMaxIdle:   "30m",
+		AdminBaseURL:    "http://127.0.0.1:9099",
+		RefreshInterval: "2s",
+	}
+	remote := admin.ConfigPayload{
+		DaemonAddr:         ":9100",
+		MCPToken:           "<redacted>",
+		AdminToken:         "remote-admin",
+		ClientMaxIdle:      "30m0s",
+		AdminBaseURL:       "http://127.0.0.1:9099",
+		TUIRefreshInterval: "2s",
+	}
+
+	rows := configDiff(form, remote)
+	if len(rows) != len(settingNames()) {
+		t.Fatalf("expected one row per setting, got %d", len(rows))
+	}
+	differs := map[string]bool{}
+	for _, r := range rows {
+		differs[r.Name] = r.Differs
+	}
+	want := map[string]bool{
+		"daemon.addr":            true,
+		"auth.mcp_token":         false, // redacted, so unknown
+		"auth.admin_token":       true,
+		"daemon.client_max_idle": false, // same duration, different spelling
+		"tui.admin_base_url":     false,
+		"tui.refresh_interval":   false,
+	}
+	for name, w := range want {
+		if differs[name] != w {
+			t.Fatalf("%s: differs=%v, want %v", name, differs[name], w)
+		}
+	}
+	if n := countDiffs(rows); n != 2 {
+		t.Fatalf("expected 2 differences, got %d", n)
+	}
+
+	lines := renderConfigDiff(rows, 0)
+	if len(lines) != len(rows)+1 {
+		t.Fatalf("expected a header plus one line per row, got %d lines", len(lines))
+	}
+	if !strings.Contains(lines[1], ":9099 | :9100") || !strings.Contains(lines[1], "(differs)") {
+		t.Fatalf("expected daemon.addr to be marked as differing, got %q", lines[1])
+	}
+	if strings.Contains(lines[4], "(differs)") {
+		t.Fatalf("expected client_max_idle to match, got %q", lines[4])
+	}
+}
+
+func TestApplyTabEvent(t *testing.T) {
+	tabs := []browser.TabInfo{{ID: 1, URL: "https://a.test/", Title: "A"}}
+
+	tabs = applyTabEvent(tabs, admin.TabEvent{Kind: admin.TabEventOpen, TabID: 2, URL: "https://b.test/"})
+	tabs = applyTabEvent(tabs, admin.TabEvent{Kind: admin.TabEventTitle, TabID: 2, Title: "B"})
+	tabs = applyTabEvent(tabs, admin.TabEvent{Kind: admin.TabEventNavigate, TabID: 1, URL: "https://c.test/"})
+	want := []browser.TabInfo{
+		{ID: 1, URL: "https://c.test/"},
+		{ID: 2, URL: "https://b.test/", Title: "B"},
+	}
+	if !slices.Equal(tabs, want) {
+		t.Fatalf("tabs = %+v, want %+v", tabs, want)
+	}
+
+	before := slices.Clone(tabs)
+	closed := applyTabEvent(tabs, admin.TabEvent{Kind: admin.TabEventClose, TabID: 1})
+	if len(closed) != 1 || closed[0].ID != 2 {
+		t.Fatalf("after close: %+v", closed)
+	}
+	if !slices.Equal(tabs, before) {
+		t.Fatal("close modified the input slice")
+	}
+	if got := applyTabEvent(closed, admin.TabEvent{Kind: admin.TabEventTitle, TabID: 9, Title: "x"}); !slices.Equal(got, closed) {
+		t.Fatalf("update for unknown tab changed tabs: %+v", got)
+	}
+}
+
+func TestPollKeepsStreamedTabs(t *testing.T) {
+	zone.NewGlobal()
+	m := newModel(nil, time.Second, t.TempDir(), config.Settings{})
+	streamed := []browser.TabInfo{{ID: 1, URL: "https://streamed.test/"}}
+	m.browsers = []admin.BrowserSession{{Tabs: streamed}}
+	m.browsers[0].ID = "s1"
+	m.tabStreamID, m.tabStreamCancel = "s1", func() {}
+
+	next, _ := m.Update(loadResultMsg{sameBrowsers: true, status: admin.Status{BrowserSessions: 1}, at: time.Now()})
+	m = next.(model)
+	if len(m.browsers) != 1 || !slices.Equal(m.browsers[0].Tabs, streamed) {
+		t.Fatalf("skipped browser fetch replaced the list: %+v", m.browsers)
+	}
+
+	polled := []admin.BrowserSession{{Tabs: []browser.TabInfo{{ID: 1, URL: "https://stale.test/"}}}, {}}
+	polled[0].ID, polled[1].ID = "s1", "s2"
+	next, _ = m.Update(loadResultMsg{browser: polled, status: admin.Status{BrowserSessions: 2}, at: time.Now()})
+	m = next.(model)
+	if len(m.browsers) != 2 || !slices.Equal(m.browsers[0].Tabs, streamed) {
+		t.Fatalf("polled tabs overwrote the streamed session: %+v", m.browsers)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// running reports whether pid is a live process. A zombie counts as gone:
+// it has exited and only waits for whoever adopted it to reap it.
+func running(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	_, rest, _ := strings.Cut(string(stat), ") ")
+	return !strings.HasPrefix(rest, "Z")
+}
+
+func TestStopChildrenReachesGrandchildren(t *testing.T) {
+	// Like "go run", the parent exits on SIGTERM without passing it on.
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	parent := startChild(t, "sh", "-c", `sleep 30 & echo $! > "$1"; wait`, "sh", pidFile)
+	var pid int
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, _ := os.ReadFile(pidFile)
+		if n, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			pid = n
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("grandchild never started")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Cleanup(func() { _ = syscall.Kill(pid, syscall.SIGKILL) })
+
+	stopChildren(300*time.Millisecond, parent)
+	deadline = time.Now().Add(time.Second)
+	for running(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("grandchild %d still running after stopChildren", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !unix
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Without process groups only the started command itself is signalled.
+
+func newProcessGroup(*exec.Cmd) {}
+
+func signalGroup(cmd *exec.Cmd, sig syscall.Signal) error {
+	if sig == syscall.SIGKILL {
+		return cmd.Process.Kill()
+	}
+	return cmd.Process.Signal(sig)
+}
+
+func groupAlive(cmd *exec.Cmd) bool {
+	return procAlive(cmd)
+}
@@ -0,0 +1,210 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/adityalohuni/mcp-server/internal/traceid"
+)
+
+const (
+	defaultAuditSize  = 1000
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// Audit actions recorded by the admin handlers.
+const (
+	AuditClientDisconnect  = "client.disconnect"
+	AuditBrowserDisconnect = "browser.disconnect"
+	AuditBrowserBroadcast  = "browser.broadcast"
+	AuditBrowserActivate   = "browser.activate"
+	AuditConfigSet         = "config.set"
+)
+
+// AuditEntry is one admin action. IDs start at 1 and increase by one per
+// entry, so they stay valid as cursors after older entries are dropped.
+type AuditEntry struct {
+	ID     uint64    `json:"id"`
+	At     time.Time `json:"at"`
+	Action string    `json:"action"`
+	Target string    `json:"target,omitempty"`
+	Remote string    `json:"remote,omitempty"`
+	// TraceID is the request's trace id (see httpx.Trace), which any
+	// browser commands the action sent also carry.
+	TraceID string `json:"trace_id,omitempty"`
+}
+
+// AuditLog keeps the most recent admin actions in a fixed-size ring.
+// A nil *AuditLog records nothing.
+type AuditLog struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+	last    uint64
+	// Now overrides the clock used to stamp entries; nil means time.Now.
+	Now func() time.Time
+}
+
+// NewAuditLog keeps up to size entries; size <= 0 means 1000.
+func NewAuditLog(size int) *AuditLog {
+	if size <= 0 {
+		size = defaultAuditSize
+	}
+	return &AuditLog{entries: make([]AuditEntry, size)}
+}
+
+// Record appends an entry, overwriting the oldest once the ring is full.
+func (l *AuditLog) Record(action, target, remote, traceID string) {
+	if l == nil {
+		return
+	}
+	now := time.Now
+	if l.Now != nil {
+		now = l.Now
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.last++
+	l.entries[(l.last-1)%uint64(len(l.entries))] = AuditEntry{ID: l.last, At: now().UTC(), Action: action, Target: target, Remote: remote, TraceID: traceID}
+}
+
+// AuditPage is the /admin/audit response. Entries are oldest first.
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	// NextAfter is the cursor for newer entries: pass it as after to tail
+	// the log. It is the newest returned ID, or when none was returned the
+	// request's after (or the newest ID for a before page).
+	NextAfter uint64 `json:"next_after"`
+	// NextBefore is the cursor for older entries, passed as before to
+	// backfill; it is left out once the oldest kept entry was returned.
+	NextBefore uint64 `json:"next_before,omitempty"`
+	// HasMore reports entries left in the paging direction beyond limit.
+	HasMore bool `json:"has_more"`
+	// Gap reports that entries after the after cursor were dropped from the
+	// ring before they could be read.
+	Gap bool `json:"gap,omitempty"`
+}
+
+// After returns up to limit entries with IDs above after, oldest first.
+// after = 0 starts at the oldest kept entry.
+func (l *AuditLog) After(after uint64, limit int) AuditPage {
+	page := AuditPage{Entries: []AuditEntry{}, NextAfter: after}
+	if l == nil {
+		return page
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	first := l.firstLocked()
+	if after >= l.last {
+		return page
+	}
+	page.Gap = after > 0 && after+1 < first
+	lo := max(after+1, first)
+	hi := min(l.last, lo+uint64(auditLimit(limit))-1)
+	page.HasMore = hi < l.last
+	l.fillLocked(&page, lo, hi, first)
+	return page
+}
+
+// Before returns the newest limit entries with IDs below before, oldest
+// first. before = 0 starts from the newest entry.
+func (l *AuditLog) Before(before uint64, limit int) AuditPage {
+	page := AuditPage{Entries: []AuditEntry{}}
+	if l == nil {
+		return page
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	page.NextAfter = l.last
+	first := l.firstLocked()
+	hi := l.last
+	if before > 0 {
+		hi = min(before-1, l.last)
+	}
+	if l.last == 0 || hi < first {
+		return page
+	}
+	lo := first
+	if n := uint64(auditLimit(limit)); hi-first+1 > n {
+		lo = hi - n + 1
+	}
+	page.HasMore = lo > first
+	l.fillLocked(&page, lo, hi, first)
+	return page
+}
+
+// firstLocked is the ID of the oldest kept entry.
+func (l *AuditLog) firstLocked() uint64 {
+	if size := uint64(len(l.entries)); l.last > size {
+		return l.last - size + 1
+	}
+	return 1
+}
+
+// fillLocked copies entries lo..hi into page and sets its cursors.
+func (l *AuditLog) fillLocked(page *AuditPage, lo, hi, first uint64) {
+	for id := lo; id <= hi; id++ {
+		page.Entries = append(page.Entries, l.entries[(id-1)%uint64(len(l.entries))])
+	}
+	if n := len(page.Entries); n > 0 {
+		page.NextAfter = page.Entries[n-1].ID
+		if page.Entries[0].ID > first {
+			page.NextBefore = page.Entries[0].ID
+		}
+	}
+}
+
+func auditLimit(limit int) int {
+	if limit <= 0 {
+		return defaultAuditLimit
+	}
+	return min(limit, maxAuditLimit)
+}
+
+// Audit pages through recorded admin actions. ?after=<id> returns newer
+// entries, oldest first (after=0 starts at the oldest kept one); otherwise
+// the newest entries, or with ?before=<id> the ones older than it, are
+// returned. ?limit= caps the page (default 100, max 1000).
+func (h *Handlers) Audit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	after, err := auditCursor(q.Get("after"))
+	if err != nil {
+		http.Error(w, "invalid after", http.StatusBadRequest)
+		return
+	}
+	before, err := auditCursor(q.Get("before"))
+	if err != nil {
+		http.Error(w, "invalid before", http.StatusBadRequest)
+		return
+	}
+	if q.Has("after") && q.Has("before") {
+		http.Error(w, "after and before cannot be combined", http.StatusBadRequest)
+		return
+	}
+	limit := 0
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if q.Has("after") {
+		writeJSON(w, h.AuditLog.After(after, limit))
+		return
+	}
+	writeJSON(w, h.AuditLog.Before(before, limit))
+}
+
+func auditCursor(v string) (uint64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(v, 10, 64)
+}
+
+func (h *Handlers) audit(r *http.Request, action, target string) {
+	traceID, _ := traceid.FromContext(r.Context())
+	h.AuditLog.Record(action, target, r.RemoteAddr, traceID)
+}
@@ -0,0 +1,110 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adityalohuni/mcp-server/internal/session"
+	"github.com/adityalohuni/mcp-server/internal/traceid"
+)
+
+func auditIDs(entries []AuditEntry) []uint64 {
+	ids := make([]uint64, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestAuditPagingForward(t *testing.T) {
+	log := NewAuditLog(10)
+	for i := range 7 {
+		log.Record(AuditClientDisconnect, fmt.Sprint("c", i), "", "")
+	}
+
+	var got []uint64
+	after := uint64(0)
+	for {
+		page := log.After(after, 3)
+		got = append(got, auditIDs(page.Entries)...)
+		after = page.NextAfter
+		if !page.HasMore {
+			break
+		}
+	}
+	if fmt.Sprint(got) != "[1 2 3 4 5 6 7]" {
+		t.Fatalf("forward paging returned %v", got)
+	}
+
+	page := log.After(7, 3)
+	if len(page.Entries) != 0 || page.NextAfter != 7 || page.HasMore {
+		t.Fatalf("expected an empty tail page that keeps the cursor, got %+v", page)
+	}
+	log.Record(AuditConfigSet, "config.toml", "", "")
+	page = log.After(7, 3)
+	if fmt.Sprint(auditIDs(page.Entries)) != "[8]" || page.NextAfter != 8 {
+		t.Fatalf("expected tailing to pick up the new entry, got %+v", page)
+	}
+}
+
+func TestAuditPagingBackward(t *testing.T) {
+	log := NewAuditLog(5)
+	for i := range 8 {
+		log.Record(AuditBrowserBroadcast, fmt.Sprint("b", i), "", "")
+	}
+	// The ring holds 4..8.
+	page := log.Before(0, 2)
+	if fmt.Sprint(auditIDs(page.Entries)) != "[7 8]" || page.NextBefore != 7 || !page.HasMore {
+		t.Fatalf("unexpected newest page %+v", page)
+	}
+	page = log.Before(page.NextBefore, 2)
+	if fmt.Sprint(auditIDs(page.Entries)) != "[5 6]" || page.NextBefore != 5 || !page.HasMore {
+		t.Fatalf("unexpected second page %+v", page)
+	}
+	page = log.Before(page.NextBefore, 2)
+	if fmt.Sprint(auditIDs(page.Entries)) != "[4]" || page.NextBefore != 0 || page.HasMore {
+		t.Fatalf("unexpected last page %+v", page)
+	}
+
+	page = log.After(1, 10)
+	if !page.Gap || fmt.Sprint(auditIDs(page.Entries)) != "[4 5 6 7 8]" {
+		t.Fatalf("expected a gap for a cursor older than the ring, got %+v", page)
+	}
+}
+
+func TestAuditHandler(t *testing.T) {
+	h := &Handlers{Clients: session.NewRegistry(), AuditLog: NewAuditLog(0)}
+	for _, id := range []string{"a", "b", "c"} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/clients/disconnect?id="+id, nil)
+		req = req.WithContext(traceid.With(req.Context(), "trace-"+id))
+		h.DisconnectClient(httptest.NewRecorder(), req)
+	}
+
+	get := func(query string) (int, AuditPage) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.Audit(rec, httptest.NewRequest(http.MethodGet, "/admin/audit?"+query, nil))
+		var page AuditPage
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+		}
+		return rec.Code, page
+	}
+	code, page := get("after=1&limit=1")
+	if code != http.StatusOK || len(page.Entries) != 1 || page.Entries[0].Target != "b" || page.Entries[0].Action != AuditClientDisconnect || page.NextAfter != 2 || !page.HasMore {
+		t.Fatalf("unexpected page %d %+v", code, page)
+	}
+	if page.Entries[0].Remote == "" || page.Entries[0].TraceID != "trace-b" {
+		t.Fatalf("expected the remote address and trace id to be recorded, got %+v", page.Entries[0])
+	}
+	for _, query := range []string{"after=1&before=3", "after=x", "limit=-1"} {
+		if code, _ := get(query); code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", query, code)
+		}
+	}
+}
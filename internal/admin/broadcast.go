@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/adityalohuni/mcp-server/internal/traceid"
+	"github.com/adityalohuni/mcp-server/internal/wsbridge"
+	"github.com/adityalohuni/mcp-server/protocol"
+)
+
+const (
+	defaultBroadcastTimeout = 5 * time.Second
+	maxBroadcastTimeout     = 30 * time.Second
+)
+
+// broadcastable lists the commands that may be sent to every browser at once.
+// Page actions are left out: a stray click on every open browser is never
+// what an operator wants.
+var broadcastable = map[protocol.CommandType]bool{
+	protocol.CommandStartRecording: true,
+	protocol.CommandStopRecording:  true,
+	protocol.CommandGetRecording:   true,
+	protocol.CommandListTabs:       true,
+}
+
+type BroadcastRequest struct {
+	Type      protocol.CommandType `json:"type"`
+	Payload   json.RawMessage      `json:"payload,omitempty"`
+	TimeoutMs int                  `json:"timeout_ms,omitempty"`
+}
+
+type BroadcastResponse struct {
+	ID      string                   `json:"id"`
+	Type    protocol.CommandType     `json:"type"`
+	Results []wsbridge.SessionResult `json:"results"`
+}
+
+// Broadcast sends one command to every browser session and reports each
+// session's response. Only commands in broadcastable are accepted, and the
+// timeout is shared by all sessions.
+func (h *Handlers) Broadcast(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req BroadcastRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !broadcastable[req.Type] {
+		http.Error(w, "command cannot be broadcast: "+string(req.Type), http.StatusBadRequest)
+		return
+	}
+	if len(req.Payload) == 0 {
+		req.Payload = json.RawMessage(`{}`)
+	}
+	timeout := defaultBroadcastTimeout
+	if req.TimeoutMs > 0 {
+		timeout = min(time.Duration(req.TimeoutMs)*time.Millisecond, maxBroadcastTimeout)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	id := uuid.New().String()
+	traceID, _ := traceid.FromContext(r.Context())
+	h.audit(r, AuditBrowserBroadcast, string(req.Type))
+	results := h.Bridge.Broadcast(ctx, protocol.Command{ID: id, TraceID: traceID, Type: req.Type, Payload: req.Payload})
+	writeJSON(w, BroadcastResponse{ID: id, Type: req.Type, Results: results})
+}
@@ -0,0 +1,136 @@
+package admin
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/adityalohuni/mcp-server/internal/wsbridge"
+	"github.com/adityalohuni/mcp-server/protocol"
+)
+
+// Tab event kinds streamed by BrowserEvents.
+const (
+	TabEventOpen     = "open"
+	TabEventClose    = "close"
+	TabEventNavigate = "navigate"
+	TabEventTitle    = "title"
+	// TabEventSessionClosed is the last message on a stream.
+	TabEventSessionClosed = "session_closed"
+)
+
+// TabEvent is one message on the /admin/browsers/events stream.
+type TabEvent struct {
+	SessionID string    `json:"session_id"`
+	Kind      string    `json:"kind"`
+	TabID     int       `json:"tab_id,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// tabEventFrom maps an extension event to a stream message. It reports false
+// for events that are not about tabs and for malformed tab events.
+func tabEventFrom(ev wsbridge.SessionEvent) (TabEvent, bool) {
+	out := TabEvent{SessionID: ev.SessionID, At: ev.At}
+	if ev.Event.Event == wsbridge.EventSessionClosed {
+		out.Kind = TabEventSessionClosed
+		return out, true
+	}
+	var data protocol.TabEventData
+	if len(ev.Data) == 0 || json.Unmarshal(ev.Data, &data) != nil || data.TabID == 0 {
+		return TabEvent{}, false
+	}
+	out.TabID, out.URL, out.Title = data.TabID, data.URL, data.Title
+	switch ev.Event.Event {
+	case protocol.EventTabOpened:
+		out.Kind = TabEventOpen
+	case protocol.EventTabClosed:
+		out.Kind = TabEventClose
+	case protocol.EventTabUpdated:
+		// A navigation usually brings a new title too; report it once.
+		switch {
+		case data.URL != "":
+			out.Kind = TabEventNavigate
+		case data.Title != "":
+			out.Kind = TabEventTitle
+		default:
+			return TabEvent{}, false
+		}
+	default:
+		return TabEvent{}, false
+	}
+	return out, true
+}
+
+// The stream is token-protected like every admin route, and browsers cannot
+// set the Authorization header on a websocket, so the origin is not checked.
+var eventsUpgrader = websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+
+// BrowserEvents streams tab changes for the browser session named by ?id=
+// (or "active") over a websocket until the session or the client goes away.
+func (h *Handlers) BrowserEvents(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(r.URL.Query().Get("id"))
+	if id == "active" {
+		active, ok := h.Bridge.ActiveSessionID()
+		if !ok {
+			http.Error(w, "no active session", http.StatusNotFound)
+			return
+		}
+		id = active
+	}
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	// Subscribe first so a disconnect right after the check still ends the
+	// stream with session_closed.
+	events, cancel := h.Bridge.Subscribe(id)
+	defer cancel()
+	if _, ok := h.Bridge.SessionInfo(id); !ok {
+		http.Error(w, "browser session not found", http.StatusNotFound)
+		return
+	}
+	conn, err := eventsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("admin events upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// The client sends nothing; reading only notices when it leaves.
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-gone:
+			return
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			out, ok := tabEventFrom(ev)
+			if !ok {
+				continue
+			}
+			if err := conn.WriteJSON(out); err != nil {
+				return
+			}
+			if out.Kind == TabEventSessionClosed {
+				_ = conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session closed"))
+				return
+			}
+		}
+	}
+}
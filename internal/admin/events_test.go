@@ -0,0 +1,105 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/adityalohuni/mcp-server/internal/session"
+	"github.com/adityalohuni/mcp-server/internal/wsbridge"
+	"github.com/adityalohuni/mcp-server/protocol"
+)
+
+func TestTabEventFrom(t *testing.T) {
+	at := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	ev := func(name, data string) wsbridge.SessionEvent {
+		return wsbridge.SessionEvent{SessionID: "s1", At: at, Event: protocol.Event{Event: name, Data: []byte(data)}}
+	}
+	cases := []struct {
+		name string
+		in   wsbridge.SessionEvent
+		want TabEvent
+		ok   bool
+	}{
+		{"opened", ev(protocol.EventTabOpened, `{"tabId":4,"url":"https://a.test"}`), TabEvent{Kind: TabEventOpen, TabID: 4, URL: "https://a.test"}, true},
+		{"closed", ev(protocol.EventTabClosed, `{"tabId":4}`), TabEvent{Kind: TabEventClose, TabID: 4}, true},
+		{"navigated", ev(protocol.EventTabUpdated, `{"tabId":4,"url":"https://b.test","title":"B"}`), TabEvent{Kind: TabEventNavigate, TabID: 4, URL: "https://b.test", Title: "B"}, true},
+		{"retitled", ev(protocol.EventTabUpdated, `{"tabId":4,"title":"(1) Inbox"}`), TabEvent{Kind: TabEventTitle, TabID: 4, Title: "(1) Inbox"}, true},
+		{"update without changes", ev(protocol.EventTabUpdated, `{"tabId":4}`), TabEvent{}, false},
+		{"missing tab id", ev(protocol.EventTabOpened, `{"url":"https://a.test"}`), TabEvent{}, false},
+		{"malformed", ev(protocol.EventTabOpened, `[1]`), TabEvent{}, false},
+		{"other event", ev("download_started", `{"tabId":4}`), TabEvent{}, false},
+		{"session closed", ev(wsbridge.EventSessionClosed, ``), TabEvent{Kind: TabEventSessionClosed}, true},
+	}
+	for _, tc := range cases {
+		got, ok := tabEventFrom(tc.in)
+		if ok != tc.ok {
+			t.Errorf("%s: ok = %v, want %v", tc.name, ok, tc.ok)
+			continue
+		}
+		if ok {
+			tc.want.SessionID, tc.want.At = "s1", at
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %#v, want %#v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestBrowserEventsStream(t *testing.T) {
+	bridge := wsbridge.NewBridge(wsbridge.Options{})
+	h := &Handlers{Clients: session.NewRegistry(), Bridge: bridge}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", bridge.HandleWS)
+	mux.HandleFunc("/admin/browsers/events", h.BrowserEvents)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	ext, _, err := websocket.DefaultDialer.Dial(wsURL+"/ws", nil)
+	if err != nil {
+		t.Fatalf("dial extension: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for bridge.Count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("session never registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	id := bridge.ListSessions()[0].ID
+
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL+"/admin/browsers/events?id=nope", nil); err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown session, got %v", err)
+	}
+	stream, _, err := websocket.DefaultDialer.Dial(wsURL+"/admin/browsers/events?id=active", nil)
+	if err != nil {
+		t.Fatalf("dial stream: %v", err)
+	}
+	defer stream.Close()
+	// The subscription is made before the upgrade completes, so events sent
+	// from here on are streamed.
+	_ = ext.WriteJSON(protocol.Event{Event: "download_started", Data: []byte(`{"tabId":1}`)})
+	_ = ext.WriteJSON(protocol.Event{Event: protocol.EventTabUpdated, Data: []byte(`{"tabId":1,"title":"Docs"}`)})
+
+	_ = stream.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var got TabEvent
+	if err := stream.ReadJSON(&got); err != nil {
+		t.Fatalf("read event: %v", err)
+	}
+	if got.SessionID != id || got.Kind != TabEventTitle || got.TabID != 1 || got.Title != "Docs" {
+		t.Fatalf("unexpected event %#v", got)
+	}
+
+	_ = ext.Close()
+	if err := stream.ReadJSON(&got); err != nil || got.Kind != TabEventSessionClosed {
+		t.Fatalf("expected session_closed, got %#v (%v)", got, err)
+	}
+	if err := stream.ReadJSON(&got); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("expected the stream to close, got %v", err)
+	}
+}
@@ -4,21 +4,39 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/adityalohuni/mcp-server/internal/browser"
+	"github.com/adityalohuni/mcp-server/internal/buildinfo"
 	"github.com/adityalohuni/mcp-server/internal/config"
+	"github.com/adityalohuni/mcp-server/internal/httpx"
+	"github.com/adityalohuni/mcp-server/internal/mcpserver"
+	"github.com/adityalohuni/mcp-server/internal/page"
 	"github.com/adityalohuni/mcp-server/internal/session"
 	"github.com/adityalohuni/mcp-server/internal/wsbridge"
 )
 
 type Status struct {
-	Uptime          string `json:"uptime"`
-	MCPClients      int    `json:"mcp_clients"`
-	BrowserSessions int    `json:"browser_sessions"`
+	Uptime           string `json:"uptime"`
+	MCPClients       int    `json:"mcp_clients"`
+	BrowserSessions  int    `json:"browser_sessions"`
+	OrphanResponses  uint64 `json:"orphan_responses"`
+	PendingCommands  int    `json:"pending_commands"`
+	OldestSessionAge string `json:"oldest_session_age,omitempty"`
+	NewestSessionAge string `json:"newest_session_age,omitempty"`
+	OldestClientAge  string `json:"oldest_client_age,omitempty"`
+	NewestClientAge  string `json:"newest_client_age,omitempty"`
+	// ActiveSession is the session the "active" alias and untargeted commands
+	// currently resolve to: the pinned one when ActivePinned, else the one
+	// ActiveStrategy picks.
+	ActiveSession  string `json:"active_session,omitempty"`
+	ActiveStrategy string `json:"active_strategy"`
+	ActivePinned   bool   `json:"active_pinned,omitempty"`
 }
 
 type Handlers struct {
@@ -29,46 +47,142 @@ type Handlers struct {
 	TabsTimeout time.Duration
 	MaxIdle     time.Duration
 	ConfigPath  string
+	// AuditLog records admin actions for /admin/audit; nil records nothing.
+	AuditLog *AuditLog
+	// Now overrides the clock used for uptime and connection ages; nil means time.Now.
+	Now func() time.Time
+}
+
+// Version reports the daemon build; see package buildinfo.
+func (h *Handlers) Version(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, buildinfo.Get())
 }
 
 func (h *Handlers) Status(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, h.status())
+}
+
+func (h *Handlers) status() Status {
 	h.prune()
+	now := h.now()
+	clients := h.Clients.List()
+	sessions := h.Bridge.ListSessions()
+
+	clientTimes := make([]time.Time, 0, len(clients))
+	for _, c := range clients {
+		clientTimes = append(clientTimes, c.ConnectedAt)
+	}
+	sessionTimes := make([]time.Time, 0, len(sessions))
+	for _, s := range sessions {
+		sessionTimes = append(sessionTimes, s.ConnectedAt)
+	}
+
 	resp := Status{
-		Uptime:          time.Since(h.StartedAt).String(),
-		MCPClients:      h.Clients.Count(),
-		BrowserSessions: h.Bridge.Count(),
+		Uptime:          now.Sub(h.StartedAt).String(),
+		MCPClients:      len(clients),
+		BrowserSessions: len(sessions),
+		OrphanResponses: h.Bridge.OrphanResponses(),
+		PendingCommands: h.Bridge.PendingCount(),
+		ActiveStrategy:  h.Bridge.ActiveStrategy(),
 	}
-	writeJSON(w, resp)
+	resp.ActiveSession, _ = h.Bridge.ActiveSessionID()
+	_, resp.ActivePinned = h.Bridge.PinnedSessionID()
+	resp.OldestClientAge, resp.NewestClientAge = connectionAges(clientTimes, now)
+	resp.OldestSessionAge, resp.NewestSessionAge = connectionAges(sessionTimes, now)
+	return resp
+}
+
+// connectionAges returns the age of the earliest and latest connection time,
+// rounded to the second, or empty strings when there are none.
+func connectionAges(connectedAt []time.Time, now time.Time) (oldest, newest string) {
+	if len(connectedAt) == 0 {
+		return "", ""
+	}
+	first, last := connectedAt[0], connectedAt[0]
+	for _, t := range connectedAt[1:] {
+		if t.Before(first) {
+			first = t
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+	return now.Sub(first).Round(time.Second).String(), now.Sub(last).Round(time.Second).String()
+}
+
+func (h *Handlers) now() time.Time {
+	if h.Now != nil {
+		return h.Now()
+	}
+	return time.Now()
 }
 
-func (h *Handlers) ClientsList(w http.ResponseWriter, _ *http.Request) {
+// ClientsList returns registered MCP clients. Repeated label query parameters
+// (label=env=ci&label=canary) narrow the list to clients carrying all of them.
+func (h *Handlers) ClientsList(w http.ResponseWriter, r *http.Request) {
 	h.prune()
-	writeJSON(w, h.Clients.List())
+	selector := session.ParseLabels(strings.Join(r.URL.Query()["label"], ","))
+	writeJSON(w, h.Clients.Filter(selector))
+}
+
+// ClientGet returns the client named by ?id=, or 404.
+func (h *Handlers) ClientGet(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(r.URL.Query().Get("id"))
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	h.prune()
+	info, ok := h.Clients.Get(id)
+	if !ok {
+		http.Error(w, "client not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, info)
 }
 
 func (h *Handlers) BrowsersList(w http.ResponseWriter, _ *http.Request) {
 	sessions := h.Bridge.ListSessions()
 	resp := make([]BrowserSession, 0, len(sessions))
 	for _, s := range sessions {
-		entry := BrowserSession{
-			SessionInfo: s,
-		}
-		if h.Browser != nil {
-			ctx, cancel := context.WithTimeout(context.Background(), h.tabsTimeout())
-			target := browser.Target{SessionID: s.ID}
-			tabs, err := h.Browser.ListTabs(browser.WithTarget(ctx, target))
-			cancel()
-			if err != nil {
-				entry.TabsError = err.Error()
-			} else {
-				entry.Tabs = tabs
-			}
-		}
-		resp = append(resp, entry)
+		resp = append(resp, h.browserSession(s))
 	}
 	writeJSON(w, resp)
 }
 
+// BrowserGet returns the browser session named by ?id=, with its tabs, or 404.
+func (h *Handlers) BrowserGet(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(r.URL.Query().Get("id"))
+	if id == "" {
+		http.Error(w, "missing id", http.StatusBadRequest)
+		return
+	}
+	info, ok := h.Bridge.SessionInfo(id)
+	if !ok {
+		http.Error(w, "browser session not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, h.browserSession(info))
+}
+
+func (h *Handlers) browserSession(s wsbridge.SessionInfo) BrowserSession {
+	entry := BrowserSession{
+		SessionInfo: s,
+	}
+	if h.Browser != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), h.tabsTimeout())
+		target := browser.Target{SessionID: s.ID}
+		tabs, err := h.Browser.ListTabs(browser.WithTarget(ctx, target))
+		cancel()
+		if err != nil {
+			entry.TabsError = err.Error()
+		} else {
+			entry.Tabs = tabs
+		}
+	}
+	return entry
+}
+
 func (h *Handlers) DisconnectClient(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -80,6 +194,7 @@ func (h *Handlers) DisconnectClient(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	h.Clients.Unregister(id)
+	h.audit(r, AuditClientDisconnect, id)
 	writeJSON(w, map[string]any{"ok": true, "id": id})
 }
 
@@ -89,34 +204,113 @@ func (h *Handlers) DisconnectBrowser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	id := strings.TrimSpace(r.URL.Query().Get("id"))
-	useActive := id == "active"
-	if id == "active" {
-		id = ""
-	}
-	if id == "" && !useActive {
+	if id == "" {
 		http.Error(w, "missing id", http.StatusBadRequest)
 		return
 	}
-	if err := h.Bridge.DisconnectSession(id); err != nil {
+	if id == "active" {
+		active, ok := h.Bridge.ActiveSessionID()
+		if !ok {
+			http.Error(w, "no active session", http.StatusNotFound)
+			return
+		}
+		id = active
+	}
+	released, err := h.Bridge.DisconnectSession(id)
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
-	if useActive {
-		id = "active"
+	h.audit(r, AuditBrowserDisconnect, id)
+	writeJSON(w, map[string]any{"ok": true, "id": id, "released_claims": released})
+}
+
+// SetActiveBrowser pins which browser session is active. POST ?id=<session-id>
+// pins it until it disconnects; DELETE unpins, handing the choice back to the
+// active session strategy.
+func (h *Handlers) SetActiveBrowser(w http.ResponseWriter, r *http.Request) {
+	id := ""
+	switch r.Method {
+	case http.MethodPost:
+		id = strings.TrimSpace(r.URL.Query().Get("id"))
+		if id == "" {
+			http.Error(w, "missing id", http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
-	writeJSON(w, map[string]any{"ok": true, "id": id})
+	if err := h.Bridge.SetActive(id); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	h.audit(r, AuditBrowserActivate, id)
+	active, _ := h.Bridge.ActiveSessionID()
+	writeJSON(w, map[string]any{"ok": true, "active_session": active, "pinned": id != ""})
 }
 
 type ConfigPayload struct {
-	Path               string `json:"path,omitempty"`
+	Path string `json:"path,omitempty"`
+	// Version identifies the config file contents. Send back the version a
+	// GET returned (or an If-Match header) and the PUT fails with 409
+	// Conflict if the file has changed since; omit it to overwrite.
+	Version            string `json:"version,omitempty"`
 	DaemonAddr         string `json:"daemon_addr"`
+	AdminAddr          string `json:"admin_addr,omitempty"`
 	MCPToken           string `json:"mcp_token"`
+	MCPTokenFile       string `json:"mcp_token_file,omitempty"`
 	AdminToken         string `json:"admin_token"`
-	ClientMaxIdle      string `json:"client_max_idle"`
-	AdminBaseURL       string `json:"admin_base_url"`
-	TUIRefreshInterval string `json:"tui_refresh_interval"`
+	AdminTokenFile     string `json:"admin_token_file,omitempty"`
+	AdminReadonlyToken string `json:"admin_readonly_token,omitempty"`
+	// ScopedTokens maps tokens to the scopes they grant.
+	ScopedTokens           map[string][]string `json:"scoped_tokens,omitempty"`
+	TokenBytes             int                 `json:"token_bytes,omitempty"`
+	RequireExplicitTokens  bool                `json:"require_explicit_tokens,omitempty"`
+	ClientMaxIdle          string              `json:"client_max_idle"`
+	CommandTTL             string              `json:"command_ttl,omitempty"`
+	IdleTimeout            string              `json:"idle_timeout,omitempty"`
+	PingInterval           string              `json:"ping_interval,omitempty"`
+	PongWait               string              `json:"pong_wait,omitempty"`
+	WriteWait              string              `json:"write_wait,omitempty"`
+	WriteWaitPerKB         string              `json:"write_wait_per_kb,omitempty"`
+	MaxWriteWait           string              `json:"max_write_wait,omitempty"`
+	ActiveSessionStrategy  string              `json:"active_session_strategy,omitempty"`
+	ClientIDHeaders        []string            `json:"client_id_headers,omitempty"`
+	AssignedClientIDHeader string              `json:"assigned_client_id_header,omitempty"`
+	AdminBaseURL           string              `json:"admin_base_url"`
+	TUIRefreshInterval     string              `json:"tui_refresh_interval"`
+	TUIAutoRestart         int                 `json:"tui_auto_restart,omitempty"`
+	AllowedHosts           []string            `json:"allowed_hosts,omitempty"`
+	AllowEvaluate          bool                `json:"allow_evaluate,omitempty"`
+	DefaultSnapshotFormat  string              `json:"default_snapshot_format,omitempty"`
+	DisableSnapshotStorage bool                `json:"disable_snapshot_storage,omitempty"`
+	MaxSnapshots           int                 `json:"max_snapshots,omitempty"`
+	MaxSnapshotMB          int                 `json:"max_snapshot_mb,omitempty"`
+	MaxScreenshotMB        int                 `json:"max_screenshot_mb,omitempty"`
+	MaxTabsPerSession      int                 `json:"max_tabs_per_session,omitempty"`
+	ReplayDir              string              `json:"replay_dir,omitempty"`
+	LogFile                string              `json:"log_file,omitempty"`
+	LogMaxSize             int                 `json:"log_max_size,omitempty"`
+	LogMaxBackups          int                 `json:"log_max_backups,omitempty"`
+	// ToolTimeouts maps tool names to durations such as "45s".
+	ToolTimeouts   map[string]string `json:"tool_timeouts,omitempty"`
+	ToolRateLimit  float64           `json:"tool_rate_limit,omitempty"`
+	ToolRateBurst  int               `json:"tool_rate_burst,omitempty"`
+	DisablePrompts bool              `json:"disable_prompts,omitempty"`
+	WorkflowDir    string            `json:"workflow_dir,omitempty"`
+	// The snapshot_* fields configure the page reducer.
+	SnapshotMainText            bool     `json:"snapshot_main_text,omitempty"`
+	SnapshotMaxHTMLInputMB      int      `json:"snapshot_max_html_input_mb,omitempty"`
+	SnapshotUniqueSelectors     bool     `json:"snapshot_unique_selectors,omitempty"`
+	SnapshotStripTrackingParams bool     `json:"snapshot_strip_tracking_params,omitempty"`
+	SnapshotTrackingParams      []string `json:"snapshot_tracking_params,omitempty"`
+	SnapshotPreserveWhitespace  bool     `json:"snapshot_preserve_whitespace,omitempty"`
 }
 
+// ConfigGet serves the config file as it is on disk. mcpd reads it only at
+// startup, so this is not necessarily the configuration it is running with.
 func (h *Handlers) ConfigGet(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -127,9 +321,20 @@ func (h *Handlers) ConfigGet(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	writeJSON(w, payloadFromSettings(settings))
+	payload := payloadFromSettings(settings)
+	w.Header().Set("ETag", `"`+settings.Version+`"`)
+	if httpx.IsReadOnly(r.Context()) {
+		// Handing out tokens would let a read-only caller escalate.
+		payload.MCPToken = redacted
+		payload.AdminToken = redacted
+		payload.AdminReadonlyToken = redacted
+		payload.ScopedTokens = nil
+	}
+	writeJSON(w, payload)
 }
 
+const redacted = "<redacted>"
+
 func (h *Handlers) ConfigSet(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -146,42 +351,258 @@ func (h *Handlers) ConfigSet(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid client_max_idle", http.StatusBadRequest)
 		return
 	}
+	commandTTL, ok := optionalDuration(payload.CommandTTL)
+	if !ok {
+		http.Error(w, "invalid command_ttl", http.StatusBadRequest)
+		return
+	}
+	idleTimeout, ok := optionalDuration(payload.IdleTimeout)
+	if !ok {
+		http.Error(w, "invalid idle_timeout", http.StatusBadRequest)
+		return
+	}
+	// A negative ping_interval disables pings.
+	var pingInterval time.Duration
+	if v := strings.TrimSpace(payload.PingInterval); v != "" {
+		if pingInterval, err = time.ParseDuration(v); err != nil {
+			http.Error(w, "invalid ping_interval", http.StatusBadRequest)
+			return
+		}
+	}
+	pongWait, ok := optionalDuration(payload.PongWait)
+	if !ok {
+		http.Error(w, "invalid pong_wait", http.StatusBadRequest)
+		return
+	}
+	writeWait, ok1 := optionalDuration(payload.WriteWait)
+	writeWaitPerKB, ok2 := optionalDuration(payload.WriteWaitPerKB)
+	maxWriteWait, ok3 := optionalDuration(payload.MaxWriteWait)
+	if !ok1 || !ok2 || !ok3 {
+		http.Error(w, "invalid write_wait, write_wait_per_kb or max_write_wait", http.StatusBadRequest)
+		return
+	}
 	refresh, err := time.ParseDuration(strings.TrimSpace(payload.TUIRefreshInterval))
 	if err != nil {
 		http.Error(w, "invalid tui_refresh_interval", http.StatusBadRequest)
 		return
 	}
+	// Normalized as the config loader does, so "Recent" is accepted here too.
+	payload.ActiveSessionStrategy = strings.ToLower(strings.TrimSpace(payload.ActiveSessionStrategy))
+	if err := wsbridge.ValidActiveStrategy(payload.ActiveSessionStrategy); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	timeouts, err := config.ParseTimeouts(payload.ToolTimeouts)
+	if err == nil {
+		err = mcpserver.ValidateToolTimeouts(timeouts)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, name := range append(slices.Clone(payload.ClientIDHeaders), payload.AssignedClientIDHeader) {
+		if name = strings.TrimSpace(name); name != "" && !config.ValidHeaderName(name) {
+			http.Error(w, fmt.Sprintf("invalid client id header %q", name), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := httpx.ValidateScopes(payload.ScopedTokens); err != nil {
+		http.Error(w, "invalid scoped_tokens: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	snapshotFormat, err := page.ParseFormat(payload.DefaultSnapshotFormat)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if payload.AllowEvaluate && len(payload.AllowedHosts) > 0 {
+		http.Error(w, "allow_evaluate cannot be combined with allowed_hosts", http.StatusBadRequest)
+		return
+	}
+	if payload.TUIAutoRestart < 0 {
+		http.Error(w, "invalid tui_auto_restart", http.StatusBadRequest)
+		return
+	}
+	if payload.MaxSnapshots < 0 || payload.MaxSnapshotMB < 0 || payload.MaxScreenshotMB < 0 {
+		http.Error(w, "invalid max_snapshots, max_snapshot_mb or max_screenshot_mb", http.StatusBadRequest)
+		return
+	}
+	if payload.SnapshotMaxHTMLInputMB < 0 {
+		http.Error(w, "invalid snapshot_max_html_input_mb", http.StatusBadRequest)
+		return
+	}
+	if payload.MaxTabsPerSession < 0 {
+		http.Error(w, "invalid max_tabs_per_session", http.StatusBadRequest)
+		return
+	}
+	if payload.ToolRateLimit < 0 || payload.ToolRateBurst < 0 {
+		http.Error(w, "invalid tool_rate_limit or tool_rate_burst", http.StatusBadRequest)
+		return
+	}
 
 	next := config.Settings{
-		Path:               strings.TrimSpace(payload.Path),
-		DaemonAddr:         strings.TrimSpace(payload.DaemonAddr),
-		MCPToken:           strings.TrimSpace(payload.MCPToken),
-		AdminToken:         strings.TrimSpace(payload.AdminToken),
-		ClientMaxIdle:      maxIdle,
-		AdminBaseURL:       strings.TrimSpace(payload.AdminBaseURL),
-		TUIRefreshInterval: refresh,
+		Path:                   strings.TrimSpace(payload.Path),
+		Version:                configVersion(r, payload),
+		DaemonAddr:             strings.TrimSpace(payload.DaemonAddr),
+		AdminAddr:              strings.TrimSpace(payload.AdminAddr),
+		MCPToken:               strings.TrimSpace(payload.MCPToken),
+		MCPTokenFile:           strings.TrimSpace(payload.MCPTokenFile),
+		AdminToken:             strings.TrimSpace(payload.AdminToken),
+		AdminTokenFile:         strings.TrimSpace(payload.AdminTokenFile),
+		AdminReadonlyToken:     strings.TrimSpace(payload.AdminReadonlyToken),
+		ScopedTokens:           payload.ScopedTokens,
+		TokenBytes:             payload.TokenBytes,
+		RequireExplicitTokens:  payload.RequireExplicitTokens,
+		ClientMaxIdle:          maxIdle,
+		CommandTTL:             commandTTL,
+		IdleTimeout:            idleTimeout,
+		PingInterval:           pingInterval,
+		PongWait:               pongWait,
+		WriteWait:              writeWait,
+		WriteWaitPerKB:         writeWaitPerKB,
+		MaxWriteWait:           maxWriteWait,
+		ActiveSessionStrategy:  payload.ActiveSessionStrategy,
+		ClientIDHeaders:        payload.ClientIDHeaders,
+		AssignedClientIDHeader: strings.TrimSpace(payload.AssignedClientIDHeader),
+		AdminBaseURL:           strings.TrimSpace(payload.AdminBaseURL),
+		TUIRefreshInterval:     refresh,
+		TUIAutoRestart:         payload.TUIAutoRestart,
+		AllowedHosts:           payload.AllowedHosts,
+		AllowEvaluate:          payload.AllowEvaluate,
+		DefaultSnapshotFormat:  snapshotFormat,
+		DisableSnapshotStorage: payload.DisableSnapshotStorage,
+		MaxSnapshots:           payload.MaxSnapshots,
+		MaxSnapshotMB:          payload.MaxSnapshotMB,
+		MaxScreenshotMB:        payload.MaxScreenshotMB,
+		MaxTabsPerSession:      payload.MaxTabsPerSession,
+		ReplayDir:              strings.TrimSpace(payload.ReplayDir),
+		LogFile:                strings.TrimSpace(payload.LogFile),
+		LogMaxSize:             payload.LogMaxSize,
+		LogMaxBackups:          payload.LogMaxBackups,
+		ToolTimeouts:           timeouts,
+		ToolRateLimit:          payload.ToolRateLimit,
+		ToolRateBurst:          payload.ToolRateBurst,
+		DisablePrompts:         payload.DisablePrompts,
+		WorkflowDir:            strings.TrimSpace(payload.WorkflowDir),
+		// Page reducer options.
+		SnapshotMainText:            payload.SnapshotMainText,
+		SnapshotMaxHTMLInputMB:      payload.SnapshotMaxHTMLInputMB,
+		SnapshotUniqueSelectors:     payload.SnapshotUniqueSelectors,
+		SnapshotStripTrackingParams: payload.SnapshotStripTrackingParams,
+		SnapshotTrackingParams:      payload.SnapshotTrackingParams,
+		SnapshotPreserveWhitespace:  payload.SnapshotPreserveWhitespace,
 	}
 	if next.Path == "" {
 		next.Path = h.ConfigPath
 	}
 
 	saved, err := config.Save(next)
+	if errors.Is(err, config.ErrConflict) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	h.audit(r, AuditConfigSet, saved.Path)
+	w.Header().Set("ETag", `"`+saved.Version+`"`)
 	writeJSON(w, payloadFromSettings(saved))
 }
 
+// configVersion is the version a PUT was based on: the payload's, or else
+// the If-Match header's.
+func configVersion(r *http.Request, payload ConfigPayload) string {
+	if v := strings.TrimSpace(payload.Version); v != "" {
+		return v
+	}
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "*" {
+		return ""
+	}
+	return strings.Trim(strings.TrimPrefix(v, "W/"), `"`)
+}
+
+// optionalDuration parses a duration field that may be left empty (zero)
+// but not negative.
+func optionalDuration(v string) (time.Duration, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, true
+	}
+	d, err := time.ParseDuration(v)
+	return d, err == nil && d >= 0
+}
+
+// durationString formats an optional duration, leaving zero empty.
+func durationString(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// pingString formats a ping interval, leaving zero empty; a negative one,
+// which disables pings, is kept.
+func pingString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
 func payloadFromSettings(settings config.Settings) ConfigPayload {
 	return ConfigPayload{
-		Path:               settings.Path,
-		DaemonAddr:         settings.DaemonAddr,
-		MCPToken:           settings.MCPToken,
-		AdminToken:         settings.AdminToken,
-		ClientMaxIdle:      settings.ClientMaxIdle.String(),
-		AdminBaseURL:       settings.AdminBaseURL,
-		TUIRefreshInterval: settings.TUIRefreshInterval.String(),
+		Path:                   settings.Path,
+		Version:                settings.Version,
+		DaemonAddr:             settings.DaemonAddr,
+		AdminAddr:              settings.AdminAddr,
+		MCPToken:               settings.MCPToken,
+		MCPTokenFile:           settings.MCPTokenFile,
+		AdminToken:             settings.AdminToken,
+		AdminTokenFile:         settings.AdminTokenFile,
+		AdminReadonlyToken:     settings.AdminReadonlyToken,
+		ScopedTokens:           settings.ScopedTokens,
+		TokenBytes:             settings.TokenBytes,
+		RequireExplicitTokens:  settings.RequireExplicitTokens,
+		ClientMaxIdle:          settings.ClientMaxIdle.String(),
+		CommandTTL:             durationString(settings.CommandTTL),
+		IdleTimeout:            durationString(settings.IdleTimeout),
+		PingInterval:           pingString(settings.PingInterval),
+		PongWait:               durationString(settings.PongWait),
+		WriteWait:              durationString(settings.WriteWait),
+		WriteWaitPerKB:         durationString(settings.WriteWaitPerKB),
+		MaxWriteWait:           durationString(settings.MaxWriteWait),
+		ActiveSessionStrategy:  settings.ActiveSessionStrategy,
+		ClientIDHeaders:        settings.ClientIDHeaders,
+		AssignedClientIDHeader: settings.AssignedClientIDHeader,
+		AdminBaseURL:           settings.AdminBaseURL,
+		TUIRefreshInterval:     settings.TUIRefreshInterval.String(),
+		TUIAutoRestart:         settings.TUIAutoRestart,
+		AllowedHosts:           settings.AllowedHosts,
+		AllowEvaluate:          settings.AllowEvaluate,
+		DefaultSnapshotFormat:  settings.DefaultSnapshotFormat,
+		DisableSnapshotStorage: settings.DisableSnapshotStorage,
+		MaxSnapshots:           settings.MaxSnapshots,
+		MaxSnapshotMB:          settings.MaxSnapshotMB,
+		MaxScreenshotMB:        settings.MaxScreenshotMB,
+		MaxTabsPerSession:      settings.MaxTabsPerSession,
+		ReplayDir:              settings.ReplayDir,
+		LogFile:                settings.LogFile,
+		LogMaxSize:             settings.LogMaxSize,
+		LogMaxBackups:          settings.LogMaxBackups,
+		ToolTimeouts:           config.FormatTimeouts(settings.ToolTimeouts),
+		ToolRateLimit:          settings.ToolRateLimit,
+		ToolRateBurst:          settings.ToolRateBurst,
+		DisablePrompts:         settings.DisablePrompts,
+		WorkflowDir:            settings.WorkflowDir,
+		// Page reducer options.
+		SnapshotMainText:            settings.SnapshotMainText,
+		SnapshotMaxHTMLInputMB:      settings.SnapshotMaxHTMLInputMB,
+		SnapshotUniqueSelectors:     settings.SnapshotUniqueSelectors,
+		SnapshotStripTrackingParams: settings.SnapshotStripTrackingParams,
+		SnapshotTrackingParams:      settings.SnapshotTrackingParams,
+		SnapshotPreserveWhitespace:  settings.SnapshotPreserveWhitespace,
 	}
 }
 
@@ -0,0 +1,277 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/adityalohuni/mcp-server/internal/buildinfo"
+	"github.com/adityalohuni/mcp-server/internal/session"
+	"github.com/adityalohuni/mcp-server/internal/wsbridge"
+)
+
+func TestStatusConnectionAges(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	reg := session.NewRegistry()
+	reg.Register("old", session.ClientInfo{ConnectedAt: now.Add(-90 * time.Minute)})
+	reg.Register("new", session.ClientInfo{ConnectedAt: now.Add(-30 * time.Second)})
+	h := &Handlers{
+		StartedAt: now.Add(-2 * time.Hour),
+		Clients:   reg,
+		Bridge:    wsbridge.NewBridge(wsbridge.Options{}),
+		Now:       func() time.Time { return now },
+	}
+
+	st := h.status()
+	if st.Uptime != "2h0m0s" {
+		t.Fatalf("unexpected uptime %q", st.Uptime)
+	}
+	if st.OldestClientAge != "1h30m0s" || st.NewestClientAge != "30s" {
+		t.Fatalf("unexpected client ages %q / %q", st.OldestClientAge, st.NewestClientAge)
+	}
+	if st.OldestSessionAge != "" || st.NewestSessionAge != "" {
+		t.Fatalf("expected empty session ages without sessions, got %q / %q", st.OldestSessionAge, st.NewestSessionAge)
+	}
+	if st.ActiveSession != "" || st.ActiveStrategy != wsbridge.ActiveLatest {
+		t.Fatalf("unexpected active session %q / strategy %q", st.ActiveSession, st.ActiveStrategy)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	defer func(v, c, b string) { buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = v, c, b }(buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime)
+	buildinfo.Version, buildinfo.Commit, buildinfo.BuildTime = "v1.4.0", "3f2a9c1d", "2025-06-01T12:00:00Z"
+
+	rec := httptest.NewRecorder()
+	(&Handlers{}).Version(rec, httptest.NewRequest(http.MethodGet, "/admin/version", nil))
+	var body map[string]string
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &body) != nil {
+		t.Fatalf("version: %d %s", rec.Code, rec.Body)
+	}
+	if body["version"] != "v1.4.0" || body["commit"] != "3f2a9c1d" || body["build_time"] != "2025-06-01T12:00:00Z" || !strings.HasPrefix(body["go_version"], "go") || len(body) != 4 {
+		t.Fatalf("unexpected version body %v", body)
+	}
+
+	buildinfo.Version = ""
+	if got := buildinfo.Get().Version; got != "dev" {
+		t.Fatalf("expected an unset version to read dev, got %q", got)
+	}
+}
+
+func TestClientAndBrowserGet(t *testing.T) {
+	reg := session.NewRegistry()
+	reg.Register("c1", session.ClientInfo{Name: "agent"})
+	bridge := wsbridge.NewBridge(wsbridge.Options{})
+	srv := httptest.NewServer(http.HandlerFunc(bridge.HandleWS))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for bridge.Count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("session never registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	sessionID := bridge.ListSessions()[0].ID
+	h := &Handlers{Clients: reg, Bridge: bridge}
+	if st := h.status(); st.ActiveSession != sessionID {
+		t.Fatalf("expected status to report active session %q, got %q", sessionID, st.ActiveSession)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ClientGet(rec, httptest.NewRequest(http.MethodGet, "/admin/clients/get?id=c1", nil))
+	var client session.ClientInfo
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &client) != nil || client.Name != "agent" {
+		t.Fatalf("client get: %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	h.ClientGet(rec, httptest.NewRequest(http.MethodGet, "/admin/clients/get?id=nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown client, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.BrowserGet(rec, httptest.NewRequest(http.MethodGet, "/admin/browsers/get?id="+sessionID, nil))
+	var browser BrowserSession
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &browser) != nil || browser.ID != sessionID || !browser.Active {
+		t.Fatalf("browser get: %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	h.BrowserGet(rec, httptest.NewRequest(http.MethodGet, "/admin/browsers/get?id=nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown session, got %d", rec.Code)
+	}
+}
+
+func TestSetActiveBrowser(t *testing.T) {
+	bridge := wsbridge.NewBridge(wsbridge.Options{})
+	srv := httptest.NewServer(http.HandlerFunc(bridge.HandleWS))
+	defer srv.Close()
+	for i := range 2 {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+		deadline := time.Now().Add(2 * time.Second)
+		for bridge.Count() <= i {
+			if time.Now().After(deadline) {
+				t.Fatalf("session never registered")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	h := &Handlers{Clients: session.NewRegistry(), Bridge: bridge, AuditLog: NewAuditLog(0)}
+	latest, _ := bridge.ActiveSessionID()
+	other := ""
+	for _, info := range bridge.ListSessions() {
+		if info.ID != latest {
+			other = info.ID
+		}
+	}
+
+	call := func(method, query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.SetActiveBrowser(rec, httptest.NewRequest(method, "/admin/browsers/active"+query, nil))
+		return rec
+	}
+	if rec := call(http.MethodPost, "?id="+other); rec.Code != http.StatusOK {
+		t.Fatalf("pin: %d %s", rec.Code, rec.Body)
+	}
+	if st := h.status(); st.ActiveSession != other || !st.ActivePinned {
+		t.Fatalf("expected status to report the pinned session, got %+v", st)
+	}
+	if page := h.AuditLog.Before(0, 10); len(page.Entries) != 1 || page.Entries[0].Action != AuditBrowserActivate || page.Entries[0].Target != other {
+		t.Fatalf("expected the pin to be audited, got %+v", page.Entries)
+	}
+	if rec := call(http.MethodPost, "?id=nope"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown session, got %d", rec.Code)
+	}
+	if rec := call(http.MethodPost, ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 without an id, got %d", rec.Code)
+	}
+	if rec := call(http.MethodDelete, ""); rec.Code != http.StatusOK {
+		t.Fatalf("unpin: %d %s", rec.Code, rec.Body)
+	}
+	if st := h.status(); st.ActiveSession != latest || st.ActivePinned {
+		t.Fatalf("expected unpinning to restore the latest session, got %+v", st)
+	}
+}
+
+func TestBroadcastRejectsPageActions(t *testing.T) {
+	h := &Handlers{Clients: session.NewRegistry(), Bridge: wsbridge.NewBridge(wsbridge.Options{})}
+
+	rec := httptest.NewRecorder()
+	h.Broadcast(rec, httptest.NewRequest(http.MethodPost, "/admin/browsers/broadcast", strings.NewReader(`{"type":"click","payload":{"selector":"a"}}`)))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected click broadcast to be rejected, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	h.Broadcast(rec, httptest.NewRequest(http.MethodPost, "/admin/browsers/broadcast", strings.NewReader(`{"type":"start_recording"}`)))
+	var out BroadcastResponse
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &out) != nil || len(out.Results) != 0 {
+		t.Fatalf("expected empty broadcast without sessions: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestConfigSetKeepsNewSettings(t *testing.T) {
+	h := &Handlers{ConfigPath: filepath.Join(t.TempDir(), "config.toml")}
+	put := func(p ConfigPayload) *httptest.ResponseRecorder {
+		t.Helper()
+		body, _ := json.Marshal(p)
+		rec := httptest.NewRecorder()
+		h.ConfigSet(rec, httptest.NewRequest(http.MethodPut, "/admin/config", strings.NewReader(string(body))))
+		return rec
+	}
+	rec := httptest.NewRecorder()
+	h.ConfigGet(rec, httptest.NewRequest(http.MethodGet, "/admin/config", nil))
+	var p ConfigPayload
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decode config: %v", err)
+	}
+	p.Version = ""
+	p.AllowEvaluate = true
+	p.CommandTTL = "10m"
+	p.IdleTimeout = "2h"
+	p.RequireExplicitTokens = true
+	p.MaxScreenshotMB = 16
+	p.DisablePrompts = true
+	p.ActiveSessionStrategy = " Recent "
+	p.WorkflowDir = "/var/lib/surfingbros"
+	p.SnapshotMainText = true
+	rec = put(p)
+	var saved ConfigPayload
+	if err := json.Unmarshal(rec.Body.Bytes(), &saved); rec.Code != http.StatusOK || err != nil || !saved.AllowEvaluate || saved.CommandTTL != "10m0s" || saved.IdleTimeout != "2h0m0s" || !saved.RequireExplicitTokens || saved.MaxScreenshotMB != 16 || !saved.DisablePrompts || saved.ActiveSessionStrategy != "recent" || saved.WorkflowDir != "/var/lib/surfingbros" || !saved.SnapshotMainText {
+		t.Fatalf("expected allow_evaluate, command_ttl, idle_timeout, require_explicit_tokens, max_screenshot_mb, disable_prompts, workflow_dir, snapshot_main_text and a normalized active_session_strategy to be saved, got %d: %s", rec.Code, rec.Body)
+	}
+	p.AllowedHosts = []string{"example.com"}
+	if rec := put(p); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected allow_evaluate with allowed_hosts to be refused, got %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestConfigSetConflict(t *testing.T) {
+	h := &Handlers{ConfigPath: filepath.Join(t.TempDir(), "config.toml")}
+	get := func() (ConfigPayload, string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ConfigGet(rec, httptest.NewRequest(http.MethodGet, "/admin/config", nil))
+		var p ConfigPayload
+		if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+			t.Fatalf("decode config: %v", err)
+		}
+		return p, rec.Header().Get("ETag")
+	}
+	put := func(p ConfigPayload, ifMatch string) *httptest.ResponseRecorder {
+		t.Helper()
+		body, _ := json.Marshal(p)
+		req := httptest.NewRequest(http.MethodPut, "/admin/config", strings.NewReader(string(body)))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		h.ConfigSet(rec, req)
+		return rec
+	}
+
+	first, etag := get()
+	if first.Version == "" || etag != `"`+first.Version+`"` {
+		t.Fatalf("expected the version in the payload and ETag, got %q and %q", first.Version, etag)
+	}
+	edit := first
+	edit.MaxTabsPerSession = 3
+	rec := put(edit, "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected the first PUT to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+
+	stale := first
+	stale.MaxSnapshots = 7
+	if rec := put(stale, ""); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a stale version, got %d: %s", rec.Code, rec.Body)
+	}
+	stale.Version = ""
+	if rec := put(stale, etag); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a stale If-Match, got %d: %s", rec.Code, rec.Body)
+	}
+
+	current, etag := get()
+	if current.MaxTabsPerSession != 3 || current.MaxSnapshots != 0 {
+		t.Fatalf("a refused PUT changed the config: %+v", current)
+	}
+	current.Version = ""
+	current.MaxSnapshots = 7
+	if rec := put(current, etag); rec.Code != http.StatusOK {
+		t.Fatalf("expected a PUT with the fresh ETag to succeed, got %d: %s", rec.Code, rec.Body)
+	}
+}
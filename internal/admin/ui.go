@@ -1,41 +1,143 @@
 package admin
 
 import (
+	"fmt"
+	"mime"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
 )
 
+// hashedAsset matches bundler output names such as index-5d41402a.js or
+// app.3f9c1e2d.css whose content never changes under the same name. The
+// hash must be lower-case hex, so hyphenated plain names such as
+// main-controller.js are not cached forever.
+var hashedAsset = regexp.MustCompile(`[.-][0-9a-f]{8,}\.[A-Za-z0-9]+$`)
+
 // UIHandler serves a static admin web UI directory and falls back to index.html for SPA routes.
+// Root may be swapped at runtime with SetRoot, so share the handler by pointer.
 type UIHandler struct {
 	Root string
+	mu   sync.RWMutex
+}
+
+// SetRoot points the handler at another build directory. The directory must
+// contain index.html; on error the current root is kept.
+func (h *UIHandler) SetRoot(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(filepath.Join(abs, "index.html"))
+	if err != nil {
+		return fmt.Errorf("no index.html in %s", abs)
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", filepath.Join(abs, "index.html"))
+	}
+	h.mu.Lock()
+	h.Root = abs
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *UIHandler) root() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.Root
+}
+
+// Reload handles POST /admin/ui/reload?root=<dir>, switching the directory
+// the UI is served from without a restart.
+func (h *UIHandler) Reload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dir := strings.TrimSpace(r.URL.Query().Get("root"))
+	if dir == "" {
+		http.Error(w, "missing root", http.StatusBadRequest)
+		return
+	}
+	if err := h.SetRoot(dir); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, map[string]any{"ok": true, "root": h.root()})
 }
 
-func (h UIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func (h *UIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	clean := path.Clean("/" + r.URL.Path)
 	rel := strings.TrimPrefix(clean, "/")
 	if rel == "." || rel == "" {
 		h.serveIndex(w, r)
 		return
 	}
-	full := filepath.Join(h.Root, filepath.FromSlash(rel))
+	full, ok := h.resolve(rel)
+	if !ok {
+		http.Error(w, "invalid path", http.StatusBadRequest)
+		return
+	}
 	if fi, err := os.Stat(full); err == nil && !fi.IsDir() {
-		http.ServeFile(w, r, full)
+		h.serveFile(w, r, full)
 		return
 	}
 	// SPA fallback.
 	h.serveIndex(w, r)
 }
 
-func (h UIHandler) serveIndex(w http.ResponseWriter, r *http.Request) {
-	index := filepath.Join(h.Root, "index.html")
+func (h *UIHandler) serveIndex(w http.ResponseWriter, r *http.Request) {
+	index := filepath.Join(h.root(), "index.html")
 	if fi, err := os.Stat(index); err == nil && !fi.IsDir() {
-		http.ServeFile(w, r, index)
+		h.serveFile(w, r, index)
 		return
 	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusNotFound)
 	_, _ = w.Write([]byte("admin UI build not found. expected web/admin-ui/dist/index.html"))
 }
+
+func (h *UIHandler) serveFile(w http.ResponseWriter, r *http.Request, full string) {
+	name := filepath.Base(full)
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	if name != "index.html" && hashedAsset.MatchString(name) {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	http.ServeFile(w, r, full)
+}
+
+// resolve maps a slash separated path relative to Root onto the filesystem and
+// reports false when the result, after following symlinks, lies outside Root.
+func (h *UIHandler) resolve(rel string) (string, bool) {
+	root, err := filepath.Abs(h.root())
+	if err != nil {
+		return "", false
+	}
+	full := filepath.Join(root, filepath.FromSlash(rel))
+	if !within(root, full) {
+		return "", false
+	}
+	if real, err := filepath.EvalSymlinks(full); err == nil {
+		realRoot, err := filepath.EvalSymlinks(root)
+		if err != nil || !within(realRoot, real) {
+			return "", false
+		}
+	}
+	return full, true
+}
+
+func within(root, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUIHandlerCacheHeaders(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "index.html"), "<!doctype html>")
+	writeFile(t, filepath.Join(root, "assets", "index-5d41402a.js"), "console.log(1)")
+	writeFile(t, filepath.Join(root, "assets", "main-controller.js"), "console.log(2)")
+	h := UIHandler{Root: root}
+
+	cases := []struct {
+		path, contentType, cache string
+	}{
+		{"/", "text/html; charset=utf-8", "no-cache"},
+		{"/assets/index-5d41402a.js", mime.TypeByExtension(".js"), "public, max-age=31536000, immutable"},
+		{"/assets/main-controller.js", mime.TypeByExtension(".js"), "no-cache"},
+		{"/sessions/123", "text/html; charset=utf-8", "no-cache"},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status %d", tc.path, rec.Code)
+		}
+		if got := rec.Header().Get("Content-Type"); got != tc.contentType {
+			t.Fatalf("%s: content type %q, want %q", tc.path, got, tc.contentType)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != tc.cache {
+			t.Fatalf("%s: cache control %q, want %q", tc.path, got, tc.cache)
+		}
+	}
+}
+
+func TestUIHandlerRejectsEscapes(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "dist")
+	writeFile(t, filepath.Join(root, "index.html"), "<!doctype html>")
+	writeFile(t, filepath.Join(base, "secret.txt"), "token")
+	if err := os.Symlink(filepath.Join(base, "secret.txt"), filepath.Join(root, "leak.txt")); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+	h := UIHandler{Root: root}
+
+	if _, ok := h.resolve("../secret.txt"); ok {
+		t.Fatalf("expected parent traversal to be rejected")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/leak.txt", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected symlink escape to be rejected, got %d", rec.Code)
+	}
+}
+
+func writeFile(t *testing.T, name, body string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUIHandlerReload(t *testing.T) {
+	first, second, empty := t.TempDir(), t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(first, "index.html"), "first")
+	writeFile(t, filepath.Join(second, "index.html"), "second")
+	if err := os.Mkdir(filepath.Join(empty, "index.html"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	h := &UIHandler{Root: first}
+	body := func() string {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Body.String()
+	}
+	reload := func(method, root string) int {
+		rec := httptest.NewRecorder()
+		h.Reload(rec, httptest.NewRequest(method, "/admin/ui/reload?root="+url.QueryEscape(root), nil))
+		return rec.Code
+	}
+
+	if code := reload(http.MethodPost, second); code != http.StatusOK || body() != "second" {
+		t.Fatalf("expected switch to second root, got %d %q", code, body())
+	}
+	for _, root := range []string{"", filepath.Join(second, "missing"), empty} {
+		if code := reload(http.MethodPost, root); code != http.StatusBadRequest {
+			t.Fatalf("root %q: expected 400, got %d", root, code)
+		}
+	}
+	if body() != "second" {
+		t.Fatalf("expected a rejected reload to keep the current root, got %q", body())
+	}
+	if code := reload(http.MethodGet, first); code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected GET to be rejected, got %d", code)
+	}
+}
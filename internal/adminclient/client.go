@@ -1,17 +1,25 @@
 package adminclient
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
 
 	"github.com/adityalohuni/mcp-server/internal/admin"
+	"github.com/adityalohuni/mcp-server/internal/buildinfo"
+	"github.com/adityalohuni/mcp-server/internal/cbor"
 	"github.com/adityalohuni/mcp-server/internal/session"
 )
 
+// ErrNotFound is wrapped by errors for lookups of unknown ids.
+var ErrNotFound = errors.New("not found")
+
 type Client struct {
 	baseURL string
 	token   string
@@ -29,6 +37,45 @@ func New(baseURL, token string, httpClient *http.Client) *Client {
 	}
 }
 
+func (c *Client) Status(ctx context.Context) (admin.Status, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/admin/status")
+	if err != nil {
+		return admin.Status{}, err
+	}
+	var out admin.Status
+	if err := c.doJSON(req, &out); err != nil {
+		return admin.Status{}, err
+	}
+	return out, nil
+}
+
+// Version fetches the daemon's build info.
+func (c *Client) Version(ctx context.Context) (buildinfo.Info, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/admin/version")
+	if err != nil {
+		return buildinfo.Info{}, err
+	}
+	var out buildinfo.Info
+	if err := c.doJSON(req, &out); err != nil {
+		return buildinfo.Info{}, err
+	}
+	return out, nil
+}
+
+// GetConfig fetches the config the daemon is running with. Tokens come back
+// as "<redacted>" when the client uses the read-only admin token.
+func (c *Client) GetConfig(ctx context.Context) (admin.ConfigPayload, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/admin/config")
+	if err != nil {
+		return admin.ConfigPayload{}, err
+	}
+	var out admin.ConfigPayload
+	if err := c.doJSON(req, &out); err != nil {
+		return admin.ConfigPayload{}, err
+	}
+	return out, nil
+}
+
 func (c *Client) ListClients(ctx context.Context) ([]session.ClientInfo, error) {
 	req, err := c.newRequest(ctx, http.MethodGet, "/admin/clients")
 	if err != nil {
@@ -53,6 +100,33 @@ func (c *Client) ListBrowsers(ctx context.Context) ([]admin.BrowserSession, erro
 	return out, nil
 }
 
+// GetClient fetches one client; a missing client yields an error wrapping ErrNotFound.
+func (c *Client) GetClient(ctx context.Context, id string) (session.ClientInfo, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/admin/clients/get?id="+url.QueryEscape(id))
+	if err != nil {
+		return session.ClientInfo{}, err
+	}
+	var out session.ClientInfo
+	if err := c.doJSON(req, &out); err != nil {
+		return session.ClientInfo{}, err
+	}
+	return out, nil
+}
+
+// GetBrowser fetches one browser session with its tabs; a missing session
+// yields an error wrapping ErrNotFound.
+func (c *Client) GetBrowser(ctx context.Context, id string) (admin.BrowserSession, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/admin/browsers/get?id="+url.QueryEscape(id))
+	if err != nil {
+		return admin.BrowserSession{}, err
+	}
+	var out admin.BrowserSession
+	if err := c.doJSON(req, &out); err != nil {
+		return admin.BrowserSession{}, err
+	}
+	return out, nil
+}
+
 func (c *Client) DisconnectClient(ctx context.Context, id string) error {
 	req, err := c.newRequest(ctx, http.MethodPost, "/admin/clients/disconnect?id="+url.QueryEscape(id))
 	if err != nil {
@@ -69,12 +143,29 @@ func (c *Client) DisconnectBrowser(ctx context.Context, id string) error {
 	return c.doNoBody(req)
 }
 
+// SetActiveBrowser pins the active browser session; an empty id unpins it.
+func (c *Client) SetActiveBrowser(ctx context.Context, id string) error {
+	method, path := http.MethodPost, "/admin/browsers/active?id="+url.QueryEscape(id)
+	if id == "" {
+		method, path = http.MethodDelete, "/admin/browsers/active"
+	}
+	req, err := c.newRequest(ctx, method, path)
+	if err != nil {
+		return err
+	}
+	return c.doNoBody(req)
+}
+
 func (c *Client) newRequest(ctx context.Context, method, path string) (*http.Request, error) {
 	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("Authorization", "Bearer "+c.token)
+	// Set explicitly, so the transport leaves decompression to doJSON.
+	req.Header.Set("Accept-Encoding", "gzip")
+	// Daemons without CBOR support answer in JSON, which doJSON also reads.
+	req.Header.Set("Accept", cbor.ContentType+", application/json;q=0.9")
 	return req, nil
 }
 
@@ -84,10 +175,29 @@ func (c *Client) doJSON(req *http.Request, out any) error {
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("admin request failed: %s: %w", resp.Status, ErrNotFound)
+	}
 	if resp.StatusCode >= 400 {
 		return fmt.Errorf("admin request failed: %s", resp.Status)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+	body := io.Reader(resp.Body)
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return fmt.Errorf("admin response: %w", err)
+		}
+		defer gz.Close()
+		body = gz
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), cbor.ContentType) {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		return cbor.Unmarshal(data, out)
+	}
+	if err := json.NewDecoder(body).Decode(out); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,117 @@
+package adminclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adityalohuni/mcp-server/internal/admin"
+	"github.com/adityalohuni/mcp-server/internal/browser"
+	"github.com/adityalohuni/mcp-server/internal/cbor"
+	"github.com/adityalohuni/mcp-server/internal/httpx"
+	"github.com/adityalohuni/mcp-server/internal/wsbridge"
+)
+
+// recordingTransport keeps the headers of the last raw response and counts
+// the bytes read from its body before any decoding.
+type recordingTransport struct {
+	header http.Header
+	read   int
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err == nil {
+		t.header = resp.Header.Clone()
+		resp.Body = &countingBody{ReadCloser: resp.Body, n: &t.read}
+	}
+	return resp, err
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n *int
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	*b.n += n
+	return n, err
+}
+
+func TestListBrowsersDecodesGzip(t *testing.T) {
+	var sessions []admin.BrowserSession
+	for i := 0; i < 50; i++ {
+		s := admin.BrowserSession{SessionInfo: wsbridge.SessionInfo{ID: fmt.Sprintf("session-%d", i)}}
+		for j := 0; j < 20; j++ {
+			s.Tabs = append(s.Tabs, browser.TabInfo{ID: j, Title: "Example tab", URL: fmt.Sprintf("https://example.com/page/%d", j)})
+		}
+		sessions = append(sessions, s)
+	}
+	raw, _ := json.Marshal(sessions)
+
+	srv := httptest.NewServer(httpx.Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(raw)
+	})))
+	defer srv.Close()
+
+	rt := &recordingTransport{}
+	client := New(srv.URL, "token", &http.Client{Transport: rt})
+	got, err := client.ListBrowsers(context.Background())
+	if err != nil {
+		t.Fatalf("list browsers: %v", err)
+	}
+	if rt.header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected a gzip response, got headers %v", rt.header)
+	}
+	if len(got) != len(sessions) || len(got[49].Tabs) != 20 || got[49].ID != "session-49" {
+		t.Fatalf("decoded %d sessions, want %d", len(got), len(sessions))
+	}
+	if rt.read == 0 || rt.read >= len(raw)/4 {
+		t.Fatalf("expected well under %d bytes on the wire, read %d", len(raw), rt.read)
+	}
+}
+
+func TestListBrowsersDecodesCBOR(t *testing.T) {
+	var sessions []admin.BrowserSession
+	for i := 0; i < 50; i++ {
+		s := admin.BrowserSession{SessionInfo: wsbridge.SessionInfo{ID: fmt.Sprintf("session-%d", i), ConnectedAt: time.Date(2025, 6, 1, 12, i, 0, 0, time.UTC)}}
+		for j := 0; j < 20; j++ {
+			s.Tabs = append(s.Tabs, browser.TabInfo{ID: j, Title: "Example tab", URL: fmt.Sprintf("https://example.com/page/%d", j)})
+		}
+		sessions = append(sessions, s)
+	}
+	// The admin handlers write indented JSON.
+	raw, _ := json.MarshalIndent(sessions, "", "  ")
+
+	srv := httptest.NewServer(httpx.CBOR(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(raw)
+	})))
+	defer srv.Close()
+
+	rt := &recordingTransport{}
+	client := New(srv.URL, "token", &http.Client{Transport: rt})
+	got, err := client.ListBrowsers(context.Background())
+	if err != nil {
+		t.Fatalf("list browsers: %v", err)
+	}
+	if rt.header.Get("Content-Type") != cbor.ContentType {
+		t.Fatalf("expected a CBOR response, got headers %v", rt.header)
+	}
+	if !reflect.DeepEqual(got, sessions) {
+		t.Fatalf("CBOR round trip changed the sessions")
+	}
+	compact, _ := json.Marshal(sessions)
+	t.Logf("browsers list: %d bytes indented JSON, %d compact JSON, %d CBOR", len(raw), len(compact), rt.read)
+	if rt.read >= len(compact) {
+		t.Fatalf("expected CBOR (%d bytes) to be smaller than compact JSON (%d bytes)", rt.read, len(compact))
+	}
+}
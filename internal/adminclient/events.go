@@ -0,0 +1,58 @@
+package adminclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/adityalohuni/mcp-server/internal/admin"
+)
+
+// SubscribeTabEvents streams tab changes for one browser session. The
+// channel closes when ctx is done, the session disconnects (after an
+// admin.TabEventSessionClosed event) or the connection fails. A daemon
+// without the endpoint, or an unknown session, yields an error wrapping
+// ErrNotFound; callers should fall back to polling.
+func (c *Client) SubscribeTabEvents(ctx context.Context, sessionID string) (<-chan admin.TabEvent, error) {
+	wsURL := c.baseURL + "/admin/browsers/events?id=" + url.QueryEscape(sessionID)
+	switch {
+	case strings.HasPrefix(wsURL, "https://"):
+		wsURL = "wss://" + strings.TrimPrefix(wsURL, "https://")
+	case strings.HasPrefix(wsURL, "http://"):
+		wsURL = "ws://" + strings.TrimPrefix(wsURL, "http://")
+	}
+	header := http.Header{"Authorization": []string{"Bearer " + c.token}}
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, wsURL, header)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("admin events: %s: %w", resp.Status, ErrNotFound)
+		}
+		if resp != nil {
+			return nil, fmt.Errorf("admin events: %s", resp.Status)
+		}
+		return nil, fmt.Errorf("admin events: %w", err)
+	}
+	out := make(chan admin.TabEvent)
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	go func() {
+		defer close(out)
+		defer stop()
+		defer conn.Close()
+		for {
+			var ev admin.TabEvent
+			if err := conn.ReadJSON(&ev); err != nil {
+				return
+			}
+			select {
+			case out <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -2,6 +2,7 @@ package browser
 
 import (
 	"context"
+	"encoding/json"
 
 	"github.com/adityalohuni/mcp-server/internal/page"
 )
@@ -18,6 +19,11 @@ type SnapshotOptions struct {
 	IncludeHTML   bool
 	MaxHTML       int
 	MaxHTMLTokens int
+	// IncludeValues asks for the current value of form fields, including
+	// what the user has typed, in the element list.
+	IncludeValues bool
+	// Reducer overrides the implementation's default reducer for this call.
+	Reducer *page.Reducer
 }
 
 type Browser interface {
@@ -25,13 +31,17 @@ type Browser interface {
 	Snapshot(ctx context.Context, opts SnapshotOptions) (page.Snapshot, error)
 	Scroll(ctx context.Context, opts ScrollOptions) (ScrollResult, error)
 	Hover(ctx context.Context, selector string) (HoverResult, error)
-	Type(ctx context.Context, selector string, text string, pressEnter bool) (TypeResult, error)
+	Type(ctx context.Context, opts TypeOptions) (TypeResult, error)
 	Enter(ctx context.Context, selector string, key string) (EnterResult, error)
+	PressKeys(ctx context.Context, selector string, chords []KeyChord) (PressKeysResult, error)
 	Back(ctx context.Context) (HistoryResult, error)
 	Forward(ctx context.Context) (HistoryResult, error)
-	WaitForSelector(ctx context.Context, selector string, timeoutMs int) (WaitForSelectorResult, error)
-	Find(ctx context.Context, text string, limit int, radius int, caseSensitive bool) (FindResult, error)
+	History(ctx context.Context) (HistoryList, error)
+	WaitForSelector(ctx context.Context, opts WaitForSelectorOptions) (WaitForSelectorResult, error)
+	WaitForURL(ctx context.Context, opts WaitForURLOptions) (WaitForURLResult, error)
+	Find(ctx context.Context, opts FindOptions) (FindResult, error)
 	Navigate(ctx context.Context, url string) (NavigateResult, error)
+	Reload(ctx context.Context, opts ReloadOptions) (NavigateResult, error)
 	Select(ctx context.Context, opts SelectOptions) (SelectResult, error)
 	Screenshot(ctx context.Context, opts ScreenshotOptions) (ScreenshotResult, error)
 	StartRecording(ctx context.Context) (RecordingStateResult, error)
@@ -43,6 +53,14 @@ type Browser interface {
 	ClaimTab(ctx context.Context, opts ClaimTabOptions) (TabInfo, error)
 	ReleaseTab(ctx context.Context, tabID int) error
 	SetTabSharing(ctx context.Context, tabID int, allowShared bool) error
+	ClearStorage(ctx context.Context, opts ClearStorageOptions) (ClearStorageResult, error)
+	GetStorage(ctx context.Context, opts GetStorageOptions) (StorageResult, error)
+	SetStorage(ctx context.Context, opts SetStorageOptions) (SetStorageResult, error)
+	Evaluate(ctx context.Context, script string) (EvaluateResult, error)
+	GetAttribute(ctx context.Context, selector, attribute string) (AttributeResult, error)
+	GetText(ctx context.Context, selector string) (TextResult, error)
+	FillForm(ctx context.Context, fields []FillFormField) (FillFormResult, error)
+	SetChecked(ctx context.Context, selector string, checked bool) (CheckedResult, error)
 }
 
 type TabInfo struct {
@@ -83,10 +101,31 @@ type HoverResult struct {
 	Selector string `json:"selector"`
 }
 
+type TypeOptions struct {
+	Selector   string
+	Text       string
+	PressEnter bool
+	// ReportValidation asks the extension to return error text associated
+	// with the field after typing.
+	ReportValidation bool
+}
+
 type TypeResult struct {
 	Selector   string `json:"selector"`
 	TextLength int    `json:"textLength"`
 	PressEnter bool   `json:"pressEnter"`
+	// Invalid and Validation are only filled when ReportValidation was set.
+	Invalid    bool                `json:"invalid,omitempty"`
+	Validation []ValidationMessage `json:"validation,omitempty"`
+}
+
+// ValidationMessage is error text the page associates with a field. Source
+// names the association: aria-describedby, aria-errormessage, adjacent
+// (a nearby .error/[role=alert] element) or validity (the browser's
+// validationMessage).
+type ValidationMessage struct {
+	Text   string `json:"text"`
+	Source string `json:"source"`
 }
 
 type EnterResult struct {
@@ -95,19 +134,120 @@ type EnterResult struct {
 	UsedActiveElement bool   `json:"usedActiveElement"`
 }
 
+// PressKeysResult lists the chords dispatched, in canonical form. It is
+// shorter than the chords asked for only when an error is returned too.
+type PressKeysResult struct {
+	Selector          string   `json:"selector,omitempty"`
+	Dispatched        []string `json:"dispatched"`
+	UsedActiveElement bool     `json:"usedActiveElement"`
+}
+
+// NavigationState is where a navigation-style command (navigate, reload,
+// back, forward) left the tab, shared by their results so agents can read
+// them the same way. URL is the page URL afterwards and is always reported;
+// Title is set when the browser knows it. Moved reports whether a page was
+// loaded: always for a successful navigate or reload, and for back and
+// forward only when there was a history entry to go to. It is nil when the
+// browser did not say and it could not be worked out, so unknown is not
+// mistaken for false.
+type NavigationState struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	Moved *bool  `json:"moved,omitempty"`
+}
+
 type HistoryResult struct {
 	Direction string `json:"direction"`
+	NavigationState
+}
+
+// HistoryList is the tab's navigable session history, oldest first. Index
+// is the position of the current page in Entries. Complete is false when the
+// browser could only report the current page; Length is then the size of the
+// whole history when known, and 0 otherwise.
+type HistoryList struct {
+	Entries  []HistoryEntry `json:"entries"`
+	Index    int            `json:"index"`
+	Length   int            `json:"length,omitempty"`
+	Complete bool           `json:"complete"`
+}
+
+type HistoryEntry struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+}
+
+// Wait states for WaitForSelectorOptions.State. The empty state means
+// WaitAttached, the original appear-in-DOM behaviour.
+const (
+	WaitAttached = "attached"
+	WaitVisible  = "visible"
+	WaitHidden   = "hidden"
+	WaitDetached = "detached"
+)
+
+type WaitForSelectorOptions struct {
+	Selector  string
+	TimeoutMs int
+	State     string
+	// ContainsText additionally requires the element's text to contain this
+	// substring. It only applies to the attached and visible states.
+	ContainsText string
 }
 
 type WaitForSelectorResult struct {
-	Selector  string `json:"selector"`
+	Selector     string `json:"selector"`
+	TimeoutMs    int    `json:"timeoutMs"`
+	Found        bool   `json:"found"`
+	State        string `json:"state,omitempty"`
+	ContainsText string `json:"containsText,omitempty"`
+	// Condition names what resolved the wait: a state, or "text" when
+	// ContainsText matched.
+	Condition string `json:"condition,omitempty"`
+}
+
+// WaitForURLOptions waits for the tab's URL to match Pattern, a glob or a
+// regex as Match says; see URLPatternRegex.
+type WaitForURLOptions struct {
+	Pattern   string
+	Match     string
+	TimeoutMs int
+}
+
+type WaitForURLResult struct {
+	Pattern   string `json:"pattern"`
+	Match     string `json:"match"`
 	TimeoutMs int    `json:"timeoutMs"`
-	Found     bool   `json:"found"`
+	Matched   bool   `json:"matched"`
+	// URL is the tab's URL when the wait ended, matched or not.
+	URL string `json:"url"`
+}
+
+type FindOptions struct {
+	Text          string
+	Limit         int
+	Radius        int
+	CaseSensitive bool
+	// IncludePositions asks for each match's element selector and rect.
+	IncludePositions bool
 }
 
 type FindResultItem struct {
 	Index   int    `json:"index"`
 	Snippet string `json:"snippet"`
+	// Selector and Rect locate the element containing the match; they are
+	// only reported when positions were asked for.
+	Selector string `json:"selector,omitempty"`
+	Rect     *Rect  `json:"rect,omitempty"`
+}
+
+// Rect is an element's box in CSS pixels relative to the document, not the
+// viewport, so it stays valid after scrolling.
+type Rect struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
 }
 
 type FindResult struct {
@@ -120,20 +260,51 @@ type FindResult struct {
 	Results       []FindResultItem `json:"results"`
 }
 
+// NavigateResult is where a navigate or reload ended up. StatusCode is the
+// HTTP status of the main document, or 0 when the browser could not report
+// it; Headers then is empty too. Only headers in NavigateHeaders are kept,
+// keyed by lower-case name.
 type NavigateResult struct {
-	URL string `json:"url"`
+	NavigationState
+	StatusCode int               `json:"statusCode,omitempty"`
+	StatusText string            `json:"statusText,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+}
+
+// ReloadOptions configures Reload. BypassCache reloads without the HTTP
+// cache, like a hard refresh.
+type ReloadOptions struct {
+	BypassCache bool
+}
+
+// NavigateHeaders are the response headers NavigateResult carries. Cookies
+// and other credentials are deliberately left out.
+var NavigateHeaders = []string{
+	"content-type",
+	"content-length",
+	"content-language",
+	"location",
+	"last-modified",
+	"etag",
+	"cache-control",
+	"retry-after",
+	"server",
 }
 
 type SelectOptions struct {
-	Selector  string
-	Value     string
-	Label     string
-	Index     int
-	Values    []string
-	Labels    []string
-	Indices   []int
-	MatchMode string
-	Toggle    bool
+	Selector   string
+	Value      string
+	Label      string
+	Index      int
+	Values     []string
+	Labels     []string
+	Indices    []int
+	MatchMode  string
+	LabelRegex string
+	Toggle     bool
+	// BlurAfter blurs the element once the selection is made, for
+	// frameworks that only commit a field on blur.
+	BlurAfter bool
 }
 
 type SelectResult struct {
@@ -145,9 +316,13 @@ type SelectResult struct {
 	Labels        []string `json:"labels,omitempty"`
 	Indices       []int    `json:"indices,omitempty"`
 	MatchMode     string   `json:"matchMode,omitempty"`
+	LabelRegex    string   `json:"labelRegex,omitempty"`
 	Toggle        bool     `json:"toggle,omitempty"`
 	Multiple      bool     `json:"multiple,omitempty"`
 	SelectedCount int      `json:"selectedCount,omitempty"`
+	// Events lists the DOM events dispatched on the element, in order:
+	// "input" and "change", then "blur" when asked for.
+	Events []string `json:"events,omitempty"`
 }
 
 type ScreenshotOptions struct {
@@ -157,14 +332,162 @@ type ScreenshotOptions struct {
 	Quality   float64
 	MaxWidth  int
 	MaxHeight int
+	// Annotate outlines the element named by Selector in the capture.
+	Annotate bool
 }
 
 type ScreenshotResult struct {
 	Selector string `json:"selector"`
-	DataURL  string `json:"dataUrl"`
+	DataURL  string `json:"dataUrl,omitempty"`
 	Width    int    `json:"width"`
 	Height   int    `json:"height"`
 	Format   string `json:"format"`
+	// Box is the outlined element's box; only set for annotated captures.
+	Box *Rect `json:"box,omitempty"`
+}
+
+// ClearStorageOptions selects what ClearStorage removes. It only ever
+// touches the origin of the target tab.
+type ClearStorageOptions struct {
+	Cookies        bool
+	LocalStorage   bool
+	SessionStorage bool
+	Cache          bool
+}
+
+type ClearStorageResult struct {
+	Origin string `json:"origin"`
+	// Cleared lists what was actually cleared: "cookies", "localStorage",
+	// "sessionStorage" and/or "cache".
+	Cleared []string `json:"cleared"`
+}
+
+// Storage kinds for GetStorageOptions.Kind and SetStorageOptions.Kind.
+const (
+	StorageLocal   = "local"
+	StorageSession = "session"
+)
+
+// GetStorageOptions reads one key of the target tab's storage area, or every
+// key when Key is empty. MaxBytes, when positive, caps the total size of the
+// keys and values returned.
+type GetStorageOptions struct {
+	Kind     string
+	Key      string
+	MaxBytes int
+}
+
+// StorageResult holds the items read, sorted by key. For a single key Items
+// has at most one entry and Found says whether the key exists. Count is the
+// number of keys in the storage area and Truncated is set when items or a
+// value were left out to stay within MaxBytes.
+type StorageResult struct {
+	Origin    string        `json:"origin"`
+	Kind      string        `json:"kind"`
+	Items     []StorageItem `json:"items"`
+	Count     int           `json:"count"`
+	Found     bool          `json:"found,omitempty"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+type StorageItem struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+	// Truncated is set when Value was cut short to stay within MaxBytes.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// SetStorageOptions sets Key to Value in the target tab's storage area, or
+// removes it when Remove is set.
+type SetStorageOptions struct {
+	Kind   string
+	Key    string
+	Value  string
+	Remove bool
+}
+
+type SetStorageResult struct {
+	Origin  string `json:"origin"`
+	Kind    string `json:"kind"`
+	Key     string `json:"key"`
+	Removed bool   `json:"removed,omitempty"`
+	// Existed reports whether the key was present before the change.
+	Existed bool `json:"existed"`
+}
+
+// EvaluateResult.Type is the typeof of the result; these are the common ones.
+const (
+	EvaluateString    = "string"
+	EvaluateNumber    = "number"
+	EvaluateBoolean   = "boolean"
+	EvaluateObject    = "object"
+	EvaluateUndefined = "undefined"
+)
+
+// EvaluateResult is the outcome of evaluating a script in the page. Value is
+// the JSON-serialized result and is empty for undefined; Error is set when
+// the script threw.
+type EvaluateResult struct {
+	Value json.RawMessage `json:"value,omitempty"`
+	Type  string          `json:"type"`
+	Error string          `json:"error,omitempty"`
+}
+
+// AttributeResult is one attribute of an element. Present tells a missing
+// attribute apart from an empty one.
+type AttributeResult struct {
+	Selector  string `json:"selector"`
+	Attribute string `json:"attribute"`
+	Value     string `json:"value"`
+	Present   bool   `json:"present"`
+}
+
+// TextResult is the text of an element: InnerText as rendered, TextContent
+// as in the DOM, including hidden text.
+type TextResult struct {
+	Selector    string `json:"selector"`
+	InnerText   string `json:"innerText"`
+	TextContent string `json:"textContent"`
+}
+
+// CheckedResult is the state of a checkbox or radio after SetChecked.
+// Changed is false when it was already in the requested state.
+type CheckedResult struct {
+	Selector string `json:"selector"`
+	Checked  bool   `json:"checked"`
+	Changed  bool   `json:"changed"`
+}
+
+type FillFormField struct {
+	Selector   string
+	Value      string
+	PressEnter bool
+}
+
+// FillFormResult reports each field of a FillForm call in order, with totals.
+type FillFormResult struct {
+	Fields    []FillFieldResult `json:"fields"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+}
+
+type FillFieldResult struct {
+	Selector  string `json:"selector"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
+}
+
+// Count sets Succeeded and Failed from Fields.
+func (r *FillFormResult) Count() {
+	r.Succeeded, r.Failed = 0, 0
+	for _, f := range r.Fields {
+		if f.OK {
+			r.Succeeded++
+		} else {
+			r.Failed++
+		}
+	}
 }
 
 type RecordingStateResult struct {
@@ -178,4 +501,5 @@ type RecordedAction struct {
 	Timestamp int64          `json:"timestamp"`
 	URL       string         `json:"url"`
 	Title     string         `json:"title"`
+	Seq       uint64         `json:"seq,omitempty"`
 }
@@ -0,0 +1,70 @@
+package browser
+
+import "fmt"
+
+// TabLockedError reports that the target tab is claimed by another session.
+// OwnerSessionID is only set when the owner allows shared claims.
+type TabLockedError struct {
+	TabID          int
+	OwnerSessionID string
+	AllowShared    bool
+}
+
+func (e *TabLockedError) Error() string {
+	tab := "active tab"
+	if e.TabID != 0 {
+		tab = fmt.Sprintf("tab %d", e.TabID)
+	}
+	msg := fmt.Sprintf("%s is claimed by another session", tab)
+	if e.OwnerSessionID != "" {
+		msg = fmt.Sprintf("%s is claimed by session %s", tab, e.OwnerSessionID)
+	}
+	return fmt.Sprintf("%s (tab_locked): %s", msg, e.Hint())
+}
+
+// Hint tells an agent how to proceed.
+func (e *TabLockedError) Hint() string {
+	if e.AllowShared {
+		return "claim it with browser.claim_tab mode \"shared\" or target another tab"
+	}
+	return "it is owned exclusively elsewhere; open or claim another tab with browser.open_tab or browser.claim_tab"
+}
+
+// NotFoundError reports that a selector matched no element. Message is the
+// extension's description, when it sent one.
+type NotFoundError struct {
+	Selector string
+	Message  string
+}
+
+func (e *NotFoundError) Error() string {
+	msg := e.Message
+	switch {
+	case e.Selector != "":
+		msg = fmt.Sprintf("no element matches %q", e.Selector)
+	case msg == "":
+		msg = "no element matches the selector"
+	}
+	return fmt.Sprintf("%s (not_found): %s", msg, e.Hint())
+}
+
+// Hint tells an agent how to proceed.
+func (e *NotFoundError) Hint() string {
+	return "check the selector against a fresh browser.snapshot"
+}
+
+// TabLimitError reports that a browser session already has the maximum
+// number of open tabs allowed by the server.
+type TabLimitError struct {
+	Limit int
+	Open  int
+}
+
+func (e *TabLimitError) Error() string {
+	return fmt.Sprintf("session has %d open tabs, limit is %d (tab_limit_exceeded): %s", e.Open, e.Limit, e.Hint())
+}
+
+// Hint tells an agent how to proceed.
+func (e *TabLimitError) Hint() string {
+	return "close tabs you no longer need with browser.close_tab, or reuse one with browser.navigate"
+}
@@ -0,0 +1,121 @@
+package browser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// KeyChord is a key pressed with zero or more modifiers held, such as
+// Control+a. Key is a single character or a named key like Enter.
+type KeyChord struct {
+	Key     string
+	Control bool
+	Shift   bool
+	Alt     bool
+	Meta    bool
+}
+
+// String formats the chord in the canonical form the extension parses:
+// modifiers in the order Control, Shift, Alt, Meta, then the key, joined
+// by "+".
+func (c KeyChord) String() string {
+	var parts []string
+	for _, m := range []struct {
+		on   bool
+		name string
+	}{{c.Control, "Control"}, {c.Shift, "Shift"}, {c.Alt, "Alt"}, {c.Meta, "Meta"}} {
+		if m.on {
+			parts = append(parts, m.name)
+		}
+	}
+	return strings.Join(append(parts, c.Key), "+")
+}
+
+// modifierNames maps the accepted modifier spellings, lower-cased, to their
+// canonical name.
+var modifierNames = map[string]string{
+	"control": "Control",
+	"ctrl":    "Control",
+	"shift":   "Shift",
+	"alt":     "Alt",
+	"option":  "Alt",
+	"meta":    "Meta",
+	"cmd":     "Meta",
+	"command": "Meta",
+	"super":   "Meta",
+}
+
+// namedKeys maps the accepted named keys, lower-cased, to their
+// KeyboardEvent.key value.
+var namedKeys = func() map[string]string {
+	names := []string{
+		"Enter", "Tab", "Escape", "Backspace", "Delete", "Insert",
+		"ArrowUp", "ArrowDown", "ArrowLeft", "ArrowRight",
+		"Home", "End", "PageUp", "PageDown",
+		"Control", "Shift", "Alt", "Meta", "CapsLock", "ContextMenu",
+	}
+	for i := 1; i <= 12; i++ {
+		names = append(names, fmt.Sprintf("F%d", i))
+	}
+	out := make(map[string]string, len(names)+4)
+	for _, n := range names {
+		out[strings.ToLower(n)] = n
+	}
+	out["esc"] = "Escape"
+	out["del"] = "Delete"
+	out["return"] = "Enter"
+	out["space"] = " "
+	return out
+}()
+
+// ParseKeyChord parses a chord such as "Control+a", "Shift+Tab" or
+// "Meta+Shift+z". Modifier and named-key spellings are case-insensitive;
+// "Ctrl", "Option" and "Cmd" are accepted for Control, Alt and Meta. A
+// literal plus is written "+" or, after modifiers, "Control++".
+func ParseKeyChord(s string) (KeyChord, error) {
+	if s == "" {
+		return KeyChord{}, fmt.Errorf("empty key chord")
+	}
+	parts := strings.Split(s, "+")
+	if s == "+" || strings.HasSuffix(s, "++") {
+		// The key itself is "+": the split left two empty parts for it.
+		parts = append(parts[:len(parts)-2], "+")
+	}
+	var c KeyChord
+	for _, p := range parts[:len(parts)-1] {
+		var held *bool
+		switch modifierNames[strings.ToLower(strings.TrimSpace(p))] {
+		case "Control":
+			held = &c.Control
+		case "Shift":
+			held = &c.Shift
+		case "Alt":
+			held = &c.Alt
+		case "Meta":
+			held = &c.Meta
+		default:
+			return KeyChord{}, fmt.Errorf("key chord %q: unknown modifier %q (want Control, Shift, Alt or Meta)", s, p)
+		}
+		if *held {
+			return KeyChord{}, fmt.Errorf("key chord %q: modifier %q given twice", s, p)
+		}
+		*held = true
+	}
+	key := parts[len(parts)-1]
+	if key != " " {
+		key = strings.TrimSpace(key)
+	}
+	switch {
+	case key == "":
+		return KeyChord{}, fmt.Errorf("key chord %q has no key", s)
+	case len([]rune(key)) == 1:
+		c.Key = key
+	default:
+		name, ok := namedKeys[strings.ToLower(key)]
+		if !ok {
+			return KeyChord{}, fmt.Errorf("key chord %q: unknown key %q (want a single character or a key name like Enter, Tab or ArrowDown)", s, key)
+		}
+		c.Key = name
+	}
+	return c, nil
+}
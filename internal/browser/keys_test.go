@@ -0,0 +1,40 @@
+package browser
+
+import "testing"
+
+func TestParseKeyChord(t *testing.T) {
+	for in, want := range map[string]string{
+		"a":               "a",
+		"Control+a":       "Control+a",
+		"ctrl+A":          "Control+A",
+		"Shift+Cmd+z":     "Shift+Meta+z",
+		"alt+option+x":    "",
+		"Control+Shift+P": "Control+Shift+P",
+		"enter":           "Enter",
+		"Shift+tab":       "Shift+Tab",
+		"esc":             "Escape",
+		"f5":              "F5",
+		"Control+Space":   "Control+ ",
+		"+":               "+",
+		"Control++":       "Control++",
+		"é":               "é",
+		"a+":              "",
+		"Hyper+a":         "",
+		"Control+":        "",
+		"Control+Shift":   "Control+Shift",
+		"Control+Ctrl+a":  "",
+		"Control+Enterr":  "",
+		"":                "",
+	} {
+		c, err := ParseKeyChord(in)
+		if want == "" {
+			if err == nil {
+				t.Fatalf("ParseKeyChord(%q) = %q, want an error", in, c)
+			}
+			continue
+		}
+		if err != nil || c.String() != want {
+			t.Fatalf("ParseKeyChord(%q) = %q (%v), want %q", in, c, err, want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package browser
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// portableEscapes are the letter escapes Go and JavaScript read the same way.
+const portableEscapes = "dDwWsSbBnrtfv"
+
+// CheckRegex reports whether pattern can be sent to the extension, which
+// runs it as a JavaScript RegExp. It must compile in Go and keep to syntax
+// both engines read the same way, so inline flags such as (?i), (?P<name>),
+// \A, \z, \Q…\E, \p{…}, \x{…}, numeric escapes and POSIX classes like
+// [[:alpha:]] are rejected rather than left to fail or misbehave in the
+// browser.
+func CheckRegex(pattern string) error {
+	if _, err := regexp.Compile(pattern); err != nil {
+		return err
+	}
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			e := pattern[i]
+			switch {
+			case strings.IndexByte(portableEscapes, e) >= 0:
+			case e == 'x' && i+1 < len(pattern) && pattern[i+1] != '{':
+			case !isASCIIAlnum(e):
+				// An escaped symbol is the symbol itself in both.
+			default:
+				return fmt.Errorf("escape \\%c is not supported by the browser's RegExp", e)
+			}
+		case inClass:
+			if c == ']' {
+				inClass = false
+			} else if c == '[' && i+1 < len(pattern) && pattern[i+1] == ':' {
+				return fmt.Errorf("POSIX class %s is not supported by the browser's RegExp", posixClass(pattern[i:]))
+			}
+		case c == '[':
+			inClass = true
+			j := i + 1
+			if j < len(pattern) && pattern[j] == '^' {
+				j++
+			}
+			// Go reads a leading ] as a literal; JavaScript ends the class.
+			if j < len(pattern) && pattern[j] == ']' {
+				return fmt.Errorf("a ] at the start of a character class is read differently by the browser's RegExp; escape it as \\]")
+			}
+		case c == '(' && strings.HasPrefix(pattern[i:], "(?"):
+			rest := pattern[i+2:]
+			if !strings.HasPrefix(rest, ":") && !strings.HasPrefix(rest, "<") {
+				return fmt.Errorf("group %s is not supported by the browser's RegExp; use (?:…) or (?<name>…) and no inline flags", groupPrefix(pattern[i:]))
+			}
+		}
+	}
+	return nil
+}
+
+func isASCIIAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// posixClass returns the [:name:] at the start of s.
+func posixClass(s string) string {
+	if end := strings.Index(s, ":]"); end >= 0 {
+		return s[:end+2]
+	}
+	return s
+}
+
+// groupPrefix returns the "(?…" opener at the start of s, up to its ) or :.
+func groupPrefix(s string) string {
+	if end := strings.IndexAny(s[2:], ":)>"); end >= 0 {
+		return s[:end+3]
+	}
+	return s
+}
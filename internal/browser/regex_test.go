@@ -0,0 +1,36 @@
+package browser
+
+import "testing"
+
+func TestCheckRegex(t *testing.T) {
+	for _, ok := range []string{
+		`^Mar(ch)? \d{1,2}`,
+		`/orders/\d+$`,
+		`(?:a|b)+\.html`,
+		`(?<year>\d{4})-\x41`,
+		`[^\]a-z\-]+`,
+		`\bword\B\s\S\w\W\n\t`,
+		`\/path\?q=\(1\)`,
+	} {
+		if err := CheckRegex(ok); err != nil {
+			t.Fatalf("expected %q to be accepted, got %v", ok, err)
+		}
+	}
+	for _, bad := range []string{
+		`(`,
+		`(?i)checkout`,
+		`(?P<year>\d{4})`,
+		`\Aorders\z`,
+		`\Qa.b\E`,
+		`\pL+`,
+		`\x{41}`,
+		`(a)\1`,
+		`[[:alpha:]]+`,
+		`[]a]`,
+		`[^]a]`,
+	} {
+		if err := CheckRegex(bad); err == nil {
+			t.Fatalf("expected %q to be rejected", bad)
+		}
+	}
+}
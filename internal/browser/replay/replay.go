@@ -0,0 +1,560 @@
+// Package replay implements browser.Browser over pages recorded on disk, so
+// agents can be tested against fixed pages without a live browser.
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+	"github.com/adityalohuni/mcp-server/internal/page"
+)
+
+// ManifestName is the file in a fixture directory that lists its pages.
+const ManifestName = "replay.json"
+
+// tabID is the id of the replay browser's only tab.
+const tabID = 1
+
+// Manifest describes a fixture directory. Each page is either an HTML file,
+// reduced like a page the extension sent without an element list, or a
+// page.RawPage saved as JSON, e.g. captured from a live browser.
+type Manifest struct {
+	// Start is the URL the browser is on before any navigation; empty means
+	// the first page.
+	Start string         `json:"start,omitempty"`
+	Pages []ManifestPage `json:"pages"`
+}
+
+type ManifestPage struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+	// HTML and Page name files relative to the manifest; set one.
+	HTML string `json:"html,omitempty"`
+	Page string `json:"page,omitempty"`
+}
+
+// Browser serves recorded pages. Navigate and history move between them and
+// Snapshot reduces the current one; actions that would change a page are
+// recorded and otherwise do nothing.
+type Browser struct {
+	reducer *page.Reducer
+	pages   map[string]page.RawPage
+	now     func() time.Time
+
+	mu      sync.Mutex
+	history []string
+	pos     int
+	actions []browser.RecordedAction
+}
+
+// Load reads the fixture directory dir. A nil reducer uses the defaults.
+func Load(dir string, reducer *page.Reducer) (*Browser, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestName))
+	if err != nil {
+		return nil, fmt.Errorf("replay fixtures: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("replay fixtures: parse %s: %w", ManifestName, err)
+	}
+	if len(m.Pages) == 0 {
+		return nil, fmt.Errorf("replay fixtures: %s lists no pages", ManifestName)
+	}
+	if reducer == nil {
+		reducer = page.NewReducer(page.ReduceOptions{})
+	}
+	b := &Browser{reducer: reducer, pages: make(map[string]page.RawPage, len(m.Pages)), now: time.Now}
+	for i, p := range m.Pages {
+		raw, err := loadPage(dir, p)
+		if err != nil {
+			return nil, fmt.Errorf("replay fixtures: pages[%d]: %w", i, err)
+		}
+		b.pages[raw.URL] = raw
+	}
+	start := m.Start
+	if start == "" {
+		start = m.Pages[0].URL
+	}
+	if _, ok := b.pages[start]; !ok {
+		return nil, fmt.Errorf("replay fixtures: start %q is not a listed page", start)
+	}
+	b.history = []string{start}
+	return b, nil
+}
+
+func loadPage(dir string, p ManifestPage) (page.RawPage, error) {
+	if (p.HTML == "") == (p.Page == "") {
+		return page.RawPage{}, errors.New("set one of html or page")
+	}
+	var raw page.RawPage
+	if p.HTML != "" {
+		data, err := os.ReadFile(filepath.Join(dir, p.HTML))
+		if err != nil {
+			return page.RawPage{}, err
+		}
+		raw.HTML = string(data)
+	} else {
+		data, err := os.ReadFile(filepath.Join(dir, p.Page))
+		if err != nil {
+			return page.RawPage{}, err
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return page.RawPage{}, fmt.Errorf("parse %s: %w", p.Page, err)
+		}
+	}
+	if p.URL != "" {
+		raw.URL = p.URL
+	}
+	if p.Title != "" {
+		raw.Title = p.Title
+	}
+	if raw.URL == "" {
+		return page.RawPage{}, errors.New("url is required")
+	}
+	return raw, nil
+}
+
+// Actions returns the actions recorded so far, oldest first.
+func (b *Browser) Actions() []browser.RecordedAction {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]browser.RecordedAction(nil), b.actions...)
+}
+
+func (b *Browser) current() page.RawPage {
+	return b.pages[b.history[b.pos]]
+}
+
+// record logs a mutating action against the current page.
+func (b *Browser) record(kind string, payload map[string]any) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cur := b.current()
+	b.actions = append(b.actions, browser.RecordedAction{
+		Type:      kind,
+		Payload:   payload,
+		Timestamp: b.now().UnixMilli(),
+		URL:       cur.URL,
+		Title:     cur.Title,
+		Seq:       uint64(len(b.actions) + 1),
+	})
+}
+
+func (b *Browser) Snapshot(ctx context.Context, opts browser.SnapshotOptions) (page.Snapshot, error) {
+	reducer := b.reducer
+	if opts.Reducer != nil {
+		reducer = opts.Reducer
+	}
+	b.mu.Lock()
+	raw := b.current()
+	b.mu.Unlock()
+	return reducer.WithLimits(opts.MaxText, opts.MaxElements).Reduce(raw), nil
+}
+
+func (b *Browser) Navigate(ctx context.Context, url string) (browser.NavigateResult, error) {
+	if url == "" {
+		return browser.NavigateResult{}, errors.New("url is required")
+	}
+	if _, ok := b.pages[url]; !ok {
+		return browser.NavigateResult{}, fmt.Errorf("replay: no recorded page for %s", url)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.history = append(b.history[:b.pos+1], url)
+	b.pos++
+	return browser.NavigateResult{NavigationState: b.stateLocked(true)}, nil
+}
+
+// Reload stays on the current page.
+func (b *Browser) Reload(ctx context.Context, opts browser.ReloadOptions) (browser.NavigateResult, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return browser.NavigateResult{NavigationState: b.stateLocked(true)}, nil
+}
+
+func (b *Browser) Back(ctx context.Context) (browser.HistoryResult, error) {
+	return b.move(-1, "back"), nil
+}
+
+func (b *Browser) Forward(ctx context.Context) (browser.HistoryResult, error) {
+	return b.move(1, "forward"), nil
+}
+
+func (b *Browser) History(ctx context.Context) (browser.HistoryList, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := browser.HistoryList{Entries: make([]browser.HistoryEntry, len(b.history)), Index: b.pos, Length: len(b.history), Complete: true}
+	for i, url := range b.history {
+		out.Entries[i] = browser.HistoryEntry{URL: url, Title: b.pages[url].Title}
+	}
+	return out, nil
+}
+
+func (b *Browser) move(step int, direction string) browser.HistoryResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	next := b.pos + step
+	moved := next >= 0 && next < len(b.history)
+	if moved {
+		b.pos = next
+	}
+	return browser.HistoryResult{Direction: direction, NavigationState: b.stateLocked(moved)}
+}
+
+func (b *Browser) stateLocked(moved bool) browser.NavigationState {
+	url := b.history[b.pos]
+	return browser.NavigationState{URL: url, Title: b.pages[url].Title, Moved: &moved}
+}
+
+func (b *Browser) Click(ctx context.Context, selector string) (browser.ClickResult, error) {
+	if selector == "" {
+		return browser.ClickResult{}, errors.New("selector is required")
+	}
+	b.record("click", map[string]any{"selector": selector})
+	return browser.ClickResult{Status: "ok", Selector: selector}, nil
+}
+
+func (b *Browser) Hover(ctx context.Context, selector string) (browser.HoverResult, error) {
+	if selector == "" {
+		return browser.HoverResult{}, errors.New("selector is required")
+	}
+	b.record("hover", map[string]any{"selector": selector})
+	return browser.HoverResult{Selector: selector}, nil
+}
+
+func (b *Browser) Type(ctx context.Context, opts browser.TypeOptions) (browser.TypeResult, error) {
+	if opts.Selector == "" {
+		return browser.TypeResult{}, errors.New("selector is required")
+	}
+	b.record("type", map[string]any{"selector": opts.Selector, "text": opts.Text, "pressEnter": opts.PressEnter})
+	return browser.TypeResult{Selector: opts.Selector, TextLength: len(opts.Text), PressEnter: opts.PressEnter}, nil
+}
+
+// FillForm records each field as typed; every field succeeds.
+func (b *Browser) FillForm(ctx context.Context, fields []browser.FillFormField) (browser.FillFormResult, error) {
+	if len(fields) == 0 {
+		return browser.FillFormResult{}, errors.New("fields is required")
+	}
+	out := browser.FillFormResult{Fields: make([]browser.FillFieldResult, 0, len(fields))}
+	for i, f := range fields {
+		if f.Selector == "" {
+			return browser.FillFormResult{}, fmt.Errorf("fields[%d]: selector is required", i)
+		}
+	}
+	for _, f := range fields {
+		b.record("type", map[string]any{"selector": f.Selector, "text": f.Value, "pressEnter": f.PressEnter})
+		out.Fields = append(out.Fields, browser.FillFieldResult{Selector: f.Selector, OK: true})
+	}
+	out.Count()
+	return out, nil
+}
+
+// SetChecked records the change. The recorded page keeps no checked state,
+// so the result reports the requested state and no change.
+func (b *Browser) SetChecked(ctx context.Context, selector string, checked bool) (browser.CheckedResult, error) {
+	if selector == "" {
+		return browser.CheckedResult{}, errors.New("selector is required")
+	}
+	el, ok := b.element(ctx, selector)
+	if !ok {
+		return browser.CheckedResult{}, &browser.NotFoundError{Selector: selector}
+	}
+	if el.InputType != "checkbox" && el.InputType != "radio" {
+		return browser.CheckedResult{}, fmt.Errorf("%s is not a checkbox or radio button (not_checkable)", selector)
+	}
+	if el.InputType == "radio" && !checked {
+		return browser.CheckedResult{}, fmt.Errorf("%s is a radio button; check another option instead (not_checkable)", selector)
+	}
+	b.record("set_checked", map[string]any{"selector": selector, "checked": checked})
+	return browser.CheckedResult{Selector: selector, Checked: checked}, nil
+}
+
+func (b *Browser) Enter(ctx context.Context, selector string, key string) (browser.EnterResult, error) {
+	if key == "" {
+		key = "Enter"
+	}
+	b.record("enter", map[string]any{"selector": selector, "key": key})
+	return browser.EnterResult{Selector: selector, Key: key, UsedActiveElement: selector == ""}, nil
+}
+
+func (b *Browser) PressKeys(ctx context.Context, selector string, chords []browser.KeyChord) (browser.PressKeysResult, error) {
+	if len(chords) == 0 {
+		return browser.PressKeysResult{}, errors.New("keys is required")
+	}
+	keys := make([]string, len(chords))
+	for i, chord := range chords {
+		keys[i] = chord.String()
+	}
+	b.record("press_keys", map[string]any{"selector": selector, "keys": keys})
+	return browser.PressKeysResult{Selector: selector, Dispatched: keys, UsedActiveElement: selector == ""}, nil
+}
+
+func (b *Browser) Select(ctx context.Context, opts browser.SelectOptions) (browser.SelectResult, error) {
+	if opts.Selector == "" {
+		return browser.SelectResult{}, errors.New("selector is required")
+	}
+	b.record("select", map[string]any{"selector": opts.Selector, "value": opts.Value, "label": opts.Label, "blurAfter": opts.BlurAfter})
+	events := []string{"input", "change"}
+	if opts.BlurAfter {
+		events = append(events, "blur")
+	}
+	return browser.SelectResult{Selector: opts.Selector, Value: opts.Value, Label: opts.Label, Index: opts.Index, Events: events}, nil
+}
+
+func (b *Browser) Scroll(ctx context.Context, opts browser.ScrollOptions) (browser.ScrollResult, error) {
+	b.record("scroll", map[string]any{"selector": opts.Selector, "deltaX": opts.DeltaX, "deltaY": opts.DeltaY})
+	return browser.ScrollResult{DeltaX: opts.DeltaX, DeltaY: opts.DeltaY, Selector: opts.Selector, Behavior: opts.Behavior, Block: opts.Block}, nil
+}
+
+// WaitForSelector answers at once from the recorded page: the selector is
+// found when an element of the reduced page has it.
+func (b *Browser) WaitForSelector(ctx context.Context, opts browser.WaitForSelectorOptions) (browser.WaitForSelectorResult, error) {
+	if opts.Selector == "" {
+		return browser.WaitForSelectorResult{}, errors.New("selector is required")
+	}
+	snap, _ := b.Snapshot(ctx, browser.SnapshotOptions{})
+	present := false
+	for _, el := range snap.Elements {
+		if el.Selector == opts.Selector && (opts.ContainsText == "" || strings.Contains(el.Text, opts.ContainsText)) {
+			present = true
+			break
+		}
+	}
+	found := present
+	if opts.State == browser.WaitHidden || opts.State == browser.WaitDetached {
+		found = !present
+	}
+	state := opts.State
+	if state == "" {
+		state = browser.WaitAttached
+	}
+	out := browser.WaitForSelectorResult{Selector: opts.Selector, TimeoutMs: opts.TimeoutMs, Found: found, State: state, ContainsText: opts.ContainsText}
+	if found {
+		out.Condition = state
+	}
+	return out, nil
+}
+
+// WaitForURL answers at once from the current recorded page's URL.
+func (b *Browser) WaitForURL(ctx context.Context, opts browser.WaitForURLOptions) (browser.WaitForURLResult, error) {
+	if opts.Match == "" {
+		opts.Match = browser.URLMatchGlob
+	}
+	expr, err := browser.URLPatternRegex(opts.Pattern, opts.Match)
+	if err != nil {
+		return browser.WaitForURLResult{}, err
+	}
+	url := b.tab().URL
+	return browser.WaitForURLResult{Pattern: opts.Pattern, Match: opts.Match, TimeoutMs: opts.TimeoutMs, Matched: regexp.MustCompile(expr).MatchString(url), URL: url}, nil
+}
+
+// GetAttribute answers from the recorded element with exactly this selector.
+// Only the attributes the reducer keeps can be read.
+func (b *Browser) GetAttribute(ctx context.Context, selector, attribute string) (browser.AttributeResult, error) {
+	if selector == "" {
+		return browser.AttributeResult{}, errors.New("selector is required")
+	}
+	if attribute == "" {
+		return browser.AttributeResult{}, errors.New("attribute is required")
+	}
+	el, ok := b.element(ctx, selector)
+	if !ok {
+		return browser.AttributeResult{}, &browser.NotFoundError{Selector: selector}
+	}
+	out := browser.AttributeResult{Selector: selector, Attribute: attribute}
+	switch strings.ToLower(attribute) {
+	case "href":
+		out.Value = el.Href
+	case "type":
+		out.Value = el.InputType
+	case "name":
+		out.Value = el.Name
+	case "id":
+		out.Value = el.ID
+	case "aria-label":
+		out.Value = el.ARIALabel
+	case "title":
+		out.Value = el.Title
+	case "alt":
+		out.Value = el.Alt
+	case "value":
+		out.Value = el.Value
+	case "placeholder":
+		out.Value = el.Placeholder
+	}
+	out.Present = out.Value != ""
+	return out, nil
+}
+
+// GetText returns the recorded element's text as both inner text and text
+// content; a recording does not keep them apart.
+func (b *Browser) GetText(ctx context.Context, selector string) (browser.TextResult, error) {
+	if selector == "" {
+		return browser.TextResult{}, errors.New("selector is required")
+	}
+	el, ok := b.element(ctx, selector)
+	if !ok {
+		return browser.TextResult{}, &browser.NotFoundError{Selector: selector}
+	}
+	return browser.TextResult{Selector: selector, InnerText: el.Text, TextContent: el.Text}, nil
+}
+
+func (b *Browser) element(ctx context.Context, selector string) (page.Element, bool) {
+	snap, _ := b.Snapshot(ctx, browser.SnapshotOptions{})
+	for _, el := range snap.Elements {
+		if el.Selector == selector {
+			return el, true
+		}
+	}
+	return page.Element{}, false
+}
+
+// Find searches the reduced page text.
+func (b *Browser) Find(ctx context.Context, opts browser.FindOptions) (browser.FindResult, error) {
+	if opts.Text == "" {
+		return browser.FindResult{}, errors.New("text is required")
+	}
+	snap, _ := b.Snapshot(ctx, browser.SnapshotOptions{})
+	text, query := snap.Text, opts.Text
+	if !opts.CaseSensitive {
+		text, query = strings.ToLower(text), strings.ToLower(query)
+	}
+	out := browser.FindResult{Query: opts.Text, Limit: opts.Limit, Radius: opts.Radius, CaseSensitive: opts.CaseSensitive, Results: []browser.FindResultItem{}}
+	for from := 0; ; {
+		i := strings.Index(text[from:], query)
+		if i < 0 {
+			break
+		}
+		i += from
+		if i >= len(snap.Text) {
+			// Lowercasing lengthened the text; the rest cannot be mapped back.
+			break
+		}
+		out.Total++
+		if opts.Limit <= 0 || len(out.Results) < opts.Limit {
+			lo, hi := max(0, i-opts.Radius), min(len(snap.Text), i+len(query)+opts.Radius)
+			out.Results = append(out.Results, browser.FindResultItem{Index: i, Snippet: snap.Text[lo:hi]})
+		}
+		from = i + len(query)
+	}
+	out.Returned = len(out.Results)
+	return out, nil
+}
+
+func (b *Browser) Screenshot(ctx context.Context, opts browser.ScreenshotOptions) (browser.ScreenshotResult, error) {
+	return browser.ScreenshotResult{}, errors.New("replay: screenshots are not recorded")
+}
+
+func (b *Browser) Evaluate(context.Context, string) (browser.EvaluateResult, error) {
+	return browser.EvaluateResult{}, errors.New("replay: recorded pages cannot run scripts")
+}
+
+// StartRecording clears the recorded actions. Actions are always recorded,
+// so StopRecording only reports the count.
+func (b *Browser) StartRecording(ctx context.Context) (browser.RecordingStateResult, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.actions = nil
+	return browser.RecordingStateResult{Recording: true}, nil
+}
+
+func (b *Browser) StopRecording(ctx context.Context) (browser.RecordingStateResult, error) {
+	return browser.RecordingStateResult{Recording: true, Count: len(b.Actions())}, nil
+}
+
+func (b *Browser) GetRecording(ctx context.Context) ([]browser.RecordedAction, error) {
+	return b.Actions(), nil
+}
+
+// ListTabs reports the single replay tab.
+func (b *Browser) ListTabs(ctx context.Context) ([]browser.TabInfo, error) {
+	return []browser.TabInfo{b.tab()}, nil
+}
+
+func (b *Browser) tab() browser.TabInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cur := b.current()
+	return browser.TabInfo{ID: tabID, Title: cur.Title, URL: cur.URL}
+}
+
+func (b *Browser) OpenTab(ctx context.Context, opts browser.OpenTabOptions) (browser.TabInfo, error) {
+	return browser.TabInfo{}, errors.New("replay: the replay browser has a single tab; use browser.navigate")
+}
+
+func (b *Browser) CloseTab(ctx context.Context, tabID int) error {
+	b.record("close_tab", map[string]any{"tabId": tabID})
+	return nil
+}
+
+func (b *Browser) ClaimTab(ctx context.Context, opts browser.ClaimTabOptions) (browser.TabInfo, error) {
+	if opts.TabID != tabID {
+		return browser.TabInfo{}, fmt.Errorf("replay: no tab %d", opts.TabID)
+	}
+	return b.tab(), nil
+}
+
+func (b *Browser) ReleaseTab(ctx context.Context, tabID int) error {
+	return nil
+}
+
+func (b *Browser) SetTabSharing(ctx context.Context, tabID int, allowShared bool) error {
+	return nil
+}
+
+func (b *Browser) ClearStorage(ctx context.Context, opts browser.ClearStorageOptions) (browser.ClearStorageResult, error) {
+	if !opts.Cookies && !opts.LocalStorage && !opts.SessionStorage && !opts.Cache {
+		return browser.ClearStorageResult{}, errors.New("nothing to clear: set cookies, localStorage, sessionStorage or cache")
+	}
+	cleared := []string{}
+	for _, c := range []struct {
+		on   bool
+		name string
+	}{{opts.Cookies, "cookies"}, {opts.LocalStorage, "localStorage"}, {opts.SessionStorage, "sessionStorage"}, {opts.Cache, "cache"}} {
+		if c.on {
+			cleared = append(cleared, c.name)
+		}
+	}
+	b.record("clear_storage", map[string]any{"cleared": cleared})
+	return browser.ClearStorageResult{Origin: b.origin(), Cleared: cleared}, nil
+}
+
+// GetStorage reports empty storage; recorded pages carry none.
+func (b *Browser) GetStorage(ctx context.Context, opts browser.GetStorageOptions) (browser.StorageResult, error) {
+	if opts.Kind != browser.StorageLocal && opts.Kind != browser.StorageSession {
+		return browser.StorageResult{}, fmt.Errorf("invalid storage kind %q (want local or session)", opts.Kind)
+	}
+	return browser.StorageResult{Origin: b.origin(), Kind: opts.Kind, Items: []browser.StorageItem{}}, nil
+}
+
+func (b *Browser) SetStorage(ctx context.Context, opts browser.SetStorageOptions) (browser.SetStorageResult, error) {
+	if opts.Kind != browser.StorageLocal && opts.Kind != browser.StorageSession {
+		return browser.SetStorageResult{}, fmt.Errorf("invalid storage kind %q (want local or session)", opts.Kind)
+	}
+	if opts.Key == "" {
+		return browser.SetStorageResult{}, errors.New("key is required")
+	}
+	b.record("set_storage", map[string]any{"kind": opts.Kind, "key": opts.Key, "remove": opts.Remove})
+	return browser.SetStorageResult{Origin: b.origin(), Kind: opts.Kind, Key: opts.Key, Removed: opts.Remove}, nil
+}
+
+// origin is the scheme and host of the current page.
+func (b *Browser) origin() string {
+	origin := b.tab().URL
+	if u, err := neturl.Parse(origin); err == nil && u.Host != "" {
+		origin = u.Scheme + "://" + u.Host
+	}
+	return origin
+}
+
+var _ browser.Browser = (*Browser)(nil)
@@ -0,0 +1,111 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+)
+
+func writeFixtures(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestReplaySnapshotsFixtures(t *testing.T) {
+	dir := writeFixtures(t, map[string]string{
+		ManifestName: `{"pages": [
+			{"url": "https://shop.example/", "title": "Shop", "html": "home.html"},
+			{"url": "https://shop.example/cart", "page": "cart.json"}
+		]}`,
+		"home.html": `<html><body><h1>Welcome</h1><a id="cart" href="/cart">Cart</a><input name="q" placeholder="Search"></body></html>`,
+		"cart.json": `{"title": "Your cart", "text": "2 items", "elements": [{"tag": "button", "selector": "#checkout", "text": "Checkout"}]}`,
+	})
+	b, err := Load(dir, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	ctx := context.Background()
+
+	snap, err := b.Snapshot(ctx, browser.SnapshotOptions{})
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if snap.URL != "https://shop.example/" || snap.Title != "Shop" || !strings.Contains(snap.Text, "Welcome") || len(snap.Elements) != 2 || snap.Elements[0].Selector != "#cart" {
+		t.Fatalf("unexpected home snapshot %+v", snap)
+	}
+
+	if _, err := b.Click(ctx, "#cart"); err != nil {
+		t.Fatalf("click: %v", err)
+	}
+	if snap, _ := b.Snapshot(ctx, browser.SnapshotOptions{}); snap.URL != "https://shop.example/" {
+		t.Fatalf("expected a click to leave the page alone, got %s", snap.URL)
+	}
+	if _, err := b.Navigate(ctx, "https://shop.example/cart"); err != nil {
+		t.Fatalf("navigate: %v", err)
+	}
+	snap, _ = b.Snapshot(ctx, browser.SnapshotOptions{})
+	if snap.Title != "Your cart" || snap.Text != "2 items" || len(snap.Elements) != 1 || snap.Elements[0].Ref != "e1" {
+		t.Fatalf("unexpected cart snapshot %+v", snap)
+	}
+	if _, err := b.Navigate(ctx, "https://shop.example/missing"); err == nil {
+		t.Fatalf("expected an unrecorded URL to fail")
+	}
+	if res, _ := b.Back(ctx); res.Moved == nil || !*res.Moved || res.URL != "https://shop.example/" {
+		t.Fatalf("unexpected back %+v", res)
+	}
+	if res, _ := b.Back(ctx); res.Moved == nil || *res.Moved {
+		t.Fatalf("expected back from the first page not to move")
+	}
+	if res, _ := b.Reload(ctx, browser.ReloadOptions{}); res.Moved == nil || !*res.Moved || res.URL != "https://shop.example/" || res.Title != "Shop" {
+		t.Fatalf("expected reload to stay on the home page, got %+v", res)
+	}
+	if h, _ := b.History(ctx); !h.Complete || h.Index != 0 || len(h.Entries) != 2 || h.Entries[1].URL != "https://shop.example/cart" {
+		t.Fatalf("unexpected history %+v", h)
+	}
+
+	if text, err := b.GetText(ctx, "#cart"); err != nil || text.InnerText != "Cart" {
+		t.Fatalf("unexpected text %+v (%v)", text, err)
+	}
+	if attr, err := b.GetAttribute(ctx, "#cart", "href"); err != nil || !attr.Present || !strings.HasSuffix(attr.Value, "/cart") {
+		t.Fatalf("unexpected attribute %+v (%v)", attr, err)
+	}
+	var nf *browser.NotFoundError
+	if _, err := b.GetText(ctx, "#nope"); !errors.As(err, &nf) {
+		t.Fatalf("expected not_found for a missing selector, got %v", err)
+	}
+
+	actions := b.Actions()
+	if len(actions) != 1 || actions[0].Type != "click" || actions[0].Payload["selector"] != "#cart" || actions[0].URL != "https://shop.example/" {
+		t.Fatalf("expected the click to be recorded, got %+v", actions)
+	}
+}
+
+func TestReplayLoadErrors(t *testing.T) {
+	if _, err := Load(t.TempDir(), nil); err == nil {
+		t.Fatalf("expected a directory without a manifest to fail")
+	}
+	dir := writeFixtures(t, map[string]string{
+		ManifestName: `{"start": "https://other.example/", "pages": [{"url": "https://a.example/", "html": "a.html"}]}`,
+		"a.html":     `<p>a</p>`,
+	})
+	if _, err := Load(dir, nil); err == nil || !strings.Contains(err.Error(), "start") {
+		t.Fatalf("expected an unknown start page to fail, got %v", err)
+	}
+	dir = writeFixtures(t, map[string]string{
+		ManifestName: `{"pages": [{"url": "https://a.example/", "html": "a.html", "page": "a.json"}]}`,
+	})
+	if _, err := Load(dir, nil); err == nil {
+		t.Fatalf("expected a page with both html and page to fail")
+	}
+}
@@ -0,0 +1,23 @@
+package browser
+
+import (
+	"context"
+	"time"
+)
+
+type timeoutKey struct{}
+
+// WithTimeout overrides how long a Browser implementation waits for the
+// command made with ctx. Zero or negative leaves ctx unchanged.
+func WithTimeout(ctx context.Context, d time.Duration) context.Context {
+	if d <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, timeoutKey{}, d)
+}
+
+// TimeoutFromContext returns the override set by WithTimeout.
+func TimeoutFromContext(ctx context.Context) (time.Duration, bool) {
+	d, ok := ctx.Value(timeoutKey{}).(time.Duration)
+	return d, ok
+}
@@ -0,0 +1,59 @@
+package browser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// URL pattern kinds for WaitForURLOptions.Match. The empty kind means
+// URLMatchGlob.
+const (
+	URLMatchGlob  = "glob"
+	URLMatchRegex = "regex"
+)
+
+// URLPatternRegex returns the regular expression a URL must match for
+// pattern. Globs match the whole URL: "**" matches any run of characters,
+// "*" any run without a "/", and "?" one character other than "/". A regex
+// may match anywhere in the URL and must pass CheckRegex, since the
+// extension does the matching.
+func URLPatternRegex(pattern, match string) (string, error) {
+	if pattern == "" {
+		return "", errors.New("pattern is required")
+	}
+	switch match {
+	case "", URLMatchGlob:
+		return globRegex(pattern), nil
+	case URLMatchRegex:
+		if err := CheckRegex(pattern); err != nil {
+			return "", fmt.Errorf("invalid regex: %w", err)
+		}
+		return pattern, nil
+	default:
+		return "", fmt.Errorf("invalid match %q (want glob or regex)", match)
+	}
+}
+
+func globRegex(glob string) string {
+	var b strings.Builder
+	b.WriteByte('^')
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteByte('$')
+	return b.String()
+}
@@ -0,0 +1,38 @@
+package browser
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestURLPatternRegex(t *testing.T) {
+	cases := []struct {
+		pattern, match, url string
+		want                bool
+	}{
+		{"**/success", "", "https://shop.example/checkout/success", true},
+		{"**/success", "glob", "https://shop.example/checkout/success?order=1", false},
+		{"https://shop.example/*/success", "glob", "https://shop.example/checkout/success", true},
+		{"https://shop.example/*/success", "glob", "https://shop.example/a/b/success", false},
+		{"https://shop.example/step?", "glob", "https://shop.example/step2", true},
+		{"**/order.html", "glob", "https://shop.example/orderxhtml", false},
+		{"**/café", "glob", "https://shop.example/café", true},
+		{`/orders/\d+$`, "regex", "https://shop.example/orders/42", true},
+		{`/orders/\d+$`, "regex", "https://shop.example/orders/new", false},
+	}
+	for _, tc := range cases {
+		expr, err := URLPatternRegex(tc.pattern, tc.match)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.pattern, err)
+		}
+		if got := regexp.MustCompile(expr).MatchString(tc.url); got != tc.want {
+			t.Fatalf("%q (%s) against %q: got %v, want %v", tc.pattern, expr, tc.url, got, tc.want)
+		}
+	}
+
+	for _, bad := range [][2]string{{"", "glob"}, {"(", "regex"}, {"(?i)/orders", "regex"}, {`/orders\z`, "regex"}, {"**", "prefix"}} {
+		if _, err := URLPatternRegex(bad[0], bad[1]); err == nil {
+			t.Fatalf("expected %q (%s) to be rejected", bad[0], bad[1])
+		}
+	}
+}
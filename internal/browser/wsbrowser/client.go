@@ -1,20 +1,30 @@
 package wsbrowser
 
 import (
+	"bytes"
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 
 	"github.com/adityalohuni/mcp-server/internal/browser"
 	"github.com/adityalohuni/mcp-server/internal/page"
-	"github.com/adityalohuni/mcp-server/internal/protocol"
+	"github.com/adityalohuni/mcp-server/internal/traceid"
 	"github.com/adityalohuni/mcp-server/internal/wsbridge"
+	"github.com/adityalohuni/mcp-server/protocol"
 )
 
+// waitMargin is added to a waitForSelector or waitForUrl timeout to cover
+// the round trip.
+const waitMargin = 2 * time.Second
+
 type Options struct {
 	Timeout time.Duration
 }
@@ -50,15 +60,20 @@ func (c *Client) Click(ctx context.Context, selector string) (browser.ClickResul
 		return browser.ClickResult{}, errors.New("selector is required")
 	}
 	if err := c.sendAction(ctx, protocol.CommandClick, protocol.ClickPayload{Selector: selector}); err != nil {
-		return browser.ClickResult{}, err
+		return browser.ClickResult{}, withSelector(err, selector)
 	}
 	return browser.ClickResult{Status: "ok", Selector: selector}, nil
 }
 
 func (c *Client) Snapshot(ctx context.Context, opts browser.SnapshotOptions) (page.Snapshot, error) {
-	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	ctx, cancel := context.WithTimeout(ctx, c.commandTimeout(ctx))
 	defer cancel()
 
+	reducer := c.reducer
+	if opts.Reducer != nil {
+		reducer = opts.Reducer
+	}
+
 	payload, err := json.Marshal(protocol.SnapshotPayload{
 		IncludeHidden: opts.IncludeHidden,
 		MaxElements:   opts.MaxElements,
@@ -66,11 +81,13 @@ func (c *Client) Snapshot(ctx context.Context, opts browser.SnapshotOptions) (pa
 		IncludeHTML:   opts.IncludeHTML,
 		MaxHTML:       opts.MaxHTML,
 		MaxHTMLTokens: opts.MaxHTMLTokens,
+		IncludeValues: opts.IncludeValues || reducer.IncludesValues(),
 	})
 	if err != nil {
 		return page.Snapshot{}, err
 	}
 
+	sent := time.Now()
 	resp, err := c.bridge.SendCommand(ctx, c.makeCommand(ctx, protocol.CommandSnapshot, payload))
 	if err != nil {
 		return page.Snapshot{}, err
@@ -78,6 +95,7 @@ func (c *Client) Snapshot(ctx context.Context, opts browser.SnapshotOptions) (pa
 	if !resp.OK {
 		return page.Snapshot{}, errors.New(resp.Error)
 	}
+	roundTrip := time.Since(sent)
 
 	var data protocol.SnapshotData
 	if err := json.Unmarshal(resp.Data, &data); err != nil {
@@ -92,7 +110,10 @@ func (c *Client) Snapshot(ctx context.Context, opts browser.SnapshotOptions) (pa
 		Elements: mapElements(data.Elements),
 	}
 
-	snapshot := c.reducer.Reduce(raw)
+	snapshot := reducer.Reduce(raw)
+	if snapshot.Debug != nil {
+		snapshot.Debug.ExtensionMs = float64(roundTrip.Microseconds()) / 1000
+	}
 	if snapshot.ID == "" {
 		snapshot.ID = c.store.Put(snapshot)
 	}
@@ -123,7 +144,7 @@ func (c *Client) Hover(ctx context.Context, selector string) (browser.HoverResul
 	}
 	resp, err := c.sendActionWithData(ctx, protocol.CommandHover, protocol.HoverPayload{Selector: selector})
 	if err != nil {
-		return browser.HoverResult{}, err
+		return browser.HoverResult{}, withSelector(err, selector)
 	}
 	var out browser.HoverResult
 	if err := decodeResponse(resp, &out); err != nil {
@@ -132,17 +153,18 @@ func (c *Client) Hover(ctx context.Context, selector string) (browser.HoverResul
 	return out, nil
 }
 
-func (c *Client) Type(ctx context.Context, selector string, text string, pressEnter bool) (browser.TypeResult, error) {
-	if selector == "" {
+func (c *Client) Type(ctx context.Context, opts browser.TypeOptions) (browser.TypeResult, error) {
+	if opts.Selector == "" {
 		return browser.TypeResult{}, errors.New("selector is required")
 	}
 	resp, err := c.sendActionWithData(ctx, protocol.CommandTypeText, protocol.TypePayload{
-		Selector:   selector,
-		Text:       text,
-		PressEnter: pressEnter,
+		Selector:         opts.Selector,
+		Text:             opts.Text,
+		PressEnter:       opts.PressEnter,
+		ReportValidation: opts.ReportValidation,
 	})
 	if err != nil {
-		return browser.TypeResult{}, err
+		return browser.TypeResult{}, withSelector(err, opts.Selector)
 	}
 	var out browser.TypeResult
 	if err := decodeResponse(resp, &out); err != nil {
@@ -154,7 +176,7 @@ func (c *Client) Type(ctx context.Context, selector string, text string, pressEn
 func (c *Client) Enter(ctx context.Context, selector string, key string) (browser.EnterResult, error) {
 	resp, err := c.sendActionWithData(ctx, protocol.CommandEnter, protocol.EnterPayload{Selector: selector, Key: key})
 	if err != nil {
-		return browser.EnterResult{}, err
+		return browser.EnterResult{}, withSelector(err, selector)
 	}
 	var out browser.EnterResult
 	if err := decodeResponse(resp, &out); err != nil {
@@ -163,35 +185,166 @@ func (c *Client) Enter(ctx context.Context, selector string, key string) (browse
 	return out, nil
 }
 
-func (c *Client) Back(ctx context.Context) (browser.HistoryResult, error) {
-	resp, err := c.sendActionWithData(ctx, protocol.CommandBack, struct{}{})
+// PressKeys sends the chords in one command. When the extension stops
+// partway, the result lists what it dispatched alongside an error naming the
+// first chord left out.
+func (c *Client) PressKeys(ctx context.Context, selector string, chords []browser.KeyChord) (browser.PressKeysResult, error) {
+	if len(chords) == 0 {
+		return browser.PressKeysResult{}, errors.New("keys is required")
+	}
+	keys := make([]string, len(chords))
+	for i, chord := range chords {
+		keys[i] = chord.String()
+	}
+	resp, err := c.sendActionWithData(ctx, protocol.CommandPressKeys, protocol.PressKeysPayload{Selector: selector, Keys: keys})
 	if err != nil {
-		return browser.HistoryResult{}, err
+		return browser.PressKeysResult{}, withSelector(err, selector)
 	}
-	var out browser.HistoryResult
-	if err := decodeResponse(resp, &out); err != nil {
-		return browser.HistoryResult{}, err
+	var data protocol.PressKeysData
+	if err := decodeResponse(resp, &data); err != nil {
+		return browser.PressKeysResult{}, err
+	}
+	out := browser.PressKeysResult{Selector: selector, Dispatched: data.Dispatched, UsedActiveElement: data.UsedActiveElement || selector == ""}
+	if out.Dispatched == nil {
+		// Extensions that do not report progress dispatch everything or fail.
+		out.Dispatched = keys
+	}
+	if n := len(out.Dispatched); n < len(keys) {
+		return out, fmt.Errorf("dispatched %d of %d key chords; stopped before %q", n, len(keys), keys[n])
 	}
 	return out, nil
 }
 
+func (c *Client) Back(ctx context.Context) (browser.HistoryResult, error) {
+	return c.history(ctx, protocol.CommandBack, "back")
+}
+
 func (c *Client) Forward(ctx context.Context) (browser.HistoryResult, error) {
-	resp, err := c.sendActionWithData(ctx, protocol.CommandForward, struct{}{})
+	return c.history(ctx, protocol.CommandForward, "forward")
+}
+
+// history runs back or forward. When the extension does not say whether the
+// page moved, it is worked out from the URLs before and after, or else left
+// unknown.
+func (c *Client) history(ctx context.Context, cmdType protocol.CommandType, direction string) (browser.HistoryResult, error) {
+	resp, err := c.sendActionWithData(ctx, cmdType, struct{}{})
 	if err != nil {
 		return browser.HistoryResult{}, err
 	}
-	var out browser.HistoryResult
-	if err := decodeResponse(resp, &out); err != nil {
+	var data protocol.HistoryData
+	if err := decodeResponse(resp, &data); err != nil {
 		return browser.HistoryResult{}, err
 	}
+	out := browser.HistoryResult{Direction: data.Direction, NavigationState: browser.NavigationState{URL: data.URL, Title: data.Title}}
+	if out.Direction == "" {
+		out.Direction = direction
+	}
+	out.Moved = data.Moved
+	if out.Moved == nil && data.URL != "" && data.PreviousURL != "" {
+		moved := data.URL != data.PreviousURL
+		out.Moved = &moved
+	}
+	c.fillLocation(ctx, &out.NavigationState)
 	return out, nil
 }
 
-func (c *Client) WaitForSelector(ctx context.Context, selector string, timeoutMs int) (browser.WaitForSelectorResult, error) {
-	if selector == "" {
+// fillLocation asks for the current page when the extension left the URL
+// out of a navigation answer, so results always carry one. Failing that,
+// the state is left as it was.
+func (c *Client) fillLocation(ctx context.Context, state *browser.NavigationState) {
+	if state.URL != "" {
+		return
+	}
+	list, err := c.History(ctx)
+	if err != nil || list.Index < 0 || list.Index >= len(list.Entries) {
+		return
+	}
+	current := list.Entries[list.Index]
+	state.URL = current.URL
+	if state.Title == "" {
+		state.Title = current.Title
+	}
+}
+
+func (c *Client) History(ctx context.Context) (browser.HistoryList, error) {
+	resp, err := c.sendActionWithData(ctx, protocol.CommandGetHistory, struct{}{})
+	if err != nil {
+		return browser.HistoryList{}, err
+	}
+	var data protocol.HistoryListData
+	if err := decodeResponse(resp, &data); err != nil {
+		return browser.HistoryList{}, err
+	}
+	return historyList(data), nil
+}
+
+// historyList normalizes the extension's history. Without entries the list
+// holds the current page only. Without an index the current page is the
+// entry flagged current, else the last entry with the current URL, else the
+// last entry.
+func historyList(data protocol.HistoryListData) browser.HistoryList {
+	if len(data.Entries) == 0 {
+		out := browser.HistoryList{Entries: []browser.HistoryEntry{}, Length: data.Length}
+		if data.URL != "" {
+			out.Entries = append(out.Entries, browser.HistoryEntry{URL: data.URL, Title: data.Title})
+		}
+		return out
+	}
+	out := browser.HistoryList{
+		Entries:  make([]browser.HistoryEntry, len(data.Entries)),
+		Index:    -1,
+		Length:   len(data.Entries),
+		Complete: data.Length == 0 || data.Length == len(data.Entries),
+	}
+	if !out.Complete {
+		out.Length = data.Length
+	}
+	for i, e := range data.Entries {
+		out.Entries[i] = browser.HistoryEntry{URL: e.URL, Title: e.Title}
+		if e.Current {
+			out.Index = i
+		}
+	}
+	switch {
+	case data.Index != nil && *data.Index >= 0 && *data.Index < len(data.Entries):
+		out.Index = *data.Index
+	case out.Index >= 0:
+	default:
+		out.Index = len(data.Entries) - 1
+		for i := len(data.Entries) - 1; i >= 0; i-- {
+			if data.URL != "" && data.Entries[i].URL == data.URL {
+				out.Index = i
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (c *Client) WaitForSelector(ctx context.Context, opts browser.WaitForSelectorOptions) (browser.WaitForSelectorResult, error) {
+	if opts.Selector == "" {
 		return browser.WaitForSelectorResult{}, errors.New("selector is required")
 	}
-	resp, err := c.sendActionWithData(ctx, protocol.CommandWaitFor, protocol.WaitForSelectorPayload{Selector: selector, TimeoutMs: timeoutMs})
+	switch opts.State {
+	case "", browser.WaitAttached, browser.WaitVisible:
+	case browser.WaitHidden, browser.WaitDetached:
+		if opts.ContainsText != "" {
+			return browser.WaitForSelectorResult{}, fmt.Errorf("containsText cannot be combined with state %q", opts.State)
+		}
+	default:
+		return browser.WaitForSelectorResult{}, fmt.Errorf("invalid state %q (want attached, visible, hidden or detached)", opts.State)
+	}
+	// The extension waits up to TimeoutMs, so give the round trip that long
+	// plus a margin rather than cutting the wait short.
+	if wait := time.Duration(opts.TimeoutMs)*time.Millisecond + waitMargin; wait > c.commandTimeout(ctx) {
+		ctx = browser.WithTimeout(ctx, wait)
+	}
+	resp, err := c.sendActionWithData(ctx, protocol.CommandWaitFor, protocol.WaitForSelectorPayload{
+		Selector:     opts.Selector,
+		TimeoutMs:    opts.TimeoutMs,
+		State:        opts.State,
+		ContainsText: opts.ContainsText,
+	})
 	if err != nil {
 		return browser.WaitForSelectorResult{}, err
 	}
@@ -202,15 +355,43 @@ func (c *Client) WaitForSelector(ctx context.Context, selector string, timeoutMs
 	return out, nil
 }
 
-func (c *Client) Find(ctx context.Context, text string, limit int, radius int, caseSensitive bool) (browser.FindResult, error) {
-	if text == "" {
+func (c *Client) WaitForURL(ctx context.Context, opts browser.WaitForURLOptions) (browser.WaitForURLResult, error) {
+	if opts.Match == "" {
+		opts.Match = browser.URLMatchGlob
+	}
+	regex, err := browser.URLPatternRegex(opts.Pattern, opts.Match)
+	if err != nil {
+		return browser.WaitForURLResult{}, err
+	}
+	if wait := time.Duration(opts.TimeoutMs)*time.Millisecond + waitMargin; wait > c.commandTimeout(ctx) {
+		ctx = browser.WithTimeout(ctx, wait)
+	}
+	resp, err := c.sendActionWithData(ctx, protocol.CommandWaitForURL, protocol.WaitForURLPayload{
+		Pattern:   opts.Pattern,
+		Match:     opts.Match,
+		Regex:     regex,
+		TimeoutMs: opts.TimeoutMs,
+	})
+	if err != nil {
+		return browser.WaitForURLResult{}, err
+	}
+	var data protocol.WaitForURLData
+	if err := decodeResponse(resp, &data); err != nil {
+		return browser.WaitForURLResult{}, err
+	}
+	return browser.WaitForURLResult{Pattern: opts.Pattern, Match: opts.Match, TimeoutMs: opts.TimeoutMs, Matched: data.Matched, URL: data.URL}, nil
+}
+
+func (c *Client) Find(ctx context.Context, opts browser.FindOptions) (browser.FindResult, error) {
+	if opts.Text == "" {
 		return browser.FindResult{}, errors.New("text is required")
 	}
 	resp, err := c.sendActionWithData(ctx, protocol.CommandFind, protocol.FindPayload{
-		Text:          text,
-		Limit:         limit,
-		Radius:        radius,
-		CaseSensitive: caseSensitive,
+		Text:             opts.Text,
+		Limit:            opts.Limit,
+		Radius:           opts.Radius,
+		CaseSensitive:    opts.CaseSensitive,
+		IncludePositions: opts.IncludePositions,
 	})
 	if err != nil {
 		return browser.FindResult{}, err
@@ -230,10 +411,43 @@ func (c *Client) Navigate(ctx context.Context, url string) (browser.NavigateResu
 	if err != nil {
 		return browser.NavigateResult{}, err
 	}
-	var out browser.NavigateResult
-	if err := decodeResponse(resp, &out); err != nil {
+	return c.navigateResult(ctx, resp, url)
+}
+
+func (c *Client) Reload(ctx context.Context, opts browser.ReloadOptions) (browser.NavigateResult, error) {
+	resp, err := c.sendActionWithData(ctx, protocol.CommandReload, protocol.ReloadPayload{BypassCache: opts.BypassCache})
+	if err != nil {
+		return browser.NavigateResult{}, err
+	}
+	return c.navigateResult(ctx, resp, "")
+}
+
+// navigateResult decodes the answer to navigate or reload. Without a URL in
+// the answer, requested (the URL navigated to) stands in for it, or else the
+// current page is looked up.
+func (c *Client) navigateResult(ctx context.Context, resp protocol.Response, requested string) (browser.NavigateResult, error) {
+	var data protocol.NavigateData
+	if err := decodeResponse(resp, &data); err != nil {
 		return browser.NavigateResult{}, err
 	}
+	moved := true
+	out := browser.NavigateResult{NavigationState: browser.NavigationState{URL: cmp.Or(data.URL, requested), Title: data.Title, Moved: &moved}}
+	c.fillLocation(ctx, &out.NavigationState)
+	if data.StatusCode <= 0 {
+		return out, nil
+	}
+	out.StatusCode = data.StatusCode
+	out.StatusText = data.StatusText
+	for name, value := range data.Headers {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !slices.Contains(browser.NavigateHeaders, name) {
+			continue
+		}
+		if out.Headers == nil {
+			out.Headers = map[string]string{}
+		}
+		out.Headers[name] = value
+	}
 	return out, nil
 }
 
@@ -241,19 +455,26 @@ func (c *Client) Select(ctx context.Context, opts browser.SelectOptions) (browse
 	if opts.Selector == "" {
 		return browser.SelectResult{}, errors.New("selector is required")
 	}
+	if opts.LabelRegex != "" {
+		if err := browser.CheckRegex(opts.LabelRegex); err != nil {
+			return browser.SelectResult{}, fmt.Errorf("invalid labelRegex: %w", err)
+		}
+	}
 	resp, err := c.sendActionWithData(ctx, protocol.CommandSelect, protocol.SelectPayload{
-		Selector:  opts.Selector,
-		Value:     opts.Value,
-		Label:     opts.Label,
-		Index:     opts.Index,
-		Values:    opts.Values,
-		Labels:    opts.Labels,
-		Indices:   opts.Indices,
-		MatchMode: opts.MatchMode,
-		Toggle:    opts.Toggle,
+		Selector:   opts.Selector,
+		Value:      opts.Value,
+		Label:      opts.Label,
+		Index:      opts.Index,
+		Values:     opts.Values,
+		Labels:     opts.Labels,
+		Indices:    opts.Indices,
+		MatchMode:  opts.MatchMode,
+		LabelRegex: opts.LabelRegex,
+		Toggle:     opts.Toggle,
+		BlurAfter:  opts.BlurAfter,
 	})
 	if err != nil {
-		return browser.SelectResult{}, err
+		return browser.SelectResult{}, withSelector(err, opts.Selector)
 	}
 	var out browser.SelectResult
 	if err := decodeResponse(resp, &out); err != nil {
@@ -270,6 +491,7 @@ func (c *Client) Screenshot(ctx context.Context, opts browser.ScreenshotOptions)
 		Quality:   opts.Quality,
 		MaxWidth:  opts.MaxWidth,
 		MaxHeight: opts.MaxHeight,
+		Annotate:  opts.Annotate,
 	})
 	if err != nil {
 		return browser.ScreenshotResult{}, err
@@ -314,9 +536,23 @@ func (c *Client) GetRecording(ctx context.Context) ([]browser.RecordedAction, er
 	if err := decodeResponse(resp, &out); err != nil {
 		return nil, err
 	}
+	if sequenced(out) {
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Seq < out[j].Seq })
+	}
 	return out, nil
 }
 
+// sequenced reports whether every action carries a sequence number, in which
+// case they can be put in send order. Otherwise the extension's order stands.
+func sequenced(actions []browser.RecordedAction) bool {
+	for _, a := range actions {
+		if a.Seq == 0 {
+			return false
+		}
+	}
+	return len(actions) > 0
+}
+
 func (c *Client) ListTabs(ctx context.Context) ([]browser.TabInfo, error) {
 	resp, err := c.sendActionWithData(ctx, protocol.CommandListTabs, struct{}{})
 	if err != nil {
@@ -379,6 +615,271 @@ func (c *Client) SetTabSharing(ctx context.Context, tabID int, allowShared bool)
 	return err
 }
 
+func (c *Client) ClearStorage(ctx context.Context, opts browser.ClearStorageOptions) (browser.ClearStorageResult, error) {
+	if !opts.Cookies && !opts.LocalStorage && !opts.SessionStorage && !opts.Cache {
+		return browser.ClearStorageResult{}, errors.New("nothing to clear: set cookies, localStorage, sessionStorage or cache")
+	}
+	resp, err := c.sendActionWithData(ctx, protocol.CommandClearStorage, protocol.ClearStoragePayload{
+		Cookies:        opts.Cookies,
+		LocalStorage:   opts.LocalStorage,
+		SessionStorage: opts.SessionStorage,
+		Cache:          opts.Cache,
+	})
+	if err != nil {
+		return browser.ClearStorageResult{}, err
+	}
+	var out browser.ClearStorageResult
+	if err := decodeResponse(resp, &out); err != nil {
+		return browser.ClearStorageResult{}, err
+	}
+	if out.Cleared == nil {
+		out.Cleared = []string{}
+	}
+	return out, nil
+}
+
+// GetStorage reads the target tab's storage. Items are sorted by key and, when
+// opts.MaxBytes is set, cut to fit it even if the extension sent more.
+func (c *Client) GetStorage(ctx context.Context, opts browser.GetStorageOptions) (browser.StorageResult, error) {
+	if err := validStorageKind(opts.Kind); err != nil {
+		return browser.StorageResult{}, err
+	}
+	resp, err := c.sendActionWithData(ctx, protocol.CommandGetStorage, protocol.GetStoragePayload{
+		Kind:     opts.Kind,
+		Key:      opts.Key,
+		MaxBytes: opts.MaxBytes,
+	})
+	if err != nil {
+		return browser.StorageResult{}, err
+	}
+	var data protocol.StorageData
+	if err := decodeResponse(resp, &data); err != nil {
+		return browser.StorageResult{}, err
+	}
+	out := browser.StorageResult{
+		Origin:    data.Origin,
+		Kind:      opts.Kind,
+		Items:     make([]browser.StorageItem, 0, len(data.Items)),
+		Count:     max(data.Count, len(data.Items)),
+		Truncated: data.Truncated,
+	}
+	if opts.Key != "" {
+		for _, item := range data.Items {
+			if item.Key == opts.Key {
+				out.Items = append(out.Items, browser.StorageItem{Key: item.Key, Value: item.Value})
+				out.Found = true
+				break
+			}
+		}
+	} else {
+		for _, item := range data.Items {
+			out.Items = append(out.Items, browser.StorageItem{Key: item.Key, Value: item.Value})
+		}
+		sort.Slice(out.Items, func(i, j int) bool { return out.Items[i].Key < out.Items[j].Key })
+	}
+	if opts.MaxBytes > 0 {
+		capStorage(&out, opts.MaxBytes)
+	}
+	return out, nil
+}
+
+// capStorage drops the items past limit bytes of keys and values. A single
+// item over the limit on its own keeps its key and the start of its value.
+func capStorage(out *browser.StorageResult, limit int) {
+	used := 0
+	for i, item := range out.Items {
+		size := len(item.Key) + len(item.Value)
+		if used+size <= limit {
+			used += size
+			continue
+		}
+		out.Truncated = true
+		if i == 0 {
+			out.Items[0].Value = page.TruncateUTF8(item.Value, max(limit-len(item.Key), 0))
+			out.Items[0].Truncated = true
+			i = 1
+		}
+		out.Items = out.Items[:i]
+		return
+	}
+}
+
+func (c *Client) SetStorage(ctx context.Context, opts browser.SetStorageOptions) (browser.SetStorageResult, error) {
+	if err := validStorageKind(opts.Kind); err != nil {
+		return browser.SetStorageResult{}, err
+	}
+	if opts.Key == "" {
+		return browser.SetStorageResult{}, errors.New("key is required")
+	}
+	resp, err := c.sendActionWithData(ctx, protocol.CommandSetStorage, protocol.SetStoragePayload{
+		Kind:   opts.Kind,
+		Key:    opts.Key,
+		Value:  opts.Value,
+		Remove: opts.Remove,
+	})
+	if err != nil {
+		return browser.SetStorageResult{}, err
+	}
+	var data protocol.SetStorageData
+	if err := decodeResponse(resp, &data); err != nil {
+		return browser.SetStorageResult{}, err
+	}
+	return browser.SetStorageResult{Origin: data.Origin, Kind: opts.Kind, Key: opts.Key, Removed: opts.Remove, Existed: data.Existed}, nil
+}
+
+func validStorageKind(kind string) error {
+	switch kind {
+	case browser.StorageLocal, browser.StorageSession:
+		return nil
+	}
+	return fmt.Errorf("invalid storage kind %q (want local or session)", kind)
+}
+
+// Evaluate runs script in the target tab. An exception in the page is
+// returned as an error alongside the result that reported it.
+func (c *Client) Evaluate(ctx context.Context, script string) (browser.EvaluateResult, error) {
+	if strings.TrimSpace(script) == "" {
+		return browser.EvaluateResult{}, errors.New("script is required")
+	}
+	resp, err := c.sendActionWithData(ctx, protocol.CommandEvaluate, protocol.EvaluatePayload{Script: script})
+	if err != nil {
+		return browser.EvaluateResult{}, err
+	}
+	var out browser.EvaluateResult
+	if err := decodeResponse(resp, &out); err != nil {
+		return browser.EvaluateResult{}, err
+	}
+	if out.Error != "" {
+		return out, fmt.Errorf("script threw: %s", out.Error)
+	}
+	if out.Type == "" {
+		out.Type = valueType(out.Value)
+	}
+	return out, nil
+}
+
+func (c *Client) GetAttribute(ctx context.Context, selector, attribute string) (browser.AttributeResult, error) {
+	if selector == "" {
+		return browser.AttributeResult{}, errors.New("selector is required")
+	}
+	if attribute == "" {
+		return browser.AttributeResult{}, errors.New("attribute is required")
+	}
+	resp, err := c.sendActionWithData(ctx, protocol.CommandGetAttribute, protocol.GetAttributePayload{Selector: selector, Attribute: attribute})
+	if err != nil {
+		return browser.AttributeResult{}, withSelector(err, selector)
+	}
+	out := browser.AttributeResult{Selector: selector, Attribute: attribute}
+	if err := decodeResponse(resp, &out); err != nil {
+		return browser.AttributeResult{}, err
+	}
+	return out, nil
+}
+
+func (c *Client) GetText(ctx context.Context, selector string) (browser.TextResult, error) {
+	if selector == "" {
+		return browser.TextResult{}, errors.New("selector is required")
+	}
+	resp, err := c.sendActionWithData(ctx, protocol.CommandGetText, protocol.GetTextPayload{Selector: selector})
+	if err != nil {
+		return browser.TextResult{}, withSelector(err, selector)
+	}
+	out := browser.TextResult{Selector: selector}
+	if err := decodeResponse(resp, &out); err != nil {
+		return browser.TextResult{}, err
+	}
+	return out, nil
+}
+
+// FillForm fills fields in one command. The result has an entry for every
+// field; any the extension did not report on are marked failed.
+func (c *Client) FillForm(ctx context.Context, fields []browser.FillFormField) (browser.FillFormResult, error) {
+	if len(fields) == 0 {
+		return browser.FillFormResult{}, errors.New("fields is required")
+	}
+	payload := protocol.FillFormPayload{Fields: make([]protocol.FillFormField, 0, len(fields))}
+	for i, f := range fields {
+		if f.Selector == "" {
+			return browser.FillFormResult{}, fmt.Errorf("fields[%d]: selector is required", i)
+		}
+		payload.Fields = append(payload.Fields, protocol.FillFormField{Selector: f.Selector, Value: f.Value, PressEnter: f.PressEnter})
+	}
+	resp, err := c.sendActionWithData(ctx, protocol.CommandFillForm, payload)
+	if err != nil {
+		return browser.FillFormResult{}, err
+	}
+	var reply protocol.FillFormResult
+	if err := decodeResponse(resp, &reply); err != nil {
+		return browser.FillFormResult{}, err
+	}
+	out := browser.FillFormResult{Fields: make([]browser.FillFieldResult, 0, len(fields))}
+	for i, f := range fields {
+		if i >= len(reply.Fields) {
+			out.Fields = append(out.Fields, browser.FillFieldResult{Selector: f.Selector, Error: "no result from the extension"})
+			continue
+		}
+		r := reply.Fields[i]
+		out.Fields = append(out.Fields, browser.FillFieldResult{Selector: f.Selector, OK: r.OK, Error: r.Error, ErrorCode: r.ErrorCode})
+	}
+	out.Count()
+	return out, nil
+}
+
+// SetChecked checks or unchecks selector and fails if the element does not
+// end up in the requested state.
+func (c *Client) SetChecked(ctx context.Context, selector string, checked bool) (browser.CheckedResult, error) {
+	if selector == "" {
+		return browser.CheckedResult{}, errors.New("selector is required")
+	}
+	resp, err := c.sendActionWithData(ctx, protocol.CommandSetChecked, protocol.SetCheckedPayload{Selector: selector, Checked: checked})
+	if err != nil {
+		return browser.CheckedResult{}, withSelector(err, selector)
+	}
+	out := browser.CheckedResult{Selector: selector}
+	if err := decodeResponse(resp, &out); err != nil {
+		return browser.CheckedResult{}, err
+	}
+	if out.Checked != checked {
+		return out, fmt.Errorf("%s is still %s; a script on the page may have reverted it", selector, checkedState(out.Checked))
+	}
+	return out, nil
+}
+
+func checkedState(checked bool) string {
+	if checked {
+		return "checked"
+	}
+	return "unchecked"
+}
+
+// withSelector names selector in a not_found error from the extension.
+func withSelector(err error, selector string) error {
+	var nf *browser.NotFoundError
+	if errors.As(err, &nf) && nf.Selector == "" {
+		nf.Selector = selector
+	}
+	return err
+}
+
+// valueType guesses the typeof of a JSON value for extensions that do not
+// report it. null is an object, as in JavaScript.
+func valueType(v json.RawMessage) string {
+	v = bytes.TrimSpace(v)
+	if len(v) == 0 {
+		return browser.EvaluateUndefined
+	}
+	switch v[0] {
+	case '"':
+		return browser.EvaluateString
+	case 't', 'f':
+		return browser.EvaluateBoolean
+	case '{', '[', 'n':
+		return browser.EvaluateObject
+	default:
+		return browser.EvaluateNumber
+	}
+}
+
 func mapElements(in []protocol.Element) []page.Element {
 	if len(in) == 0 {
 		return nil
@@ -399,29 +900,47 @@ func mapElements(in []protocol.Element) []page.Element {
 			Value:       el.Value,
 			Placeholder: el.Placeholder,
 			Context:     el.Context,
+			Disabled:    el.Disabled,
+			Visible:     el.Visible,
 		})
 	}
 	return out
 }
 
+// commandTimeout is the per-call override from browser.WithTimeout, or the
+// client default.
+func (c *Client) commandTimeout(ctx context.Context) time.Duration {
+	if d, ok := browser.TimeoutFromContext(ctx); ok {
+		return d
+	}
+	return c.timeout
+}
+
 func (c *Client) sendAction(ctx context.Context, cmdType protocol.CommandType, payload any) error {
 	_, err := c.sendActionWithData(ctx, cmdType, payload)
 	return err
 }
 
 func (c *Client) sendActionWithData(ctx context.Context, cmdType protocol.CommandType, payload any) (protocol.Response, error) {
-	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	ctx, cancel := context.WithTimeout(ctx, c.commandTimeout(ctx))
 	defer cancel()
 
 	raw, err := json.Marshal(payload)
 	if err != nil {
 		return protocol.Response{}, err
 	}
-	resp, err := c.bridge.SendCommand(ctx, c.makeCommand(ctx, cmdType, raw))
+	cmd := c.makeCommand(ctx, cmdType, raw)
+	resp, err := c.bridge.SendCommand(ctx, cmd)
 	if err != nil {
 		return protocol.Response{}, err
 	}
 	if !resp.OK {
+		if strings.EqualFold(resp.ErrorCode, protocol.ErrorCodeTabLocked) {
+			return protocol.Response{}, tabLockedError(cmd, resp)
+		}
+		if strings.EqualFold(resp.ErrorCode, protocol.ErrorCodeNotFound) || strings.EqualFold(resp.ErrorCode, protocol.ErrorCodeElementNotFound) {
+			return protocol.Response{}, &browser.NotFoundError{Message: resp.Error}
+		}
 		if resp.Error == "" && resp.ErrorCode == "" {
 			return protocol.Response{}, errors.New("browser action failed")
 		}
@@ -436,6 +955,26 @@ func (c *Client) sendActionWithData(ctx context.Context, cmdType protocol.Comman
 	return resp, nil
 }
 
+// tabLockedError maps the extension's tab_locked failure onto a typed error.
+// The owner is only reported when sharing is allowed.
+func tabLockedError(cmd protocol.Command, resp protocol.Response) *browser.TabLockedError {
+	var data protocol.TabLockedData
+	if len(resp.Data) > 0 {
+		_ = json.Unmarshal(resp.Data, &data)
+	}
+	if data.TabID == 0 {
+		data.TabID = cmd.TabID
+	}
+	out := &browser.TabLockedError{
+		TabID:       data.TabID,
+		AllowShared: data.AllowShared,
+	}
+	if data.AllowShared {
+		out.OwnerSessionID = data.OwnerSessionID
+	}
+	return out
+}
+
 func (c *Client) makeCommand(ctx context.Context, cmdType protocol.CommandType, payload json.RawMessage) protocol.Command {
 	cmd := protocol.Command{
 		ID:      uuid.New().String(),
@@ -446,6 +985,7 @@ func (c *Client) makeCommand(ctx context.Context, cmdType protocol.CommandType,
 		cmd.SessionID = target.SessionID
 		cmd.TabID = target.TabID
 	}
+	cmd.TraceID, _ = traceid.FromContext(ctx)
 	return cmd
 }
 
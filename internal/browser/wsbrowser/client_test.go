@@ -0,0 +1,822 @@
+package wsbrowser
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+	"github.com/adityalohuni/mcp-server/internal/page"
+	"github.com/adityalohuni/mcp-server/internal/traceid"
+	"github.com/adityalohuni/mcp-server/internal/wsbridge"
+	"github.com/adityalohuni/mcp-server/protocol"
+)
+
+// newTestClient connects a fake extension to a real bridge and answers every
+// command with respond.
+func newTestClient(t *testing.T, respond func(protocol.Command) protocol.Response) *Client {
+	t.Helper()
+	bridge := wsbridge.NewBridge(wsbridge.Options{})
+	srv := httptest.NewServer(http.HandlerFunc(bridge.HandleWS))
+	t.Cleanup(srv.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		for {
+			var cmd protocol.Command
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			resp := respond(cmd)
+			resp.ID = cmd.ID
+			if err := conn.WriteJSON(resp); err != nil {
+				return
+			}
+		}
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for bridge.Count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("extension never registered with bridge")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return NewClient(bridge, nil, nil, Options{Timeout: 2 * time.Second})
+}
+
+func okData(t *testing.T, v any) protocol.Response {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal data: %v", err)
+	}
+	return protocol.Response{OK: true, Data: data}
+}
+
+func TestSelectForwardsLabelRegex(t *testing.T) {
+	var got protocol.SelectPayload
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		_ = json.Unmarshal(cmd.Payload, &got)
+		if got.LabelRegex == "^Mar" {
+			return okData(t, browser.SelectResult{Selector: got.Selector, Value: "2025-03", Label: "March 2025", LabelRegex: got.LabelRegex})
+		}
+		return protocol.Response{OK: false, Error: "no option matched", ErrorCode: "OPTION_NOT_FOUND"}
+	})
+
+	out, err := client.Select(context.Background(), browser.SelectOptions{Selector: "#month", LabelRegex: "^Mar"})
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if got.LabelRegex != "^Mar" || out.Label != "March 2025" || out.Value != "2025-03" {
+		t.Fatalf("unexpected select result %#v (payload %#v)", out, got)
+	}
+
+	_, err = client.Select(context.Background(), browser.SelectOptions{Selector: "#month", LabelRegex: "^Dec"})
+	if err == nil || !strings.Contains(err.Error(), "OPTION_NOT_FOUND") {
+		t.Fatalf("expected OPTION_NOT_FOUND error, got %v", err)
+	}
+
+	if _, err := client.Select(context.Background(), browser.SelectOptions{Selector: "#month", LabelRegex: "("}); err == nil {
+		t.Fatalf("expected invalid regex to be rejected")
+	}
+}
+
+func TestTabLockedError(t *testing.T) {
+	shared := true
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		data, _ := json.Marshal(protocol.TabLockedData{OwnerSessionID: "owner-1", AllowShared: shared})
+		return protocol.Response{OK: false, Error: "tab is locked", ErrorCode: "TAB_LOCKED", Data: data}
+	})
+	ctx := browser.WithTarget(context.Background(), browser.Target{TabID: 7})
+
+	_, err := client.Click(ctx, "#go")
+	var locked *browser.TabLockedError
+	if !errors.As(err, &locked) {
+		t.Fatalf("expected TabLockedError, got %v", err)
+	}
+	if locked.TabID != 7 || locked.OwnerSessionID != "owner-1" || !strings.Contains(err.Error(), "owner-1") {
+		t.Fatalf("unexpected shared lock error %#v (%v)", locked, err)
+	}
+
+	shared = false
+	_, err = client.Click(ctx, "#go")
+	if !errors.As(err, &locked) {
+		t.Fatalf("expected TabLockedError, got %v", err)
+	}
+	if locked.OwnerSessionID != "" || strings.Contains(err.Error(), "owner-1") {
+		t.Fatalf("owner leaked for exclusive lock: %v", err)
+	}
+}
+
+func TestTypeReportsValidation(t *testing.T) {
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		var p protocol.TypePayload
+		_ = json.Unmarshal(cmd.Payload, &p)
+		out := browser.TypeResult{Selector: p.Selector, TextLength: len(p.Text)}
+		if p.ReportValidation {
+			out.Invalid = true
+			out.Validation = []browser.ValidationMessage{
+				{Text: "Enter a valid email address", Source: "aria-describedby"},
+				{Text: "Required", Source: "adjacent"},
+			}
+		}
+		return okData(t, out)
+	})
+
+	plain, err := client.Type(context.Background(), browser.TypeOptions{Selector: "#email", Text: "bob@"})
+	if err != nil {
+		t.Fatalf("type: %v", err)
+	}
+	if plain.Invalid || len(plain.Validation) != 0 {
+		t.Fatalf("validation reported without reportValidation: %#v", plain)
+	}
+
+	out, err := client.Type(context.Background(), browser.TypeOptions{Selector: "#email", Text: "bob@", ReportValidation: true})
+	if err != nil {
+		t.Fatalf("type: %v", err)
+	}
+	if !out.Invalid || len(out.Validation) != 2 || out.Validation[0].Source != "aria-describedby" || out.Validation[0].Text != "Enter a valid email address" {
+		t.Fatalf("unexpected validation result %#v", out)
+	}
+}
+
+func TestSnapshotUsesReducerOverride(t *testing.T) {
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		return okData(t, protocol.SnapshotData{
+			URL:  "https://example.com",
+			HTML: `<a id="a" href="/a">A</a><a id="b" href="/b">B</a><a id="c" href="/c">C</a>`,
+		})
+	})
+
+	snap, err := client.Snapshot(context.Background(), browser.SnapshotOptions{})
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if snap.ElementsReturned != 3 {
+		t.Fatalf("default reducer returned %d elements, want 3", snap.ElementsReturned)
+	}
+
+	snap, err = client.Snapshot(context.Background(), browser.SnapshotOptions{Reducer: page.NewReducer(page.ReduceOptions{MaxElements: 1})})
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if snap.ElementsReturned != 1 || snap.ElementsTotal != 3 {
+		t.Fatalf("override ignored: %d/%d elements", snap.ElementsReturned, snap.ElementsTotal)
+	}
+}
+
+func TestWaitForSelectorForwardsStateAndText(t *testing.T) {
+	var got protocol.WaitForSelectorPayload
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		got = protocol.WaitForSelectorPayload{}
+		_ = json.Unmarshal(cmd.Payload, &got)
+		condition := got.State
+		if got.ContainsText != "" {
+			condition = "text"
+		}
+		return okData(t, browser.WaitForSelectorResult{Selector: got.Selector, Found: true, State: got.State, ContainsText: got.ContainsText, Condition: condition})
+	})
+	ctx := context.Background()
+
+	out, err := client.WaitForSelector(ctx, browser.WaitForSelectorOptions{Selector: ".spinner", State: browser.WaitDetached, TimeoutMs: 500})
+	if err != nil {
+		t.Fatalf("wait detached: %v", err)
+	}
+	if got.State != "detached" || got.TimeoutMs != 500 || out.Condition != "detached" {
+		t.Fatalf("unexpected detached wait %#v (payload %#v)", out, got)
+	}
+
+	out, err = client.WaitForSelector(ctx, browser.WaitForSelectorOptions{Selector: "#status", State: browser.WaitVisible, ContainsText: "Done"})
+	if err != nil {
+		t.Fatalf("wait text: %v", err)
+	}
+	if got.ContainsText != "Done" || got.State != "visible" || out.Condition != "text" {
+		t.Fatalf("unexpected text wait %#v (payload %#v)", out, got)
+	}
+
+	if _, err := client.WaitForSelector(ctx, browser.WaitForSelectorOptions{Selector: "#x"}); err != nil || got.State != "" {
+		t.Fatalf("default wait should send no state: %v %#v", err, got)
+	}
+	if _, err := client.WaitForSelector(ctx, browser.WaitForSelectorOptions{Selector: "#x", State: "gone"}); err == nil {
+		t.Fatalf("expected invalid state to be rejected")
+	}
+	if _, err := client.WaitForSelector(ctx, browser.WaitForSelectorOptions{Selector: "#x", State: browser.WaitHidden, ContainsText: "a"}); err == nil {
+		t.Fatalf("expected containsText with hidden to be rejected")
+	}
+}
+
+func TestTimeoutOverrideFromContext(t *testing.T) {
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		time.Sleep(300 * time.Millisecond)
+		return protocol.Response{OK: true}
+	})
+	ctx := browser.WithTimeout(context.Background(), 50*time.Millisecond)
+	if _, err := client.Click(ctx, "#slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the context override to cut the command short, got %v", err)
+	}
+	if _, err := client.Click(context.Background(), "#slow"); err != nil {
+		t.Fatalf("expected the client default to allow the slow response: %v", err)
+	}
+}
+
+func TestTraceIDOnCommand(t *testing.T) {
+	seen := make(chan string, 2)
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		seen <- cmd.TraceID
+		return protocol.Response{OK: true}
+	})
+	if _, err := client.Click(traceid.With(context.Background(), "trace-1"), "#go"); err != nil {
+		t.Fatalf("click: %v", err)
+	}
+	if got := <-seen; got != "trace-1" {
+		t.Fatalf("expected traceId trace-1 on the command, got %q", got)
+	}
+	if _, err := client.Click(context.Background(), "#go"); err != nil {
+		t.Fatalf("click: %v", err)
+	}
+	if got := <-seen; got != "" {
+		t.Fatalf("expected no traceId without one on the context, got %q", got)
+	}
+}
+
+func TestHistoryReportsMoved(t *testing.T) {
+	var data map[string]any
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		return okData(t, data)
+	})
+	ctx := context.Background()
+
+	data = map[string]any{"direction": "back", "moved": true, "url": "https://example.com/1"}
+	if out, err := client.Back(ctx); err != nil || out.Moved == nil || !*out.Moved || out.URL != "https://example.com/1" {
+		t.Fatalf("expected a move back to page 1, got %#v (%v)", out, err)
+	}
+
+	data = map[string]any{"direction": "back", "moved": false, "url": "https://example.com/1"}
+	if out, err := client.Back(ctx); err != nil || out.Moved == nil || *out.Moved || out.Direction != "back" {
+		t.Fatalf("expected no move at the first page, got %#v (%v)", out, err)
+	}
+
+	data = map[string]any{"url": "https://example.com/2", "previousUrl": "https://example.com/2"}
+	if out, err := client.Forward(ctx); err != nil || out.Moved == nil || *out.Moved || out.Direction != "forward" {
+		t.Fatalf("expected unchanged URLs to mean no move, got %#v (%v)", out, err)
+	}
+
+	data = map[string]any{"url": "https://example.com/3", "previousUrl": "https://example.com/2"}
+	if out, err := client.Forward(ctx); err != nil || out.Moved == nil || !*out.Moved {
+		t.Fatalf("expected changed URLs to mean a move, got %#v (%v)", out, err)
+	}
+
+	data = map[string]any{"url": "https://example.com/3"}
+	out, err := client.Back(ctx)
+	if err != nil || out.Moved != nil {
+		t.Fatalf("expected moved to be unknown without moved or previousUrl, got %#v (%v)", out, err)
+	}
+	if raw, _ := json.Marshal(out); strings.Contains(string(raw), "moved") {
+		t.Fatalf("expected an unknown moved to be omitted, got %s", raw)
+	}
+}
+
+func TestWaitForURLForwardsPattern(t *testing.T) {
+	var payloads []protocol.WaitForURLPayload
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		var got protocol.WaitForURLPayload
+		if err := json.Unmarshal(cmd.Payload, &got); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		payloads = append(payloads, got)
+		return okData(t, protocol.WaitForURLData{Matched: true, URL: "https://shop.example/checkout/success"})
+	})
+	ctx := context.Background()
+
+	out, err := client.WaitForURL(ctx, browser.WaitForURLOptions{Pattern: "**/success", TimeoutMs: 500})
+	if err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	if !out.Matched || out.URL != "https://shop.example/checkout/success" || out.Match != browser.URLMatchGlob || out.TimeoutMs != 500 {
+		t.Fatalf("unexpected result %+v", out)
+	}
+	if _, err := client.WaitForURL(ctx, browser.WaitForURLOptions{Pattern: `/checkout/(success|done)`, Match: browser.URLMatchRegex}); err != nil {
+		t.Fatalf("wait: %v", err)
+	}
+	want := []protocol.WaitForURLPayload{
+		{Pattern: "**/success", Match: "glob", Regex: "^.*/success$", TimeoutMs: 500},
+		{Pattern: `/checkout/(success|done)`, Match: "regex", Regex: `/checkout/(success|done)`},
+	}
+	if !slices.Equal(payloads, want) {
+		t.Fatalf("got payloads %+v, want %+v", payloads, want)
+	}
+
+	if _, err := client.WaitForURL(ctx, browser.WaitForURLOptions{Pattern: "[", Match: browser.URLMatchRegex}); err == nil || len(payloads) != 2 {
+		t.Fatalf("expected an invalid regex to fail without a command, got %v", err)
+	}
+}
+
+func TestScreenshotAnnotate(t *testing.T) {
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		var got protocol.ScreenshotPayload
+		if err := json.Unmarshal(cmd.Payload, &got); err != nil || !got.Annotate || got.Selector != "#buy" {
+			t.Errorf("unexpected payload %s", cmd.Payload)
+		}
+		return okData(t, map[string]any{
+			"selector": "#buy",
+			"dataUrl":  "data:image/png;base64,AA==",
+			"format":   "png",
+			"box":      map[string]any{"x": 12.5, "y": 340, "width": 80, "height": 24},
+		})
+	})
+	out, err := client.Screenshot(context.Background(), browser.ScreenshotOptions{Selector: "#buy", Annotate: true})
+	if err != nil {
+		t.Fatalf("screenshot: %v", err)
+	}
+	if out.Box == nil || *out.Box != (browser.Rect{X: 12.5, Y: 340, Width: 80, Height: 24}) {
+		t.Fatalf("unexpected box %+v", out.Box)
+	}
+}
+
+func TestNavigateStatusAndHeaders(t *testing.T) {
+	var data map[string]any
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		return okData(t, data)
+	})
+	ctx := context.Background()
+
+	data = map[string]any{
+		"url":        "https://example.com/gone",
+		"statusCode": 404,
+		"statusText": "Not Found",
+		"headers":    map[string]string{"Content-Type": "text/html", "Set-Cookie": "session=secret", "ETag": `"abc"`},
+	}
+	out, err := client.Navigate(ctx, "https://example.com/gone")
+	if err != nil {
+		t.Fatalf("navigate: %v", err)
+	}
+	want := map[string]string{"content-type": "text/html", "etag": `"abc"`}
+	if out.StatusCode != 404 || out.StatusText != "Not Found" || !maps.Equal(out.Headers, want) {
+		t.Fatalf("unexpected result %+v", out)
+	}
+
+	data = map[string]any{"url": "https://example.com/", "headers": map[string]string{"content-type": "text/html"}}
+	out, err = client.Navigate(ctx, "https://example.com/")
+	if err != nil || out.URL != "https://example.com/" || out.StatusCode != 0 || out.Headers != nil {
+		t.Fatalf("expected only the URL without a status, got %+v (%v)", out, err)
+	}
+}
+
+func TestNavigationResultsCarryLocation(t *testing.T) {
+	var sent []protocol.CommandType
+	var data map[string]any
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		sent = append(sent, cmd.Type)
+		switch cmd.Type {
+		case protocol.CommandReload:
+			var p protocol.ReloadPayload
+			if err := json.Unmarshal(cmd.Payload, &p); err != nil || !p.BypassCache {
+				t.Errorf("unexpected reload payload %s", cmd.Payload)
+			}
+		case protocol.CommandGetHistory:
+			return okData(t, map[string]any{"url": "https://example.com/cart", "title": "Cart"})
+		}
+		return okData(t, data)
+	})
+	ctx := context.Background()
+
+	data = map[string]any{"url": "https://example.com/", "title": "Home", "statusCode": 200}
+	out, err := client.Reload(ctx, browser.ReloadOptions{BypassCache: true})
+	moved := true
+	want := browser.NavigationState{URL: "https://example.com/", Title: "Home", Moved: &moved}
+	if err != nil || !reflect.DeepEqual(out.NavigationState, want) || out.StatusCode != 200 {
+		t.Fatalf("unexpected reload result %+v (%v)", out, err)
+	}
+
+	// Without a URL in the answer, navigate reports the one it was sent to
+	// and back looks the current page up.
+	data = map[string]any{}
+	nav, err := client.Navigate(ctx, "https://example.com/a")
+	if err != nil || nav.URL != "https://example.com/a" || nav.Moved == nil || !*nav.Moved {
+		t.Fatalf("expected the requested URL, got %+v (%v)", nav, err)
+	}
+	data = map[string]any{"moved": true}
+	back, err := client.Back(ctx)
+	want = browser.NavigationState{URL: "https://example.com/cart", Title: "Cart", Moved: &moved}
+	if err != nil || !reflect.DeepEqual(back.NavigationState, want) {
+		t.Fatalf("expected the current page to be looked up, got %+v (%v)", back, err)
+	}
+	wantSent := []protocol.CommandType{protocol.CommandReload, protocol.CommandNavigate, protocol.CommandBack, protocol.CommandGetHistory}
+	if !slices.Equal(sent, wantSent) {
+		t.Fatalf("sent %v, want %v", sent, wantSent)
+	}
+}
+
+func TestPressKeysSendsCanonicalChords(t *testing.T) {
+	payloads := make(chan protocol.PressKeysPayload, 2)
+	var dispatched []string
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		var p protocol.PressKeysPayload
+		_ = json.Unmarshal(cmd.Payload, &p)
+		payloads <- p
+		if dispatched == nil {
+			return okData(t, map[string]any{})
+		}
+		return okData(t, map[string]any{"dispatched": dispatched})
+	})
+	chords := []browser.KeyChord{{Key: "a", Control: true}, {Key: "Delete"}, {Key: "z", Shift: true, Meta: true}}
+
+	out, err := client.PressKeys(context.Background(), "", chords)
+	if err != nil {
+		t.Fatalf("press keys: %v", err)
+	}
+	want := []string{"Control+a", "Delete", "Shift+Meta+z"}
+	if got := <-payloads; !slices.Equal(got.Keys, want) || got.Selector != "" {
+		t.Fatalf("unexpected payload %+v", got)
+	}
+	if !slices.Equal(out.Dispatched, want) || !out.UsedActiveElement {
+		t.Fatalf("unexpected result %+v", out)
+	}
+
+	dispatched = want[:1]
+	out, err = client.PressKeys(context.Background(), "#editor", chords)
+	<-payloads
+	if err == nil || !strings.Contains(err.Error(), `"Delete"`) || len(out.Dispatched) != 1 {
+		t.Fatalf("expected a partial dispatch to fail naming Delete, got %+v (%v)", out, err)
+	}
+}
+
+func TestHistoryDecoding(t *testing.T) {
+	var data map[string]any
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		if cmd.Type != protocol.CommandGetHistory {
+			t.Errorf("unexpected command %s", cmd.Type)
+		}
+		return okData(t, data)
+	})
+	urls := func(list browser.HistoryList) []string {
+		var out []string
+		for _, e := range list.Entries {
+			out = append(out, e.URL)
+		}
+		return out
+	}
+	entries := []map[string]any{
+		{"url": "https://example.com/", "title": "Home"},
+		{"url": "https://example.com/a", "current": true},
+		{"url": "https://example.com/a"},
+	}
+	for _, tc := range []struct {
+		name     string
+		data     map[string]any
+		urls     []string
+		index    int
+		length   int
+		complete bool
+	}{
+		{"index", map[string]any{"entries": entries, "index": 2}, []string{"https://example.com/", "https://example.com/a", "https://example.com/a"}, 2, 3, true},
+		{"current flag", map[string]any{"entries": entries}, []string{"https://example.com/", "https://example.com/a", "https://example.com/a"}, 1, 3, true},
+		{"index out of range", map[string]any{"entries": entries[:1], "index": 5}, []string{"https://example.com/"}, 0, 1, true},
+		{"url match", map[string]any{"entries": []map[string]any{entries[0], entries[2], {"url": "https://example.com/b"}}, "url": "https://example.com/a"}, []string{"https://example.com/", "https://example.com/a", "https://example.com/b"}, 1, 3, true},
+		{"partial entries", map[string]any{"entries": entries[:1], "length": 4}, []string{"https://example.com/"}, 0, 4, false},
+		{"current page only", map[string]any{"url": "https://example.com/a", "title": "A", "length": 5}, []string{"https://example.com/a"}, 0, 5, false},
+		{"nothing", map[string]any{}, nil, 0, 0, false},
+	} {
+		data = tc.data
+		out, err := client.History(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !slices.Equal(urls(out), tc.urls) || out.Index != tc.index || out.Length != tc.length || out.Complete != tc.complete {
+			t.Fatalf("%s: unexpected history %#v", tc.name, out)
+		}
+		if out.Entries == nil {
+			t.Fatalf("%s: entries should be empty, not nil", tc.name)
+		}
+	}
+	data = map[string]any{"entries": entries[:1]}
+	if out, _ := client.History(context.Background()); out.Entries[0].Title != "Home" {
+		t.Fatalf("expected the entry title to be kept, got %#v", out)
+	}
+}
+
+func TestSnapshotRequestsLiveValues(t *testing.T) {
+	payloads := make(chan protocol.SnapshotPayload, 3)
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		var p protocol.SnapshotPayload
+		_ = json.Unmarshal(cmd.Payload, &p)
+		payloads <- p
+		return okData(t, protocol.SnapshotData{
+			URL:      "https://example.com",
+			Elements: []protocol.Element{{Tag: "input", Selector: "#q", Value: "half typed"}},
+		})
+	})
+	ctx := context.Background()
+
+	snap, err := client.Snapshot(ctx, browser.SnapshotOptions{IncludeValues: true})
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if len(snap.Elements) != 1 || snap.Elements[0].Value != "half typed" {
+		t.Fatalf("expected the live value to survive, got %#v", snap.Elements)
+	}
+	if _, err := client.Snapshot(ctx, browser.SnapshotOptions{Reducer: page.NewReducer(page.ReduceOptions{IncludeValues: true})}); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if _, err := client.Snapshot(ctx, browser.SnapshotOptions{}); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	for i, want := range []bool{true, true, false} {
+		if got := (<-payloads).IncludeValues; got != want {
+			t.Fatalf("snapshot %d: includeValues=%v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestClearStorageForwardsFlags(t *testing.T) {
+	payloads := make(chan protocol.ClearStoragePayload, 1)
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		var p protocol.ClearStoragePayload
+		_ = json.Unmarshal(cmd.Payload, &p)
+		payloads <- p
+		return okData(t, map[string]any{"origin": "https://example.com", "cleared": []string{"sessionStorage", "cache"}})
+	})
+
+	out, err := client.ClearStorage(context.Background(), browser.ClearStorageOptions{SessionStorage: true, Cache: true})
+	if err != nil {
+		t.Fatalf("clear storage: %v", err)
+	}
+	if got := <-payloads; got != (protocol.ClearStoragePayload{SessionStorage: true, Cache: true}) {
+		t.Fatalf("unexpected payload %+v", got)
+	}
+	if out.Origin != "https://example.com" || strings.Join(out.Cleared, ",") != "sessionStorage,cache" {
+		t.Fatalf("unexpected result %+v", out)
+	}
+
+	if _, err := client.ClearStorage(context.Background(), browser.ClearStorageOptions{}); err == nil {
+		t.Fatalf("expected an error when no storage kind is selected")
+	}
+}
+
+func TestGetStorageSortsAndCaps(t *testing.T) {
+	payloads := make(chan protocol.GetStoragePayload, 4)
+	var data map[string]any
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		var p protocol.GetStoragePayload
+		_ = json.Unmarshal(cmd.Payload, &p)
+		payloads <- p
+		return okData(t, data)
+	})
+	ctx := context.Background()
+	data = map[string]any{"origin": "https://example.com", "count": 3, "items": []map[string]string{
+		{"key": "b", "value": "22"}, {"key": "a", "value": "1"}, {"key": "c", "value": "333"},
+	}}
+
+	out, err := client.GetStorage(ctx, browser.GetStorageOptions{Kind: browser.StorageLocal})
+	if err != nil {
+		t.Fatalf("get storage: %v", err)
+	}
+	if got := <-payloads; got != (protocol.GetStoragePayload{Kind: "local"}) {
+		t.Fatalf("unexpected payload %+v", got)
+	}
+	if len(out.Items) != 3 || out.Items[0].Key != "a" || out.Items[2].Key != "c" || out.Count != 3 || out.Truncated || out.Kind != "local" {
+		t.Fatalf("unexpected dump %+v", out)
+	}
+
+	out, _ = client.GetStorage(ctx, browser.GetStorageOptions{Kind: browser.StorageSession, MaxBytes: 5})
+	if got := <-payloads; got.MaxBytes != 5 || got.Kind != "session" {
+		t.Fatalf("unexpected payload %+v", got)
+	}
+	if len(out.Items) != 2 || !out.Truncated || out.Count != 3 {
+		t.Fatalf("expected a and b to fit in 5 bytes, got %+v", out)
+	}
+
+	data = map[string]any{"items": []map[string]string{{"key": "big", "value": "héllo wörld"}}}
+	out, _ = client.GetStorage(ctx, browser.GetStorageOptions{Kind: browser.StorageLocal, Key: "big", MaxBytes: 8})
+	<-payloads
+	if !out.Found || len(out.Items) != 1 || !out.Items[0].Truncated || out.Items[0].Value != "héll" || out.Count != 1 {
+		t.Fatalf("expected the value cut at a rune boundary, got %+v", out)
+	}
+
+	data = map[string]any{"count": 4}
+	out, _ = client.GetStorage(ctx, browser.GetStorageOptions{Kind: browser.StorageLocal, Key: "missing"})
+	<-payloads
+	if out.Found || out.Items == nil || len(out.Items) != 0 || out.Count != 4 {
+		t.Fatalf("expected a missing key to be reported, got %+v", out)
+	}
+
+	if _, err := client.GetStorage(ctx, browser.GetStorageOptions{Kind: "cookies"}); err == nil {
+		t.Fatalf("expected an unknown kind to be rejected")
+	}
+}
+
+func TestSetStorage(t *testing.T) {
+	payloads := make(chan protocol.SetStoragePayload, 1)
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		var p protocol.SetStoragePayload
+		_ = json.Unmarshal(cmd.Payload, &p)
+		payloads <- p
+		return okData(t, map[string]any{"origin": "https://example.com", "existed": true})
+	})
+	out, err := client.SetStorage(context.Background(), browser.SetStorageOptions{Kind: browser.StorageSession, Key: "token", Remove: true})
+	if err != nil {
+		t.Fatalf("set storage: %v", err)
+	}
+	if got := <-payloads; got != (protocol.SetStoragePayload{Kind: "session", Key: "token", Remove: true}) {
+		t.Fatalf("unexpected payload %+v", got)
+	}
+	if !out.Existed || !out.Removed || out.Origin != "https://example.com" {
+		t.Fatalf("unexpected result %+v", out)
+	}
+	if _, err := client.SetStorage(context.Background(), browser.SetStorageOptions{Kind: browser.StorageLocal}); err == nil {
+		t.Fatalf("expected a missing key to be rejected")
+	}
+}
+
+func TestEvaluateReportsTypeAndExceptions(t *testing.T) {
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		var p protocol.EvaluatePayload
+		_ = json.Unmarshal(cmd.Payload, &p)
+		switch p.Script {
+		case "document.title":
+			return okData(t, map[string]any{"value": "Example"})
+		case "undefined":
+			return okData(t, map[string]any{"type": "undefined"})
+		default:
+			return okData(t, map[string]any{"type": "undefined", "error": "ReferenceError: boom is not defined"})
+		}
+	})
+	ctx := context.Background()
+
+	out, err := client.Evaluate(ctx, "document.title")
+	if err != nil || out.Type != browser.EvaluateString || string(out.Value) != `"Example"` {
+		t.Fatalf("unexpected result %+v (%v)", out, err)
+	}
+	if out, err := client.Evaluate(ctx, "undefined"); err != nil || out.Type != browser.EvaluateUndefined || len(out.Value) != 0 {
+		t.Fatalf("unexpected undefined result %+v (%v)", out, err)
+	}
+	if _, err := client.Evaluate(ctx, "boom()"); err == nil || !strings.Contains(err.Error(), "boom is not defined") {
+		t.Fatalf("expected the page exception as an error, got %v", err)
+	}
+	if _, err := client.Evaluate(ctx, " "); err == nil {
+		t.Fatalf("expected an empty script to fail")
+	}
+}
+
+func TestFillFormSendsOneCommand(t *testing.T) {
+	payloads := make(chan protocol.FillFormPayload, 2)
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		var p protocol.FillFormPayload
+		_ = json.Unmarshal(cmd.Payload, &p)
+		payloads <- p
+		// Report on the first two fields only.
+		return okData(t, protocol.FillFormResult{Fields: []protocol.FillFieldResult{
+			{Selector: p.Fields[0].Selector, OK: true},
+			{Selector: p.Fields[1].Selector, Error: "no element", ErrorCode: protocol.ErrorCodeNotFound},
+		}})
+	})
+
+	out, err := client.FillForm(context.Background(), []browser.FillFormField{
+		{Selector: "#name", Value: "Ada"},
+		{Selector: "#gone", Value: "x"},
+		{Selector: "#email", Value: "ada@example.com", PressEnter: true},
+	})
+	if err != nil {
+		t.Fatalf("fill form: %v", err)
+	}
+	got := <-payloads
+	if len(got.Fields) != 3 || got.Fields[0] != (protocol.FillFormField{Selector: "#name", Value: "Ada"}) || !got.Fields[2].PressEnter {
+		t.Fatalf("unexpected payload %+v", got)
+	}
+	if out.Succeeded != 1 || out.Failed != 2 || len(out.Fields) != 3 {
+		t.Fatalf("unexpected counts %+v", out)
+	}
+	if out.Fields[1].ErrorCode != protocol.ErrorCodeNotFound || out.Fields[2].OK || out.Fields[2].Selector != "#email" || out.Fields[2].Error == "" {
+		t.Fatalf("unexpected fields %+v", out.Fields)
+	}
+	if _, err := client.FillForm(context.Background(), nil); err == nil {
+		t.Fatalf("expected an empty field list to fail")
+	}
+}
+
+func TestSetCheckedVerifiesState(t *testing.T) {
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		var p protocol.SetCheckedPayload
+		_ = json.Unmarshal(cmd.Payload, &p)
+		switch p.Selector {
+		case "#terms":
+			return okData(t, map[string]any{"checked": p.Checked, "changed": true})
+		case "#sticky":
+			// A page script flips it back.
+			return okData(t, map[string]any{"checked": !p.Checked, "changed": false})
+		default:
+			return protocol.Response{OK: false, Error: "element is a button", ErrorCode: protocol.ErrorCodeNotCheckable}
+		}
+	})
+	ctx := context.Background()
+
+	out, err := client.SetChecked(ctx, "#terms", true)
+	if err != nil || out != (browser.CheckedResult{Selector: "#terms", Checked: true, Changed: true}) {
+		t.Fatalf("unexpected result %+v (%v)", out, err)
+	}
+	if _, err := client.SetChecked(ctx, "#sticky", true); err == nil || !strings.Contains(err.Error(), "still unchecked") {
+		t.Fatalf("expected a verification error, got %v", err)
+	}
+	if _, err := client.SetChecked(ctx, "#submit", true); err == nil || !strings.Contains(err.Error(), protocol.ErrorCodeNotCheckable) {
+		t.Fatalf("expected a not_checkable error, got %v", err)
+	}
+}
+
+func TestSelectForwardsBlurAfter(t *testing.T) {
+	payloads := make(chan protocol.SelectPayload, 1)
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		var p protocol.SelectPayload
+		_ = json.Unmarshal(cmd.Payload, &p)
+		payloads <- p
+		events := []string{"input", "change"}
+		if p.BlurAfter {
+			events = append(events, "blur")
+		}
+		return okData(t, map[string]any{"selector": p.Selector, "value": p.Value, "events": events})
+	})
+
+	out, err := client.Select(context.Background(), browser.SelectOptions{Selector: "#size", Value: "m", BlurAfter: true})
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	if got := <-payloads; !got.BlurAfter {
+		t.Fatalf("expected blurAfter in the payload, got %+v", got)
+	}
+	if strings.Join(out.Events, ",") != "input,change,blur" {
+		t.Fatalf("unexpected events %v", out.Events)
+	}
+}
+
+func TestGetTextMapsNotFound(t *testing.T) {
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		var p protocol.GetTextPayload
+		_ = json.Unmarshal(cmd.Payload, &p)
+		if p.Selector != "#title" {
+			return protocol.Response{OK: false, Error: "no match", ErrorCode: protocol.ErrorCodeNotFound}
+		}
+		return okData(t, map[string]any{"innerText": "Hello", "textContent": "Hello\n  world"})
+	})
+	ctx := context.Background()
+
+	out, err := client.GetText(ctx, "#title")
+	if err != nil || out.Selector != "#title" || out.InnerText != "Hello" || out.TextContent != "Hello\n  world" {
+		t.Fatalf("unexpected result %+v (%v)", out, err)
+	}
+	_, err = client.GetText(ctx, "#gone")
+	var nf *browser.NotFoundError
+	if !errors.As(err, &nf) || nf.Selector != "#gone" {
+		t.Fatalf("expected a not_found error naming the selector, got %v", err)
+	}
+}
+
+func TestClickMapsElementNotFound(t *testing.T) {
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		return protocol.Response{OK: false, Error: "Element not found", ErrorCode: protocol.ErrorCodeElementNotFound}
+	})
+
+	_, err := client.Click(context.Background(), "#gone")
+	var nf *browser.NotFoundError
+	if !errors.As(err, &nf) || nf.Selector != "#gone" {
+		t.Fatalf("expected a not_found error naming the selector, got %v", err)
+	}
+}
+
+func TestFindForwardsIncludePositions(t *testing.T) {
+	payloads := make(chan protocol.FindPayload, 1)
+	client := newTestClient(t, func(cmd protocol.Command) protocol.Response {
+		var p protocol.FindPayload
+		_ = json.Unmarshal(cmd.Payload, &p)
+		payloads <- p
+		return okData(t, map[string]any{
+			"query": "pricing", "total": 1, "returned": 1,
+			"results": []map[string]any{{"index": 0, "snippet": "see pricing", "selector": "#pricing", "rect": map[string]any{"x": 8, "y": 1200, "width": 300, "height": 24}}},
+		})
+	})
+
+	out, err := client.Find(context.Background(), browser.FindOptions{Text: "pricing", IncludePositions: true})
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if got := <-payloads; got.Text != "pricing" || !got.IncludePositions {
+		t.Fatalf("unexpected payload %+v", got)
+	}
+	if len(out.Results) != 1 || out.Results[0].Selector != "#pricing" || out.Results[0].Rect == nil || *out.Results[0].Rect != (browser.Rect{X: 8, Y: 1200, Width: 300, Height: 24}) {
+		t.Fatalf("unexpected result %+v", out)
+	}
+}
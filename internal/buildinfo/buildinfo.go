@@ -0,0 +1,51 @@
+// Package buildinfo reports which build of the daemon is running. Release
+// builds set the variables with -ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/adityalohuni/mcp-server/internal/buildinfo.Version=v1.4.0 \
+//	  -X github.com/adityalohuni/mcp-server/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//	  -X github.com/adityalohuni/mcp-server/internal/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/mcpd
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Unset is reported for any value the build did not provide.
+const Unset = "dev"
+
+var (
+	Version   = ""
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build info. A commit or build time missing from -ldflags
+// falls back to the VCS stamp go build embeds, when there is one.
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch {
+			case s.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = s.Value
+			case s.Key == "vcs.time" && info.BuildTime == "":
+				info.BuildTime = s.Value
+			}
+		}
+	}
+	for _, v := range []*string{&info.Version, &info.Commit, &info.BuildTime} {
+		if *v == "" {
+			*v = Unset
+		}
+	}
+	return info
+}
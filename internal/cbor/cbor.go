@@ -0,0 +1,186 @@
+// Package cbor converts between JSON and CBOR (RFC 8949) so the admin API can
+// offer a compact binary encoding without a second set of struct tags: values
+// are marshalled to JSON as usual and the JSON is transcoded. The CBOR side is
+// handled by github.com/fxamacker/cbor/v2.
+//
+// Only the JSON data model is covered: maps with text keys, arrays, text
+// strings, integers, floats, booleans and null. Byte strings, indefinite
+// lengths and other simple values are rejected when decoding; tags other than
+// bignums and times are skipped.
+package cbor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	fxcbor "github.com/fxamacker/cbor/v2"
+)
+
+// ContentType is the media type of CBOR documents.
+const ContentType = "application/cbor"
+
+// maxDepth bounds nesting on decode, so hostile input cannot exhaust the stack.
+const maxDepth = 512
+
+var (
+	// Map keys are written in the core deterministic order, so a value
+	// always encodes to the same bytes.
+	encMode = mustEncMode(fxcbor.EncOptions{Sort: fxcbor.SortCoreDeterministic})
+	decMode = mustDecMode(fxcbor.DecOptions{
+		MaxNestedLevels:  maxDepth,
+		MaxArrayElements: math.MaxInt32,
+		MaxMapPairs:      math.MaxInt32,
+		IndefLength:      fxcbor.IndefLengthForbidden,
+		DefaultMapType:   reflect.TypeOf(map[string]any(nil)),
+		BigIntDec:        fxcbor.BigIntDecodePointer,
+		TimeTagToAny:     fxcbor.TimeTagToRFC3339Nano,
+	})
+)
+
+func mustEncMode(opts fxcbor.EncOptions) fxcbor.EncMode {
+	m, err := opts.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func mustDecMode(opts fxcbor.DecOptions) fxcbor.DecMode {
+	m, err := opts.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Marshal encodes v as JSON would and returns the CBOR form.
+func Marshal(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return FromJSON(data)
+}
+
+// Unmarshal decodes a CBOR document into v as if it were the equivalent JSON.
+func Unmarshal(data []byte, v any) error {
+	j, err := ToJSON(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(j, v)
+}
+
+// FromJSON transcodes one JSON document to CBOR. Object members are sorted by
+// key. Numbers become integers when they are whole and fit in 64 bits, and
+// float64 otherwise.
+func FromJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("cbor: trailing data after JSON document")
+	}
+	v, err := fromJSONValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return encMode.Marshal(v)
+}
+
+// fromJSONValue replaces the json.Numbers in a decoded document with the
+// integer or float they encode as.
+func fromJSONValue(v any) (any, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i, nil
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u, nil
+		}
+		f, err := strconv.ParseFloat(string(v), 64)
+		if err != nil {
+			return nil, fmt.Errorf("cbor: number %s does not fit in a float64", v)
+		}
+		return f, nil
+	case []any:
+		for i, e := range v {
+			e, err := fromJSONValue(e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = e
+		}
+	case map[string]any:
+		for k, e := range v {
+			e, err := fromJSONValue(e)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = e
+		}
+	}
+	return v, nil
+}
+
+// ToJSON transcodes one CBOR document to compact JSON.
+func ToJSON(data []byte) ([]byte, error) {
+	var v any
+	if err := decMode.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	v, err := toJSONValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// toJSONValue checks that a decoded document has a JSON form, unwrapping
+// tags along the way.
+func toJSONValue(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, bool, string, uint64, int64, *big.Int:
+		return v, nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, errors.New("cbor: NaN and infinity have no JSON form")
+		}
+		return v, nil
+	case fxcbor.Tag:
+		return toJSONValue(v.Content)
+	case []any:
+		for i, e := range v {
+			e, err := toJSONValue(e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = e
+		}
+		return v, nil
+	case map[string]any:
+		for k, e := range v {
+			e, err := toJSONValue(e)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = e
+		}
+		return v, nil
+	case []byte:
+		return nil, errors.New("cbor: byte strings have no JSON form")
+	default:
+		return nil, fmt.Errorf("cbor: unsupported value of type %T", v)
+	}
+}
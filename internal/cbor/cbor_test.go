@@ -0,0 +1,149 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFromJSONVectors(t *testing.T) {
+	// Expected encodings from RFC 8949 Appendix A.
+	for in, want := range map[string]string{
+		`0`:                    "00",
+		`23`:                   "17",
+		`24`:                   "1818",
+		`1000`:                 "1903e8",
+		`1000000`:              "1a000f4240",
+		`18446744073709551615`: "1bffffffffffffffff",
+		`-1`:                   "20",
+		`-1000`:                "3903e7",
+		`1.5`:                  "fb3ff8000000000000",
+		`false`:                "f4",
+		`true`:                 "f5",
+		`null`:                 "f6",
+		`""`:                   "60",
+		`"a"`:                  "6161",
+		`"ü"`:                  "62c3bc",
+		`[]`:                   "80",
+		`[1,[2,3],[4,5]]`:      "8301820203820405",
+		`{}`:                   "a0",
+		`{"a":1,"b":[2,3]}`:    "a26161016162820203",
+		`{"b":1,"a":2}`:        "a2616102616201", // keys sorted
+	} {
+		got, err := FromJSON([]byte(in))
+		if err != nil {
+			t.Fatalf("FromJSON(%s): %v", in, err)
+		}
+		if hex.EncodeToString(got) != want {
+			t.Fatalf("FromJSON(%s) = %x, want %s", in, got, want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	type tab struct {
+		ID     int     `json:"id"`
+		URL    string  `json:"url"`
+		Active bool    `json:"active,omitempty"`
+		Zoom   float64 `json:"zoom"`
+	}
+	in := map[string]any{
+		"tabs":  []tab{{ID: 1, URL: "https://example.com/<a>&b", Active: true, Zoom: 1.25}, {ID: -7, URL: "日本", Zoom: 1e21}},
+		"empty": map[string]any{},
+		"none":  nil,
+	}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var got struct {
+		Tabs  []tab          `json:"tabs"`
+		Empty map[string]any `json:"empty"`
+		None  any            `json:"none"`
+	}
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(got.Tabs, in["tabs"]) || got.Empty == nil || got.None != nil {
+		t.Fatalf("round trip changed the value: %+v", got)
+	}
+}
+
+func TestToJSON(t *testing.T) {
+	for in, want := range map[string]string{
+		"f93e00":     `1.5`,    // half precision
+		"fa47c35000": `100000`, // single precision
+		"c074323031332d30332d32315432303a30343a30305a": `"2013-03-21T20:04:00Z"`, // tag 0 is skipped
+		"3bffffffffffffffff":                           `-18446744073709551616`,
+		"f7":                                           `null`,
+	} {
+		b, _ := hex.DecodeString(in)
+		got, err := ToJSON(b)
+		if err != nil {
+			t.Fatalf("ToJSON(%s): %v", in, err)
+		}
+		if string(got) != want {
+			t.Fatalf("ToJSON(%s) = %s, want %s", in, got, want)
+		}
+		if !json.Valid(got) {
+			t.Fatalf("ToJSON(%s) is not valid JSON: %s", in, got)
+		}
+	}
+
+	for name, in := range map[string]string{
+		"truncated":    "6261",
+		"byte string":  "4161",
+		"integer key":  "a10102",
+		"indefinite":   "9fff",
+		"trailing":     "0000",
+		"huge length":  "9b7fffffffffffffff",
+		"infinity":     "f97c00",
+		"invalid utf8": "61ff",
+		"empty":        "",
+	} {
+		b, _ := hex.DecodeString(in)
+		if got, err := ToJSON(b); err == nil {
+			t.Fatalf("%s: expected an error, got %s", name, got)
+		}
+	}
+}
+
+func FuzzJSONRoundTrip(f *testing.F) {
+	for _, seed := range []string{`0`, `-1`, `1.5`, `1e21`, `18446744073709551615`, `-9223372036854775809`, `"ü"`, `[1,[2,3],{}]`, `{"b":1,"a":[true,false,null]}`} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var want any
+		if err := json.Unmarshal(data, &want); err != nil {
+			return
+		}
+		c, err := FromJSON(data)
+		if err != nil {
+			t.Fatalf("FromJSON(%s): %v", data, err)
+		}
+		j, err := ToJSON(c)
+		if err != nil {
+			t.Fatalf("ToJSON(%x): %v", c, err)
+		}
+		var got any
+		if err := json.Unmarshal(j, &got); err != nil {
+			t.Fatalf("ToJSON(%x) = %s is not valid JSON: %v", c, j, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("round trip of %s gave %s", data, j)
+		}
+	})
+}
+
+func FuzzToJSON(f *testing.F) {
+	for _, seed := range []string{"a26161016162820203", "f93e00", "c074323031332d30332d32315432303a30343a30305a", "3bffffffffffffffff", "9fff", "4161"} {
+		b, _ := hex.DecodeString(seed)
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if out, err := ToJSON(data); err == nil && !json.Valid(out) {
+			t.Fatalf("ToJSON(%x) = %s is not valid JSON", data, out)
+		}
+	})
+}
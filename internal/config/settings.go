@@ -1,16 +1,26 @@
 package config
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/BurntSushi/toml"
-	"github.com/google/uuid"
+	"golang.org/x/net/http/httpguts"
+
+	"github.com/adityalohuni/mcp-server/internal/page"
 )
 
 const (
@@ -19,37 +29,218 @@ const (
 	defaultRefreshInterval = 2 * time.Second
 	defaultConfigDirName   = "surfingbros"
 	defaultConfigFileName  = "config.toml"
+	defaultLogMaxSize      = 10 // megabytes
+	defaultLogMaxBackups   = 3
+	defaultTokenBytes      = 32
+	defaultAssignedHeader  = "X-Assigned-Client-Id"
+	minTokenBytes          = 16
+
+	// EnvMCPToken and EnvAdminToken supply tokens when neither an inline value
+	// nor a *_token_file is configured.
+	EnvMCPToken   = "SURFINGBROS_MCP_TOKEN"
+	EnvAdminToken = "SURFINGBROS_ADMIN_TOKEN"
 )
 
+// DefaultClientIDHeaders are the request headers an MCP client's id is read
+// from unless daemon.client_id_headers says otherwise.
+var DefaultClientIDHeaders = []string{"X-Client-Id", "X-MCP-Client-Id"}
+
 type Settings struct {
-	Path               string
-	DaemonAddr         string
+	Path string
+	// Version identifies the config file contents these settings were loaded
+	// from. Save refuses to overwrite a file whose version has moved on.
+	Version    string
+	DaemonAddr string
+	// AdminAddr, when set, serves /admin/* and the admin UI on their own
+	// listener instead of DaemonAddr.
+	AdminAddr          string
 	MCPToken           string
+	MCPTokenFile       string
 	AdminToken         string
-	ClientMaxIdle      time.Duration
-	AdminBaseURL       string
-	TUIRefreshInterval time.Duration
+	AdminTokenFile     string
+	AdminReadonlyToken string
+	// ScopedTokens maps extra tokens to the scopes they are granted, such
+	// as "browsers:read" or "mcp"; see httpx.RequireScope.
+	ScopedTokens map[string][]string
+	// TokenBytes is how many random bytes generated tokens carry.
+	TokenBytes int
+	// RequireExplicitTokens makes LoadOrCreate fail when the MCP or admin
+	// token is not configured, instead of generating one and writing it to
+	// the config file.
+	RequireExplicitTokens bool
+	ClientMaxIdle         time.Duration
+	// CommandTTL bounds how long a browser command sent without a deadline
+	// waits for its answer; zero means the bridge default of 5 minutes.
+	CommandTTL time.Duration
+	// IdleTimeout closes browser sessions that have sent nothing for this
+	// long; zero keeps idle sessions open.
+	IdleTimeout time.Duration
+	// PingInterval is how often browser sessions are pinged (zero means 30s,
+	// negative disables pings), and PongWait how long one may stay silent
+	// before it is closed (zero means twice PingInterval).
+	PingInterval time.Duration
+	PongWait     time.Duration
+	// WriteWait, WriteWaitPerKB and MaxWriteWait set the write deadline for
+	// messages to browser sessions: the base, plus the per-KiB allowance,
+	// capped at the maximum. Zero uses the bridge defaults of 5s, 10ms and 60s.
+	WriteWait      time.Duration
+	WriteWaitPerKB time.Duration
+	MaxWriteWait   time.Duration
+	// ActiveSessionStrategy picks the browser session used when a command or
+	// the admin "active" alias names none: "latest", "oldest" or "recent".
+	// Empty leaves the bridge default, latest, and keeps the key out of the
+	// config file.
+	ActiveSessionStrategy string
+	// ClientIDHeaders are checked, in order, for an MCP client's id on the
+	// streamable and SSE endpoints; AssignedClientIDHeader carries the id the
+	// server hands out to a client that sent none. Proxies that strip or
+	// rename headers can be accommodated here.
+	ClientIDHeaders        []string
+	AssignedClientIDHeader string
+	AdminBaseURL           string
+	TUIRefreshInterval     time.Duration
+	// TUIAutoRestart is how many times the TUI restarts a service it started
+	// that exits unexpectedly, counted from the last manual start; zero
+	// leaves restarting to the user.
+	TUIAutoRestart int
+	AllowedHosts   []string
+	// AllowEvaluate exposes browser.evaluate, which runs arbitrary
+	// JavaScript in the page. It cannot be combined with AllowedHosts.
+	AllowEvaluate bool
+	// DefaultSnapshotFormat is the browser.snapshot format used when a call
+	// names none: "json", "markdown" or "outline". Empty means json.
+	DefaultSnapshotFormat string
+	// DisableSnapshotStorage keeps page snapshots out of memory entirely;
+	// they cannot be read back by id.
+	DisableSnapshotStorage bool
+	// MaxSnapshots and MaxSnapshotMB bound the snapshot store; the least
+	// recently used snapshots are evicted first. A zero MaxSnapshots is
+	// unlimited; a zero MaxSnapshotMB uses page.DefaultMaxBytes.
+	MaxSnapshots  int
+	MaxSnapshotMB int // megabytes
+	// MaxScreenshotMB caps the combined size of stored screenshots; zero
+	// uses screenshot.DefaultMaxBytes.
+	MaxScreenshotMB int // megabytes
+	// MaxTabsPerSession caps open tabs per browser session; zero is unlimited.
+	MaxTabsPerSession int
+	// ReplayDir, when set, serves the recorded pages in this directory
+	// instead of talking to the browser extension; see package replay.
+	ReplayDir     string
+	LogFile       string
+	LogMaxSize    int // megabytes
+	LogMaxBackups int
+	// ToolTimeouts maps MCP tool names to how long they wait on the browser.
+	ToolTimeouts map[string]time.Duration
+	// ToolRateLimit caps tool calls per second per MCP session, allowing
+	// bursts of ToolRateBurst; zero is unlimited.
+	ToolRateLimit float64
+	ToolRateBurst int
+	// DisablePrompts leaves the built-in MCP prompts unregistered.
+	DisablePrompts bool
+	// WorkflowDir holds the saved workflow files; empty means the working
+	// directory.
+	WorkflowDir string
+	// SnapshotMainText fills mainText in snapshots with the article-like body
+	// of the page; see page.ReduceOptions.IncludeMainText.
+	SnapshotMainText bool
+	// SnapshotMaxHTMLInputMB bounds the page HTML handed to the reducer's
+	// parser; zero uses the reducer's default of 4.
+	SnapshotMaxHTMLInputMB int // megabytes
+	// SnapshotUniqueSelectors replaces ambiguous selectors with positional
+	// paths; see page.ReduceOptions.UniqueSelectors.
+	SnapshotUniqueSelectors bool
+	// SnapshotStripTrackingParams removes SnapshotTrackingParams, or
+	// page.DefaultTrackingParams when that is empty, from element hrefs.
+	SnapshotStripTrackingParams bool
+	SnapshotTrackingParams      []string
+	// SnapshotPreserveWhitespace keeps the layout of pre, code and textarea
+	// text; see page.ReduceOptions.PreserveWhitespace.
+	SnapshotPreserveWhitespace bool
 }
 
 type fileConfig struct {
-	Daemon daemonConfig `toml:"daemon"`
-	Auth   authConfig   `toml:"auth"`
-	TUI    tuiConfig    `toml:"tui"`
+	Daemon  daemonConfig  `toml:"daemon"`
+	Auth    authConfig    `toml:"auth"`
+	TUI     tuiConfig     `toml:"tui"`
+	Browser browserConfig `toml:"browser"`
+	Logging loggingConfig `toml:"logging"`
+	Tools   toolsConfig   `toml:"tools"`
+	MCP     mcpConfig     `toml:"mcp"`
+	// Snapshot configures the page reducer behind browser.snapshot.
+	Snapshot snapshotConfig `toml:"snapshot"`
 }
 
 type daemonConfig struct {
 	Addr          string `toml:"addr"`
+	AdminAddr     string `toml:"admin_addr,omitempty"`
 	ClientMaxIdle string `toml:"client_max_idle"`
+	CommandTTL    string `toml:"command_ttl,omitempty"`
+	// ActiveSessionStrategy is omitted to keep existing files unchanged.
+	ActiveSessionStrategy  string   `toml:"active_session_strategy,omitempty"`
+	ClientIDHeaders        []string `toml:"client_id_headers,omitempty"`
+	AssignedClientIDHeader string   `toml:"assigned_client_id_header,omitempty"`
+	IdleTimeout            string   `toml:"idle_timeout,omitempty"`
+	PingInterval           string   `toml:"ping_interval,omitempty"`
+	PongWait               string   `toml:"pong_wait,omitempty"`
+	WriteWait              string   `toml:"write_wait,omitempty"`
+	WriteWaitPerKB         string   `toml:"write_wait_per_kb,omitempty"`
+	MaxWriteWait           string   `toml:"max_write_wait,omitempty"`
 }
 
 type authConfig struct {
-	MCPToken   string `toml:"mcp_token"`
-	AdminToken string `toml:"admin_token"`
+	MCPToken           string              `toml:"mcp_token,omitempty"`
+	MCPTokenFile       string              `toml:"mcp_token_file,omitempty"`
+	AdminToken         string              `toml:"admin_token,omitempty"`
+	AdminTokenFile     string              `toml:"admin_token_file,omitempty"`
+	AdminReadonlyToken string              `toml:"admin_readonly_token,omitempty"`
+	ScopedTokens       map[string][]string `toml:"scoped_tokens,omitempty"`
+	TokenBytes         int                 `toml:"token_bytes,omitempty"`
+	// RequireExplicitTokens is omitted to keep existing files unchanged.
+	RequireExplicitTokens bool `toml:"require_explicit_tokens,omitempty"`
 }
 
 type tuiConfig struct {
 	AdminBaseURL    string `toml:"admin_base_url"`
 	RefreshInterval string `toml:"refresh_interval"`
+	AutoRestart     int    `toml:"auto_restart,omitempty"`
+}
+
+type browserConfig struct {
+	AllowedHosts           []string `toml:"allowed_hosts"`
+	AllowEvaluate          bool     `toml:"allow_evaluate,omitempty"`
+	DefaultSnapshotFormat  string   `toml:"default_snapshot_format,omitempty"`
+	DisableSnapshotStorage bool     `toml:"disable_snapshot_storage,omitempty"`
+	MaxSnapshots           int      `toml:"max_snapshots,omitempty"`
+	MaxSnapshotMB          int      `toml:"max_snapshot_mb,omitempty"`
+	MaxScreenshotMB        int      `toml:"max_screenshot_mb,omitempty"`
+	MaxTabsPerSession      int      `toml:"max_tabs_per_session,omitempty"`
+	ReplayDir              string   `toml:"replay_dir,omitempty"`
+}
+
+type loggingConfig struct {
+	File       string `toml:"file,omitempty"`
+	MaxSize    int    `toml:"max_size,omitempty"`
+	MaxBackups int    `toml:"max_backups,omitempty"`
+}
+
+type toolsConfig struct {
+	Timeouts  map[string]string `toml:"timeouts,omitempty"`
+	RateLimit float64           `toml:"rate_limit,omitempty"`
+	RateBurst int               `toml:"rate_burst,omitempty"`
+}
+
+type mcpConfig struct {
+	DisablePrompts bool   `toml:"disable_prompts,omitempty"`
+	WorkflowDir    string `toml:"workflow_dir,omitempty"`
+}
+
+type snapshotConfig struct {
+	IncludeMainText     bool     `toml:"include_main_text,omitempty"`
+	MaxHTMLInputMB      int      `toml:"max_html_input_mb,omitempty"`
+	UniqueSelectors     bool     `toml:"unique_selectors,omitempty"`
+	StripTrackingParams bool     `toml:"strip_tracking_params,omitempty"`
+	TrackingParams      []string `toml:"tracking_params,omitempty"`
+	PreserveWhitespace  bool     `toml:"preserve_whitespace,omitempty"`
 }
 
 func LoadOrCreate(path string) (Settings, error) {
@@ -63,28 +254,56 @@ func LoadOrCreate(path string) (Settings, error) {
 
 	cfg := defaultFileConfig()
 	exists := false
-	if _, err := os.Stat(path); err == nil {
+	version := ""
+	if data, err := os.ReadFile(path); err == nil {
 		exists = true
 		var onDisk fileConfig
-		if _, err := toml.DecodeFile(path, &onDisk); err != nil {
+		if _, err := toml.Decode(string(data), &onDisk); err != nil {
 			return Settings{}, fmt.Errorf("decode config %s: %w", path, err)
 		}
 		mergeFileConfig(&cfg, onDisk)
+		version = contentVersion(data)
 	} else if !errors.Is(err, os.ErrNotExist) {
-		return Settings{}, fmt.Errorf("stat config %s: %w", path, err)
+		return Settings{}, fmt.Errorf("read config %s: %w", path, err)
 	}
 
+	tokenSize, err := tokenBytes(cfg.Auth)
+	if err != nil {
+		return Settings{}, err
+	}
 	changed := false
-	if strings.TrimSpace(cfg.Auth.MCPToken) == "" {
-		cfg.Auth.MCPToken = randomToken()
+	mcpToken, err := resolveToken(cfg.Auth.MCPToken, cfg.Auth.MCPTokenFile, EnvMCPToken)
+	if err != nil {
+		return Settings{}, fmt.Errorf("resolve auth.mcp_token: %w", err)
+	}
+	if mcpToken == "" && cfg.Auth.RequireExplicitTokens {
+		return Settings{}, missingTokenError("mcp_token", EnvMCPToken)
+	}
+	if mcpToken == "" {
+		cfg.Auth.MCPToken = randomToken(tokenSize)
+		mcpToken = cfg.Auth.MCPToken
 		changed = true
 	}
-	if strings.TrimSpace(cfg.Auth.AdminToken) == "" {
-		cfg.Auth.AdminToken = randomToken()
+	adminToken, err := resolveToken(cfg.Auth.AdminToken, cfg.Auth.AdminTokenFile, EnvAdminToken)
+	if err != nil {
+		return Settings{}, fmt.Errorf("resolve auth.admin_token: %w", err)
+	}
+	if adminToken == "" && cfg.Auth.RequireExplicitTokens {
+		return Settings{}, missingTokenError("admin_token", EnvAdminToken)
+	}
+	if adminToken == "" {
+		cfg.Auth.AdminToken = randomToken(tokenSize)
+		adminToken = cfg.Auth.AdminToken
 		changed = true
 	}
+	if err := checkScopedTokens(cfg.Auth.ScopedTokens, mcpToken, adminToken, cfg.Auth.AdminReadonlyToken); err != nil {
+		return Settings{}, err
+	}
 	if strings.TrimSpace(cfg.TUI.AdminBaseURL) == "" {
 		cfg.TUI.AdminBaseURL = deriveAdminBaseURL(cfg.Daemon.Addr)
+		if v := strings.TrimSpace(cfg.Daemon.AdminAddr); v != "" {
+			cfg.TUI.AdminBaseURL = deriveAdminBaseURL(v)
+		}
 		changed = true
 	}
 	if strings.TrimSpace(cfg.TUI.RefreshInterval) == "" {
@@ -101,7 +320,7 @@ func LoadOrCreate(path string) (Settings, error) {
 	}
 
 	if !exists || changed {
-		if err := writeConfig(path, cfg); err != nil {
+		if version, err = writeConfig(path, cfg); err != nil {
 			return Settings{}, err
 		}
 	}
@@ -110,11 +329,86 @@ func LoadOrCreate(path string) (Settings, error) {
 	if err != nil {
 		return Settings{}, err
 	}
+	settings.Version = version
+	settings.MCPToken = mcpToken
+	settings.AdminToken = adminToken
 	return settings, nil
 }
 
+// resolveToken picks a token from, in order of precedence, the inline value,
+// the contents of file, and the environment variable env. It returns "" when
+// none is set so the caller can generate one. A configured file that cannot be
+// read is an error rather than a silent fallback.
+func resolveToken(inline, file, env string) (string, error) {
+	if v := strings.TrimSpace(inline); v != "" {
+		return v, nil
+	}
+	if file = strings.TrimSpace(file); file != "" {
+		data, err := os.ReadFile(expandHome(file))
+		if err != nil {
+			return "", fmt.Errorf("read token file: %w", err)
+		}
+		v := strings.TrimSpace(string(data))
+		if v == "" {
+			return "", fmt.Errorf("token file %s is empty", file)
+		}
+		return v, nil
+	}
+	return strings.TrimSpace(os.Getenv(env)), nil
+}
+
+// checkScopedTokens rejects scoped tokens that are empty or that equal one
+// of the resolved auth tokens, which would let a scoped token act with that
+// token's full access.
+func checkScopedTokens(scoped map[string][]string, tokens ...string) error {
+	for token := range scoped {
+		if strings.TrimSpace(token) == "" {
+			return errors.New("invalid auth.scoped_tokens: a scoped token is empty")
+		}
+		if slices.Contains(tokens, token) {
+			return errors.New("invalid auth.scoped_tokens: a scoped token is also used as another auth token")
+		}
+	}
+	return nil
+}
+
+// missingTokenError reports a token that auth.require_explicit_tokens
+// forbids generating.
+func missingTokenError(name, env string) error {
+	return fmt.Errorf("auth.%s is not set and auth.require_explicit_tokens forbids generating one; set auth.%s, auth.%s_file or %s", name, name, name, env)
+}
+
+// inlineToken returns the token to persist in the TOML file, or "" when the
+// same token would be resolved from file or env anyway and so must stay out of it.
+func inlineToken(token, file, env string) string {
+	if external, err := resolveToken("", file, env); err == nil && external != "" && external == strings.TrimSpace(token) {
+		return ""
+	}
+	return token
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, strings.TrimPrefix(path, "~"))
+		}
+	}
+	return path
+}
+
+// ErrConflict is wrapped by Save errors when the config file was changed by
+// someone else since the settings being saved were loaded.
+var ErrConflict = errors.New("config file changed since it was loaded; reload it and reapply the changes")
+
+// saveMu orders saves within one process. Across processes (mcpd and the
+// TUI) the version check and the atomic rename in writeConfig leave only the
+// moment between them for a write to slip through.
+var saveMu sync.Mutex
+
 // Save writes settings to disk and returns the normalized values loaded back
 // from the config file (including defaults and generated tokens when needed).
+// When settings.Version is set and no longer matches the file, nothing is
+// written and the error wraps ErrConflict; an empty Version always writes.
 func Save(settings Settings) (Settings, error) {
 	path := strings.TrimSpace(settings.Path)
 	if path == "" {
@@ -125,18 +419,90 @@ func Save(settings Settings) (Settings, error) {
 		}
 	}
 
+	// Defaults toSettings filled in are left out again, so saving unchanged
+	// settings does not rewrite the file.
+	idHeaders, assignedHeader := settings.ClientIDHeaders, settings.AssignedClientIDHeader
+	if slices.Equal(idHeaders, DefaultClientIDHeaders) {
+		idHeaders = nil
+	}
+	if assignedHeader == defaultAssignedHeader {
+		assignedHeader = ""
+	}
+	logMaxSize, logMaxBackups := settings.LogMaxSize, settings.LogMaxBackups
+	if logMaxSize == defaultLogMaxSize {
+		logMaxSize = 0
+	}
+	if logMaxBackups == defaultLogMaxBackups {
+		logMaxBackups = 0
+	}
+	// A negative ping interval disables pings, so only zero is left unset.
+	pingInterval := ""
+	if settings.PingInterval != 0 {
+		pingInterval = settings.PingInterval.String()
+	}
 	cfg := fileConfig{
 		Daemon: daemonConfig{
-			Addr:          settings.DaemonAddr,
-			ClientMaxIdle: settings.ClientMaxIdle.String(),
+			Addr:                   settings.DaemonAddr,
+			AdminAddr:              settings.AdminAddr,
+			ClientMaxIdle:          settings.ClientMaxIdle.String(),
+			CommandTTL:             durationString(settings.CommandTTL),
+			ActiveSessionStrategy:  settings.ActiveSessionStrategy,
+			ClientIDHeaders:        idHeaders,
+			AssignedClientIDHeader: assignedHeader,
+			IdleTimeout:            durationString(settings.IdleTimeout),
+			PingInterval:           pingInterval,
+			PongWait:               durationString(settings.PongWait),
+			WriteWait:              durationString(settings.WriteWait),
+			WriteWaitPerKB:         durationString(settings.WriteWaitPerKB),
+			MaxWriteWait:           durationString(settings.MaxWriteWait),
 		},
 		Auth: authConfig{
-			MCPToken:   settings.MCPToken,
-			AdminToken: settings.AdminToken,
+			MCPToken:              inlineToken(settings.MCPToken, settings.MCPTokenFile, EnvMCPToken),
+			MCPTokenFile:          settings.MCPTokenFile,
+			AdminToken:            inlineToken(settings.AdminToken, settings.AdminTokenFile, EnvAdminToken),
+			AdminTokenFile:        settings.AdminTokenFile,
+			AdminReadonlyToken:    settings.AdminReadonlyToken,
+			ScopedTokens:          settings.ScopedTokens,
+			TokenBytes:            settings.TokenBytes,
+			RequireExplicitTokens: settings.RequireExplicitTokens,
 		},
 		TUI: tuiConfig{
 			AdminBaseURL:    settings.AdminBaseURL,
 			RefreshInterval: settings.TUIRefreshInterval.String(),
+			AutoRestart:     settings.TUIAutoRestart,
+		},
+		Browser: browserConfig{
+			AllowedHosts:           settings.AllowedHosts,
+			AllowEvaluate:          settings.AllowEvaluate,
+			DefaultSnapshotFormat:  settings.DefaultSnapshotFormat,
+			DisableSnapshotStorage: settings.DisableSnapshotStorage,
+			MaxSnapshots:           settings.MaxSnapshots,
+			MaxSnapshotMB:          settings.MaxSnapshotMB,
+			MaxScreenshotMB:        settings.MaxScreenshotMB,
+			MaxTabsPerSession:      settings.MaxTabsPerSession,
+			ReplayDir:              settings.ReplayDir,
+		},
+		Logging: loggingConfig{
+			File:       settings.LogFile,
+			MaxSize:    logMaxSize,
+			MaxBackups: logMaxBackups,
+		},
+		Tools: toolsConfig{
+			Timeouts:  FormatTimeouts(settings.ToolTimeouts),
+			RateLimit: settings.ToolRateLimit,
+			RateBurst: settings.ToolRateBurst,
+		},
+		MCP: mcpConfig{
+			DisablePrompts: settings.DisablePrompts,
+			WorkflowDir:    settings.WorkflowDir,
+		},
+		Snapshot: snapshotConfig{
+			IncludeMainText:     settings.SnapshotMainText,
+			MaxHTMLInputMB:      settings.SnapshotMaxHTMLInputMB,
+			UniqueSelectors:     settings.SnapshotUniqueSelectors,
+			StripTrackingParams: settings.SnapshotStripTrackingParams,
+			TrackingParams:      settings.SnapshotTrackingParams,
+			PreserveWhitespace:  settings.SnapshotPreserveWhitespace,
 		},
 	}
 
@@ -147,12 +513,41 @@ func Save(settings Settings) (Settings, error) {
 		cfg.TUI.RefreshInterval = defaultRefreshInterval.String()
 	}
 
-	if err := writeConfig(path, cfg); err != nil {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+	if settings.Version != "" {
+		current, err := FileVersion(path)
+		if err != nil {
+			return Settings{}, err
+		}
+		if current != settings.Version {
+			return Settings{}, fmt.Errorf("save %s: %w", path, ErrConflict)
+		}
+	}
+	if _, err := writeConfig(path, cfg); err != nil {
 		return Settings{}, err
 	}
 	return LoadOrCreate(path)
 }
 
+// FileVersion returns the version of the config file at path as
+// Settings.Version would report it, or "" when there is no file.
+func FileVersion(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read config %s: %w", path, err)
+	}
+	return contentVersion(data), nil
+}
+
+func contentVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
 func DefaultPath() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
@@ -177,21 +572,144 @@ func mergeFileConfig(dst *fileConfig, src fileConfig) {
 	if v := strings.TrimSpace(src.Daemon.Addr); v != "" {
 		dst.Daemon.Addr = v
 	}
+	if v := strings.TrimSpace(src.Daemon.AdminAddr); v != "" {
+		dst.Daemon.AdminAddr = v
+	}
 	if v := strings.TrimSpace(src.Daemon.ClientMaxIdle); v != "" {
 		dst.Daemon.ClientMaxIdle = v
 	}
+	if v := strings.TrimSpace(src.Daemon.CommandTTL); v != "" {
+		dst.Daemon.CommandTTL = v
+	}
+	if v := strings.TrimSpace(src.Daemon.ActiveSessionStrategy); v != "" {
+		dst.Daemon.ActiveSessionStrategy = v
+	}
+	if len(src.Daemon.ClientIDHeaders) > 0 {
+		dst.Daemon.ClientIDHeaders = src.Daemon.ClientIDHeaders
+	}
+	if v := strings.TrimSpace(src.Daemon.AssignedClientIDHeader); v != "" {
+		dst.Daemon.AssignedClientIDHeader = v
+	}
+	if v := strings.TrimSpace(src.Daemon.IdleTimeout); v != "" {
+		dst.Daemon.IdleTimeout = v
+	}
+	if v := strings.TrimSpace(src.Daemon.PingInterval); v != "" {
+		dst.Daemon.PingInterval = v
+	}
+	if v := strings.TrimSpace(src.Daemon.PongWait); v != "" {
+		dst.Daemon.PongWait = v
+	}
+	if v := strings.TrimSpace(src.Daemon.WriteWait); v != "" {
+		dst.Daemon.WriteWait = v
+	}
+	if v := strings.TrimSpace(src.Daemon.WriteWaitPerKB); v != "" {
+		dst.Daemon.WriteWaitPerKB = v
+	}
+	if v := strings.TrimSpace(src.Daemon.MaxWriteWait); v != "" {
+		dst.Daemon.MaxWriteWait = v
+	}
 	if v := strings.TrimSpace(src.Auth.MCPToken); v != "" {
 		dst.Auth.MCPToken = v
 	}
 	if v := strings.TrimSpace(src.Auth.AdminToken); v != "" {
 		dst.Auth.AdminToken = v
 	}
+	if v := strings.TrimSpace(src.Auth.MCPTokenFile); v != "" {
+		dst.Auth.MCPTokenFile = v
+	}
+	if v := strings.TrimSpace(src.Auth.AdminTokenFile); v != "" {
+		dst.Auth.AdminTokenFile = v
+	}
+	if v := strings.TrimSpace(src.Auth.AdminReadonlyToken); v != "" {
+		dst.Auth.AdminReadonlyToken = v
+	}
+	if len(src.Auth.ScopedTokens) > 0 {
+		dst.Auth.ScopedTokens = src.Auth.ScopedTokens
+	}
+	if src.Auth.TokenBytes != 0 {
+		dst.Auth.TokenBytes = src.Auth.TokenBytes
+	}
+	if src.Auth.RequireExplicitTokens {
+		dst.Auth.RequireExplicitTokens = true
+	}
 	if v := strings.TrimSpace(src.TUI.AdminBaseURL); v != "" {
 		dst.TUI.AdminBaseURL = v
 	}
 	if v := strings.TrimSpace(src.TUI.RefreshInterval); v != "" {
 		dst.TUI.RefreshInterval = v
 	}
+	if src.TUI.AutoRestart != 0 {
+		dst.TUI.AutoRestart = src.TUI.AutoRestart
+	}
+	if len(src.Browser.AllowedHosts) > 0 {
+		dst.Browser.AllowedHosts = src.Browser.AllowedHosts
+	}
+	if v := strings.TrimSpace(src.Browser.DefaultSnapshotFormat); v != "" {
+		dst.Browser.DefaultSnapshotFormat = v
+	}
+	if src.Browser.AllowEvaluate {
+		dst.Browser.AllowEvaluate = true
+	}
+	if src.Browser.DisableSnapshotStorage {
+		dst.Browser.DisableSnapshotStorage = true
+	}
+	if src.Browser.MaxSnapshots != 0 {
+		dst.Browser.MaxSnapshots = src.Browser.MaxSnapshots
+	}
+	if src.Browser.MaxSnapshotMB != 0 {
+		dst.Browser.MaxSnapshotMB = src.Browser.MaxSnapshotMB
+	}
+	if src.Browser.MaxScreenshotMB != 0 {
+		dst.Browser.MaxScreenshotMB = src.Browser.MaxScreenshotMB
+	}
+	if src.Browser.MaxTabsPerSession != 0 {
+		dst.Browser.MaxTabsPerSession = src.Browser.MaxTabsPerSession
+	}
+	if v := strings.TrimSpace(src.Browser.ReplayDir); v != "" {
+		dst.Browser.ReplayDir = v
+	}
+	if v := strings.TrimSpace(src.Logging.File); v != "" {
+		dst.Logging.File = v
+	}
+	if src.Logging.MaxSize > 0 {
+		dst.Logging.MaxSize = src.Logging.MaxSize
+	}
+	if src.Logging.MaxBackups > 0 {
+		dst.Logging.MaxBackups = src.Logging.MaxBackups
+	}
+	if len(src.Tools.Timeouts) > 0 {
+		dst.Tools.Timeouts = src.Tools.Timeouts
+	}
+	if src.Tools.RateLimit != 0 {
+		dst.Tools.RateLimit = src.Tools.RateLimit
+	}
+	if src.Tools.RateBurst != 0 {
+		dst.Tools.RateBurst = src.Tools.RateBurst
+	}
+	if src.MCP.DisablePrompts {
+		dst.MCP.DisablePrompts = true
+	}
+	if v := strings.TrimSpace(src.MCP.WorkflowDir); v != "" {
+		dst.MCP.WorkflowDir = v
+	}
+	if src.Snapshot.IncludeMainText {
+		dst.Snapshot.IncludeMainText = true
+	}
+	if src.Snapshot.MaxHTMLInputMB != 0 {
+		dst.Snapshot.MaxHTMLInputMB = src.Snapshot.MaxHTMLInputMB
+	}
+	if src.Snapshot.UniqueSelectors {
+		dst.Snapshot.UniqueSelectors = true
+	}
+	if src.Snapshot.StripTrackingParams {
+		dst.Snapshot.StripTrackingParams = true
+	}
+	if len(src.Snapshot.TrackingParams) > 0 {
+		dst.Snapshot.TrackingParams = src.Snapshot.TrackingParams
+	}
+	if src.Snapshot.PreserveWhitespace {
+		dst.Snapshot.PreserveWhitespace = true
+	}
 }
 
 func toSettings(path string, cfg fileConfig) (Settings, error) {
@@ -199,38 +717,261 @@ func toSettings(path string, cfg fileConfig) (Settings, error) {
 	if err != nil {
 		return Settings{}, fmt.Errorf("invalid daemon.client_max_idle duration: %w", err)
 	}
+	commandTTL, err := optionalDuration("daemon.command_ttl", cfg.Daemon.CommandTTL)
+	if err != nil {
+		return Settings{}, err
+	}
+	idleTimeout, err := optionalDuration("daemon.idle_timeout", cfg.Daemon.IdleTimeout)
+	if err != nil {
+		return Settings{}, err
+	}
+	var pingInterval time.Duration
+	if v := strings.TrimSpace(cfg.Daemon.PingInterval); v != "" {
+		if pingInterval, err = time.ParseDuration(v); err != nil {
+			return Settings{}, fmt.Errorf("invalid daemon.ping_interval %q (want a duration such as \"30s\", or a negative one to disable pings)", v)
+		}
+	}
+	pongWait, err := optionalDuration("daemon.pong_wait", cfg.Daemon.PongWait)
+	if err != nil {
+		return Settings{}, err
+	}
+	writeWait, err := optionalDuration("daemon.write_wait", cfg.Daemon.WriteWait)
+	if err != nil {
+		return Settings{}, err
+	}
+	writeWaitPerKB, err := optionalDuration("daemon.write_wait_per_kb", cfg.Daemon.WriteWaitPerKB)
+	if err != nil {
+		return Settings{}, err
+	}
+	maxWriteWait, err := optionalDuration("daemon.max_write_wait", cfg.Daemon.MaxWriteWait)
+	if err != nil {
+		return Settings{}, err
+	}
 	refresh, err := time.ParseDuration(cfg.TUI.RefreshInterval)
 	if err != nil {
 		return Settings{}, fmt.Errorf("invalid tui.refresh_interval duration: %w", err)
 	}
+	timeouts, err := ParseTimeouts(cfg.Tools.Timeouts)
+	if err != nil {
+		return Settings{}, err
+	}
+	if _, err := tokenBytes(cfg.Auth); err != nil {
+		return Settings{}, err
+	}
+	strategy := strings.ToLower(strings.TrimSpace(cfg.Daemon.ActiveSessionStrategy))
+	switch strategy {
+	case "", "latest", "oldest", "recent":
+	default:
+		return Settings{}, fmt.Errorf("invalid daemon.active_session_strategy %q (want latest, oldest or recent)", strategy)
+	}
+	snapshotFormat, err := page.ParseFormat(cfg.Browser.DefaultSnapshotFormat)
+	if err != nil {
+		return Settings{}, fmt.Errorf("invalid browser.default_snapshot_format: %w", err)
+	}
+	idHeaders, assignedHeader, err := clientIDHeaders(cfg.Daemon)
+	if err != nil {
+		return Settings{}, err
+	}
+	if cfg.Browser.MaxSnapshots < 0 {
+		return Settings{}, fmt.Errorf("invalid browser.max_snapshots %d (want 0 for unlimited or a positive count)", cfg.Browser.MaxSnapshots)
+	}
+	if cfg.Browser.MaxSnapshotMB < 0 {
+		return Settings{}, fmt.Errorf("invalid browser.max_snapshot_mb %d (want 0 for the default or a positive size)", cfg.Browser.MaxSnapshotMB)
+	}
+	if cfg.Browser.MaxScreenshotMB < 0 {
+		return Settings{}, fmt.Errorf("invalid browser.max_screenshot_mb %d (want 0 for the default or a positive size)", cfg.Browser.MaxScreenshotMB)
+	}
+	if cfg.Browser.MaxTabsPerSession < 0 {
+		return Settings{}, fmt.Errorf("invalid browser.max_tabs_per_session %d (want 0 for unlimited or a positive count)", cfg.Browser.MaxTabsPerSession)
+	}
+	if cfg.Browser.AllowEvaluate && len(cfg.Browser.AllowedHosts) > 0 {
+		return Settings{}, errors.New("browser.allow_evaluate cannot be combined with browser.allowed_hosts: a script could navigate to any host")
+	}
+	if cfg.Snapshot.MaxHTMLInputMB < 0 {
+		return Settings{}, fmt.Errorf("invalid snapshot.max_html_input_mb %d (want 0 for the default or a positive size)", cfg.Snapshot.MaxHTMLInputMB)
+	}
+	if cfg.TUI.AutoRestart < 0 {
+		return Settings{}, fmt.Errorf("invalid tui.auto_restart %d (want 0 to disable or a number of attempts)", cfg.TUI.AutoRestart)
+	}
+	if cfg.Tools.RateLimit < 0 {
+		return Settings{}, fmt.Errorf("invalid tools.rate_limit %g (want 0 for unlimited or calls per second)", cfg.Tools.RateLimit)
+	}
+	if cfg.Tools.RateBurst < 0 {
+		return Settings{}, fmt.Errorf("invalid tools.rate_burst %d (want 0 for the default or a positive count)", cfg.Tools.RateBurst)
+	}
 	return Settings{
-		Path:               path,
-		DaemonAddr:         cfg.Daemon.Addr,
-		MCPToken:           cfg.Auth.MCPToken,
-		AdminToken:         cfg.Auth.AdminToken,
-		ClientMaxIdle:      maxIdle,
-		AdminBaseURL:       cfg.TUI.AdminBaseURL,
-		TUIRefreshInterval: refresh,
+		Path:                   path,
+		DaemonAddr:             cfg.Daemon.Addr,
+		AdminAddr:              strings.TrimSpace(cfg.Daemon.AdminAddr),
+		MCPToken:               cfg.Auth.MCPToken,
+		MCPTokenFile:           cfg.Auth.MCPTokenFile,
+		AdminToken:             cfg.Auth.AdminToken,
+		AdminTokenFile:         cfg.Auth.AdminTokenFile,
+		AdminReadonlyToken:     cfg.Auth.AdminReadonlyToken,
+		ScopedTokens:           cfg.Auth.ScopedTokens,
+		TokenBytes:             cfg.Auth.TokenBytes,
+		RequireExplicitTokens:  cfg.Auth.RequireExplicitTokens,
+		ClientMaxIdle:          maxIdle,
+		CommandTTL:             commandTTL,
+		IdleTimeout:            idleTimeout,
+		PingInterval:           pingInterval,
+		PongWait:               pongWait,
+		WriteWait:              writeWait,
+		WriteWaitPerKB:         writeWaitPerKB,
+		MaxWriteWait:           maxWriteWait,
+		ActiveSessionStrategy:  strategy,
+		ClientIDHeaders:        idHeaders,
+		AssignedClientIDHeader: assignedHeader,
+		AdminBaseURL:           cfg.TUI.AdminBaseURL,
+		TUIRefreshInterval:     refresh,
+		TUIAutoRestart:         cfg.TUI.AutoRestart,
+		AllowedHosts:           cfg.Browser.AllowedHosts,
+		AllowEvaluate:          cfg.Browser.AllowEvaluate,
+		DefaultSnapshotFormat:  snapshotFormat,
+		DisableSnapshotStorage: cfg.Browser.DisableSnapshotStorage,
+		MaxSnapshots:           cfg.Browser.MaxSnapshots,
+		MaxSnapshotMB:          cfg.Browser.MaxSnapshotMB,
+		MaxScreenshotMB:        cfg.Browser.MaxScreenshotMB,
+		MaxTabsPerSession:      cfg.Browser.MaxTabsPerSession,
+		ReplayDir:              expandHome(strings.TrimSpace(cfg.Browser.ReplayDir)),
+		LogFile:                expandHome(cfg.Logging.File),
+		LogMaxSize:             orDefault(cfg.Logging.MaxSize, defaultLogMaxSize),
+		LogMaxBackups:          orDefault(cfg.Logging.MaxBackups, defaultLogMaxBackups),
+		ToolTimeouts:           timeouts,
+		ToolRateLimit:          cfg.Tools.RateLimit,
+		ToolRateBurst:          cfg.Tools.RateBurst,
+		DisablePrompts:         cfg.MCP.DisablePrompts,
+		WorkflowDir:            expandHome(cfg.MCP.WorkflowDir),
+		// Page reducer options.
+		SnapshotMainText:            cfg.Snapshot.IncludeMainText,
+		SnapshotMaxHTMLInputMB:      cfg.Snapshot.MaxHTMLInputMB,
+		SnapshotUniqueSelectors:     cfg.Snapshot.UniqueSelectors,
+		SnapshotStripTrackingParams: cfg.Snapshot.StripTrackingParams,
+		SnapshotTrackingParams:      cfg.Snapshot.TrackingParams,
+		SnapshotPreserveWhitespace:  cfg.Snapshot.PreserveWhitespace,
 	}, nil
 }
 
-func writeConfig(path string, cfg fileConfig) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
-		return fmt.Errorf("create config dir: %w", err)
+// clientIDHeaders validates the configured client id header names and fills
+// in the defaults for those left unset.
+func clientIDHeaders(cfg daemonConfig) ([]string, string, error) {
+	headers := make([]string, 0, len(cfg.ClientIDHeaders))
+	for _, h := range cfg.ClientIDHeaders {
+		h = strings.TrimSpace(h)
+		if !ValidHeaderName(h) {
+			return nil, "", fmt.Errorf("invalid daemon.client_id_headers entry %q (want an HTTP header name)", h)
+		}
+		headers = append(headers, http.CanonicalHeaderKey(h))
 	}
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
-	if err != nil {
-		return fmt.Errorf("open config file: %w", err)
+	if len(headers) == 0 {
+		headers = slices.Clone(DefaultClientIDHeaders)
 	}
-	defer file.Close()
+	assigned := strings.TrimSpace(cfg.AssignedClientIDHeader)
+	if assigned == "" {
+		assigned = defaultAssignedHeader
+	}
+	if !ValidHeaderName(assigned) {
+		return nil, "", fmt.Errorf("invalid daemon.assigned_client_id_header %q (want an HTTP header name)", assigned)
+	}
+	return headers, http.CanonicalHeaderKey(assigned), nil
+}
 
-	if _, err := file.WriteString("# SurfingBro config for mcpd and mpcd-tui\n\n"); err != nil {
-		return fmt.Errorf("write config header: %w", err)
+// ValidHeaderName reports whether name can be used as an HTTP header name.
+func ValidHeaderName(name string) bool {
+	return httpguts.ValidHeaderFieldName(name)
+}
+
+// ParseTimeouts parses tools.timeouts values such as "45s", which must be
+// positive. It does not check the tool names; see
+// mcpserver.ValidateToolTimeouts.
+func ParseTimeouts(raw map[string]string) (map[string]time.Duration, error) {
+	if len(raw) == 0 {
+		return nil, nil
 	}
-	if err := toml.NewEncoder(file).Encode(cfg); err != nil {
-		return fmt.Errorf("encode config: %w", err)
+	out := make(map[string]time.Duration, len(raw))
+	for name, v := range raw {
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid tools.timeouts.%q duration: %w", name, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("tools.timeouts.%q must be positive", name)
+		}
+		out[name] = d
 	}
-	return nil
+	return out, nil
+}
+
+// FormatTimeouts is the inverse of ParseTimeouts.
+func FormatTimeouts(timeouts map[string]time.Duration) map[string]string {
+	if len(timeouts) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(timeouts))
+	for name, d := range timeouts {
+		out[name] = d.String()
+	}
+	return out
+}
+
+func orDefault(v, def int) int {
+	if v <= 0 {
+		return def
+	}
+	return v
+}
+
+// optionalDuration parses the duration key name, which may be left unset
+// (zero) but not negative.
+func optionalDuration(name, v string) (time.Duration, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %s %q (want a positive duration such as \"5m\")", name, v)
+	}
+	return d, nil
+}
+
+// durationString formats d for an optional duration key, leaving zero unset.
+func durationString(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// writeConfig replaces the file at path in one rename, so readers never see
+// a half-written config, and returns the new contents' version.
+func writeConfig(path string, cfg fileConfig) (string, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("create config dir: %w", err)
+	}
+	var buf bytes.Buffer
+	buf.WriteString("# SurfingBro config for mcpd and mpcd-tui\n\n")
+	if err := toml.NewEncoder(&buf).Encode(cfg); err != nil {
+		return "", fmt.Errorf("encode config: %w", err)
+	}
+
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return "", fmt.Errorf("create config file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return "", fmt.Errorf("write config file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("write config file: %w", err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return "", fmt.Errorf("replace config file: %w", err)
+	}
+	return contentVersion(buf.Bytes()), nil
 }
 
 func deriveAdminBaseURL(addr string) string {
@@ -257,6 +998,47 @@ func deriveAdminBaseURL(addr string) string {
 	return "http://" + net.JoinHostPort(host, "9099")
 }
 
-func randomToken() string {
-	return strings.ReplaceAll(uuid.NewString(), "-", "")
+// WebSocketURL returns the URL the browser extension should connect to. It
+// follows tui.admin_base_url, so an https base (for example behind a TLS
+// proxy) yields wss, and falls back to daemon.addr when that is unset. A
+// base URL that was only derived from daemon.admin_addr names the admin
+// listener, which does not serve /ws, so daemon.addr is used then too; one
+// the user set, such as a reverse proxy, is kept.
+func WebSocketURL(settings Settings) string {
+	base := strings.TrimSpace(settings.AdminBaseURL)
+	if adminAddr := strings.TrimSpace(settings.AdminAddr); adminAddr != "" && strings.TrimRight(base, "/") == deriveAdminBaseURL(adminAddr) {
+		base = ""
+	}
+	if base == "" {
+		base = deriveAdminBaseURL(settings.DaemonAddr)
+	}
+	base = strings.TrimRight(base, "/")
+	switch {
+	case strings.HasPrefix(base, "https://"):
+		base = "wss://" + strings.TrimPrefix(base, "https://")
+	case strings.HasPrefix(base, "http://"):
+		base = "ws://" + strings.TrimPrefix(base, "http://")
+	}
+	return base + "/ws"
+}
+
+// tokenBytes returns auth.token_bytes, or the default when unset.
+func tokenBytes(auth authConfig) (int, error) {
+	n := auth.TokenBytes
+	if n == 0 {
+		n = defaultTokenBytes
+	}
+	if n < minTokenBytes {
+		return 0, fmt.Errorf("invalid auth.token_bytes %d (want at least %d)", n, minTokenBytes)
+	}
+	return n, nil
+}
+
+// randomToken returns n bytes from crypto/rand as unpadded URL-safe base64.
+// Tokens are compared as opaque strings, so ones generated in the older
+// 32-character hex form stay valid.
+func randomToken(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b) // never fails; see crypto/rand.Read
+	return base64.RawURLEncoding.EncodeToString(b)
 }
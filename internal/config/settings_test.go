@@ -0,0 +1,528 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokensFromFileAndEnv(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "mcp.token")
+	if err := os.WriteFile(tokenFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(EnvMCPToken, "from-env-ignored")
+	t.Setenv(EnvAdminToken, "from-env")
+	path := filepath.Join(dir, "config.toml")
+	writeTOML(t, path, "[auth]\nmcp_token_file = \""+tokenFile+"\"\n")
+
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if settings.MCPToken != "from-file" {
+		t.Fatalf("expected file token to win over env, got %q", settings.MCPToken)
+	}
+	if settings.AdminToken != "from-env" {
+		t.Fatalf("expected env admin token, got %q", settings.AdminToken)
+	}
+
+	if _, err := Save(settings); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "from-file") || strings.Contains(string(data), "from-env") {
+		t.Fatalf("expected externally sourced tokens to stay out of the config file:\n%s", data)
+	}
+
+	writeTOML(t, path, "[auth]\nmcp_token = \"inline\"\nmcp_token_file = \""+tokenFile+"\"\n")
+	settings, err = LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if settings.MCPToken != "inline" {
+		t.Fatalf("expected inline token to take precedence, got %q", settings.MCPToken)
+	}
+}
+
+func TestMissingTokenFileIsAnError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	writeTOML(t, path, "[auth]\nadmin_token_file = \""+filepath.Join(dir, "missing")+"\"\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "admin_token") {
+		t.Fatalf("expected missing token file error, got %v", err)
+	}
+}
+
+func TestRequireExplicitTokens(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	t.Setenv(EnvMCPToken, "")
+	t.Setenv(EnvAdminToken, "")
+	body := "[auth]\nrequire_explicit_tokens = true\nadmin_token = \"admin\"\n"
+	writeTOML(t, path, body)
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "auth.mcp_token") || !strings.Contains(err.Error(), EnvMCPToken) {
+		t.Fatalf("expected a missing mcp_token error, got %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != body {
+		t.Fatalf("expected the config file to be left alone, got:\n%s", data)
+	}
+
+	t.Setenv(EnvMCPToken, "from-env")
+	writeTOML(t, path, "[auth]\nrequire_explicit_tokens = true\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "auth.admin_token") {
+		t.Fatalf("expected a missing admin_token error, got %v", err)
+	}
+
+	t.Setenv(EnvAdminToken, "admin-from-env")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !settings.RequireExplicitTokens || settings.MCPToken != "from-env" || settings.AdminToken != "admin-from-env" {
+		t.Fatalf("unexpected settings %+v", settings)
+	}
+	if _, err := Save(settings); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "require_explicit_tokens = true") {
+		t.Fatalf("expected the flag to survive a save:\n%s", data)
+	}
+}
+
+func writeTOML(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWebSocketURL(t *testing.T) {
+	cases := []struct {
+		addr, adminAddr, base, want string
+	}{
+		{":9099", "", "", "ws://127.0.0.1:9099/ws"},
+		{"0.0.0.0:8080", "", "", "ws://127.0.0.1:8080/ws"},
+		{"bros.local:7000", "", "", "ws://bros.local:7000/ws"},
+		{":9099", "", "http://10.0.0.5:9099/", "ws://10.0.0.5:9099/ws"},
+		{":9099", "", "https://bros.example.com", "wss://bros.example.com/ws"},
+		{":9099", "", "https://bros.example.com/surfing", "wss://bros.example.com/surfing/ws"},
+		{":9099", ":9100", "http://127.0.0.1:9100", "ws://127.0.0.1:9099/ws"},
+		{":9099", ":9100", "", "ws://127.0.0.1:9099/ws"},
+		{":9099", ":9100", "https://bros.example.com", "wss://bros.example.com/ws"},
+	}
+	for _, tc := range cases {
+		got := WebSocketURL(Settings{DaemonAddr: tc.addr, AdminAddr: tc.adminAddr, AdminBaseURL: tc.base})
+		if got != tc.want {
+			t.Fatalf("WebSocketURL(%q, %q, %q) = %q, want %q", tc.addr, tc.adminAddr, tc.base, got, tc.want)
+		}
+	}
+}
+
+func TestToolTimeouts(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	writeTOML(t, path, "[tools.timeouts]\n\"browser.wait_for_selector\" = \"45s\"\n")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := settings.ToolTimeouts["browser.wait_for_selector"]; got != 45*time.Second {
+		t.Fatalf("expected 45s wait_for_selector timeout, got %s", got)
+	}
+
+	saved, err := Save(settings)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if got := saved.ToolTimeouts["browser.wait_for_selector"]; got != 45*time.Second {
+		t.Fatalf("expected timeout to survive a save, got %s", got)
+	}
+
+	writeTOML(t, path, "[tools.timeouts]\n\"browser.find\" = \"soon\"\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "browser.find") {
+		t.Fatalf("expected invalid duration error naming the tool, got %v", err)
+	}
+}
+
+func TestScopedTokens(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	writeTOML(t, path, "[auth]\nadmin_token = \"full\"\n[auth.scoped_tokens]\ntabs = [\"browsers:write\", \"status:read\"]\n")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if got := settings.ScopedTokens["tabs"]; !slices.Equal(got, []string{"browsers:write", "status:read"}) {
+		t.Fatalf("unexpected scopes %v", got)
+	}
+	saved, err := Save(settings)
+	if err != nil || len(saved.ScopedTokens["tabs"]) != 2 {
+		t.Fatalf("expected scoped tokens to survive a save, got %v (%v)", saved.ScopedTokens, err)
+	}
+
+	writeTOML(t, path, "[auth]\nadmin_token = \"full\"\n[auth.scoped_tokens]\nfull = [\"mcp\"]\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "scoped_tokens") {
+		t.Fatalf("expected a scoped token reusing the admin token to be rejected, got %v", err)
+	}
+
+	t.Setenv(EnvAdminToken, "from-env")
+	writeTOML(t, path, "[auth.scoped_tokens]\nfrom-env = [\"mcp\"]\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "scoped_tokens") {
+		t.Fatalf("expected a scoped token reusing the env admin token to be rejected, got %v", err)
+	}
+
+	writeTOML(t, path, "[auth]\nadmin_token = \"full\"\n[auth.scoped_tokens]\n\"\" = [\"mcp\"]\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Fatalf("expected an empty scoped token to be rejected, got %v", err)
+	}
+}
+
+func TestMaxTabsPerSession(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	writeTOML(t, path, "[browser]\nmax_tabs_per_session = 12\n")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if settings.MaxTabsPerSession != 12 {
+		t.Fatalf("expected max_tabs_per_session 12, got %d", settings.MaxTabsPerSession)
+	}
+	saved, err := Save(settings)
+	if err != nil || saved.MaxTabsPerSession != 12 {
+		t.Fatalf("expected the limit to survive a save, got %d (%v)", saved.MaxTabsPerSession, err)
+	}
+
+	writeTOML(t, path, "[browser]\nmax_tabs_per_session = -1\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "max_tabs_per_session") {
+		t.Fatalf("expected a negative limit to be rejected, got %v", err)
+	}
+}
+
+func TestToolRateLimit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	writeTOML(t, path, "[tools]\nrate_limit = 2.5\nrate_burst = 4\n\n[tools.timeouts]\n\"browser.click\" = \"5s\"\n")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if settings.ToolRateLimit != 2.5 || settings.ToolRateBurst != 4 {
+		t.Fatalf("expected rate 2.5 burst 4, got %g %d", settings.ToolRateLimit, settings.ToolRateBurst)
+	}
+	saved, err := Save(settings)
+	if err != nil || saved.ToolRateLimit != 2.5 || saved.ToolRateBurst != 4 || len(saved.ToolTimeouts) != 1 {
+		t.Fatalf("expected the limit to survive a save, got %+v (%v)", saved, err)
+	}
+
+	writeTOML(t, path, "[tools]\nrate_limit = -1\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "rate_limit") {
+		t.Fatalf("expected a negative rate to be rejected, got %v", err)
+	}
+}
+
+func TestClientIDHeaders(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !slices.Equal(settings.ClientIDHeaders, DefaultClientIDHeaders) || settings.AssignedClientIDHeader != "X-Assigned-Client-Id" {
+		t.Fatalf("expected the default headers, got %v and %q", settings.ClientIDHeaders, settings.AssignedClientIDHeader)
+	}
+
+	writeTOML(t, path, "[daemon]\nclient_id_headers = [\"x-proxy-client\"]\nassigned_client_id_header = \"X-Proxy-Assigned\"\n")
+	settings, err = LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !slices.Equal(settings.ClientIDHeaders, []string{"X-Proxy-Client"}) || settings.AssignedClientIDHeader != "X-Proxy-Assigned" {
+		t.Fatalf("expected the configured headers, got %v and %q", settings.ClientIDHeaders, settings.AssignedClientIDHeader)
+	}
+	saved, err := Save(settings)
+	if err != nil || !slices.Equal(saved.ClientIDHeaders, settings.ClientIDHeaders) || saved.AssignedClientIDHeader != "X-Proxy-Assigned" {
+		t.Fatalf("expected the headers to survive a save, got %+v (%v)", saved, err)
+	}
+
+	writeTOML(t, path, "[daemon]\nclient_id_headers = [\"X Client\"]\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "client_id_headers") {
+		t.Fatalf("expected a header name with a space to be rejected, got %v", err)
+	}
+}
+
+func TestRandomToken(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		tok := randomToken(defaultTokenBytes)
+		if len(tok) != 43 {
+			t.Fatalf("expected 43 characters for 32 bytes, got %d (%q)", len(tok), tok)
+		}
+		for _, r := range tok {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				t.Fatalf("token %q has non URL-safe character %q", tok, r)
+			}
+		}
+		if seen[tok] {
+			t.Fatalf("duplicate token %q after %d calls", tok, i)
+		}
+		seen[tok] = true
+	}
+	if got := len(randomToken(16)); got != 22 {
+		t.Fatalf("expected 22 characters for 16 bytes, got %d", got)
+	}
+}
+
+func TestTokenBytes(t *testing.T) {
+	t.Setenv(EnvMCPToken, "")
+	t.Setenv(EnvAdminToken, "")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	writeTOML(t, path, "[auth]\ntoken_bytes = 48\nadmin_token = \"0123456789abcdef0123456789abcdef\"\n")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if len(settings.MCPToken) != 64 {
+		t.Fatalf("expected a generated 48-byte token (64 characters), got %q", settings.MCPToken)
+	}
+	if settings.AdminToken != "0123456789abcdef0123456789abcdef" {
+		t.Fatalf("expected an existing hex token to be kept, got %q", settings.AdminToken)
+	}
+
+	writeTOML(t, path, "[auth]\ntoken_bytes = 8\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "token_bytes") {
+		t.Fatalf("expected a short token_bytes to be rejected, got %v", err)
+	}
+
+	writeTOML(t, path, "[auth]\ntoken_bytes = -1\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "token_bytes") {
+		t.Fatalf("expected a negative token_bytes to be rejected, got %v", err)
+	}
+}
+
+func TestSaveRejectsStaleVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	tui, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	daemon, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if tui.Version == "" || tui.Version != daemon.Version {
+		t.Fatalf("expected equal non-empty versions, got %q and %q", tui.Version, daemon.Version)
+	}
+
+	daemon.MaxTabsPerSession = 5
+	saved, err := Save(daemon)
+	if err != nil {
+		t.Fatalf("first save: %v", err)
+	}
+	if saved.Version == daemon.Version {
+		t.Fatal("expected the version to change with the contents")
+	}
+
+	tui.MaxSnapshots = 10
+	if _, err := Save(tui); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected a stale save to conflict, got %v", err)
+	}
+	if got, _ := LoadOrCreate(path); got.MaxTabsPerSession != 5 || got.MaxSnapshots != 0 {
+		t.Fatalf("stale save changed the file: %+v", got)
+	}
+
+	tui.Version = saved.Version
+	if _, err := Save(tui); err != nil {
+		t.Fatalf("save after reload: %v", err)
+	}
+	tui.Version = ""
+	if _, err := Save(tui); err != nil {
+		t.Fatalf("unversioned save: %v", err)
+	}
+}
+
+func TestSaveKeepsUntouchedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if settings.ActiveSessionStrategy != "" {
+		t.Fatalf("expected an unset active_session_strategy to stay empty, got %q", settings.ActiveSessionStrategy)
+	}
+	if _, err := Save(settings); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Fatalf("saving unchanged settings rewrote the file:\n%s\nbecame\n%s", before, after)
+	}
+}
+
+func TestAllowEvaluate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	writeTOML(t, path, "[browser]\nallow_evaluate = true\n")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !settings.AllowEvaluate {
+		t.Fatalf("expected allow_evaluate to be read")
+	}
+	if saved, err := Save(settings); err != nil || !saved.AllowEvaluate {
+		t.Fatalf("expected allow_evaluate to survive a save, got %v (%v)", saved.AllowEvaluate, err)
+	}
+
+	writeTOML(t, path, "[browser]\nallow_evaluate = true\nallowed_hosts = [\"example.com\"]\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "allow_evaluate") {
+		t.Fatalf("expected allow_evaluate with allowed_hosts to be refused, got %v", err)
+	}
+}
+
+func TestCommandTTL(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	writeTOML(t, path, "[daemon]\ncommand_ttl = \"15m\"\nidle_timeout = \"2h\"\nping_interval = \"-1s\"\npong_wait = \"90s\"\nwrite_wait = \"2s\"\nwrite_wait_per_kb = \"20ms\"\nmax_write_wait = \"2m\"\n")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if settings.CommandTTL != 15*time.Minute || settings.IdleTimeout != 2*time.Hour {
+		t.Fatalf("expected 15m and 2h, got %s and %s", settings.CommandTTL, settings.IdleTimeout)
+	}
+	if settings.PingInterval != -time.Second || settings.PongWait != 90*time.Second {
+		t.Fatalf("expected -1s and 90s, got %s and %s", settings.PingInterval, settings.PongWait)
+	}
+	if settings.WriteWait != 2*time.Second || settings.WriteWaitPerKB != 20*time.Millisecond || settings.MaxWriteWait != 2*time.Minute {
+		t.Fatalf("expected 2s, 20ms and 2m, got %s, %s and %s", settings.WriteWait, settings.WriteWaitPerKB, settings.MaxWriteWait)
+	}
+	saved, err := Save(settings)
+	if err != nil || saved.CommandTTL != 15*time.Minute || saved.IdleTimeout != 2*time.Hour || saved.PingInterval != -time.Second || saved.PongWait != 90*time.Second || saved.MaxWriteWait != 2*time.Minute {
+		t.Fatalf("expected the daemon durations to survive a save, got %+v (%v)", saved, err)
+	}
+	writeTOML(t, path, "[daemon]\ncommand_ttl = \"-1m\"\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "command_ttl") {
+		t.Fatalf("expected a negative command_ttl to be rejected, got %v", err)
+	}
+	writeTOML(t, path, "[daemon]\nidle_timeout = \"soon\"\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "idle_timeout") {
+		t.Fatalf("expected an invalid idle_timeout to be rejected, got %v", err)
+	}
+	writeTOML(t, path, "[daemon]\npong_wait = \"-1s\"\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "pong_wait") {
+		t.Fatalf("expected a negative pong_wait to be rejected, got %v", err)
+	}
+}
+
+func TestMaxScreenshotMB(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	writeTOML(t, path, "[browser]\nmax_screenshot_mb = 16\n")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if saved, err := Save(settings); err != nil || saved.MaxScreenshotMB != 16 {
+		t.Fatalf("expected max_screenshot_mb to survive a save, got %d (%v)", saved.MaxScreenshotMB, err)
+	}
+	writeTOML(t, path, "[browser]\nmax_screenshot_mb = -1\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "max_screenshot_mb") {
+		t.Fatalf("expected a negative max_screenshot_mb to be rejected, got %v", err)
+	}
+}
+
+func TestDisablePrompts(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	writeTOML(t, path, "[mcp]\ndisable_prompts = true\n")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !settings.DisablePrompts {
+		t.Fatalf("expected disable_prompts to be loaded")
+	}
+	if saved, err := Save(settings); err != nil || !saved.DisablePrompts {
+		t.Fatalf("expected disable_prompts to survive a save, got %v (%v)", saved.DisablePrompts, err)
+	}
+}
+
+func TestWorkflowDir(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	writeTOML(t, path, "[mcp]\nworkflow_dir = \"/var/lib/surfingbros\"\n")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if settings.WorkflowDir != "/var/lib/surfingbros" {
+		t.Fatalf("expected workflow_dir to be loaded, got %q", settings.WorkflowDir)
+	}
+	if saved, err := Save(settings); err != nil || saved.WorkflowDir != "/var/lib/surfingbros" {
+		t.Fatalf("expected workflow_dir to survive a save, got %q (%v)", saved.WorkflowDir, err)
+	}
+}
+
+func TestSnapshotReducerOptions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	writeTOML(t, path, "[snapshot]\ninclude_main_text = true\nmax_html_input_mb = 8\nunique_selectors = true\nstrip_tracking_params = true\ntracking_params = [\"utm_*\", \"ref\"]\npreserve_whitespace = true\n")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !settings.SnapshotMainText || settings.SnapshotMaxHTMLInputMB != 8 || !settings.SnapshotUniqueSelectors || !settings.SnapshotStripTrackingParams || strings.Join(settings.SnapshotTrackingParams, ",") != "utm_*,ref" || !settings.SnapshotPreserveWhitespace {
+		t.Fatalf("expected the [snapshot] settings to be loaded, got %+v", settings)
+	}
+	saved, err := Save(settings)
+	if err != nil || !saved.SnapshotMainText || saved.SnapshotMaxHTMLInputMB != 8 || !saved.SnapshotUniqueSelectors || !saved.SnapshotStripTrackingParams || len(saved.SnapshotTrackingParams) != 2 || !saved.SnapshotPreserveWhitespace {
+		t.Fatalf("expected the snapshot settings to survive a save, got %+v (%v)", saved, err)
+	}
+	writeTOML(t, path, "[snapshot]\nmax_html_input_mb = -1\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "max_html_input_mb") {
+		t.Fatalf("expected a negative max_html_input_mb to be rejected, got %v", err)
+	}
+}
+
+func TestDefaultSnapshotFormat(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.toml")
+	writeTOML(t, path, "[browser]\ndefault_snapshot_format = \"Markdown\"\n")
+	settings, err := LoadOrCreate(path)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if settings.DefaultSnapshotFormat != "markdown" {
+		t.Fatalf("expected markdown, got %q", settings.DefaultSnapshotFormat)
+	}
+	if saved, err := Save(settings); err != nil || saved.DefaultSnapshotFormat != "markdown" {
+		t.Fatalf("expected the format to survive a save, got %q (%v)", saved.DefaultSnapshotFormat, err)
+	}
+	writeTOML(t, path, "[browser]\ndefault_snapshot_format = \"yaml\"\n")
+	if _, err := LoadOrCreate(path); err == nil || !strings.Contains(err.Error(), "default_snapshot_format") {
+		t.Fatalf("expected an unknown format to be rejected, got %v", err)
+	}
+}
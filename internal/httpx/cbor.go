@@ -0,0 +1,85 @@
+package httpx
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/adityalohuni/mcp-server/internal/cbor"
+)
+
+// CBOR re-encodes JSON responses as CBOR for clients whose Accept header
+// prefers application/cbor. JSON stays the default; error bodies and other
+// content types pass through unchanged. The response is buffered, so CBOR
+// is only for handlers that write a single JSON document.
+func CBOR(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		if !prefersCBOR(r.Header.Get("Accept")) || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		bw := &bufferWriter{ResponseWriter: w}
+		next.ServeHTTP(bw, r)
+		bw.finish()
+	})
+}
+
+// prefersCBOR reports whether an Accept header ranks application/cbor above
+// application/json. Neither being listed, or a tie, keeps JSON.
+func prefersCBOR(header string) bool {
+	q := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		weight := 1.0
+		if v, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			var err error
+			if weight, err = strconv.ParseFloat(strings.TrimSpace(v), 64); err != nil {
+				weight = 0
+			}
+		}
+		q[strings.ToLower(strings.TrimSpace(name))] = weight
+	}
+	jsonQ, listed := q["application/json"]
+	if !listed {
+		jsonQ = max(q["application/*"], q["*/*"])
+	}
+	return q[cbor.ContentType] > jsonQ
+}
+
+type bufferWriter struct {
+	http.ResponseWriter
+	code int
+	buf  bytes.Buffer
+}
+
+func (bw *bufferWriter) WriteHeader(code int) {
+	if bw.code == 0 {
+		bw.code = code
+	}
+}
+
+func (bw *bufferWriter) Write(p []byte) (int, error) {
+	if bw.code == 0 {
+		bw.code = http.StatusOK
+	}
+	return bw.buf.Write(p)
+}
+
+func (bw *bufferWriter) finish() {
+	if bw.code == 0 {
+		bw.code = http.StatusOK
+	}
+	body := bw.buf.Bytes()
+	h := bw.Header()
+	if bw.code < 300 && strings.HasPrefix(h.Get("Content-Type"), "application/json") {
+		if out, err := cbor.FromJSON(body); err == nil {
+			body = out
+			h.Set("Content-Type", cbor.ContentType)
+			h.Del("Content-Length")
+		}
+	}
+	bw.ResponseWriter.WriteHeader(bw.code)
+	_, _ = bw.ResponseWriter.Write(body)
+}
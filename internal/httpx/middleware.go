@@ -1,6 +1,7 @@
 package httpx
 
 import (
+	"context"
 	"net"
 	"net/http"
 	"strings"
@@ -23,6 +24,41 @@ func RequireToken(token string) func(http.Handler) http.Handler {
 	}
 }
 
+type readOnlyKey struct{}
+
+// RequireAdminToken authorizes requests carrying either the full admin token
+// or, for GET and HEAD requests only, the read-only token. Requests admitted
+// with the read-only token are marked so handlers can redact secrets.
+func RequireAdminToken(full, readOnly string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if full == "" {
+				http.Error(w, "server auth not configured", http.StatusUnauthorized)
+				return
+			}
+			reqToken := tokenFromRequest(r)
+			switch {
+			case reqToken == full:
+				next.ServeHTTP(w, r)
+			case readOnly != "" && reqToken == readOnly:
+				if r.Method != http.MethodGet && r.Method != http.MethodHead {
+					http.Error(w, "read-only token cannot perform this action", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), readOnlyKey{}, true)))
+			default:
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+// IsReadOnly reports whether the request was authorized with the read-only admin token.
+func IsReadOnly(ctx context.Context) bool {
+	v, _ := ctx.Value(readOnlyKey{}).(bool)
+	return v
+}
+
 func tokenFromRequest(r *http.Request) string {
 	auth := r.Header.Get("Authorization")
 	if strings.HasPrefix(auth, "Bearer ") {
@@ -0,0 +1,190 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adityalohuni/mcp-server/internal/traceid"
+)
+
+func TestRequireAdminTokenTiers(t *testing.T) {
+	var sawReadOnly bool
+	h := RequireAdminToken("full", "view")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sawReadOnly = IsReadOnly(r.Context())
+	}))
+
+	cases := []struct {
+		method, token string
+		code          int
+		readOnly      bool
+	}{
+		{http.MethodGet, "view", http.StatusOK, true},
+		{http.MethodPost, "view", http.StatusForbidden, false},
+		{http.MethodPut, "view", http.StatusForbidden, false},
+		{http.MethodPost, "full", http.StatusOK, false},
+		{http.MethodGet, "full", http.StatusOK, false},
+		{http.MethodGet, "wrong", http.StatusUnauthorized, false},
+	}
+	for _, tc := range cases {
+		sawReadOnly = false
+		req := httptest.NewRequest(tc.method, "/admin/config", nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Fatalf("%s with %q: status %d, want %d", tc.method, tc.token, rec.Code, tc.code)
+		}
+		if sawReadOnly != tc.readOnly {
+			t.Fatalf("%s with %q: read-only flag %t, want %t", tc.method, tc.token, sawReadOnly, tc.readOnly)
+		}
+	}
+}
+
+func TestRequireScopePartialScopes(t *testing.T) {
+	tokens := map[string][]string{
+		"tabs":  {ScopeBrowsersWrite, ScopeStatusRead},
+		"admin": {"config:*"},
+	}
+	var sawReadOnly bool
+	route := func(scope string) http.Handler {
+		return RequireScope(tokens, scope, RequireAdminToken("full", ""))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sawReadOnly = IsReadOnly(r.Context())
+		}))
+	}
+
+	cases := []struct {
+		scope, token string
+		code         int
+		readOnly     bool
+	}{
+		{ScopeBrowsersWrite, "tabs", http.StatusOK, true},
+		{ScopeBrowsersRead, "tabs", http.StatusOK, true},
+		{ScopeStatusRead, "tabs", http.StatusOK, true},
+		{ScopeClientsRead, "tabs", http.StatusForbidden, false},
+		{ScopeConfigRead, "tabs", http.StatusForbidden, false},
+		{ScopeConfigRead, "admin", http.StatusOK, false},
+		{ScopeBrowsersRead, "admin", http.StatusForbidden, false},
+		{ScopeClientsWrite, "full", http.StatusOK, false},
+		{ScopeClientsRead, "wrong", http.StatusUnauthorized, false},
+		{ScopeClientsRead, "", http.StatusUnauthorized, false},
+	}
+	for _, tc := range cases {
+		sawReadOnly = false
+		req := httptest.NewRequest(http.MethodPost, "/admin/x", nil)
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		rec := httptest.NewRecorder()
+		route(tc.scope).ServeHTTP(rec, req)
+		if rec.Code != tc.code {
+			t.Fatalf("%s with %q: status %d, want %d", tc.scope, tc.token, rec.Code, tc.code)
+		}
+		if sawReadOnly != tc.readOnly {
+			t.Fatalf("%s with %q: read-only flag %t, want %t", tc.scope, tc.token, sawReadOnly, tc.readOnly)
+		}
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	valid := map[string][]string{"a": {"*"}, "b": {ScopeMCP, "browsers:*"}}
+	if err := ValidateScopes(valid); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, bad := range []map[string][]string{
+		{"a": {"tabs"}},
+		{"a": {"mcp:*"}},
+		{"a": nil},
+		{"": {ScopeMCP}},
+	} {
+		if err := ValidateScopes(bad); err == nil {
+			t.Fatalf("expected %v to be rejected", bad)
+		}
+	}
+}
+
+func TestAcceptedEncoding(t *testing.T) {
+	cases := map[string]string{
+		"":                      "",
+		"gzip":                  "gzip",
+		"deflate, gzip;q=0.5":   "gzip",
+		"gzip;q=0, deflate":     "deflate",
+		"br":                    "",
+		"GZIP":                  "gzip",
+		"identity, deflate;q=0": "",
+	}
+	for header, want := range cases {
+		if got := acceptedEncoding(header); got != want {
+			t.Fatalf("acceptedEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompressSkipsEventStreams(t *testing.T) {
+	h := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: hi\n\n"))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "data: hi\n\n" {
+		t.Fatalf("expected event stream to pass through, got %q %q", rec.Header().Get("Content-Encoding"), rec.Body.String())
+	}
+}
+
+func TestPrefersCBOR(t *testing.T) {
+	cases := map[string]bool{
+		"":                 false,
+		"application/json": false,
+		"application/cbor": true,
+		"application/cbor, application/json;q=0.9": true,
+		"application/json, application/cbor":       false,
+		"application/json;q=0.5, application/cbor": true,
+		"application/cbor;q=0, */*":                false,
+		"*/*, application/cbor":                    false,
+		"application/cbor, */*;q=0.1":              true,
+	}
+	for header, want := range cases {
+		if got := prefersCBOR(header); got != want {
+			t.Fatalf("prefersCBOR(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestCBORLeavesErrorsAlone(t *testing.T) {
+	h := CBOR(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "missing id", http.StatusBadRequest)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "application/cbor")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || rec.Body.String() != "missing id\n" || rec.Header().Get("Vary") != "Accept" {
+		t.Fatalf("expected the error to pass through, got %d %q %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var seen string
+	h := Trace(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = traceid.FromContext(r.Context())
+	}))
+
+	for sent, keep := range map[string]bool{"op-42": true, "": false, "bad id\n": false} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/browsers/broadcast", nil)
+		if sent != "" {
+			req.Header.Set(TraceHeader, sent)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		echoed := rec.Header().Get(TraceHeader)
+		if echoed == "" || echoed != seen {
+			t.Fatalf("%q: handler saw %q, response echoed %q", sent, seen, echoed)
+		}
+		if (echoed == sent) != keep {
+			t.Fatalf("%q: got trace id %q", sent, echoed)
+		}
+	}
+}
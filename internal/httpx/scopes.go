@@ -0,0 +1,100 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Scopes a scoped token can be granted. A resource's write scope implies its
+// read scope, "resource:*" grants both and "*" grants everything.
+const (
+	ScopeMCP           = "mcp"
+	ScopeStatusRead    = "status:read"
+	ScopeClientsRead   = "clients:read"
+	ScopeClientsWrite  = "clients:write"
+	ScopeBrowsersRead  = "browsers:read"
+	ScopeBrowsersWrite = "browsers:write"
+	ScopeConfigRead    = "config:read"
+	ScopeConfigWrite   = "config:write"
+)
+
+var knownScopes = []string{
+	ScopeMCP,
+	ScopeStatusRead,
+	ScopeClientsRead, ScopeClientsWrite,
+	ScopeBrowsersRead, ScopeBrowsersWrite,
+	ScopeConfigRead, ScopeConfigWrite,
+}
+
+// ValidateScopes reports empty tokens, tokens granted nothing and scopes
+// that are not known.
+func ValidateScopes(tokens map[string][]string) error {
+	for token, scopes := range tokens {
+		if strings.TrimSpace(token) == "" {
+			return errors.New("scoped token is empty")
+		}
+		if len(scopes) == 0 {
+			return fmt.Errorf("a scoped token grants no scopes")
+		}
+		for _, s := range scopes {
+			if !validScope(s) {
+				return fmt.Errorf("unknown scope %q (want one of %s, a resource:* wildcard or *)", s, strings.Join(knownScopes, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+func validScope(s string) bool {
+	if s == "*" || slices.Contains(knownScopes, s) {
+		return true
+	}
+	resource, ok := strings.CutSuffix(s, ":*")
+	return ok && slices.Contains(knownScopes, resource+":read")
+}
+
+// grants reports whether scopes include want.
+func grants(scopes []string, want string) bool {
+	resource, _, _ := strings.Cut(want, ":")
+	for _, s := range scopes {
+		switch s {
+		case "*", want, resource + ":*":
+			return true
+		}
+		if want == resource+":read" && s == resource+":write" {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireScope admits requests whose token is one of tokens and is granted
+// scope, and answers 403 when the token is known but lacks it. Requests with
+// any other token are left to fallback, the route's usual token check.
+// Requests admitted with a scoped token are marked read-only, so secrets are
+// redacted, unless the token may also write the config.
+func RequireScope(tokens map[string][]string, scope string, fallback func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		guarded := fallback(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqToken := tokenFromRequest(r)
+			scopes, ok := tokens[reqToken]
+			if reqToken == "" || !ok {
+				guarded.ServeHTTP(w, r)
+				return
+			}
+			if !grants(scopes, scope) {
+				http.Error(w, "token lacks the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+			if !grants(scopes, ScopeConfigWrite) {
+				r = r.WithContext(context.WithValue(r.Context(), readOnlyKey{}, true))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package httpx
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/google/uuid"
+
+	"github.com/adityalohuni/mcp-server/internal/traceid"
+)
+
+// TraceHeader carries an admin request's trace id in both directions.
+const TraceHeader = "X-Trace-Id"
+
+var traceIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Trace gives each request a trace id: the caller's X-Trace-Id when it is a
+// short token of letters, digits and ".-_:", otherwise a new one. The id is
+// echoed in the response header and put on the request context with
+// traceid.With, so browser commands and audit entries the handler makes
+// carry it.
+func Trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(TraceHeader)
+		if !traceIDPattern.MatchString(id) {
+			id = uuid.New().String()
+		}
+		w.Header().Set(TraceHeader, id)
+		next.ServeHTTP(w, r.WithContext(traceid.With(r.Context(), id)))
+	})
+}
@@ -0,0 +1,139 @@
+// Package logfile provides an io.Writer that appends to a file and rotates it
+// once it grows past a size threshold.
+package logfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Writer appends to Path, renaming it to Path.1 (shifting older backups to
+// Path.2 ... Path.MaxBackups) when the next write would exceed MaxSize bytes.
+//
+// A failed rotation does not stop logging: the Writer keeps appending to
+// Path and tries again once another MaxSize bytes have been written. The
+// write that first hits the failure returns its error; later failures are
+// not reported until a rotation succeeds.
+type Writer struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	// size is the file's size, or after a failed rotation the bytes written
+	// since.
+	size int64
+	// rotateFailed is set once a rotation error has been returned.
+	rotateFailed bool
+}
+
+// Open opens or creates path for appending. maxSize <= 0 disables rotation;
+// maxBackups <= 0 discards the previous file on rotation.
+func Open(path string, maxSize int64, maxBackups int) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create log dir: %w", err)
+	}
+	w := &Writer{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	var rotateErr error
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if rotateErr = w.rotate(); rotateErr != nil {
+			if err := w.recover(); err != nil {
+				return 0, errors.Join(rotateErr, err)
+			}
+			if w.rotateFailed {
+				rotateErr = nil
+			}
+			w.rotateFailed = true
+		} else {
+			w.rotateFailed = false
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// recover reopens the log after a failed rotation, wherever rotate left it,
+// and restarts the size count so the next attempt waits for another maxSize
+// bytes instead of shifting the backups again on every write.
+func (w *Writer) recover() error {
+	if w.file == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	w.size = 0
+	return nil
+}
+
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("stat log file: %w", err)
+	}
+	w.file = file
+	w.size = info.Size()
+	return nil
+}
+
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("close log file: %w", err)
+	}
+	w.file = nil
+	if w.maxBackups <= 0 {
+		if err := os.Remove(w.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove log file: %w", err)
+		}
+		return w.open()
+	}
+	_ = os.Remove(w.backup(w.maxBackups))
+	for i := w.maxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(w.backup(i), w.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("rotate log file: %w", err)
+		}
+	}
+	if err := os.Rename(w.path, w.backup(1)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("rotate log file: %w", err)
+	}
+	return w.open()
+}
+
+func (w *Writer) backup(n int) string {
+	return fmt.Sprintf("%s.%d", w.path, n)
+}
@@ -0,0 +1,82 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriterRotatesAtSizeThreshold(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcpd.log")
+	w, err := Open(path, 10, 2)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer w.Close()
+
+	for _, line := range []string{"aaaaa\n", "bbbb\n", "ccccc\n", "ddddd\n", "eeeee\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "eeeee\n",
+		path + ".1": "ddddd\n",
+		path + ".2": "ccccc\n",
+	}
+	for name, body := range want {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if string(got) != body {
+			t.Fatalf("%s = %q, want %q", filepath.Base(name), got, body)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("expected at most 2 backups, stat .3: %v", err)
+	}
+}
+
+func TestWriterKeepsWritingWhenRotationFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcpd.log")
+	// A non-empty directory where the backup goes makes the rename fail.
+	if err := os.MkdirAll(filepath.Join(path+".1", "keep"), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	w, err := Open(path, 10, 1)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer w.Close()
+
+	if _, err := w.Write([]byte("aaaaa\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if n, err := w.Write([]byte("bbbbbb\n")); err == nil || n != 7 {
+		t.Fatalf("expected the failed rotation to be reported with the write, got %d, %v", n, err)
+	}
+	// Another maxSize bytes on, the retry fails again but is not reported.
+	for _, line := range []string{"ccc\n", "dddddd\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("expected the rotation error to be reported once, got %v", err)
+		}
+	}
+	if got, _ := os.ReadFile(path); string(got) != "aaaaa\nbbbbbb\nccc\ndddddd\n" {
+		t.Fatalf("expected writes to go on in the unrotated file, got %q", got)
+	}
+
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if _, err := w.Write([]byte("eeee\n")); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "eeee\n" {
+		t.Fatalf("expected the next rotation to succeed, got %q", got)
+	}
+	if got, _ := os.ReadFile(path + ".1"); string(got) != "aaaaa\nbbbbbb\nccc\ndddddd\n" {
+		t.Fatalf("unexpected backup %q", got)
+	}
+}
@@ -0,0 +1,128 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+	"github.com/adityalohuni/mcp-server/internal/page"
+)
+
+const (
+	defaultActSettle = 300 * time.Millisecond
+	maxActSettleMs   = 10000
+)
+
+type ActInput struct {
+	TargetInput
+	IdempotencyInput
+	RefInput
+	Verb       string `json:"verb" jsonschema:"action to perform: click, hover, type, select or enter"`
+	Selector   string `json:"selector,omitempty" jsonschema:"CSS selector of the element to act on; optional for enter"`
+	Text       string `json:"text,omitempty" jsonschema:"text to type"`
+	PressEnter bool   `json:"pressEnter,omitempty" jsonschema:"press Enter after typing"`
+	Value      string `json:"value,omitempty" jsonschema:"option value to select"`
+	Label      string `json:"label,omitempty" jsonschema:"option label to select"`
+	Key        string `json:"key,omitempty" jsonschema:"key to send for enter (default Enter)"`
+	// WaitFor replaces the fixed settle delay when set.
+	WaitFor  string               `json:"waitFor,omitempty" jsonschema:"selector to wait for after the action instead of the settle delay"`
+	SettleMs int                  `json:"settleMs,omitempty" jsonschema:"milliseconds to let the page settle after the action (default 300, max 10000)"`
+	Snapshot SnapshotOptionsInput `json:"snapshot,omitempty" jsonschema:"options for the snapshots taken before and after the action"`
+}
+
+type ActOutput struct {
+	Verb     string            `json:"verb" jsonschema:"action performed"`
+	Selector string            `json:"selector,omitempty" jsonschema:"selector the action was sent to"`
+	Snapshot SnapshotOutput    `json:"snapshot" jsonschema:"snapshot taken after the action settled"`
+	Diff     page.SnapshotDiff `json:"diff" jsonschema:"what changed compared to a snapshot taken just before the action"`
+	Warnings []string          `json:"warnings,omitempty" jsonschema:"non-fatal problems with the request, such as clamped limits"`
+}
+
+// act runs one snapshot, action, snapshot round: the page is captured right
+// before the action so the diff reflects the action alone, and the snapshot
+// afterwards is stored so its refs can be used by the next call.
+func (s *Server) act(ctx context.Context, req *mcp.CallToolRequest, input ActInput) (*mcp.CallToolResult, ActOutput, error) {
+	verb := strings.ToLower(strings.TrimSpace(input.Verb))
+	var selector string
+	var err error
+	switch verb {
+	case "click", "hover", "type", "select":
+		selector, err = s.elementSelector(req, input.Selector, input.RefInput)
+	case "enter":
+		selector = input.Selector
+		if input.Ref != "" {
+			selector, err = s.elementSelector(req, input.Selector, input.RefInput)
+		}
+	default:
+		return nil, ActOutput{}, fmt.Errorf("unknown verb %q (want click, hover, type, select or enter)", input.Verb)
+	}
+	if err != nil {
+		return nil, ActOutput{}, err
+	}
+
+	var warn warnings
+	warn.snapshotInput(&input.Snapshot)
+	settle := defaultActSettle
+	if ms := warn.clamp("settleMs", input.SettleMs, maxActSettleMs); ms > 0 {
+		settle = time.Duration(ms) * time.Millisecond
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	opts := input.Snapshot.browserOptions(s.reducer)
+
+	before, err := s.sharedSnapshot(ctx, opts)
+	if err != nil {
+		return nil, ActOutput{}, fmt.Errorf("snapshot before %s: %w", verb, err)
+	}
+	if err := s.perform(ctx, verb, selector, input); err != nil {
+		return nil, ActOutput{}, err
+	}
+	if input.WaitFor != "" {
+		if _, err := s.browser.WaitForSelector(ctx, browser.WaitForSelectorOptions{Selector: input.WaitFor}); err != nil {
+			return nil, ActOutput{}, fmt.Errorf("wait for %s after %s: %w", input.WaitFor, verb, err)
+		}
+	} else {
+		select {
+		case <-time.After(settle):
+		case <-ctx.Done():
+			return nil, ActOutput{}, ctx.Err()
+		}
+	}
+	// Not shared: a snapshot already in flight may have started before the
+	// action and would miss its effect.
+	after, err := s.browser.Snapshot(ctx, opts)
+	if err != nil {
+		return nil, ActOutput{}, fmt.Errorf("snapshot after %s: %w", verb, err)
+	}
+	if after.ID == "" {
+		after.ID = s.store.Put(after)
+	}
+	s.rememberSnapshot(req, after.ID)
+	return nil, ActOutput{
+		Verb:     verb,
+		Selector: selector,
+		Snapshot: snapshotOutput(after, input.Snapshot, nil),
+		Diff:     page.Diff(before, after),
+		Warnings: warn,
+	}, nil
+}
+
+func (s *Server) perform(ctx context.Context, verb, selector string, input ActInput) error {
+	var err error
+	switch verb {
+	case "click":
+		_, err = s.browser.Click(ctx, selector)
+	case "hover":
+		_, err = s.browser.Hover(ctx, selector)
+	case "type":
+		_, err = s.browser.Type(ctx, browser.TypeOptions{Selector: selector, Text: input.Text, PressEnter: input.PressEnter})
+	case "select":
+		_, err = s.browser.Select(ctx, browser.SelectOptions{Selector: selector, Value: input.Value, Label: input.Label})
+	case "enter":
+		_, err = s.browser.Enter(ctx, selector, input.Key)
+	}
+	return err
+}
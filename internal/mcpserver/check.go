@@ -0,0 +1,37 @@
+package mcpserver
+
+import (
+	"context"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+)
+
+type CheckInput struct {
+	TargetInput
+	IdempotencyInput
+	RefInput
+	Selector string `json:"selector,omitempty" jsonschema:"CSS selector of the checkbox or radio button"`
+}
+
+func (s *Server) check(ctx context.Context, req *mcp.CallToolRequest, input CheckInput) (*mcp.CallToolResult, browser.CheckedResult, error) {
+	return s.setChecked(ctx, req, input, true)
+}
+
+func (s *Server) uncheck(ctx context.Context, req *mcp.CallToolRequest, input CheckInput) (*mcp.CallToolResult, browser.CheckedResult, error) {
+	return s.setChecked(ctx, req, input, false)
+}
+
+func (s *Server) setChecked(ctx context.Context, req *mcp.CallToolRequest, input CheckInput, checked bool) (*mcp.CallToolResult, browser.CheckedResult, error) {
+	selector, err := s.elementSelector(req, input.Selector, input.RefInput)
+	if err != nil {
+		return nil, browser.CheckedResult{}, err
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	out, err := s.browser.SetChecked(ctx, selector, checked)
+	if err != nil {
+		return nil, browser.CheckedResult{}, err
+	}
+	return nil, out, nil
+}
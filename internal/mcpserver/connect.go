@@ -0,0 +1,44 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ConnectInfo tells a user how to point the browser extension at this server.
+type ConnectInfo struct {
+	WebSocketURL string `json:"websocketUrl"`
+	AuthRequired bool   `json:"authRequired"`
+}
+
+type connectResource struct {
+	ConnectInfo
+	Instructions string `json:"instructions"`
+}
+
+func (s *Server) readConnect(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	if req == nil || req.Params == nil {
+		return nil, errors.New("missing resource params")
+	}
+	out := connectResource{ConnectInfo: *s.connect}
+	out.Instructions = "Open the SurfingBro extension options and set the server URL to " + out.WebSocketURL + "."
+	if out.AuthRequired {
+		out.Instructions += " The connection also needs the configured token."
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{
+			{
+				URI:      req.Params.URI,
+				MIMEType: "application/json",
+				Text:     string(data),
+			},
+		},
+	}, nil
+}
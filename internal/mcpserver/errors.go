@@ -0,0 +1,89 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+	"github.com/adityalohuni/mcp-server/internal/traceid"
+)
+
+// addTool registers a tool whose handler errors are turned into structured
+// tool results where the failure is one an agent can act on.
+func addTool[In, Out any](server *mcp.Server, tool *mcp.Tool, h mcp.ToolHandlerFor[In, Out]) {
+	mcp.AddTool(server, tool, func(ctx context.Context, req *mcp.CallToolRequest, in In) (*mcp.CallToolResult, Out, error) {
+		res, out, err := h(ctx, req, in)
+		if code, fields := toolError(err); code != "" {
+			return errorResult(code, withTraceID(ctx, fields)), out, nil
+		}
+		if err != nil {
+			err = traceError(ctx, err)
+		}
+		return res, out, err
+	})
+}
+
+// toolError maps err to the code and fields of a structured tool error, or
+// returns an empty code when err is not one an agent can act on.
+func toolError(err error) (string, map[string]any) {
+	var locked *browser.TabLockedError
+	if errors.As(err, &locked) {
+		fields := map[string]any{"message": locked.Error(), "allowShared": locked.AllowShared, "hint": locked.Hint()}
+		if locked.TabID != 0 {
+			fields["tabId"] = locked.TabID
+		}
+		if locked.OwnerSessionID != "" {
+			fields["ownerSessionId"] = locked.OwnerSessionID
+		}
+		return "tab_locked", fields
+	}
+	var limited *browser.TabLimitError
+	if errors.As(err, &limited) {
+		return "tab_limit_exceeded", map[string]any{"message": limited.Error(), "limit": limited.Limit, "open": limited.Open, "hint": limited.Hint()}
+	}
+	var missing *browser.NotFoundError
+	if errors.As(err, &missing) {
+		fields := map[string]any{"message": missing.Error(), "hint": missing.Hint()}
+		if missing.Selector != "" {
+			fields["selector"] = missing.Selector
+		}
+		return "not_found", fields
+	}
+	return "", nil
+}
+
+// withTraceID adds the call's trace id to fields, when it has one.
+func withTraceID(ctx context.Context, fields map[string]any) map[string]any {
+	if traceID, ok := traceid.FromContext(ctx); ok && traceID != "" {
+		fields["traceId"] = traceID
+	}
+	return fields
+}
+
+// errorResult builds a tool error whose text is a JSON object carrying code
+// under "error" alongside fields.
+func errorResult(code string, fields map[string]any) *mcp.CallToolResult {
+	body := map[string]any{"error": code}
+	maps.Copy(body, fields)
+	raw, _ := json.Marshal(body)
+	return &mcp.CallToolResult{
+		IsError: true,
+		Content: []mcp.Content{&mcp.TextContent{Text: string(raw)}},
+	}
+}
+
+// dropErrorOutput clears the zero-value structured output the SDK attaches to
+// error results so clients only see the error content.
+func dropErrorOutput(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		res, err := next(ctx, method, req)
+		if out, ok := res.(*mcp.CallToolResult); ok && out != nil && out.IsError {
+			out.StructuredContent = nil
+		}
+		return res, err
+	}
+}
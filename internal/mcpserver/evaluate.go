@@ -0,0 +1,53 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/page"
+)
+
+const (
+	defaultEvaluateBytes = 64 << 10
+	maxEvaluateBytes     = 1 << 20
+)
+
+type EvaluateInput struct {
+	TargetInput
+	IdempotencyInput
+	Script   string `json:"script" jsonschema:"JavaScript expression to evaluate in the page; its result is JSON-serialized"`
+	MaxBytes int    `json:"maxBytes,omitempty" jsonschema:"max bytes of serialized result to return (default 65536, max 1048576)"`
+}
+
+type EvaluateOutput struct {
+	Type string `json:"type" jsonschema:"typeof the result: string, number, boolean, object or undefined"`
+	// Value is left out when the result is undefined or larger than maxBytes.
+	Value     any      `json:"value,omitempty" jsonschema:"the result, when it fits in maxBytes"`
+	Bytes     int      `json:"bytes" jsonschema:"size of the serialized result in bytes"`
+	Truncated bool     `json:"truncated,omitempty" jsonschema:"the result exceeded maxBytes; preview holds its start"`
+	Preview   string   `json:"preview,omitempty" jsonschema:"first maxBytes of the serialized result, when truncated"`
+	Warnings  []string `json:"warnings,omitempty" jsonschema:"non-fatal problems with the request, such as clamped limits"`
+}
+
+func (s *Server) evaluate(ctx context.Context, req *mcp.CallToolRequest, input EvaluateInput) (*mcp.CallToolResult, EvaluateOutput, error) {
+	var warn warnings
+	limit := warn.clamp("maxBytes", input.MaxBytes, maxEvaluateBytes)
+	if limit == 0 {
+		limit = defaultEvaluateBytes
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	res, err := s.browser.Evaluate(ctx, input.Script)
+	if err != nil {
+		return nil, EvaluateOutput{}, err
+	}
+	out := EvaluateOutput{Type: res.Type, Bytes: len(res.Value), Warnings: warn}
+	if len(res.Value) > limit {
+		out.Truncated = true
+		out.Preview = page.TruncateUTF8(string(res.Value), limit)
+	} else if len(res.Value) > 0 {
+		out.Value = json.RawMessage(res.Value)
+	}
+	return nil, out, nil
+}
@@ -0,0 +1,67 @@
+package mcpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+)
+
+const maxFillFields = 100
+
+type FillFormFieldInput struct {
+	RefInput
+	Selector   string `json:"selector,omitempty" jsonschema:"CSS selector of the input/textarea"`
+	Value      string `json:"value" jsonschema:"text to enter"`
+	PressEnter bool   `json:"pressEnter,omitempty" jsonschema:"press Enter after typing"`
+}
+
+type FillFormInput struct {
+	TargetInput
+	IdempotencyInput
+	Fields []FillFormFieldInput `json:"fields" jsonschema:"fields to fill, in order (max 100)"`
+}
+
+// fillForm sends every field it can resolve in one command. A field whose
+// ref or selector cannot be resolved is reported failed in its place without
+// stopping the others.
+func (s *Server) fillForm(ctx context.Context, req *mcp.CallToolRequest, input FillFormInput) (*mcp.CallToolResult, browser.FillFormResult, error) {
+	if len(input.Fields) == 0 {
+		return nil, browser.FillFormResult{}, errors.New("fields is required")
+	}
+	if len(input.Fields) > maxFillFields {
+		return nil, browser.FillFormResult{}, fmt.Errorf("%d fields exceeds the maximum of %d", len(input.Fields), maxFillFields)
+	}
+	results := make([]browser.FillFieldResult, len(input.Fields))
+	var send []browser.FillFormField
+	var sent []int
+	for i, f := range input.Fields {
+		selector, err := s.elementSelector(req, f.Selector, f.RefInput)
+		if err != nil {
+			results[i] = browser.FillFieldResult{Selector: f.Selector, Error: err.Error()}
+			continue
+		}
+		send = append(send, browser.FillFormField{Selector: selector, Value: f.Value, PressEnter: f.PressEnter})
+		sent = append(sent, i)
+	}
+	if len(send) > 0 {
+		ctx = s.withTarget(ctx, req, input.TargetInput)
+		res, err := s.browser.FillForm(ctx, send)
+		if err != nil {
+			return nil, browser.FillFormResult{}, err
+		}
+		for j, i := range sent {
+			if j < len(res.Fields) {
+				results[i] = res.Fields[j]
+			} else {
+				results[i] = browser.FillFieldResult{Selector: send[j].Selector, Error: "no result from the browser"}
+			}
+		}
+	}
+	out := browser.FillFormResult{Fields: results}
+	out.Count()
+	return nil, out, nil
+}
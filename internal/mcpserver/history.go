@@ -0,0 +1,57 @@
+package mcpserver
+
+import (
+	"context"
+	"errors"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+)
+
+type HistoryOutput struct {
+	Entries []browser.HistoryEntry `json:"entries" jsonschema:"history entries, oldest first"`
+	Index   int                    `json:"index" jsonschema:"position of the current page in entries"`
+	// Length is the size of the whole history when entries only hold the
+	// current page but the browser knows how long the history is.
+	Length       int      `json:"length,omitempty" jsonschema:"size of the tab's whole history, when known"`
+	Complete     bool     `json:"complete" jsonschema:"entries hold the whole history; when false only the current page is known"`
+	CanGoBack    bool     `json:"canGoBack" jsonschema:"browser.back will move"`
+	CanGoForward bool     `json:"canGoForward" jsonschema:"browser.forward will move"`
+	Warnings     []string `json:"warnings,omitempty" jsonschema:"non-fatal problems, such as falling back to the current page only"`
+}
+
+// history lists the tab's session history. Extensions without get_history
+// fail the command; the current page is then read from a snapshot instead.
+func (s *Server) history(ctx context.Context, req *mcp.CallToolRequest, input EmptyInput) (*mcp.CallToolResult, HistoryOutput, error) {
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	list, err := s.browser.History(ctx)
+	var warn warnings
+	if err != nil {
+		var locked *browser.TabLockedError
+		if ctx.Err() != nil || errors.As(err, &locked) {
+			return nil, HistoryOutput{}, err
+		}
+		snap, snapErr := s.browser.Snapshot(ctx, browser.SnapshotOptions{MaxElements: 1, MaxText: 1})
+		if snapErr != nil {
+			return nil, HistoryOutput{}, err
+		}
+		list = browser.HistoryList{Entries: []browser.HistoryEntry{{URL: snap.URL, Title: snap.Title}}}
+		warn.addf("history unavailable (%v); only the current page is listed", err)
+	}
+	out := HistoryOutput{
+		Entries:  list.Entries,
+		Index:    list.Index,
+		Length:   list.Length,
+		Complete: list.Complete,
+		Warnings: warn,
+	}
+	if out.Entries == nil {
+		out.Entries = []browser.HistoryEntry{}
+	}
+	if out.Complete {
+		out.CanGoBack = out.Index > 0
+		out.CanGoForward = out.Index < len(out.Entries)-1
+	}
+	return nil, out, nil
+}
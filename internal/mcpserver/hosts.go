@@ -0,0 +1,65 @@
+package mcpserver
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// hostPolicy confines navigations to an allowlist of hosts. Entries are exact
+// host names or "*.example.com" wildcards, which match any subdomain of
+// example.com but not example.com itself. An empty list allows every host.
+// Only navigate and open_tab consult it, which is why browser.evaluate is not
+// registered while a list is set.
+type hostPolicy struct {
+	exact    map[string]struct{}
+	suffixes []string
+}
+
+func newHostPolicy(hosts []string) hostPolicy {
+	p := hostPolicy{exact: make(map[string]struct{})}
+	for _, h := range hosts {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if h == "" {
+			continue
+		}
+		if strings.HasPrefix(h, "*.") {
+			p.suffixes = append(p.suffixes, h[1:])
+			continue
+		}
+		p.exact[h] = struct{}{}
+	}
+	return p
+}
+
+func (p hostPolicy) empty() bool {
+	return len(p.exact) == 0 && len(p.suffixes) == 0
+}
+
+// check returns an error when rawURL points at a host outside the allowlist.
+func (p hostPolicy) check(rawURL string) error {
+	if p.empty() {
+		return nil
+	}
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" || rawURL == "about:blank" {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("navigation to %q is not allowed: url has no host", rawURL)
+	}
+	if _, ok := p.exact[host]; ok {
+		return nil
+	}
+	for _, suffix := range p.suffixes {
+		if strings.HasSuffix(host, suffix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("navigation to host %q is not allowed by browser.allowed_hosts", host)
+}
@@ -0,0 +1,197 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// idempotentTools are the tools that change the page or browser and so take
+// an idempotencyKey. Keep in step with the inputs that embed IdempotencyInput.
+var idempotentTools = []string{
+	"browser.click",
+	"browser.type",
+	"browser.enter",
+	"browser.press_keys",
+	"browser.back",
+	"browser.forward",
+	"browser.navigate",
+	"browser.reload",
+	"browser.select",
+	"browser.open_tab",
+	"browser.close_tab",
+	"browser.fill_form",
+	"browser.check",
+	"browser.uncheck",
+	"browser.set_storage",
+	"browser.clear_storage",
+	"browser.evaluate",
+	"browser.act",
+}
+
+const (
+	defaultIdempotencyTTL = 5 * time.Minute
+	// maxIdempotencyKeys bounds the remembered keys across all clients;
+	// past it, expired keys and then the oldest are dropped.
+	maxIdempotencyKeys = 4096
+)
+
+// IdempotencyInput is embedded in the inputs of mutating tools.
+type IdempotencyInput struct {
+	IdempotencyKey string `json:"idempotencyKey,omitempty" jsonschema:"client-chosen key; retrying a call with the same key returns the first call's result instead of acting again"`
+}
+
+// idempotencyCache remembers the result of each successful keyed call for a
+// client, so a retry of a call that succeeded after the client gave up on it
+// does not click or submit twice.
+type idempotencyCache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[idempotencyKey]*idempotencyEntry
+}
+
+type idempotencyKey struct {
+	client string
+	key    string
+}
+
+type idempotencyEntry struct {
+	tool string
+	args string
+	// done is closed once the first call finishes; result is nil if it
+	// failed, in which case the entry has been forgotten.
+	done    chan struct{}
+	result  *mcp.CallToolResult
+	expires time.Time
+}
+
+func newIdempotencyCache(ttl time.Duration, now func() time.Time) *idempotencyCache {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &idempotencyCache{ttl: ttl, now: now, entries: make(map[idempotencyKey]*idempotencyEntry)}
+}
+
+// claim returns the entry for k. owner is true when the caller must run the
+// call and then finish it; otherwise the caller waits on the entry.
+func (c *idempotencyCache) claim(k idempotencyKey, tool, args string) (entry *idempotencyEntry, owner bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if e, ok := c.entries[k]; ok && (e.expires.IsZero() || now.Before(e.expires)) {
+		return e, false
+	}
+	if len(c.entries) >= maxIdempotencyKeys {
+		c.pruneLocked(now)
+	}
+	e := &idempotencyEntry{tool: tool, args: args, done: make(chan struct{})}
+	c.entries[k] = e
+	return e, true
+}
+
+// finish records the outcome of an owned call. Failures are not remembered,
+// so a retry runs the call again.
+func (c *idempotencyCache) finish(k idempotencyKey, e *idempotencyEntry, res *mcp.CallToolResult, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil && res != nil && !res.IsError {
+		stored := *res
+		stored.Meta = maps.Clone(res.Meta)
+		e.result = &stored
+		e.expires = c.now().Add(c.ttl)
+	} else if c.entries[k] == e {
+		delete(c.entries, k)
+	}
+	close(e.done)
+}
+
+// pruneLocked drops expired entries, then the oldest finished ones, until
+// there is room for one more. Calls still in flight are kept.
+func (c *idempotencyCache) pruneLocked(now time.Time) {
+	for k, e := range c.entries {
+		if !e.expires.IsZero() && !now.Before(e.expires) {
+			delete(c.entries, k)
+		}
+	}
+	for len(c.entries) >= maxIdempotencyKeys {
+		var oldest idempotencyKey
+		var oldestAt time.Time
+		for k, e := range c.entries {
+			if !e.expires.IsZero() && (oldestAt.IsZero() || e.expires.Before(oldestAt)) {
+				oldest, oldestAt = k, e.expires
+			}
+		}
+		if oldestAt.IsZero() {
+			return
+		}
+		delete(c.entries, oldest)
+	}
+}
+
+// replayIdempotent answers a keyed call to a mutating tool with the result
+// of the first successful call with that key from the same client, marked
+// with _meta.idempotentReplay. A retry that arrives while the first call is
+// still running waits for it. Reusing a key for a different tool or
+// different arguments is an error.
+func (s *Server) replayIdempotent(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || call.Params == nil || !slices.Contains(idempotentTools, call.Params.Name) {
+			return next(ctx, method, req)
+		}
+		var args map[string]any
+		if err := json.Unmarshal(call.Params.Arguments, &args); err != nil {
+			return next(ctx, method, req)
+		}
+		key, _ := args["idempotencyKey"].(string)
+		if key == "" {
+			return next(ctx, method, req)
+		}
+		// Re-marshalling sorts the keys, so retries compare equal however
+		// the client ordered them.
+		canonical, _ := json.Marshal(args)
+		k := idempotencyKey{client: s.clientKey(call), key: key}
+		for {
+			entry, owner := s.idempotency.claim(k, call.Params.Name, string(canonical))
+			if owner {
+				res, err := next(ctx, method, req)
+				out, _ := res.(*mcp.CallToolResult)
+				s.idempotency.finish(k, entry, out, err)
+				return res, err
+			}
+			if entry.tool != call.Params.Name || entry.args != string(canonical) {
+				return &mcp.CallToolResult{
+					IsError: true,
+					Content: []mcp.Content{&mcp.TextContent{Text: fmt.Sprintf("idempotencyKey %q was already used for a different call (%s); use a new key for each action", key, entry.tool)}},
+				}, nil
+			}
+			select {
+			case <-entry.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if entry.result == nil {
+				// The first call failed; run this one in its place.
+				continue
+			}
+			replay := *entry.result
+			replay.Meta = maps.Clone(entry.result.Meta)
+			if replay.Meta == nil {
+				replay.Meta = mcp.Meta{}
+			}
+			replay.Meta["idempotentReplay"] = true
+			return &replay, nil
+		}
+	}
+}
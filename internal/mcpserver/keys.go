@@ -0,0 +1,51 @@
+package mcpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+)
+
+const maxPressKeys = 50
+
+type PressKeysInput struct {
+	TargetInput
+	IdempotencyInput
+	RefInput
+	Selector string   `json:"selector,omitempty" jsonschema:"CSS selector of the element to send keys to (default: the focused element)"`
+	Keys     []string `json:"keys" jsonschema:"key chords pressed in order, e.g. [\"Control+a\", \"Delete\"]; modifiers are Control, Shift, Alt and Meta"`
+}
+
+func (s *Server) pressKeys(ctx context.Context, req *mcp.CallToolRequest, input PressKeysInput) (*mcp.CallToolResult, browser.PressKeysResult, error) {
+	if len(input.Keys) == 0 {
+		return nil, browser.PressKeysResult{}, errors.New("keys is required")
+	}
+	if len(input.Keys) > maxPressKeys {
+		return nil, browser.PressKeysResult{}, fmt.Errorf("too many keys: %d (max %d)", len(input.Keys), maxPressKeys)
+	}
+	chords := make([]browser.KeyChord, len(input.Keys))
+	for i, k := range input.Keys {
+		chord, err := browser.ParseKeyChord(k)
+		if err != nil {
+			return nil, browser.PressKeysResult{}, fmt.Errorf("keys[%d]: %w", i, err)
+		}
+		chords[i] = chord
+	}
+	selector := input.Selector
+	if input.Ref != "" {
+		var err error
+		if selector, err = s.elementSelector(req, input.Selector, input.RefInput); err != nil {
+			return nil, browser.PressKeysResult{}, err
+		}
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	out, err := s.browser.PressKeys(ctx, selector, chords)
+	if err != nil {
+		return nil, browser.PressKeysResult{}, err
+	}
+	return nil, out, nil
+}
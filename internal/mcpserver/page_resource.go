@@ -0,0 +1,67 @@
+package mcpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/page"
+)
+
+// snapshotResource renders snap as a resource. A maxText or maxElements
+// query parameter reduces the snapshot's raw page again with those limits,
+// keeping the server reducer's other options; the stored snapshot is left
+// as it is.
+func (s *Server) snapshotResource(uri string, snap page.Snapshot, query url.Values) (*mcp.ReadResourceResult, error) {
+	maxText, err := limitParam(query, "maxText", maxSnapshotText)
+	if err != nil {
+		return nil, err
+	}
+	maxElements, err := limitParam(query, "maxElements", maxSnapshotElements)
+	if err != nil {
+		return nil, err
+	}
+	if maxText > 0 || maxElements > 0 {
+		raw, ok := snap.Raw()
+		if !ok {
+			return nil, fmt.Errorf("snapshot %s has no raw page to reduce again", snap.ID)
+		}
+		reducer := s.reducer
+		if reducer == nil {
+			reducer = page.NewReducer(page.ReduceOptions{})
+		}
+		id := snap.ID
+		snap = reducer.WithLimits(maxText, maxElements).Reduce(raw)
+		snap.ID = id
+	}
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{
+			{
+				URI:      uri,
+				MIMEType: "application/json",
+				Text:     string(data),
+			},
+		},
+	}, nil
+}
+
+// limitParam reads a positive integer query parameter, capped at hi. It
+// returns 0 when the parameter is absent.
+func limitParam(query url.Values, name string, hi int) (int, error) {
+	v := query.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%s must be a positive integer, got %q", name, v)
+	}
+	return min(n, hi), nil
+}
@@ -0,0 +1,85 @@
+package mcpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func (s *Server) registerPrompts() {
+	s.mcpServer.AddPrompt(&mcp.Prompt{
+		Name:        "browse_and_summarize",
+		Title:       "Navigate and summarize",
+		Description: "Open a URL in the browser and summarize what the page contains.",
+		Arguments: []*mcp.PromptArgument{
+			{Name: "url", Description: "page to open", Required: true},
+			{Name: "focus", Description: "optional topic to focus the summary on"},
+		},
+	}, s.browseAndSummarizePrompt)
+
+	s.mcpServer.AddPrompt(&mcp.Prompt{
+		Name:        "fill_form",
+		Title:       "Fill a form",
+		Description: "Locate a form on the page and fill it in to achieve a goal.",
+		Arguments: []*mcp.PromptArgument{
+			{Name: "goal", Description: "what the submitted form should accomplish, including the values to use", Required: true},
+			{Name: "url", Description: "optional page to open first; defaults to the current tab"},
+		},
+	}, s.fillFormPrompt)
+}
+
+func (s *Server) browseAndSummarizePrompt(_ context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	args := promptArgs(req)
+	target := strings.TrimSpace(args["url"])
+	if target == "" {
+		return nil, errors.New("url is required")
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "1. Call browser.navigate with url %q.\n", target)
+	b.WriteString("2. Call browser.snapshot to read the page. If the text looks cut off, scroll with browser.scroll and snapshot again.\n")
+	b.WriteString("3. Summarize the page: its purpose, the key facts it states, and the main links or actions available.\n")
+	if focus := strings.TrimSpace(args["focus"]); focus != "" {
+		fmt.Fprintf(&b, "Focus the summary on: %s. Use browser.find to locate relevant passages.\n", focus)
+	}
+	return &mcp.GetPromptResult{
+		Description: "Navigate to " + target + " and summarize it.",
+		Messages: []*mcp.PromptMessage{
+			{Role: "user", Content: &mcp.TextContent{Text: b.String()}},
+		},
+	}, nil
+}
+
+func (s *Server) fillFormPrompt(_ context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	args := promptArgs(req)
+	goal := strings.TrimSpace(args["goal"])
+	if goal == "" {
+		return nil, errors.New("goal is required")
+	}
+	var b strings.Builder
+	step := 1
+	if target := strings.TrimSpace(args["url"]); target != "" {
+		fmt.Fprintf(&b, "%d. Call browser.navigate with url %q.\n", step, target)
+		step++
+	}
+	fmt.Fprintf(&b, "%d. Call browser.snapshot and identify the form fields from its actions (verbs type, select, toggle).\n", step)
+	fmt.Fprintf(&b, "%d. Fill each field with browser.type or browser.select using the selectors from the snapshot. Skip fields marked disabled.\n", step+1)
+	fmt.Fprintf(&b, "%d. Snapshot again to verify the values, then submit with browser.click on the submit control.\n", step+2)
+	fmt.Fprintf(&b, "%d. Snapshot once more and report whether the submission succeeded.\n", step+3)
+	fmt.Fprintf(&b, "Goal: %s\n", goal)
+	return &mcp.GetPromptResult{
+		Description: "Fill a form to: " + goal,
+		Messages: []*mcp.PromptMessage{
+			{Role: "user", Content: &mcp.TextContent{Text: b.String()}},
+		},
+	}, nil
+}
+
+func promptArgs(req *mcp.GetPromptRequest) map[string]string {
+	if req == nil || req.Params == nil || req.Params.Arguments == nil {
+		return map[string]string{}
+	}
+	return req.Params.Arguments
+}
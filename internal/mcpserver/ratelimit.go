@@ -0,0 +1,122 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Full buckets carry no state worth keeping, so they are dropped every
+// bucketSweepInterval, and sooner once maxIdleBuckets are held.
+const (
+	maxIdleBuckets      = 1024
+	bucketSweepInterval = time.Minute
+)
+
+// rateLimiter is a token bucket per MCP client. Each bucket holds up to burst
+// tokens and refills at rate tokens per second; a tool call takes one.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns nil, meaning unlimited, when rate is not positive.
+// A burst below one defaults to the rate rounded up.
+func newRateLimiter(rate float64, burst int, now func() time.Time) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &rateLimiter{rate: rate, burst: float64(burst), now: now, buckets: make(map[string]*bucket), lastSweep: now()}
+}
+
+// take spends a token from key's bucket. When none is left it reports how
+// long until one is.
+func (l *rateLimiter) take(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if len(l.buckets) >= maxIdleBuckets || now.Sub(l.lastSweep) >= bucketSweepInterval {
+		l.dropFull(now)
+		l.lastSweep = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+func (l *rateLimiter) dropFull(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// limitToolCalls rejects tool calls from a client that has spent its bucket.
+// Other requests, such as resource reads, pass through untouched.
+func (s *Server) limitToolCalls(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || s.limiter == nil {
+			return next(ctx, method, req)
+		}
+		if ok, wait := s.limiter.take(rateKey(call)); !ok {
+			return s.rateLimitResult(ctx, wait), nil
+		}
+		return next(ctx, method, req)
+	}
+}
+
+// rateKey picks the bucket for a tool call: the authenticated user when the
+// transport verified a bearer token, else the MCP session. Unlike clientKey it
+// ignores client id headers, which a client could change to get a fresh
+// bucket.
+func rateKey(req *mcp.CallToolRequest) string {
+	if req.Extra != nil && req.Extra.TokenInfo != nil && req.Extra.TokenInfo.UserID != "" {
+		return "user:" + req.Extra.TokenInfo.UserID
+	}
+	if req.Session != nil {
+		return "session:" + req.Session.ID()
+	}
+	return ""
+}
+
+func (s *Server) rateLimitResult(ctx context.Context, wait time.Duration) *mcp.CallToolResult {
+	retry := max(wait.Milliseconds(), 1)
+	return errorResult("rate_limited", withTraceID(ctx, map[string]any{
+		"message":      fmt.Sprintf("too many tool calls: limit is %g per second with a burst of %d; retry in %dms", s.limiter.rate, int(s.limiter.burst), retry),
+		"rate":         s.limiter.rate,
+		"burst":        int(s.limiter.burst),
+		"retryAfterMs": retry,
+	}))
+}
@@ -0,0 +1,52 @@
+package mcpserver
+
+import (
+	"context"
+	"errors"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+)
+
+type GetAttributeInput struct {
+	TargetInput
+	RefInput
+	Selector  string `json:"selector,omitempty" jsonschema:"CSS selector of the element to read"`
+	Attribute string `json:"attribute" jsonschema:"attribute name, e.g. href or aria-expanded"`
+}
+
+func (s *Server) getAttribute(ctx context.Context, req *mcp.CallToolRequest, input GetAttributeInput) (*mcp.CallToolResult, browser.AttributeResult, error) {
+	if input.Attribute == "" {
+		return nil, browser.AttributeResult{}, errors.New("attribute is required")
+	}
+	selector, err := s.elementSelector(req, input.Selector, input.RefInput)
+	if err != nil {
+		return nil, browser.AttributeResult{}, err
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	out, err := s.browser.GetAttribute(ctx, selector, input.Attribute)
+	if err != nil {
+		return nil, browser.AttributeResult{}, err
+	}
+	return nil, out, nil
+}
+
+type GetTextInput struct {
+	TargetInput
+	RefInput
+	Selector string `json:"selector,omitempty" jsonschema:"CSS selector of the element to read"`
+}
+
+func (s *Server) getText(ctx context.Context, req *mcp.CallToolRequest, input GetTextInput) (*mcp.CallToolResult, browser.TextResult, error) {
+	selector, err := s.elementSelector(req, input.Selector, input.RefInput)
+	if err != nil {
+		return nil, browser.TextResult{}, err
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	out, err := s.browser.GetText(ctx, selector)
+	if err != nil {
+		return nil, browser.TextResult{}, err
+	}
+	return nil, out, nil
+}
@@ -0,0 +1,79 @@
+package mcpserver
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+)
+
+const maxRecordingLimit = 1000
+
+type GetRecordingInput struct {
+	TargetInput
+	Since      int64    `json:"since,omitempty" jsonschema:"only actions with a timestamp after this (ms since epoch)"`
+	SinceIndex int      `json:"sinceIndex,omitempty" jsonschema:"skip actions before this index in the full recording; pass nextIndex to continue"`
+	Limit      int      `json:"limit,omitempty" jsonschema:"max actions to return; 0 returns all"`
+	Types      []string `json:"types,omitempty" jsonschema:"only actions of these types, e.g. click or type"`
+}
+
+type RecordingOutput struct {
+	Actions []browser.RecordedAction `json:"actions"`
+	// Total counts every action in the recording, before filtering.
+	Total int `json:"total" jsonschema:"actions in the whole recording"`
+	// NextIndex is the sinceIndex that continues after the last action
+	// examined, so repeated calls walk the recording without gaps.
+	NextIndex int      `json:"nextIndex" jsonschema:"sinceIndex for the next page"`
+	HasMore   bool     `json:"hasMore,omitempty" jsonschema:"true when matching actions remain past limit"`
+	Warnings  []string `json:"warnings,omitempty" jsonschema:"non-fatal problems with the request, such as clamped limits"`
+}
+
+func (s *Server) getRecording(ctx context.Context, req *mcp.CallToolRequest, input GetRecordingInput) (*mcp.CallToolResult, RecordingOutput, error) {
+	var warn warnings
+	input.SinceIndex = warn.clamp("sinceIndex", input.SinceIndex, math.MaxInt)
+	input.Limit = warn.clamp("limit", input.Limit, maxRecordingLimit)
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	actions, err := s.browser.GetRecording(ctx)
+	if err != nil {
+		return nil, RecordingOutput{}, err
+	}
+	out := filterRecording(actions, input)
+	out.Warnings = warn
+	return nil, out, nil
+}
+
+// filterRecording pages through actions from input.SinceIndex, keeping those
+// that match the timestamp and type filters, until input.Limit are found.
+func filterRecording(actions []browser.RecordedAction, input GetRecordingInput) RecordingOutput {
+	out := RecordingOutput{Actions: []browser.RecordedAction{}, Total: len(actions), NextIndex: len(actions)}
+	for i := min(input.SinceIndex, len(actions)); i < len(actions); i++ {
+		a := actions[i]
+		// Since is only a filter when set, so actions the extension
+		// recorded without a timestamp are still returned by default.
+		if input.Since > 0 && a.Timestamp <= input.Since || !matchesType(a.Type, input.Types) {
+			continue
+		}
+		if input.Limit > 0 && len(out.Actions) == input.Limit {
+			out.NextIndex = i
+			out.HasMore = true
+			break
+		}
+		out.Actions = append(out.Actions, a)
+	}
+	return out
+}
+
+func matchesType(t string, types []string) bool {
+	if len(types) == 0 {
+		return true
+	}
+	for _, want := range types {
+		if strings.EqualFold(strings.TrimSpace(want), t) {
+			return true
+		}
+	}
+	return false
+}
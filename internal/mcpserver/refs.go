@@ -0,0 +1,72 @@
+package mcpserver
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// RefInput lets element tools act on an element from a prior snapshot by its
+// ref instead of a CSS selector.
+type RefInput struct {
+	Ref        string `json:"ref,omitempty" jsonschema:"element ref from browser.snapshot, e.g. e12; use instead of selector"`
+	SnapshotID string `json:"snapshotId,omitempty" jsonschema:"snapshot_id the ref comes from; the call fails if you have taken a newer snapshot since (default: your latest snapshot)"`
+}
+
+// rememberSnapshot records id as the snapshot the client's refs resolve
+// against.
+func (s *Server) rememberSnapshot(req *mcp.CallToolRequest, id string) {
+	if id == "" {
+		return
+	}
+	s.refsMu.Lock()
+	defer s.refsMu.Unlock()
+	s.refSnapshots[s.clientKey(req)] = id
+}
+
+func (s *Server) lastSnapshot(req *mcp.CallToolRequest) string {
+	s.refsMu.Lock()
+	defer s.refsMu.Unlock()
+	return s.refSnapshots[s.clientKey(req)]
+}
+
+// elementSelector returns selector, or the selector in the stored snapshot
+// for the element ref names. A ref is only good against the latest snapshot
+// the calling client took: once it takes a newer one the page may have
+// changed, and acting on the old element could hit the wrong one. Snapshots
+// other clients take, of their own pages, do not count.
+func (s *Server) elementSelector(req *mcp.CallToolRequest, selector string, ref RefInput) (string, error) {
+	if ref.Ref == "" {
+		if selector == "" {
+			return "", errors.New("selector or ref is required")
+		}
+		return selector, nil
+	}
+	if selector != "" {
+		return "", errors.New("pass selector or ref, not both")
+	}
+	if s.store.Disabled() {
+		return "", errors.New("refs need snapshot storage, which is disabled; pass a selector")
+	}
+	latestID := s.lastSnapshot(req)
+	if latestID == "" {
+		return "", fmt.Errorf("unknown ref %q: you have not taken a snapshot; call browser.snapshot first", ref.Ref)
+	}
+	if ref.SnapshotID != "" && ref.SnapshotID != latestID {
+		if _, ok := s.store.Get(ref.SnapshotID); !ok {
+			return "", fmt.Errorf("unknown snapshot %q for ref %q; call browser.snapshot and use its refs", ref.SnapshotID, ref.Ref)
+		}
+		return "", fmt.Errorf("stale ref %q: snapshot %s has been superseded by %s; use the refs from the latest browser.snapshot", ref.Ref, ref.SnapshotID, latestID)
+	}
+	latest, ok := s.store.Get(latestID)
+	if !ok {
+		return "", fmt.Errorf("unknown ref %q: snapshot %s is no longer stored; call browser.snapshot again", ref.Ref, latestID)
+	}
+	for _, el := range latest.Elements {
+		if el.Ref == ref.Ref && el.Selector != "" {
+			return el.Selector, nil
+		}
+	}
+	return "", fmt.Errorf("unknown ref %q in snapshot %s", ref.Ref, latest.ID)
+}
@@ -0,0 +1,93 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+	"github.com/adityalohuni/mcp-server/internal/screenshot"
+)
+
+// maxScreenshotRead caps the image size served by browser://screenshot/{id}.
+const maxScreenshotRead = 8 << 20
+
+// storeScreenshot keeps a capture and returns its id, or "" when the data URL
+// cannot be decoded.
+func (s *Server) storeScreenshot(out browser.ScreenshotResult) string {
+	mimeType, data, err := screenshot.DecodeDataURL(out.DataURL)
+	if err != nil {
+		log.Printf("screenshot not stored: %v", err)
+		return ""
+	}
+	shot := s.screenshots.Put(screenshot.Shot{
+		MIMEType: mimeType,
+		Format:   out.Format,
+		Selector: out.Selector,
+		Width:    out.Width,
+		Height:   out.Height,
+		Data:     data,
+	})
+	return shot.ID
+}
+
+type screenshotListEntry struct {
+	screenshot.Shot
+	URI string `json:"uri"`
+}
+
+func (s *Server) readScreenshotList(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	if req == nil || req.Params == nil {
+		return nil, errors.New("missing resource params")
+	}
+	shots := s.screenshots.List()
+	entries := make([]screenshotListEntry, 0, len(shots))
+	for _, shot := range shots {
+		entries = append(entries, screenshotListEntry{Shot: shot, URI: "browser://screenshot/" + shot.ID})
+	}
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{
+			{URI: req.Params.URI, MIMEType: "application/json", Text: string(data)},
+		},
+	}, nil
+}
+
+func (s *Server) readScreenshot(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	if req == nil || req.Params == nil {
+		return nil, errors.New("missing resource params")
+	}
+	id := strings.TrimPrefix(req.Params.URI, "browser://screenshot/")
+	shot, ok := s.screenshots.Get(id)
+	if !ok {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
+	}
+	if shot.Size > maxScreenshotRead {
+		return nil, fmt.Errorf("screenshot %s is %d bytes, over the %d byte read limit; capture a smaller one with maxWidth/maxHeight", id, shot.Size, maxScreenshotRead)
+	}
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{
+			{
+				URI:      req.Params.URI,
+				MIMEType: shot.MIMEType,
+				Blob:     shot.Data,
+				Meta: mcp.Meta{
+					"width":      shot.Width,
+					"height":     shot.Height,
+					"format":     shot.Format,
+					"selector":   shot.Selector,
+					"size":       shot.Size,
+					"capturedAt": shot.CapturedAt,
+				},
+			},
+		},
+	}, nil
+}
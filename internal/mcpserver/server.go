@@ -1,17 +1,23 @@
 package mcpserver
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/adityalohuni/mcp-server/internal/browser"
 	"github.com/adityalohuni/mcp-server/internal/page"
+	"github.com/adityalohuni/mcp-server/internal/screenshot"
 	"github.com/adityalohuni/mcp-server/internal/workflow"
 )
 
@@ -19,14 +25,103 @@ type Options struct {
 	Implementation *mcp.Implementation
 	Instructions   string
 	WorkflowLimit  int
+	// WorkflowDir holds one workflows file per namespace; empty means the
+	// working directory.
+	WorkflowDir string
+	// DisablePrompts skips registering the built-in browsing prompts.
+	DisablePrompts bool
+	// AllowedHosts restricts browser.navigate and browser.open_tab to these
+	// hosts; "*.example.com" matches subdomains. Empty allows all hosts.
+	AllowedHosts []string
+	// AllowEvaluate registers browser.evaluate, which runs arbitrary
+	// JavaScript in the user's page. A script can navigate anywhere, so the
+	// tool is left out when AllowedHosts is set even if this is true.
+	AllowEvaluate bool
+	// DefaultSnapshotFormat is the browser.snapshot format used when a call
+	// names none; see the page.Format* constants. Empty means json.
+	DefaultSnapshotFormat string
+	// Connect, when set, is served as the browser://connect resource.
+	Connect *ConnectInfo
+	// Reducer, when set, reduces every snapshot taken through this server in
+	// place of the browser's default. Share it with wsbrowser.NewClient to
+	// configure reduction in one place.
+	Reducer *page.Reducer
+	// ToolTimeouts overrides how long a tool waits on the browser, by tool
+	// name. For browser.wait_for_selector and browser.wait_for_url it is also
+	// the default timeoutMs.
+	// Check it with ValidateToolTimeouts; unknown names are ignored.
+	ToolTimeouts map[string]time.Duration
+	// MaxTabsPerSession caps how many tabs a browser session may have open
+	// before browser.open_tab fails with tab_limit_exceeded. Zero is unlimited.
+	MaxTabsPerSession int
+	// ActiveSession reports the browser session that commands naming none
+	// are sent to, as wsbridge.Bridge.ActiveSessionID does. With it, an
+	// untargeted browser.open_tab is counted under the same lock as one
+	// naming that session.
+	ActiveSession func() (string, bool)
+	// ToolRateLimit caps tool calls per second for each MCP session, or
+	// each user when the transport verifies bearer tokens, with bursts of up
+	// to ToolRateBurst calls (default: the rate rounded up).
+	// Calls over the limit fail with rate_limited. Zero is unlimited.
+	ToolRateLimit float64
+	ToolRateBurst int
+	// ClientIDHeaders are checked, in order, to tell MCP clients apart over
+	// HTTP; match the headers mcpd tracks clients by. Empty means X-Client-Id
+	// then X-MCP-Client-Id.
+	ClientIDHeaders []string
+	// Screenshots keeps browser.screenshot captures for the
+	// browser://screenshot resources; nil uses a default in-memory store.
+	// It is not used when the page store is disabled: screenshots are then
+	// returned inline and never kept either.
+	Screenshots *screenshot.Store
+	// IdempotencyTTL is how long the result of a mutating tool call made
+	// with an idempotencyKey is replayed to retries; zero means 5 minutes.
+	IdempotencyTTL time.Duration
 }
 
 type Server struct {
 	mcpServer     *mcp.Server
 	browser       browser.Browser
 	store         *page.Store
-	workflows     *workflow.Store
+	workflows     *workflow.Namespaces
 	workflowLimit int
+	hosts         hostPolicy
+	connect       *ConnectInfo
+	reducer       *page.Reducer
+	toolTimeouts  map[string]time.Duration
+	maxTabs       int
+	activeSession func() (string, bool)
+	screenshots   *screenshot.Store // nil when storage is disabled
+	limiter       *rateLimiter
+	idempotency   *idempotencyCache
+	idHeaders     []string
+	// snapshotFormat is the default format for browser.snapshot.
+	snapshotFormat string
+
+	// openTabLocks serializes browser.open_tab per target session so
+	// concurrent calls cannot overshoot maxTabs between counting and opening.
+	// Calls that name no session lock the active session, or share the ""
+	// entry when it is unknown.
+	openTabMu    sync.Mutex
+	openTabLocks map[string]*openTabLock
+
+	targetsMu sync.Mutex
+	targets   map[string]TargetInput
+
+	// refSnapshots is the last snapshot each client took, by clientKey;
+	// refs resolve against it.
+	refsMu       sync.Mutex
+	refSnapshots map[string]string
+
+	// sessionKeys is the clientKey of each open session that has called a
+	// tool, and keySessions counts them per key, so the per-client state
+	// above is dropped once a client's last session closes.
+	clientsMu   sync.Mutex
+	sessionKeys map[*mcp.ServerSession]string
+	keySessions map[string]int
+
+	// snapshots joins concurrent identical snapshot calls; see sharedSnapshot.
+	snapshots singleflight.Group
 }
 
 type TargetInput struct {
@@ -42,144 +137,285 @@ func New(browserClient browser.Browser, store *page.Store, opts Options) *Server
 	if store == nil {
 		store = page.NewStore()
 	}
-	workflows := workflow.NewStore("workflows.json")
+	screenshots := opts.Screenshots
+	if store.Disabled() {
+		screenshots = nil
+	} else if screenshots == nil {
+		screenshots = screenshot.NewStore(screenshot.Options{})
+	}
+	workflows := workflow.NewNamespaces(opts.WorkflowDir)
 	server := mcp.NewServer(impl, &mcp.ServerOptions{Instructions: opts.Instructions})
-	s := &Server{mcpServer: server, browser: browserClient, store: store, workflows: workflows, workflowLimit: opts.WorkflowLimit}
+	s := &Server{
+		mcpServer:      server,
+		browser:        browserClient,
+		store:          store,
+		workflows:      workflows,
+		workflowLimit:  opts.WorkflowLimit,
+		hosts:          newHostPolicy(opts.AllowedHosts),
+		connect:        opts.Connect,
+		reducer:        opts.Reducer,
+		toolTimeouts:   opts.ToolTimeouts,
+		maxTabs:        opts.MaxTabsPerSession,
+		activeSession:  opts.ActiveSession,
+		screenshots:    screenshots,
+		limiter:        newRateLimiter(opts.ToolRateLimit, opts.ToolRateBurst, nil),
+		idempotency:    newIdempotencyCache(opts.IdempotencyTTL, nil),
+		idHeaders:      opts.ClientIDHeaders,
+		snapshotFormat: opts.DefaultSnapshotFormat,
+		targets:        make(map[string]TargetInput),
+		refSnapshots:   make(map[string]string),
+		sessionKeys:    make(map[*mcp.ServerSession]string),
+		keySessions:    make(map[string]int),
+		openTabLocks:   make(map[string]*openTabLock),
+	}
+	if len(s.idHeaders) == 0 {
+		s.idHeaders = defaultClientIDHeaders
+	}
+	server.AddReceivingMiddleware(dropErrorOutput, s.applyToolTimeouts, traceToolCalls, s.limitToolCalls, s.replayIdempotent, s.watchClients)
 	if opts.WorkflowLimit > 0 {
-		_, _ = workflows.Compact(opts.WorkflowLimit)
+		if def, err := workflows.Store(""); err == nil {
+			_, _ = def.Compact(opts.WorkflowLimit)
+		}
 	}
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.click",
 		Description: "Click the first element matching a CSS selector on the active page.",
 	}, s.click)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.snapshot",
 		Description: "Return a reduced, LLM-friendly snapshot of the current page.",
 	}, s.snapshot)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.scroll",
 		Description: "Scroll the page or a specific element by pixel offsets.",
 	}, s.scroll)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.hover",
 		Description: "Hover over the first element matching a CSS selector.",
 	}, s.hover)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.type",
 		Description: "Type text into an input or textarea; optionally press Enter.",
 	}, s.typeText)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.enter",
 		Description: "Press a key (default Enter) on a target element or active element.",
 	}, s.enter)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
+		Name:        "browser.press_keys",
+		Description: "Press a sequence of key chords, such as [\"Control+a\", \"Delete\"], on a target element or the focused element. Modifiers are Control, Shift, Alt and Meta; keys are single characters or names like Enter, Tab, Escape or ArrowDown. Returns the chords dispatched.",
+	}, s.pressKeys)
+
+	addTool(server, &mcp.Tool{
 		Name:        "browser.back",
-		Description: "Navigate backward in browser history.",
+		Description: "Navigate backward in browser history. Returns the url and title of the page the tab is on afterwards; moved is false when there was no earlier page.",
 	}, s.back)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.forward",
-		Description: "Navigate forward in browser history.",
+		Description: "Navigate forward in browser history. Returns the url and title of the page the tab is on afterwards; moved is false when there was no later page.",
 	}, s.forward)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
+		Name:        "browser.history",
+		Description: "List the tab's history entries (url, title) and the index of the current page, to see where back and forward will land. complete is false when the browser only reports the current page.",
+	}, s.history)
+
+	addTool(server, &mcp.Tool{
 		Name:        "browser.wait_for_selector",
-		Description: "Wait for a selector to appear in the DOM.",
+		Description: "Wait for a selector to reach a state: attached to the DOM (default), visible, hidden or detached, e.g. hidden to wait for a spinner to go away. Set containsText to also wait until the element's text contains it.",
 	}, s.waitForSelector)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
+		Name:        "browser.wait_for_url",
+		Description: "Wait until the tab's URL matches a glob (default; e.g. **/success) or a regex, such as after a form submit redirects. Returns the final URL.",
+	}, s.waitForURL)
+
+	addTool(server, &mcp.Tool{
 		Name:        "browser.find",
-		Description: "Find text on the page and return short snippets.",
+		Description: "Find text on the page and return short snippets. Set includePositions for each match's selector and document rect, or scrollTo to also scroll the first match into view.",
 	}, s.find)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.navigate",
-		Description: "Navigate to a URL in the active tab.",
+		Description: "Navigate to a URL in the active tab. statusCode and key response headers are included when the browser can report them, so error pages such as 404s can be spotted without reading the page.",
 	}, s.navigate)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
+		Name:        "browser.reload",
+		Description: "Reload the current page, optionally bypassing the cache. Returns the url, title and statusCode like browser.navigate.",
+	}, s.reload)
+
+	addTool(server, &mcp.Tool{
 		Name:        "browser.select",
 		Description: "Select option(s) in a <select> by value/label/index.",
 	}, s.selectOption)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.screenshot",
-		Description: "Capture a screenshot of an element or the viewport.",
+		Description: "Capture a screenshot of an element or the viewport. Returns a screenshotId and the dimensions; read the image from browser://screenshot/{screenshotId}, or pass inline to also get it as a data URL.",
 	}, s.screenshot)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.start_recording",
 		Description: "Start recording user actions in the browser.",
 	}, s.startRecording)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.stop_recording",
 		Description: "Stop recording user actions in the browser.",
 	}, s.stopRecording)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.get_recording",
 		Description: "Get the current recorded action list.",
 	}, s.getRecording)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.list_tabs",
 		Description: "List available browser tabs for the active session.",
 	}, s.listTabs)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.find_tab",
 		Description: "Find tabs by title, URL, or id and return matching tab info.",
 	}, s.findTab)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.open_tab",
-		Description: "Open a new browser tab owned by the session.",
+		Description: "Open a new browser tab owned by the session. Fails with tab_limit_exceeded when the session already has the configured maximum of open tabs.",
 	}, s.openTab)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.close_tab",
 		Description: "Close a browser tab owned by the session.",
 	}, s.closeTab)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.claim_tab",
 		Description: "Claim an existing browser tab for the session.",
 	}, s.claimTab)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.release_tab",
 		Description: "Release ownership of a browser tab for the session.",
 	}, s.releaseTab)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "browser.set_tab_sharing",
 		Description: "Allow or disallow shared claims on a tab owned by the session.",
 	}, s.setTabSharing)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
+		Name:        "browser.clear_storage",
+		Description: "Clear cookies, localStorage, sessionStorage and/or cache for the current tab's origin, e.g. to reset state between test runs.",
+	}, s.clearStorage)
+
+	addTool(server, &mcp.Tool{
+		Name:        "browser.get_storage",
+		Description: "Read the current tab's localStorage (kind local, default) or sessionStorage (kind session): one key, or every key and value when key is omitted. Output is capped at maxBytes; truncated is set when items were left out.",
+	}, s.getStorage)
+
+	addTool(server, &mcp.Tool{
+		Name:        "browser.set_storage",
+		Description: "Set or remove a key in the current tab's localStorage or sessionStorage, e.g. to restore a logged-in session without repeating the login flow.",
+	}, s.setStorage)
+
+	switch {
+	case opts.AllowEvaluate && len(opts.AllowedHosts) > 0:
+		log.Printf("browser.evaluate is not registered: a script could navigate past allowed_hosts")
+	case opts.AllowEvaluate:
+		addTool(server, &mcp.Tool{
+			Name:        "browser.evaluate",
+			Description: "Evaluate a JavaScript expression in the page and return its JSON-serialized result and type. An exception in the page is returned as a tool error.",
+		}, s.evaluate)
+	}
+
+	addTool(server, &mcp.Tool{
+		Name:        "browser.fill_form",
+		Description: "Fill several fields in order in one round trip. A field that fails does not stop the rest; each field's status is returned with succeeded and failed counts.",
+	}, s.fillForm)
+
+	addTool(server, &mcp.Tool{
+		Name:        "browser.check",
+		Description: "Check a checkbox or radio button by ref or selector. Does nothing if it is already checked; returns the final state and whether it changed.",
+	}, s.check)
+
+	addTool(server, &mcp.Tool{
+		Name:        "browser.uncheck",
+		Description: "Uncheck a checkbox by ref or selector. Does nothing if it is already unchecked; returns the final state and whether it changed.",
+	}, s.uncheck)
+
+	addTool(server, &mcp.Tool{
+		Name:        "browser.get_attribute",
+		Description: "Read one attribute of the first element matching a selector or ref, without taking a snapshot.",
+	}, s.getAttribute)
+
+	addTool(server, &mcp.Tool{
+		Name:        "browser.get_text",
+		Description: "Read the text of the first element matching a selector or ref: innerText as rendered and textContent as in the DOM.",
+	}, s.getText)
+
+	addTool(server, &mcp.Tool{
+		Name:        "browser.act",
+		Description: "Perform one action (click, hover, type, select or enter) by ref or selector, let the page settle, and return the new snapshot with a diff against the page just before the action.",
+	}, s.act)
+
+	addTool(server, &mcp.Tool{
+		Name:        "browser.use_target",
+		Description: "Set the default sessionId/tabId used by later calls from this client that omit a target.",
+	}, s.useTarget)
+
+	addTool(server, &mcp.Tool{
+		Name:        "browser.clear_target",
+		Description: "Clear the default target set by browser.use_target.",
+	}, s.clearTarget)
+
+	addTool(server, &mcp.Tool{
 		Name:        "workflow.save",
 		Description: "Save a recorded workflow into server memory.",
 	}, s.saveWorkflow)
 
-	mcp.AddTool(server, &mcp.Tool{
+	addTool(server, &mcp.Tool{
 		Name:        "workflow.compact",
 		Description: "Compact workflow memory to a maximum count.",
 	}, s.compactWorkflows)
 
-	server.AddResource(&mcp.Resource{
-		Name:        "browser_latest",
-		Description: "Read the most recent stored page snapshot.",
-		URI:         "browser://page/latest",
-		MIMEType:    "application/json",
-	}, s.readLatest)
+	// With storage disabled there is nothing to read back, so the page
+	// resources are left out rather than always answering not found.
+	if !store.Disabled() {
+		server.AddResource(&mcp.Resource{
+			Name:        "browser_latest",
+			Description: "Read the most recent stored page snapshot.",
+			URI:         "browser://page/latest",
+			MIMEType:    "application/json",
+		}, s.readLatest)
+	}
+
+	if !store.Disabled() {
+		server.AddResource(&mcp.Resource{
+			Name:        "browser_screenshot_list",
+			Description: "List stored screenshots, newest first, with their size and dimensions.",
+			URI:         "browser://screenshot/list",
+			MIMEType:    "application/json",
+		}, s.readScreenshotList)
+	}
+
+	if opts.Connect != nil {
+		server.AddResource(&mcp.Resource{
+			Name:        "browser_connect",
+			Description: "WebSocket URL and instructions for connecting the browser extension.",
+			URI:         "browser://connect",
+			MIMEType:    "application/json",
+		}, s.readConnect)
+	}
 
 	server.AddResource(&mcp.Resource{
 		Name:        "workflow_list",
@@ -188,12 +424,22 @@ func New(browserClient browser.Browser, store *page.Store, opts Options) *Server
 		MIMEType:    "application/json",
 	}, s.readWorkflowList)
 
-	server.AddResourceTemplate(&mcp.ResourceTemplate{
-		Name:        "browser_page",
-		Description: "Read a stored page snapshot by ID.",
-		URITemplate: "browser://page/{snapshot_id}",
-		MIMEType:    "application/json",
-	}, s.readSnapshot)
+	if !store.Disabled() {
+		server.AddResourceTemplate(&mcp.ResourceTemplate{
+			Name:        "browser_page",
+			Description: "Read a stored page snapshot by ID (or latest). maxText and maxElements re-reduce it with tighter limits.",
+			URITemplate: "browser://page/{snapshot_id}{?maxText,maxElements}",
+			MIMEType:    "application/json",
+		}, s.readSnapshot)
+	}
+
+	if !store.Disabled() {
+		server.AddResourceTemplate(&mcp.ResourceTemplate{
+			Name:        "browser_screenshot",
+			Description: "Read a stored screenshot's image by ID.",
+			URITemplate: "browser://screenshot/{screenshot_id}",
+		}, s.readScreenshot)
+	}
 
 	server.AddResourceTemplate(&mcp.ResourceTemplate{
 		Name:        "workflow_item",
@@ -202,6 +448,17 @@ func New(browserClient browser.Browser, store *page.Store, opts Options) *Server
 		MIMEType:    "application/json",
 	}, s.readWorkflow)
 
+	server.AddResourceTemplate(&mcp.ResourceTemplate{
+		Name:        "workflow_namespace_item",
+		Description: "Read a workflow by ID from a namespace; workflow://{namespace}/list lists the namespace.",
+		URITemplate: "workflow://{namespace}/{workflow_id}",
+		MIMEType:    "application/json",
+	}, s.readWorkflow)
+
+	if !opts.DisablePrompts {
+		s.registerPrompts()
+	}
+
 	return s
 }
 
@@ -213,7 +470,12 @@ func (s *Server) MCPServer() *mcp.Server {
 	return s.mcpServer
 }
 
-func (s *Server) withTarget(ctx context.Context, target TargetInput) context.Context {
+// withTarget routes the call to the explicit target when either field is set,
+// otherwise to the default stored for the calling client by browser.use_target.
+func (s *Server) withTarget(ctx context.Context, req *mcp.CallToolRequest, target TargetInput) context.Context {
+	if target.SessionID == "" && target.TabID == 0 {
+		target = s.defaultTarget(s.clientKey(req))
+	}
 	if target.SessionID == "" && target.TabID == 0 {
 		return ctx
 	}
@@ -225,7 +487,9 @@ func (s *Server) withTarget(ctx context.Context, target TargetInput) context.Con
 
 type ClickInput struct {
 	TargetInput
-	Selector string `json:"selector" jsonschema:"CSS selector for the element to click"`
+	IdempotencyInput
+	RefInput
+	Selector string `json:"selector,omitempty" jsonschema:"CSS selector for the element to click"`
 }
 
 type ClickOutput struct {
@@ -233,12 +497,13 @@ type ClickOutput struct {
 	Selector string `json:"selector,omitempty" jsonschema:"CSS selector that was clicked"`
 }
 
-func (s *Server) click(ctx context.Context, _ *mcp.CallToolRequest, input ClickInput) (*mcp.CallToolResult, ClickOutput, error) {
-	if input.Selector == "" {
-		return nil, ClickOutput{}, errors.New("selector is required")
+func (s *Server) click(ctx context.Context, req *mcp.CallToolRequest, input ClickInput) (*mcp.CallToolResult, ClickOutput, error) {
+	selector, err := s.elementSelector(req, input.Selector, input.RefInput)
+	if err != nil {
+		return nil, ClickOutput{}, err
 	}
-	ctx = s.withTarget(ctx, input.TargetInput)
-	result, err := s.browser.Click(ctx, input.Selector)
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	result, err := s.browser.Click(ctx, selector)
 	if err != nil {
 		return nil, ClickOutput{}, err
 	}
@@ -247,47 +512,111 @@ func (s *Server) click(ctx context.Context, _ *mcp.CallToolRequest, input ClickI
 
 type SnapshotInput struct {
 	TargetInput
+	SnapshotOptionsInput
+	Format string `json:"format,omitempty" jsonschema:"json (structured text, elements and actions), markdown (one document) or outline (one line per element: ref, role, name); default set by the server, normally json"`
+}
+
+// SnapshotOptionsInput shapes a snapshot; browser.act takes the same options
+// for the snapshot it returns.
+type SnapshotOptionsInput struct {
 	IncludeHidden bool `json:"includeHidden,omitempty" jsonschema:"include hidden elements"`
 	MaxElements   int  `json:"maxElements,omitempty" jsonschema:"maximum number of elements to return"`
 	MaxText       int  `json:"maxText,omitempty" jsonschema:"maximum characters of text to return"`
 	IncludeHTML   bool `json:"includeHTML,omitempty" jsonschema:"include raw HTML in snapshot"`
 	MaxHTML       int  `json:"maxHTML,omitempty" jsonschema:"max characters of HTML to return"`
 	MaxHTMLTokens int  `json:"maxHTMLTokens,omitempty" jsonschema:"approx max HTML tokens to return"`
+	IncludeValues bool `json:"includeValues,omitempty" jsonschema:"report the current value of form fields, e.g. to resume a half-filled form"`
+	// ElementFilter is applied after reduction, so maxElements still bounds
+	// what the reducer keeps and the stored snapshot stays complete.
+	ElementFilter *ElementFilterInput `json:"elementFilter,omitempty" jsonschema:"return only elements matching these verbs or tags"`
+	Debug         bool                `json:"debug,omitempty" jsonschema:"report how the snapshot was produced: timings, HTML size and where the elements came from"`
+}
+
+type ElementFilterInput struct {
+	Verbs []string `json:"verbs,omitempty" jsonschema:"keep elements whose action verb is listed: open, click, type, select, toggle"`
+	Tags  []string `json:"tags,omitempty" jsonschema:"keep elements whose tag is listed, e.g. a or input"`
 }
 
 type SnapshotOutput struct {
-	SnapshotID string         `json:"snapshot_id" jsonschema:"identifier for the stored snapshot"`
-	URL        string         `json:"url" jsonschema:"page URL"`
-	Title      string         `json:"title,omitempty" jsonschema:"page title"`
-	Text       string         `json:"text" jsonschema:"reduced page text"`
-	Elements   []page.Element `json:"elements,omitempty" jsonschema:"actionable elements"`
-	Actions    []page.Action  `json:"actions,omitempty" jsonschema:"compact action map"`
-}
-
-func (s *Server) snapshot(ctx context.Context, _ *mcp.CallToolRequest, input SnapshotInput) (*mcp.CallToolResult, SnapshotOutput, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
-	snap, err := s.browser.Snapshot(ctx, browser.SnapshotOptions{
-		IncludeHidden: input.IncludeHidden,
-		MaxElements:   input.MaxElements,
-		MaxText:       input.MaxText,
-		IncludeHTML:   input.IncludeHTML,
-		MaxHTML:       input.MaxHTML,
-		MaxHTMLTokens: input.MaxHTMLTokens,
-	})
+	SnapshotID       string           `json:"snapshot_id" jsonschema:"identifier for the stored snapshot; empty when snapshot storage is disabled"`
+	URL              string           `json:"url" jsonschema:"page URL"`
+	Title            string           `json:"title,omitempty" jsonschema:"page title"`
+	Text             string           `json:"text" jsonschema:"reduced page text"`
+	MainText         string           `json:"mainText,omitempty" jsonschema:"main article text without navigation or ads, when enabled"`
+	Elements         []page.Element   `json:"elements,omitempty" jsonschema:"actionable elements"`
+	Actions          []page.Action    `json:"actions,omitempty" jsonschema:"compact action map"`
+	TextTruncated    bool             `json:"textTruncated,omitempty" jsonschema:"true when text was cut to maxText"`
+	PartialParse     bool             `json:"partialParse,omitempty" jsonschema:"true when the page HTML looked truncated or malformed and the view may be incomplete"`
+	ElementsTotal    int              `json:"elementsTotal" jsonschema:"actionable elements found on the page"`
+	ElementsReturned int              `json:"elementsReturned" jsonschema:"actionable elements included after maxElements"`
+	Pagination       *page.Pagination `json:"pagination,omitempty" jsonschema:"next and previous page controls, when the page has any"`
+	Warnings         []string         `json:"warnings,omitempty" jsonschema:"non-fatal problems with the request, such as clamped limits"`
+	Format           string           `json:"format,omitempty" jsonschema:"the format used, when not json"`
+	Markdown         string           `json:"markdown,omitempty" jsonschema:"title, text and actions as markdown, in the markdown format"`
+	Outline          string           `json:"outline,omitempty" jsonschema:"one line per element (ref, role, name), in the outline format"`
+	// Debug is only filled in when asked for; it is noise for most callers.
+	Debug *page.SnapshotDebug `json:"debug,omitempty" jsonschema:"timings and element source, when debug is set"`
+}
+
+func (s *Server) snapshot(ctx context.Context, req *mcp.CallToolRequest, input SnapshotInput) (*mcp.CallToolResult, SnapshotOutput, error) {
+	var warn warnings
+	warn.snapshotInput(&input.SnapshotOptionsInput)
+	format, err := page.ParseFormat(cmp.Or(input.Format, s.snapshotFormat))
+	if err != nil {
+		return nil, SnapshotOutput{}, err
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	snap, err := s.sharedSnapshot(ctx, input.browserOptions(s.reducer))
 	if err != nil {
 		return nil, SnapshotOutput{}, err
 	}
 	if snap.ID == "" {
 		snap.ID = s.store.Put(snap)
 	}
-	return nil, SnapshotOutput{
-		SnapshotID: snap.ID,
-		URL:        snap.URL,
-		Title:      snap.Title,
-		Text:       snap.Text,
-		Elements:   snap.Elements,
-		Actions:    snap.Actions,
-	}, nil
+	s.rememberSnapshot(req, snap.ID)
+	out := snapshotOutput(snap, input.SnapshotOptionsInput, warn)
+	applySnapshotFormat(&out, format)
+	return nil, out, nil
+}
+
+func (in SnapshotOptionsInput) browserOptions(reducer *page.Reducer) browser.SnapshotOptions {
+	return browser.SnapshotOptions{
+		IncludeHidden: in.IncludeHidden,
+		MaxElements:   in.MaxElements,
+		MaxText:       in.MaxText,
+		IncludeHTML:   in.IncludeHTML,
+		MaxHTML:       in.MaxHTML,
+		MaxHTMLTokens: in.MaxHTMLTokens,
+		IncludeValues: in.IncludeValues,
+		Reducer:       reducer,
+	}
+}
+
+// snapshotOutput applies the element filter, if any, to a stored snapshot for
+// returning.
+func snapshotOutput(snap page.Snapshot, in SnapshotOptionsInput, warn warnings) SnapshotOutput {
+	if filter := in.ElementFilter; filter != nil {
+		snap = page.ElementFilter{Verbs: filter.Verbs, Tags: filter.Tags}.Apply(snap)
+	}
+	out := SnapshotOutput{
+		SnapshotID:       snap.ID,
+		URL:              snap.URL,
+		Title:            snap.Title,
+		Text:             snap.Text,
+		MainText:         snap.MainText,
+		Elements:         snap.Elements,
+		Actions:          snap.Actions,
+		TextTruncated:    snap.TextTruncated,
+		PartialParse:     snap.PartialParse,
+		ElementsTotal:    snap.ElementsTotal,
+		ElementsReturned: snap.ElementsReturned,
+		Pagination:       snap.Pagination,
+		Warnings:         warn,
+	}
+	if in.Debug {
+		out.Debug = snap.Debug
+	}
+	return out
 }
 
 type ScrollInput struct {
@@ -299,8 +628,8 @@ type ScrollInput struct {
 	Block    string `json:"block,omitempty" jsonschema:"scroll alignment: start|center|end|nearest"`
 }
 
-func (s *Server) scroll(ctx context.Context, _ *mcp.CallToolRequest, input ScrollInput) (*mcp.CallToolResult, browser.ScrollResult, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
+func (s *Server) scroll(ctx context.Context, req *mcp.CallToolRequest, input ScrollInput) (*mcp.CallToolResult, browser.ScrollResult, error) {
+	ctx = s.withTarget(ctx, req, input.TargetInput)
 	out, err := s.browser.Scroll(ctx, browser.ScrollOptions{
 		DeltaX:   input.DeltaX,
 		DeltaY:   input.DeltaY,
@@ -316,12 +645,17 @@ func (s *Server) scroll(ctx context.Context, _ *mcp.CallToolRequest, input Scrol
 
 type HoverInput struct {
 	TargetInput
-	Selector string `json:"selector" jsonschema:"CSS selector of element to hover"`
+	RefInput
+	Selector string `json:"selector,omitempty" jsonschema:"CSS selector of element to hover"`
 }
 
-func (s *Server) hover(ctx context.Context, _ *mcp.CallToolRequest, input HoverInput) (*mcp.CallToolResult, browser.HoverResult, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
-	out, err := s.browser.Hover(ctx, input.Selector)
+func (s *Server) hover(ctx context.Context, req *mcp.CallToolRequest, input HoverInput) (*mcp.CallToolResult, browser.HoverResult, error) {
+	selector, err := s.elementSelector(req, input.Selector, input.RefInput)
+	if err != nil {
+		return nil, browser.HoverResult{}, err
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	out, err := s.browser.Hover(ctx, selector)
 	if err != nil {
 		return nil, browser.HoverResult{}, err
 	}
@@ -330,14 +664,26 @@ func (s *Server) hover(ctx context.Context, _ *mcp.CallToolRequest, input HoverI
 
 type TypeInput struct {
 	TargetInput
-	Selector   string `json:"selector" jsonschema:"CSS selector of input/textarea"`
-	Text       string `json:"text" jsonschema:"text to enter"`
-	PressEnter bool   `json:"pressEnter,omitempty" jsonschema:"press Enter after typing"`
+	IdempotencyInput
+	RefInput
+	Selector         string `json:"selector,omitempty" jsonschema:"CSS selector of input/textarea"`
+	Text             string `json:"text" jsonschema:"text to enter"`
+	PressEnter       bool   `json:"pressEnter,omitempty" jsonschema:"press Enter after typing"`
+	ReportValidation bool   `json:"reportValidation,omitempty" jsonschema:"return validation/error text associated with the field after typing"`
 }
 
-func (s *Server) typeText(ctx context.Context, _ *mcp.CallToolRequest, input TypeInput) (*mcp.CallToolResult, browser.TypeResult, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
-	out, err := s.browser.Type(ctx, input.Selector, input.Text, input.PressEnter)
+func (s *Server) typeText(ctx context.Context, req *mcp.CallToolRequest, input TypeInput) (*mcp.CallToolResult, browser.TypeResult, error) {
+	selector, err := s.elementSelector(req, input.Selector, input.RefInput)
+	if err != nil {
+		return nil, browser.TypeResult{}, err
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	out, err := s.browser.Type(ctx, browser.TypeOptions{
+		Selector:         selector,
+		Text:             input.Text,
+		PressEnter:       input.PressEnter,
+		ReportValidation: input.ReportValidation,
+	})
 	if err != nil {
 		return nil, browser.TypeResult{}, err
 	}
@@ -346,12 +692,13 @@ func (s *Server) typeText(ctx context.Context, _ *mcp.CallToolRequest, input Typ
 
 type EnterInput struct {
 	TargetInput
+	IdempotencyInput
 	Selector string `json:"selector,omitempty" jsonschema:"optional selector to send key to"`
 	Key      string `json:"key,omitempty" jsonschema:"key to send (default Enter)"`
 }
 
-func (s *Server) enter(ctx context.Context, _ *mcp.CallToolRequest, input EnterInput) (*mcp.CallToolResult, browser.EnterResult, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
+func (s *Server) enter(ctx context.Context, req *mcp.CallToolRequest, input EnterInput) (*mcp.CallToolResult, browser.EnterResult, error) {
+	ctx = s.withTarget(ctx, req, input.TargetInput)
 	out, err := s.browser.Enter(ctx, input.Selector, input.Key)
 	if err != nil {
 		return nil, browser.EnterResult{}, err
@@ -363,8 +710,13 @@ type EmptyInput struct {
 	TargetInput
 }
 
-func (s *Server) back(ctx context.Context, _ *mcp.CallToolRequest, input EmptyInput) (*mcp.CallToolResult, browser.HistoryResult, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
+type HistoryStepInput struct {
+	TargetInput
+	IdempotencyInput
+}
+
+func (s *Server) back(ctx context.Context, req *mcp.CallToolRequest, input HistoryStepInput) (*mcp.CallToolResult, browser.HistoryResult, error) {
+	ctx = s.withTarget(ctx, req, input.TargetInput)
 	out, err := s.browser.Back(ctx)
 	if err != nil {
 		return nil, browser.HistoryResult{}, err
@@ -372,8 +724,8 @@ func (s *Server) back(ctx context.Context, _ *mcp.CallToolRequest, input EmptyIn
 	return nil, out, nil
 }
 
-func (s *Server) forward(ctx context.Context, _ *mcp.CallToolRequest, input EmptyInput) (*mcp.CallToolResult, browser.HistoryResult, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
+func (s *Server) forward(ctx context.Context, req *mcp.CallToolRequest, input HistoryStepInput) (*mcp.CallToolResult, browser.HistoryResult, error) {
+	ctx = s.withTarget(ctx, req, input.TargetInput)
 	out, err := s.browser.Forward(ctx)
 	if err != nil {
 		return nil, browser.HistoryResult{}, err
@@ -383,43 +735,115 @@ func (s *Server) forward(ctx context.Context, _ *mcp.CallToolRequest, input Empt
 
 type WaitForSelectorInput struct {
 	TargetInput
-	Selector  string `json:"selector" jsonschema:"CSS selector to wait for"`
-	TimeoutMs int    `json:"timeoutMs,omitempty" jsonschema:"timeout in milliseconds"`
+	Selector     string `json:"selector" jsonschema:"CSS selector to wait for"`
+	TimeoutMs    int    `json:"timeoutMs,omitempty" jsonschema:"timeout in milliseconds"`
+	State        string `json:"state,omitempty" jsonschema:"attached (default), visible, hidden or detached"`
+	ContainsText string `json:"containsText,omitempty" jsonschema:"also wait until the element text contains this"`
 }
 
-func (s *Server) waitForSelector(ctx context.Context, _ *mcp.CallToolRequest, input WaitForSelectorInput) (*mcp.CallToolResult, browser.WaitForSelectorResult, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
-	out, err := s.browser.WaitForSelector(ctx, input.Selector, input.TimeoutMs)
+func (s *Server) waitForSelector(ctx context.Context, req *mcp.CallToolRequest, input WaitForSelectorInput) (*mcp.CallToolResult, browser.WaitForSelectorResult, error) {
+	if d, ok := s.toolTimeouts["browser.wait_for_selector"]; ok && input.TimeoutMs == 0 {
+		input.TimeoutMs = int(d / time.Millisecond)
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	out, err := s.browser.WaitForSelector(ctx, browser.WaitForSelectorOptions{
+		Selector:     input.Selector,
+		TimeoutMs:    input.TimeoutMs,
+		State:        input.State,
+		ContainsText: input.ContainsText,
+	})
 	if err != nil {
 		return nil, browser.WaitForSelectorResult{}, err
 	}
 	return nil, out, nil
 }
 
+type WaitForURLInput struct {
+	TargetInput
+	Pattern   string `json:"pattern" jsonschema:"URL pattern: a glob matching the whole URL (** any characters, * any but /, ? one character) or a regex"`
+	Match     string `json:"match,omitempty" jsonschema:"glob (default) or regex"`
+	TimeoutMs int    `json:"timeoutMs,omitempty" jsonschema:"timeout in milliseconds"`
+}
+
+func (s *Server) waitForURL(ctx context.Context, req *mcp.CallToolRequest, input WaitForURLInput) (*mcp.CallToolResult, browser.WaitForURLResult, error) {
+	// Reject a bad pattern before it reaches the extension.
+	if _, err := browser.URLPatternRegex(input.Pattern, input.Match); err != nil {
+		return nil, browser.WaitForURLResult{}, err
+	}
+	if d, ok := s.toolTimeouts["browser.wait_for_url"]; ok && input.TimeoutMs == 0 {
+		input.TimeoutMs = int(d / time.Millisecond)
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	out, err := s.browser.WaitForURL(ctx, browser.WaitForURLOptions{
+		Pattern:   input.Pattern,
+		Match:     input.Match,
+		TimeoutMs: input.TimeoutMs,
+	})
+	if err != nil {
+		return nil, browser.WaitForURLResult{}, err
+	}
+	return nil, out, nil
+}
+
 type FindInput struct {
 	TargetInput
 	Text          string `json:"text" jsonschema:"text to search for"`
 	Limit         int    `json:"limit,omitempty" jsonschema:"max results returned"`
 	Radius        int    `json:"radius,omitempty" jsonschema:"context radius for snippets"`
 	CaseSensitive bool   `json:"caseSensitive,omitempty" jsonschema:"case sensitive search"`
-}
-
-func (s *Server) find(ctx context.Context, _ *mcp.CallToolRequest, input FindInput) (*mcp.CallToolResult, browser.FindResult, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
-	out, err := s.browser.Find(ctx, input.Text, input.Limit, input.Radius, input.CaseSensitive)
+	// ScrollTo implies IncludePositions.
+	IncludePositions bool `json:"includePositions,omitempty" jsonschema:"return each match's element selector and document rect"`
+	ScrollTo         bool `json:"scrollTo,omitempty" jsonschema:"scroll the first match into view"`
+}
+
+type FindOutput struct {
+	browser.FindResult
+	// ScrolledTo is the match scrolled into view when scrollTo was set.
+	ScrolledTo *browser.FindResultItem `json:"scrolledTo,omitempty"`
+	Warnings   []string                `json:"warnings,omitempty" jsonschema:"non-fatal problems with the request, such as clamped limits"`
+}
+
+func (s *Server) find(ctx context.Context, req *mcp.CallToolRequest, input FindInput) (*mcp.CallToolResult, FindOutput, error) {
+	var warn warnings
+	warn.findInput(&input)
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	out, err := s.browser.Find(ctx, browser.FindOptions{
+		Text:             input.Text,
+		Limit:            input.Limit,
+		Radius:           input.Radius,
+		CaseSensitive:    input.CaseSensitive,
+		IncludePositions: input.IncludePositions || input.ScrollTo,
+	})
 	if err != nil {
-		return nil, browser.FindResult{}, err
+		return nil, FindOutput{}, err
 	}
-	return nil, out, nil
+	result := FindOutput{FindResult: out}
+	if input.ScrollTo && len(out.Results) > 0 {
+		first := out.Results[0]
+		if first.Selector == "" {
+			warn.addf("scrollTo: the browser reported no selector for the first match; not scrolled")
+		} else {
+			if _, err := s.browser.Scroll(ctx, browser.ScrollOptions{Selector: first.Selector, Block: "center"}); err != nil {
+				return nil, FindOutput{}, fmt.Errorf("scroll to first match: %w", err)
+			}
+			result.ScrolledTo = &first
+		}
+	}
+	result.Warnings = warn
+	return nil, result, nil
 }
 
 type NavigateInput struct {
 	TargetInput
+	IdempotencyInput
 	URL string `json:"url" jsonschema:"URL to navigate to"`
 }
 
-func (s *Server) navigate(ctx context.Context, _ *mcp.CallToolRequest, input NavigateInput) (*mcp.CallToolResult, browser.NavigateResult, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
+func (s *Server) navigate(ctx context.Context, req *mcp.CallToolRequest, input NavigateInput) (*mcp.CallToolResult, browser.NavigateResult, error) {
+	if err := s.hosts.check(input.URL); err != nil {
+		return nil, browser.NavigateResult{}, err
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
 	out, err := s.browser.Navigate(ctx, input.URL)
 	if err != nil {
 		return nil, browser.NavigateResult{}, err
@@ -427,38 +851,71 @@ func (s *Server) navigate(ctx context.Context, _ *mcp.CallToolRequest, input Nav
 	return nil, out, nil
 }
 
-type SelectInput struct {
+type ReloadInput struct {
 	TargetInput
-	Selector  string   `json:"selector" jsonschema:"CSS selector for select element"`
-	Value     string   `json:"value,omitempty" jsonschema:"option value to select"`
-	Label     string   `json:"label,omitempty" jsonschema:"option label to select"`
-	Index     int      `json:"index,omitempty" jsonschema:"option index to select"`
-	Values    []string `json:"values,omitempty" jsonschema:"values to select (multi-select)"`
-	Labels    []string `json:"labels,omitempty" jsonschema:"labels to select (multi-select)"`
-	Indices   []int    `json:"indices,omitempty" jsonschema:"indices to select (multi-select)"`
-	MatchMode string   `json:"matchMode,omitempty" jsonschema:"label match mode: exact or partial"`
-	Toggle    bool     `json:"toggle,omitempty" jsonschema:"toggle selection (multi-select)"`
-}
-
-func (s *Server) selectOption(ctx context.Context, _ *mcp.CallToolRequest, input SelectInput) (*mcp.CallToolResult, browser.SelectResult, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
-	out, err := s.browser.Select(ctx, browser.SelectOptions{
-		Selector:  input.Selector,
-		Value:     input.Value,
-		Label:     input.Label,
-		Index:     input.Index,
-		Values:    input.Values,
-		Labels:    input.Labels,
-		Indices:   input.Indices,
-		MatchMode: input.MatchMode,
-		Toggle:    input.Toggle,
-	})
+	IdempotencyInput
+	BypassCache bool `json:"bypassCache,omitempty" jsonschema:"reload without the HTTP cache, like a hard refresh"`
+}
+
+func (s *Server) reload(ctx context.Context, req *mcp.CallToolRequest, input ReloadInput) (*mcp.CallToolResult, browser.NavigateResult, error) {
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	out, err := s.browser.Reload(ctx, browser.ReloadOptions{BypassCache: input.BypassCache})
 	if err != nil {
-		return nil, browser.SelectResult{}, err
+		return nil, browser.NavigateResult{}, err
 	}
 	return nil, out, nil
 }
 
+type SelectInput struct {
+	TargetInput
+	IdempotencyInput
+	RefInput
+	Selector   string   `json:"selector,omitempty" jsonschema:"CSS selector for select element"`
+	Value      string   `json:"value,omitempty" jsonschema:"option value to select"`
+	Label      string   `json:"label,omitempty" jsonschema:"option label to select"`
+	Index      int      `json:"index,omitempty" jsonschema:"option index to select"`
+	Values     []string `json:"values,omitempty" jsonschema:"values to select (multi-select)"`
+	Labels     []string `json:"labels,omitempty" jsonschema:"labels to select (multi-select)"`
+	Indices    []int    `json:"indices,omitempty" jsonschema:"indices to select (multi-select)"`
+	MatchMode  string   `json:"matchMode,omitempty" jsonschema:"label match mode: exact or partial"`
+	LabelRegex string   `json:"labelRegex,omitempty" jsonschema:"regular expression; selects the first option whose label matches"`
+	Toggle     bool     `json:"toggle,omitempty" jsonschema:"toggle selection (multi-select)"`
+	BlurAfter  bool     `json:"blurAfter,omitempty" jsonschema:"blur the element after selecting, for apps that commit the value on blur"`
+}
+
+type SelectOutput struct {
+	browser.SelectResult
+	Warnings []string `json:"warnings,omitempty" jsonschema:"non-fatal problems with the request, such as an ignored match mode"`
+}
+
+func (s *Server) selectOption(ctx context.Context, req *mcp.CallToolRequest, input SelectInput) (*mcp.CallToolResult, SelectOutput, error) {
+	selector, err := s.elementSelector(req, input.Selector, input.RefInput)
+	if err != nil {
+		return nil, SelectOutput{}, err
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	opts := browser.SelectOptions{
+		Selector:   selector,
+		Value:      input.Value,
+		Label:      input.Label,
+		Index:      input.Index,
+		Values:     input.Values,
+		Labels:     input.Labels,
+		Indices:    input.Indices,
+		MatchMode:  input.MatchMode,
+		LabelRegex: input.LabelRegex,
+		Toggle:     input.Toggle,
+		BlurAfter:  input.BlurAfter,
+	}
+	var warn warnings
+	warn.selectOptions(&opts)
+	out, err := s.browser.Select(ctx, opts)
+	if err != nil {
+		return nil, SelectOutput{}, err
+	}
+	return nil, SelectOutput{SelectResult: out, Warnings: warn}, nil
+}
+
 type ScreenshotInput struct {
 	TargetInput
 	Selector  string  `json:"selector,omitempty" jsonschema:"element selector (omit for viewport)"`
@@ -467,10 +924,24 @@ type ScreenshotInput struct {
 	Quality   float64 `json:"quality,omitempty" jsonschema:"jpeg quality 0-1"`
 	MaxWidth  int     `json:"maxWidth,omitempty" jsonschema:"max output width"`
 	MaxHeight int     `json:"maxHeight,omitempty" jsonschema:"max output height"`
+	Annotate  bool    `json:"annotate,omitempty" jsonschema:"outline the selector's element in the capture and return its box; needs selector"`
+	Inline    bool    `json:"inline,omitempty" jsonschema:"also return the image as a data URL in dataUrl; by default read it from browser://screenshot/{screenshotId}"`
+}
+
+type ScreenshotOutput struct {
+	browser.ScreenshotResult
+	// ScreenshotID names the stored capture; it is empty when storage is
+	// disabled or the browser's data URL could not be decoded, and dataUrl
+	// is returned instead.
+	ScreenshotID string   `json:"screenshotId,omitempty"`
+	Warnings     []string `json:"warnings,omitempty" jsonschema:"non-fatal problems with the request, such as an annotation the extension ignored"`
 }
 
-func (s *Server) screenshot(ctx context.Context, _ *mcp.CallToolRequest, input ScreenshotInput) (*mcp.CallToolResult, browser.ScreenshotResult, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
+func (s *Server) screenshot(ctx context.Context, req *mcp.CallToolRequest, input ScreenshotInput) (*mcp.CallToolResult, ScreenshotOutput, error) {
+	if input.Annotate && input.Selector == "" {
+		return nil, ScreenshotOutput{}, errors.New("annotate needs a selector")
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
 	out, err := s.browser.Screenshot(ctx, browser.ScreenshotOptions{
 		Selector:  input.Selector,
 		Padding:   input.Padding,
@@ -478,11 +949,27 @@ func (s *Server) screenshot(ctx context.Context, _ *mcp.CallToolRequest, input S
 		Quality:   input.Quality,
 		MaxWidth:  input.MaxWidth,
 		MaxHeight: input.MaxHeight,
+		Annotate:  input.Annotate,
 	})
 	if err != nil {
-		return nil, browser.ScreenshotResult{}, err
+		return nil, ScreenshotOutput{}, err
 	}
-	return nil, out, nil
+	var warn warnings
+	if input.Annotate && out.Box == nil {
+		warn.addf("annotate: the extension reported no element box, so the capture may not be outlined")
+	}
+	if s.screenshots == nil {
+		// Nothing is kept, so the image can only be returned inline.
+		return nil, ScreenshotOutput{ScreenshotResult: out, Warnings: warn}, nil
+	}
+	id := s.storeScreenshot(out)
+	if id == "" && !input.Inline {
+		warn.addf("the screenshot could not be stored, so it is returned inline as dataUrl")
+	} else if !input.Inline {
+		// The image is read from the resource; keep the tool result small.
+		out.DataURL = ""
+	}
+	return nil, ScreenshotOutput{ScreenshotResult: out, ScreenshotID: id, Warnings: warn}, nil
 }
 
 func (s *Server) readSnapshot(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
@@ -501,23 +988,19 @@ func (s *Server) readSnapshot(ctx context.Context, req *mcp.ReadResourceRequest)
 		return nil, mcp.ResourceNotFoundError(req.Params.URI)
 	}
 
-	snap, ok := s.store.Get(id)
+	var snap page.Snapshot
+	var ok bool
+	if id == "latest" {
+		// browser://page/latest with a query lands here rather than on
+		// the plain resource.
+		snap, ok = s.store.Latest()
+	} else {
+		snap, ok = s.store.Get(id)
+	}
 	if !ok {
 		return nil, mcp.ResourceNotFoundError(req.Params.URI)
 	}
-	data, err := json.MarshalIndent(snap, "", "  ")
-	if err != nil {
-		return nil, err
-	}
-	return &mcp.ReadResourceResult{
-		Contents: []*mcp.ResourceContents{
-			{
-				URI:      req.Params.URI,
-				MIMEType: "application/json",
-				Text:     string(data),
-			},
-		},
-	}, nil
+	return s.snapshotResource(req.Params.URI, snap, u.Query())
 }
 
 func (s *Server) readLatest(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
@@ -528,19 +1011,7 @@ func (s *Server) readLatest(ctx context.Context, req *mcp.ReadResourceRequest) (
 	if !ok {
 		return nil, mcp.ResourceNotFoundError(req.Params.URI)
 	}
-	data, err := json.MarshalIndent(snap, "", "  ")
-	if err != nil {
-		return nil, err
-	}
-	return &mcp.ReadResourceResult{
-		Contents: []*mcp.ResourceContents{
-			{
-				URI:      req.Params.URI,
-				MIMEType: "application/json",
-				Text:     string(data),
-			},
-		},
-	}, nil
+	return s.snapshotResource(req.Params.URI, snap, nil)
 }
 
 type RecordingStateOutput struct {
@@ -548,8 +1019,8 @@ type RecordingStateOutput struct {
 	Count     int  `json:"count"`
 }
 
-func (s *Server) startRecording(ctx context.Context, _ *mcp.CallToolRequest, input EmptyInput) (*mcp.CallToolResult, RecordingStateOutput, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
+func (s *Server) startRecording(ctx context.Context, req *mcp.CallToolRequest, input EmptyInput) (*mcp.CallToolResult, RecordingStateOutput, error) {
+	ctx = s.withTarget(ctx, req, input.TargetInput)
 	out, err := s.browser.StartRecording(ctx)
 	if err != nil {
 		return nil, RecordingStateOutput{}, err
@@ -557,8 +1028,8 @@ func (s *Server) startRecording(ctx context.Context, _ *mcp.CallToolRequest, inp
 	return nil, RecordingStateOutput{Recording: out.Recording, Count: out.Count}, nil
 }
 
-func (s *Server) stopRecording(ctx context.Context, _ *mcp.CallToolRequest, input EmptyInput) (*mcp.CallToolResult, RecordingStateOutput, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
+func (s *Server) stopRecording(ctx context.Context, req *mcp.CallToolRequest, input EmptyInput) (*mcp.CallToolResult, RecordingStateOutput, error) {
+	ctx = s.withTarget(ctx, req, input.TargetInput)
 	out, err := s.browser.StopRecording(ctx)
 	if err != nil {
 		return nil, RecordingStateOutput{}, err
@@ -566,19 +1037,6 @@ func (s *Server) stopRecording(ctx context.Context, _ *mcp.CallToolRequest, inpu
 	return nil, RecordingStateOutput{Recording: out.Recording, Count: out.Count}, nil
 }
 
-type RecordingOutput struct {
-	Actions []browser.RecordedAction `json:"actions"`
-}
-
-func (s *Server) getRecording(ctx context.Context, _ *mcp.CallToolRequest, input EmptyInput) (*mcp.CallToolResult, RecordingOutput, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
-	out, err := s.browser.GetRecording(ctx)
-	if err != nil {
-		return nil, RecordingOutput{}, err
-	}
-	return nil, RecordingOutput{Actions: out}, nil
-}
-
 type ListTabsInput struct {
 	TargetInput
 }
@@ -587,8 +1045,8 @@ type ListTabsOutput struct {
 	Tabs []browser.TabInfo `json:"tabs"`
 }
 
-func (s *Server) listTabs(ctx context.Context, _ *mcp.CallToolRequest, input ListTabsInput) (*mcp.CallToolResult, ListTabsOutput, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
+func (s *Server) listTabs(ctx context.Context, req *mcp.CallToolRequest, input ListTabsInput) (*mcp.CallToolResult, ListTabsOutput, error) {
+	ctx = s.withTarget(ctx, req, input.TargetInput)
 	tabs, err := s.browser.ListTabs(ctx)
 	if err != nil {
 		return nil, ListTabsOutput{}, err
@@ -607,11 +1065,11 @@ type FindTabOutput struct {
 	Tabs []browser.TabInfo `json:"tabs"`
 }
 
-func (s *Server) findTab(ctx context.Context, _ *mcp.CallToolRequest, input FindTabInput) (*mcp.CallToolResult, FindTabOutput, error) {
+func (s *Server) findTab(ctx context.Context, req *mcp.CallToolRequest, input FindTabInput) (*mcp.CallToolResult, FindTabOutput, error) {
 	if strings.TrimSpace(input.Query) == "" {
 		return nil, FindTabOutput{}, errors.New("query is required")
 	}
-	ctx = s.withTarget(ctx, input.TargetInput)
+	ctx = s.withTarget(ctx, req, input.TargetInput)
 	tabs, err := s.browser.ListTabs(ctx)
 	if err != nil {
 		return nil, FindTabOutput{}, err
@@ -646,6 +1104,7 @@ func (s *Server) findTab(ctx context.Context, _ *mcp.CallToolRequest, input Find
 
 type OpenTabInput struct {
 	TargetInput
+	IdempotencyInput
 	URL    string `json:"url,omitempty" jsonschema:"URL to open in a new tab"`
 	Active bool   `json:"active,omitempty" jsonschema:"open tab as active"`
 	Pinned bool   `json:"pinned,omitempty" jsonschema:"open tab as pinned"`
@@ -657,8 +1116,26 @@ type OpenTabOutput struct {
 
 type EmptyOutput struct{}
 
-func (s *Server) openTab(ctx context.Context, _ *mcp.CallToolRequest, input OpenTabInput) (*mcp.CallToolResult, OpenTabOutput, error) {
-	ctx = s.withTarget(ctx, input.TargetInput)
+func (s *Server) openTab(ctx context.Context, req *mcp.CallToolRequest, input OpenTabInput) (*mcp.CallToolResult, OpenTabOutput, error) {
+	if err := s.hosts.check(input.URL); err != nil {
+		return nil, OpenTabOutput{}, err
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	if s.maxTabs > 0 {
+		target, _ := browser.TargetFromContext(ctx)
+		session := target.SessionID
+		if session == "" && s.activeSession != nil {
+			session, _ = s.activeSession()
+		}
+		defer s.lockOpenTab(session)()
+		tabs, err := s.browser.ListTabs(ctx)
+		if err != nil {
+			return nil, OpenTabOutput{}, err
+		}
+		if len(tabs) >= s.maxTabs {
+			return nil, OpenTabOutput{}, &browser.TabLimitError{Limit: s.maxTabs, Open: len(tabs)}
+		}
+	}
 	tab, err := s.browser.OpenTab(ctx, browser.OpenTabOptions{
 		URL:    input.URL,
 		Active: input.Active,
@@ -670,16 +1147,46 @@ func (s *Server) openTab(ctx context.Context, _ *mcp.CallToolRequest, input Open
 	return nil, OpenTabOutput{Tab: tab}, nil
 }
 
+// openTabLock is one session's open_tab lock; refs counts the calls holding
+// or waiting on it so lockOpenTab can drop it once none are left.
+type openTabLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lockOpenTab locks open_tab for session and returns the unlock function.
+func (s *Server) lockOpenTab(session string) func() {
+	s.openTabMu.Lock()
+	l := s.openTabLocks[session]
+	if l == nil {
+		l = &openTabLock{}
+		s.openTabLocks[session] = l
+	}
+	l.refs++
+	s.openTabMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		s.openTabMu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(s.openTabLocks, session)
+		}
+		s.openTabMu.Unlock()
+	}
+}
+
 type CloseTabInput struct {
 	TargetInput
+	IdempotencyInput
 	TabID int `json:"tabId" jsonschema:"tab id to close"`
 }
 
-func (s *Server) closeTab(ctx context.Context, _ *mcp.CallToolRequest, input CloseTabInput) (*mcp.CallToolResult, EmptyOutput, error) {
+func (s *Server) closeTab(ctx context.Context, req *mcp.CallToolRequest, input CloseTabInput) (*mcp.CallToolResult, EmptyOutput, error) {
 	if input.TabID == 0 {
 		return nil, EmptyOutput{}, errors.New("tabId is required")
 	}
-	ctx = s.withTarget(ctx, input.TargetInput)
+	ctx = s.withTarget(ctx, req, input.TargetInput)
 	if err := s.browser.CloseTab(ctx, input.TabID); err != nil {
 		return nil, EmptyOutput{}, err
 	}
@@ -697,11 +1204,11 @@ type ClaimTabOutput struct {
 	Tab browser.TabInfo `json:"tab"`
 }
 
-func (s *Server) claimTab(ctx context.Context, _ *mcp.CallToolRequest, input ClaimTabInput) (*mcp.CallToolResult, ClaimTabOutput, error) {
+func (s *Server) claimTab(ctx context.Context, req *mcp.CallToolRequest, input ClaimTabInput) (*mcp.CallToolResult, ClaimTabOutput, error) {
 	if input.TabID == 0 && !input.RequireActive {
 		return nil, ClaimTabOutput{}, errors.New("tabId is required")
 	}
-	ctx = s.withTarget(ctx, input.TargetInput)
+	ctx = s.withTarget(ctx, req, input.TargetInput)
 	tab, err := s.browser.ClaimTab(ctx, browser.ClaimTabOptions{
 		TabID:         input.TabID,
 		Mode:          input.Mode,
@@ -718,11 +1225,11 @@ type ReleaseTabInput struct {
 	TabID int `json:"tabId" jsonschema:"tab id to release"`
 }
 
-func (s *Server) releaseTab(ctx context.Context, _ *mcp.CallToolRequest, input ReleaseTabInput) (*mcp.CallToolResult, EmptyOutput, error) {
+func (s *Server) releaseTab(ctx context.Context, req *mcp.CallToolRequest, input ReleaseTabInput) (*mcp.CallToolResult, EmptyOutput, error) {
 	if input.TabID == 0 {
 		return nil, EmptyOutput{}, errors.New("tabId is required")
 	}
-	ctx = s.withTarget(ctx, input.TargetInput)
+	ctx = s.withTarget(ctx, req, input.TargetInput)
 	if err := s.browser.ReleaseTab(ctx, input.TabID); err != nil {
 		return nil, EmptyOutput{}, err
 	}
@@ -735,11 +1242,11 @@ type SetTabSharingInput struct {
 	AllowShared bool `json:"allowShared" jsonschema:"allow shared claims"`
 }
 
-func (s *Server) setTabSharing(ctx context.Context, _ *mcp.CallToolRequest, input SetTabSharingInput) (*mcp.CallToolResult, EmptyOutput, error) {
+func (s *Server) setTabSharing(ctx context.Context, req *mcp.CallToolRequest, input SetTabSharingInput) (*mcp.CallToolResult, EmptyOutput, error) {
 	if input.TabID == 0 {
 		return nil, EmptyOutput{}, errors.New("tabId is required")
 	}
-	ctx = s.withTarget(ctx, input.TargetInput)
+	ctx = s.withTarget(ctx, req, input.TargetInput)
 	if err := s.browser.SetTabSharing(ctx, input.TabID, input.AllowShared); err != nil {
 		return nil, EmptyOutput{}, err
 	}
@@ -747,6 +1254,7 @@ func (s *Server) setTabSharing(ctx context.Context, _ *mcp.CallToolRequest, inpu
 }
 
 type WorkflowSaveInput struct {
+	Namespace   string                   `json:"namespace,omitempty" jsonschema:"workflow namespace; empty means the default namespace"`
 	Name        string                   `json:"name" jsonschema:"workflow name"`
 	Description string                   `json:"description,omitempty" jsonschema:"workflow description"`
 	Steps       []browser.RecordedAction `json:"steps,omitempty" jsonschema:"recorded steps"`
@@ -754,12 +1262,17 @@ type WorkflowSaveInput struct {
 
 type WorkflowSaveOutput struct {
 	ID          string `json:"id"`
+	Namespace   string `json:"namespace"`
 	Name        string `json:"name"`
 	Description string `json:"description,omitempty"`
 	StepCount   int    `json:"stepCount"`
 }
 
 func (s *Server) saveWorkflow(ctx context.Context, _ *mcp.CallToolRequest, input WorkflowSaveInput) (*mcp.CallToolResult, WorkflowSaveOutput, error) {
+	store, err := s.workflows.Store(input.Namespace)
+	if err != nil {
+		return nil, WorkflowSaveOutput{}, err
+	}
 	steps := input.Steps
 	if len(steps) == 0 {
 		recording, err := s.browser.GetRecording(ctx)
@@ -774,16 +1287,17 @@ func (s *Server) saveWorkflow(ctx context.Context, _ *mcp.CallToolRequest, input
 	if input.Name == "" {
 		input.Name = "workflow"
 	}
-	w := s.workflows.Add(workflow.Workflow{
+	w := store.Add(workflow.Workflow{
 		Name:        input.Name,
 		Description: input.Description,
 		Steps:       steps,
 	})
 	if s.workflowLimit > 0 {
-		_, _ = s.workflows.Compact(s.workflowLimit)
+		_, _ = store.Compact(s.workflowLimit)
 	}
 	return nil, WorkflowSaveOutput{
 		ID:          w.ID,
+		Namespace:   namespaceName(input.Namespace),
 		Name:        w.Name,
 		Description: w.Description,
 		StepCount:   len(w.Steps),
@@ -791,7 +1305,8 @@ func (s *Server) saveWorkflow(ctx context.Context, _ *mcp.CallToolRequest, input
 }
 
 type WorkflowCompactInput struct {
-	Limit int `json:"limit,omitempty" jsonschema:"max workflows to keep"`
+	Namespace string `json:"namespace,omitempty" jsonschema:"workflow namespace to compact; empty means the default namespace"`
+	Limit     int    `json:"limit,omitempty" jsonschema:"max workflows to keep"`
 }
 
 type WorkflowCompactOutput struct {
@@ -799,7 +1314,11 @@ type WorkflowCompactOutput struct {
 }
 
 func (s *Server) compactWorkflows(ctx context.Context, _ *mcp.CallToolRequest, input WorkflowCompactInput) (*mcp.CallToolResult, WorkflowCompactOutput, error) {
-	removed, err := s.workflows.Compact(input.Limit)
+	store, err := s.workflows.Store(input.Namespace)
+	if err != nil {
+		return nil, WorkflowCompactOutput{}, err
+	}
+	removed, err := store.Compact(input.Limit)
 	if err != nil {
 		return nil, WorkflowCompactOutput{}, err
 	}
@@ -807,16 +1326,23 @@ func (s *Server) compactWorkflows(ctx context.Context, _ *mcp.CallToolRequest, i
 }
 
 func (s *Server) readWorkflowList(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
-	_ = req
-	list := s.workflows.List()
-	data, err := json.MarshalIndent(list, "", "  ")
+	return s.listWorkflows("", "workflow://list")
+}
+
+// listWorkflows renders the workflows of one namespace under uri.
+func (s *Server) listWorkflows(namespace, uri string) (*mcp.ReadResourceResult, error) {
+	store, err := s.workflows.Store(namespace)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(store.List(), "", "  ")
 	if err != nil {
 		return nil, err
 	}
 	return &mcp.ReadResourceResult{
 		Contents: []*mcp.ResourceContents{
 			{
-				URI:      "workflow://list",
+				URI:      uri,
 				MIMEType: "application/json",
 				Text:     string(data),
 			},
@@ -835,14 +1361,22 @@ func (s *Server) readWorkflow(ctx context.Context, req *mcp.ReadResourceRequest)
 	if u.Scheme != "workflow" {
 		return nil, fmt.Errorf("unsupported workflow URI: %s", req.Params.URI)
 	}
-	id := strings.TrimPrefix(u.Path, "/")
+	// workflow://{id} reads the default namespace; workflow://{namespace}/{id}
+	// reads a named one.
+	namespace, id := "", strings.TrimPrefix(u.Path, "/")
 	if id == "" {
 		id = u.Host
+	} else {
+		namespace = u.Host
 	}
 	if id == "" || id == "list" {
-		return s.readWorkflowList(ctx, req)
+		return s.listWorkflows(namespace, req.Params.URI)
+	}
+	store, err := s.workflows.Store(namespace)
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(req.Params.URI)
 	}
-	w, ok := s.workflows.Get(id)
+	w, ok := store.Get(id)
 	if !ok {
 		return nil, mcp.ResourceNotFoundError(req.Params.URI)
 	}
@@ -860,3 +1394,10 @@ func (s *Server) readWorkflow(ctx context.Context, req *mcp.ReadResourceRequest)
 		},
 	}, nil
 }
+
+func namespaceName(name string) string {
+	if strings.TrimSpace(name) == "" {
+		return workflow.DefaultNamespace
+	}
+	return strings.TrimSpace(name)
+}
@@ -0,0 +1,2085 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+	"github.com/adityalohuni/mcp-server/internal/page"
+	"github.com/adityalohuni/mcp-server/internal/screenshot"
+	"github.com/adityalohuni/mcp-server/internal/traceid"
+)
+
+// connect starts s on an in-memory transport and returns a connected client session.
+func connect(t *testing.T, s *Server) *mcp.ClientSession {
+	t.Helper()
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := s.MCPServer().Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatalf("server connect: %v", err)
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v0.0.1"}, nil)
+	cs, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("client connect: %v", err)
+	}
+	t.Cleanup(func() { _ = cs.Close() })
+	return cs
+}
+
+// fakeBrowser implements browser.Browser for tests; methods not overridden
+// panic through the nil embedded interface.
+type fakeBrowser struct {
+	browser.Browser
+	targets   []browser.Target
+	clickErr  error
+	waits     []browser.WaitForSelectorOptions
+	timeouts  []time.Duration
+	recording []browser.RecordedAction
+	traces    []string
+	clears    []browser.ClearStorageOptions
+	tabs      []browser.TabInfo
+	matches   []string
+	scrolls   []browser.ScrollOptions
+	selects   []browser.SelectOptions
+	checked   bool
+	history   *browser.HistoryList
+	storage   []browser.GetStorageOptions
+	urlWaits  []browser.WaitForURLOptions
+	reloads   []browser.ReloadOptions
+	// selectors records the selector each element action was sent.
+	selectors []string
+
+	// snapshotCalls counts Snapshot calls; when snapshotGate is set, each
+	// call blocks until it is closed and then fails with snapshotErr, if set.
+	snapshotCalls atomic.Int32
+	snapshotGate  chan struct{}
+	snapshotErr   error
+	// snapshotCtx is the context of the last Snapshot call.
+	snapshotCtx atomic.Pointer[context.Context]
+}
+
+// ClearStorage records its options and reports them all as cleared.
+func (f *fakeBrowser) ClearStorage(_ context.Context, opts browser.ClearStorageOptions) (browser.ClearStorageResult, error) {
+	f.clears = append(f.clears, opts)
+	out := browser.ClearStorageResult{Origin: "https://example.com", Cleared: []string{}}
+	if opts.Cookies {
+		out.Cleared = append(out.Cleared, "cookies")
+	}
+	if opts.LocalStorage {
+		out.Cleared = append(out.Cleared, "localStorage")
+	}
+	return out, nil
+}
+
+// Evaluate returns a canned result per script; "throw" fails as a page
+// exception would.
+func (f *fakeBrowser) Evaluate(_ context.Context, script string) (browser.EvaluateResult, error) {
+	switch script {
+	case "throw":
+		return browser.EvaluateResult{Type: browser.EvaluateUndefined, Error: "Error: nope"}, errors.New("script threw: Error: nope")
+	case "big":
+		return browser.EvaluateResult{Type: browser.EvaluateString, Value: json.RawMessage(`"` + strings.Repeat("é", 100) + `"`)}, nil
+	}
+	return browser.EvaluateResult{Type: browser.EvaluateObject, Value: json.RawMessage(`{"n":1}`)}, nil
+}
+
+// FillForm fails fields whose selector is #missing and fills the rest.
+func (f *fakeBrowser) FillForm(_ context.Context, fields []browser.FillFormField) (browser.FillFormResult, error) {
+	var out browser.FillFormResult
+	for _, field := range fields {
+		f.selectors = append(f.selectors, field.Selector)
+		if field.Selector == "#missing" {
+			out.Fields = append(out.Fields, browser.FillFieldResult{Selector: field.Selector, Error: "no element", ErrorCode: "not_found"})
+			continue
+		}
+		out.Fields = append(out.Fields, browser.FillFieldResult{Selector: field.Selector, OK: true})
+	}
+	out.Count()
+	return out, nil
+}
+
+// SetChecked treats #a as a checkbox that starts unchecked; anything else is
+// not checkable.
+func (f *fakeBrowser) SetChecked(_ context.Context, selector string, checked bool) (browser.CheckedResult, error) {
+	if selector != "#a" {
+		return browser.CheckedResult{}, fmt.Errorf("%s is not a checkbox (not_checkable)", selector)
+	}
+	changed := f.checked != checked
+	f.checked = checked
+	return browser.CheckedResult{Selector: selector, Checked: checked, Changed: changed}, nil
+}
+
+// GetText and GetAttribute know only #a, the first link of the fake page.
+func (f *fakeBrowser) GetText(_ context.Context, selector string) (browser.TextResult, error) {
+	if selector != "#a" {
+		return browser.TextResult{}, &browser.NotFoundError{Selector: selector}
+	}
+	return browser.TextResult{Selector: selector, InnerText: "A", TextContent: "A hidden"}, nil
+}
+
+func (f *fakeBrowser) GetAttribute(_ context.Context, selector, attribute string) (browser.AttributeResult, error) {
+	if selector != "#a" {
+		return browser.AttributeResult{}, &browser.NotFoundError{Selector: selector}
+	}
+	return browser.AttributeResult{Selector: selector, Attribute: attribute, Value: "/a", Present: attribute == "href"}, nil
+}
+
+func (f *fakeBrowser) ListTabs(context.Context) ([]browser.TabInfo, error) {
+	return f.tabs, nil
+}
+
+// OpenTab appends a tab so later ListTabs calls count it.
+func (f *fakeBrowser) OpenTab(_ context.Context, opts browser.OpenTabOptions) (browser.TabInfo, error) {
+	tab := browser.TabInfo{ID: len(f.tabs) + 1, URL: opts.URL}
+	f.tabs = append(f.tabs, tab)
+	return tab, nil
+}
+
+func (f *fakeBrowser) GetRecording(context.Context) ([]browser.RecordedAction, error) {
+	return f.recording, nil
+}
+
+func (f *fakeBrowser) Click(ctx context.Context, selector string) (browser.ClickResult, error) {
+	target, _ := browser.TargetFromContext(ctx)
+	f.targets = append(f.targets, target)
+	traceID, _ := traceid.FromContext(ctx)
+	f.traces = append(f.traces, traceID)
+	f.selectors = append(f.selectors, selector)
+	if f.clickErr != nil {
+		return browser.ClickResult{}, f.clickErr
+	}
+	return browser.ClickResult{Status: "ok", Selector: selector}, nil
+}
+
+func (f *fakeBrowser) Hover(_ context.Context, selector string) (browser.HoverResult, error) {
+	f.selectors = append(f.selectors, selector)
+	return browser.HoverResult{Selector: selector}, nil
+}
+
+func (f *fakeBrowser) Type(_ context.Context, opts browser.TypeOptions) (browser.TypeResult, error) {
+	f.selectors = append(f.selectors, opts.Selector)
+	return browser.TypeResult{Selector: opts.Selector, TextLength: len(opts.Text)}, nil
+}
+
+func (f *fakeBrowser) Select(_ context.Context, opts browser.SelectOptions) (browser.SelectResult, error) {
+	f.selectors = append(f.selectors, opts.Selector)
+	f.selects = append(f.selects, opts)
+	return browser.SelectResult{Selector: opts.Selector, Value: opts.Value}, nil
+}
+
+// WaitForSelector records its options and the timeout override on ctx.
+func (f *fakeBrowser) WaitForSelector(ctx context.Context, opts browser.WaitForSelectorOptions) (browser.WaitForSelectorResult, error) {
+	f.waits = append(f.waits, opts)
+	d, _ := browser.TimeoutFromContext(ctx)
+	f.timeouts = append(f.timeouts, d)
+	return browser.WaitForSelectorResult{Selector: opts.Selector, Found: true}, nil
+}
+
+// WaitForURL records its options and reports a match on a fixed URL.
+func (f *fakeBrowser) WaitForURL(_ context.Context, opts browser.WaitForURLOptions) (browser.WaitForURLResult, error) {
+	f.urlWaits = append(f.urlWaits, opts)
+	return browser.WaitForURLResult{Pattern: opts.Pattern, Match: opts.Match, TimeoutMs: opts.TimeoutMs, Matched: true, URL: "https://example.com/done/success"}, nil
+}
+
+// Find echoes the limits it was called with. Each entry in matches becomes a
+// result, with its selector and a rect only when positions were asked for.
+func (f *fakeBrowser) Find(_ context.Context, opts browser.FindOptions) (browser.FindResult, error) {
+	out := browser.FindResult{Query: opts.Text, Limit: opts.Limit, Radius: opts.Radius, CaseSensitive: opts.CaseSensitive, Results: []browser.FindResultItem{}}
+	for i, selector := range f.matches {
+		item := browser.FindResultItem{Index: i, Snippet: opts.Text}
+		if opts.IncludePositions {
+			item.Selector = selector
+			item.Rect = &browser.Rect{Y: float64(1000 * (i + 1)), Width: 100, Height: 20}
+		}
+		out.Results = append(out.Results, item)
+	}
+	out.Total, out.Returned = len(out.Results), len(out.Results)
+	return out, nil
+}
+
+// Screenshot returns a tiny PNG-typed data URL, with a box when annotated.
+func (f *fakeBrowser) Screenshot(_ context.Context, opts browser.ScreenshotOptions) (browser.ScreenshotResult, error) {
+	out := browser.ScreenshotResult{
+		Selector: opts.Selector,
+		DataURL:  "data:image/png;base64," + base64.StdEncoding.EncodeToString([]byte("png-bytes")),
+		Width:    4,
+		Height:   2,
+		Format:   "png",
+	}
+	if opts.Annotate {
+		out.Box = &browser.Rect{X: 10, Y: 20, Width: 30, Height: 40}
+	}
+	return out, nil
+}
+
+func (f *fakeBrowser) Scroll(_ context.Context, opts browser.ScrollOptions) (browser.ScrollResult, error) {
+	f.scrolls = append(f.scrolls, opts)
+	return browser.ScrollResult{Selector: opts.Selector, Block: opts.Block}, nil
+}
+
+// Snapshot reduces a fixed page with the reducer the server passed down, or
+// the default one.
+func (f *fakeBrowser) Snapshot(ctx context.Context, opts browser.SnapshotOptions) (page.Snapshot, error) {
+	f.snapshotCalls.Add(1)
+	f.snapshotCtx.Store(&ctx)
+	if f.snapshotGate != nil {
+		<-f.snapshotGate
+	}
+	if f.snapshotErr != nil {
+		return page.Snapshot{}, f.snapshotErr
+	}
+	reducer := opts.Reducer
+	if reducer == nil {
+		reducer = page.NewReducer(page.ReduceOptions{})
+	}
+	return reducer.Reduce(page.RawPage{
+		URL:  "https://example.com",
+		HTML: `<p>` + strings.Repeat("lorem ipsum ", 50) + `</p><a id="a" href="/a">A</a><a id="b" href="/b">B</a><a id="c" href="/c">C</a>`,
+	}), nil
+}
+
+// Navigate answers like an extension that reports the response status.
+func (f *fakeBrowser) Navigate(_ context.Context, url string) (browser.NavigateResult, error) {
+	moved := true
+	return browser.NavigateResult{NavigationState: browser.NavigationState{URL: url, Title: "Missing", Moved: &moved}, StatusCode: 404, StatusText: "Not Found", Headers: map[string]string{"content-type": "text/html"}}, nil
+}
+
+// Reload records its options and answers with a successful reload of a
+// fixed page.
+func (f *fakeBrowser) Reload(_ context.Context, opts browser.ReloadOptions) (browser.NavigateResult, error) {
+	f.reloads = append(f.reloads, opts)
+	moved := true
+	return browser.NavigateResult{NavigationState: browser.NavigationState{URL: "https://example.com/", Title: "Example", Moved: &moved}, StatusCode: 200}, nil
+}
+
+// PressKeys dispatches every chord.
+func (f *fakeBrowser) PressKeys(_ context.Context, selector string, chords []browser.KeyChord) (browser.PressKeysResult, error) {
+	f.selectors = append(f.selectors, selector)
+	out := browser.PressKeysResult{Selector: selector, Dispatched: []string{}, UsedActiveElement: selector == ""}
+	for _, c := range chords {
+		out.Dispatched = append(out.Dispatched, c.String())
+	}
+	return out, nil
+}
+
+// History returns history when set and otherwise fails the way an extension
+// without get_history does.
+func (f *fakeBrowser) History(context.Context) (browser.HistoryList, error) {
+	if f.history == nil {
+		return browser.HistoryList{}, errors.New("unknown command get_history")
+	}
+	return *f.history, nil
+}
+
+// GetStorage records its options and returns one item.
+func (f *fakeBrowser) GetStorage(_ context.Context, opts browser.GetStorageOptions) (browser.StorageResult, error) {
+	f.storage = append(f.storage, opts)
+	return browser.StorageResult{Origin: "https://example.com", Kind: opts.Kind, Items: []browser.StorageItem{{Key: "k", Value: "v"}}, Count: 1}, nil
+}
+
+func newTestServer(t *testing.T, b browser.Browser, opts Options) *Server {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	return New(b, nil, opts)
+}
+
+func TestPromptsRegistered(t *testing.T) {
+	cs := connect(t, newTestServer(t, nil, Options{}))
+	res, err := cs.ListPrompts(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("list prompts: %v", err)
+	}
+	args := map[string][]string{}
+	for _, p := range res.Prompts {
+		for _, a := range p.Arguments {
+			args[p.Name] = append(args[p.Name], a.Name)
+		}
+	}
+	if got := args["browse_and_summarize"]; len(got) != 2 || got[0] != "url" {
+		t.Fatalf("unexpected browse_and_summarize arguments: %v", got)
+	}
+	if got := args["fill_form"]; len(got) != 2 || got[0] != "goal" {
+		t.Fatalf("unexpected fill_form arguments: %v", got)
+	}
+
+	got, err := cs.GetPrompt(context.Background(), &mcp.GetPromptParams{
+		Name:      "browse_and_summarize",
+		Arguments: map[string]string{"url": "https://example.com"},
+	})
+	if err != nil {
+		t.Fatalf("get prompt: %v", err)
+	}
+	if len(got.Messages) != 1 {
+		t.Fatalf("expected one prompt message, got %d", len(got.Messages))
+	}
+}
+
+func TestPromptsCanBeDisabled(t *testing.T) {
+	cs := connect(t, newTestServer(t, nil, Options{DisablePrompts: true}))
+	res, err := cs.ListPrompts(context.Background(), nil)
+	if err == nil && len(res.Prompts) != 0 {
+		t.Fatalf("expected no prompts, got %d", len(res.Prompts))
+	}
+}
+
+func TestHostPolicy(t *testing.T) {
+	p := newHostPolicy([]string{"example.com", "*.corp.test", " Docs.Example.org "})
+	allowed := []string{"https://example.com/a", "http://EXAMPLE.com:8080", "https://wiki.corp.test", "https://a.b.corp.test/x", "https://docs.example.org", "about:blank", ""}
+	for _, u := range allowed {
+		if err := p.check(u); err != nil {
+			t.Fatalf("expected %q to be allowed: %v", u, err)
+		}
+	}
+	denied := []string{"https://evil.com", "https://corp.test", "https://notexample.com", "https://example.com.evil.com", "javascript:alert(1)"}
+	for _, u := range denied {
+		if err := p.check(u); err == nil {
+			t.Fatalf("expected %q to be denied", u)
+		}
+	}
+	if err := newHostPolicy(nil).check("https://anything.test"); err != nil {
+		t.Fatalf("expected empty allowlist to allow all: %v", err)
+	}
+}
+
+func TestNavigateRejectsDisallowedHost(t *testing.T) {
+	s := newTestServer(t, nil, Options{AllowedHosts: []string{"example.com"}})
+	_, _, err := s.navigate(context.Background(), nil, NavigateInput{URL: "https://evil.com"})
+	if err == nil {
+		t.Fatalf("expected navigation to a disallowed host to fail")
+	}
+	_, _, err = s.openTab(context.Background(), nil, OpenTabInput{URL: "https://evil.com"})
+	if err == nil {
+		t.Fatalf("expected open_tab to a disallowed host to fail")
+	}
+}
+
+func TestSnapshotFormatDefaultAndOverride(t *testing.T) {
+	cs := connect(t, newTestServer(t, &fakeBrowser{}, Options{DefaultSnapshotFormat: page.FormatMarkdown}))
+	call := func(args map[string]any) (*mcp.CallToolResult, SnapshotOutput) {
+		t.Helper()
+		res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.snapshot", Arguments: args})
+		if err != nil {
+			t.Fatalf("snapshot: %v", err)
+		}
+		var out SnapshotOutput
+		data, _ := json.Marshal(res.StructuredContent)
+		_ = json.Unmarshal(data, &out)
+		return res, out
+	}
+
+	_, out := call(map[string]any{})
+	if out.Format != "markdown" || !strings.Contains(out.Markdown, "- `e1` open \"A\"") || out.Text != "" || len(out.Elements) != 0 {
+		t.Fatalf("expected the configured markdown default, got %+v", out)
+	}
+	_, out = call(map[string]any{"format": "json"})
+	if out.Format != "" || out.Markdown != "" || len(out.Elements) != 3 || out.Text == "" {
+		t.Fatalf("expected format to override the default, got %+v", out)
+	}
+	_, out = call(map[string]any{"format": "outline"})
+	if out.Outline != "e1 link \"A\" -> /a\ne2 link \"B\" -> /b\ne3 link \"C\" -> /c\n" || len(out.Actions) != 0 {
+		t.Fatalf("unexpected outline %q", out.Outline)
+	}
+	if res, _ := call(map[string]any{"format": "yaml"}); !res.IsError {
+		t.Fatalf("expected an unknown format to fail")
+	}
+}
+
+func TestNavigateReturnsStatus(t *testing.T) {
+	cs := connect(t, newTestServer(t, &fakeBrowser{}, Options{}))
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.navigate", Arguments: map[string]any{"url": "https://example.com/missing"}})
+	if err != nil || res.IsError {
+		t.Fatalf("navigate: %v %#v", err, res)
+	}
+	var out browser.NavigateResult
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &out); err != nil || out.StatusCode != 404 || out.URL != "https://example.com/missing" || out.Moved == nil || !*out.Moved || out.Headers["content-type"] != "text/html" {
+		t.Fatalf("unexpected navigate result %s (%v)", data, err)
+	}
+}
+
+func TestReloadReturnsLocation(t *testing.T) {
+	fb := &fakeBrowser{}
+	cs := connect(t, newTestServer(t, fb, Options{}))
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.reload", Arguments: map[string]any{"bypassCache": true}})
+	if err != nil || res.IsError {
+		t.Fatalf("reload: %v %#v", err, res)
+	}
+	var out browser.NavigateResult
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &out); err != nil || out.URL != "https://example.com/" || out.Title != "Example" || out.Moved == nil || !*out.Moved || out.StatusCode != 200 {
+		t.Fatalf("unexpected reload result %s (%v)", data, err)
+	}
+	if len(fb.reloads) != 1 || !fb.reloads[0].BypassCache {
+		t.Fatalf("expected one cache-bypassing reload, got %+v", fb.reloads)
+	}
+}
+
+func TestDefaultTarget(t *testing.T) {
+	fb := &fakeBrowser{}
+	cs := connect(t, newTestServer(t, fb, Options{}))
+	ctx := context.Background()
+	call := func(name string, args map[string]any) {
+		t.Helper()
+		res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if res.IsError {
+			t.Fatalf("%s: tool error %v", name, res.Content)
+		}
+	}
+
+	call("browser.use_target", map[string]any{"sessionId": "s1", "tabId": 7})
+	call("browser.click", map[string]any{"selector": "#a"})
+	call("browser.click", map[string]any{"selector": "#a", "sessionId": "s2"})
+	call("browser.clear_target", map[string]any{})
+	call("browser.click", map[string]any{"selector": "#a"})
+
+	want := []browser.Target{{SessionID: "s1", TabID: 7}, {SessionID: "s2"}, {}}
+	if len(fb.targets) != len(want) {
+		t.Fatalf("expected %d clicks, got %d", len(want), len(fb.targets))
+	}
+	for i, w := range want {
+		if fb.targets[i] != w {
+			t.Fatalf("click %d: target %#v, want %#v", i, fb.targets[i], w)
+		}
+	}
+}
+
+func TestTargetForgottenWhenSessionCloses(t *testing.T) {
+	s := newTestServer(t, &fakeBrowser{}, Options{})
+	cs := connect(t, s)
+	if _, err := cs.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "browser.use_target",
+		Arguments: map[string]any{"sessionId": "s1", "tabId": 7},
+	}); err != nil {
+		t.Fatalf("use_target: %v", err)
+	}
+	s.targetsMu.Lock()
+	n := len(s.targets)
+	s.targetsMu.Unlock()
+	if n != 1 {
+		t.Fatalf("expected one stored target, got %d", n)
+	}
+	if err := cs.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.targetsMu.Lock()
+		n = len(s.targets)
+		s.targetsMu.Unlock()
+		s.clientsMu.Lock()
+		open := len(s.sessionKeys)
+		s.clientsMu.Unlock()
+		if n == 0 && open == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("targets not pruned after close: %d targets, %d sessions", n, open)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestTabLockedResult(t *testing.T) {
+	fb := &fakeBrowser{clickErr: &browser.TabLockedError{TabID: 7, OwnerSessionID: "owner-1", AllowShared: true}}
+	cs := connect(t, newTestServer(t, fb, Options{}))
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "browser.click",
+		Arguments: map[string]any{"selector": "#go"},
+	})
+	if err != nil {
+		t.Fatalf("call click: %v", err)
+	}
+	if !res.IsError || res.StructuredContent != nil || len(res.Content) != 1 {
+		t.Fatalf("expected a single error content block, got %#v", res)
+	}
+	out := errorBody(t, res)
+	if out["error"] != "tab_locked" || out["tabId"] != 7.0 || out["ownerSessionId"] != "owner-1" || out["allowShared"] != true || out["hint"] == nil {
+		t.Fatalf("unexpected tab_locked body %#v", out)
+	}
+}
+
+// errorBody decodes the JSON text of a structured tool error.
+func errorBody(t *testing.T, res *mcp.CallToolResult) map[string]any {
+	t.Helper()
+	var out map[string]any
+	if err := json.Unmarshal([]byte(res.Content[0].(*mcp.TextContent).Text), &out); err != nil {
+		t.Fatalf("decode error body: %v", err)
+	}
+	return out
+}
+
+func TestOpenTabLimit(t *testing.T) {
+	fb := &fakeBrowser{}
+	cs := connect(t, newTestServer(t, fb, Options{MaxTabsPerSession: 2}))
+	open := func() *mcp.CallToolResult {
+		t.Helper()
+		res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.open_tab", Arguments: map[string]any{"url": "https://example.com"}})
+		if err != nil {
+			t.Fatalf("call open_tab: %v", err)
+		}
+		return res
+	}
+
+	for i := 0; i < 2; i++ {
+		if res := open(); res.IsError {
+			t.Fatalf("open_tab %d under the limit failed: %#v", i+1, res.Content)
+		}
+	}
+	res := open()
+	if !res.IsError || res.StructuredContent != nil || len(res.Content) != 1 {
+		t.Fatalf("expected a single error content block, got %#v", res)
+	}
+	out := errorBody(t, res)
+	if out["error"] != "tab_limit_exceeded" || out["limit"] != 2.0 || out["open"] != 2.0 || out["hint"] == nil || out["traceId"] == nil {
+		t.Fatalf("unexpected tab_limit_exceeded body %#v", out)
+	}
+	if len(fb.tabs) != 2 {
+		t.Fatalf("expected the refused call not to open a tab, have %d", len(fb.tabs))
+	}
+
+	fb.tabs = fb.tabs[:1]
+	if res := open(); res.IsError {
+		t.Fatalf("expected open_tab to succeed after a tab closed: %#v", res.Content)
+	}
+}
+
+func TestOpenTabLockIsPerSession(t *testing.T) {
+	s := newTestServer(t, &fakeBrowser{}, Options{MaxTabsPerSession: 1})
+	unlockA := s.lockOpenTab("a")
+
+	done := make(chan struct{})
+	go func() {
+		s.lockOpenTab("b")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected another session's open_tab not to wait on session a")
+	}
+
+	locked := make(chan func())
+	go func() { locked <- s.lockOpenTab("a") }()
+	select {
+	case <-locked:
+		t.Fatalf("expected a second open_tab on session a to wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlockA()
+	(<-locked)()
+
+	if n := len(s.openTabLocks); n != 0 {
+		t.Fatalf("expected released locks to be dropped, have %d", n)
+	}
+}
+
+// slowTabs widens the gap between counting and opening tabs so unserialized
+// open_tab calls would both get past the limit.
+type slowTabs struct {
+	*fakeBrowser
+	mu sync.Mutex
+}
+
+func (f *slowTabs) ListTabs(ctx context.Context) ([]browser.TabInfo, error) {
+	f.mu.Lock()
+	tabs := slices.Clone(f.tabs)
+	f.mu.Unlock()
+	time.Sleep(20 * time.Millisecond)
+	return tabs, nil
+}
+
+func (f *slowTabs) OpenTab(ctx context.Context, opts browser.OpenTabOptions) (browser.TabInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fakeBrowser.OpenTab(ctx, opts)
+}
+
+func TestOpenTabLockResolvesActiveSession(t *testing.T) {
+	fb := &slowTabs{fakeBrowser: &fakeBrowser{}}
+	s := newTestServer(t, fb, Options{
+		MaxTabsPerSession: 1,
+		ActiveSession:     func() (string, bool) { return "s1", true },
+	})
+
+	inputs := []OpenTabInput{{}, {TargetInput: TargetInput{SessionID: "s1"}}}
+	errs := make(chan error, len(inputs))
+	for _, input := range inputs {
+		go func() {
+			_, _, err := s.openTab(context.Background(), nil, input)
+			errs <- err
+		}()
+	}
+	var limited int
+	for range inputs {
+		var tabLimit *browser.TabLimitError
+		if err := <-errs; errors.As(err, &tabLimit) {
+			limited++
+		} else if err != nil {
+			t.Fatalf("open_tab: %v", err)
+		}
+	}
+	if limited != 1 || len(fb.tabs) != 1 {
+		t.Fatalf("expected the untargeted call to share s1's limit, got %d refused and %d tabs", limited, len(fb.tabs))
+	}
+}
+
+func TestOpenTabUnlimitedByDefault(t *testing.T) {
+	fb := &fakeBrowser{}
+	s := newTestServer(t, fb, Options{})
+	for i := 0; i < 50; i++ {
+		if _, _, err := s.openTab(context.Background(), nil, OpenTabInput{}); err != nil {
+			t.Fatalf("open_tab %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestTraceIDReachesBrowser(t *testing.T) {
+	fb := &fakeBrowser{}
+	cs := connect(t, newTestServer(t, fb, Options{}))
+	ctx := context.Background()
+	click := func() *mcp.CallToolResult {
+		t.Helper()
+		res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.click", Arguments: map[string]any{"selector": "#go"}})
+		if err != nil {
+			t.Fatalf("call click: %v", err)
+		}
+		return res
+	}
+
+	res := click()
+	if len(fb.traces) != 1 || fb.traces[0] == "" {
+		t.Fatalf("expected the browser call to carry a trace id, got %q", fb.traces)
+	}
+	if res.Meta["traceId"] != fb.traces[0] {
+		t.Fatalf("expected result _meta.traceId %q, got %v", fb.traces[0], res.Meta["traceId"])
+	}
+
+	fb.clickErr = errors.New("element not found")
+	res = click()
+	if len(fb.traces) != 2 || fb.traces[1] == fb.traces[0] {
+		t.Fatalf("expected a fresh trace id per call, got %q", fb.traces)
+	}
+	text := res.Content[0].(*mcp.TextContent).Text
+	if !res.IsError || !strings.Contains(text, "(trace "+fb.traces[1]+")") {
+		t.Fatalf("expected the error to carry trace %s, got %q", fb.traces[1], text)
+	}
+
+	fb.clickErr = &browser.TabLockedError{TabID: 7}
+	res = click()
+	if out := errorBody(t, res); out["traceId"] != fb.traces[2] {
+		t.Fatalf("expected tab_locked body to carry trace %s, got %#v", fb.traces[2], out)
+	}
+}
+
+func TestInjectedReducer(t *testing.T) {
+	reducer := page.NewReducer(page.ReduceOptions{MaxText: 20, MaxElements: 2})
+	cs := connect(t, newTestServer(t, &fakeBrowser{}, Options{Reducer: reducer}))
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.snapshot", Arguments: map[string]any{}})
+	if err != nil || res.IsError {
+		t.Fatalf("snapshot: %v %#v", err, res)
+	}
+	var out SnapshotOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if len(out.Text) != 20 || !out.TextTruncated || out.ElementsReturned != 2 || out.ElementsTotal != 3 {
+		t.Fatalf("snapshot ignored injected limits: text=%d truncated=%v elements=%d/%d", len(out.Text), out.TextTruncated, out.ElementsReturned, out.ElementsTotal)
+	}
+}
+
+func TestWorkflowNamespaces(t *testing.T) {
+	cs := connect(t, newTestServer(t, nil, Options{}))
+	ctx := context.Background()
+	steps := []map[string]any{{"type": "click", "payload": map[string]any{"selector": "#go"}, "timestamp": 1, "url": "https://example.com", "title": "Example"}}
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "workflow.save", Arguments: map[string]any{"name": "shared", "namespace": "team", "steps": steps}})
+	if err != nil || res.IsError {
+		t.Fatalf("save: %v %v", err, res)
+	}
+	var saved WorkflowSaveOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &saved); err != nil || saved.Namespace != "team" {
+		t.Fatalf("unexpected save output %s", data)
+	}
+
+	read := func(uri string) string {
+		t.Helper()
+		out, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri})
+		if err != nil {
+			t.Fatalf("read %s: %v", uri, err)
+		}
+		return out.Contents[0].Text
+	}
+	if got := read("workflow://list"); strings.Contains(got, saved.ID) {
+		t.Fatalf("expected default namespace not to list team workflow, got %s", got)
+	}
+	if got := read("workflow://team/list"); !strings.Contains(got, saved.ID) {
+		t.Fatalf("expected team namespace to list its workflow, got %s", got)
+	}
+	if got := read("workflow://team/" + saved.ID); !strings.Contains(got, `"shared"`) {
+		t.Fatalf("expected workflow by namespace and id, got %s", got)
+	}
+	if _, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: "workflow://" + saved.ID}); err == nil {
+		t.Fatalf("expected team workflow to be missing from the default namespace")
+	}
+}
+
+func TestSnapshotElementFilter(t *testing.T) {
+	cs := connect(t, newTestServer(t, &fakeBrowser{}, Options{}))
+	ctx := context.Background()
+	snapshot := func(filter map[string]any) SnapshotOutput {
+		t.Helper()
+		res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.snapshot", Arguments: map[string]any{"elementFilter": filter}})
+		if err != nil || res.IsError {
+			t.Fatalf("snapshot: %v %#v", err, res)
+		}
+		var out SnapshotOutput
+		data, _ := json.Marshal(res.StructuredContent)
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatalf("decode snapshot: %v", err)
+		}
+		return out
+	}
+
+	if out := snapshot(map[string]any{"verbs": []string{"open"}}); out.ElementsReturned != 3 || len(out.Actions) != 3 {
+		t.Fatalf("expected links-only filter to keep 3 links, got %d elements / %d actions", out.ElementsReturned, len(out.Actions))
+	}
+	out := snapshot(map[string]any{"verbs": []string{"type"}})
+	if len(out.Elements) != 0 || out.ElementsReturned != 0 || out.ElementsTotal != 3 {
+		t.Fatalf("expected type filter to drop every link, got %d returned of %d", out.ElementsReturned, out.ElementsTotal)
+	}
+
+	latest, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: "browser://page/latest"})
+	if err != nil {
+		t.Fatalf("read latest: %v", err)
+	}
+	if !strings.Contains(latest.Contents[0].Text, `"/c"`) {
+		t.Fatalf("expected the stored snapshot to stay unfiltered, got %s", latest.Contents[0].Text)
+	}
+}
+
+func TestSnapshotStorageDisabled(t *testing.T) {
+	t.Chdir(t.TempDir())
+	store := page.NewDisabledStore()
+	cs := connect(t, New(&fakeBrowser{}, store, Options{}))
+	ctx := context.Background()
+
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.snapshot", Arguments: map[string]any{}})
+	if err != nil || res.IsError {
+		t.Fatalf("snapshot: %v %#v", err, res)
+	}
+	var out SnapshotOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if out.SnapshotID != "" || len(out.Elements) != 3 {
+		t.Fatalf("expected an unstored snapshot with 3 elements, got id %q and %d elements", out.SnapshotID, len(out.Elements))
+	}
+	if _, ok := store.Latest(); ok {
+		t.Fatalf("expected nothing to be stored")
+	}
+	if _, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: "browser://page/latest"}); err == nil {
+		t.Fatalf("expected browser://page/latest to be unavailable")
+	}
+	templates, err := cs.ListResourceTemplates(ctx, nil)
+	if err != nil {
+		t.Fatalf("list templates: %v", err)
+	}
+	for _, tmpl := range templates.ResourceTemplates {
+		if strings.HasPrefix(tmpl.URITemplate, "browser://page/") {
+			t.Fatalf("expected no page template, got %s", tmpl.URITemplate)
+		}
+	}
+}
+
+func TestClampedRequestsSucceedWithWarnings(t *testing.T) {
+	cs := connect(t, newTestServer(t, &fakeBrowser{}, Options{}))
+	ctx := context.Background()
+
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.find", Arguments: map[string]any{"text": "x", "limit": 5000, "radius": -3}})
+	if err != nil || res.IsError {
+		t.Fatalf("find: %v %#v", err, res)
+	}
+	var found FindOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &found); err != nil {
+		t.Fatalf("decode find: %v", err)
+	}
+	if found.Limit != maxFindLimit || found.Radius != 0 || len(found.Warnings) != 2 {
+		t.Fatalf("expected clamped limit/radius with 2 warnings, got %s", data)
+	}
+
+	res, err = cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.snapshot", Arguments: map[string]any{
+		"maxElements":   10000,
+		"elementFilter": map[string]any{"verbs": []string{"open", "frobnicate"}},
+	}})
+	if err != nil || res.IsError {
+		t.Fatalf("snapshot: %v %#v", err, res)
+	}
+	var snap SnapshotOutput
+	data, _ = json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &snap); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if len(snap.Warnings) != 2 || snap.ElementsReturned != 3 {
+		t.Fatalf("expected 2 warnings and the links kept, got %s", data)
+	}
+
+	res, err = cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.find", Arguments: map[string]any{"text": "x", "limit": 5}})
+	if err != nil || res.IsError {
+		t.Fatalf("find: %v %#v", err, res)
+	}
+	if data, _ := json.Marshal(res.StructuredContent); strings.Contains(string(data), "warnings") {
+		t.Fatalf("expected no warnings for a valid request, got %s", data)
+	}
+}
+
+func TestSelectWarnings(t *testing.T) {
+	var warn warnings
+	opts := browser.SelectOptions{Selector: "select", Value: "a", MatchMode: "fuzzy", LabelRegex: "("}
+	warn.selectOptions(&opts)
+	if opts.MatchMode != "" || opts.LabelRegex != "" || len(warn) != 2 {
+		t.Fatalf("expected match mode and regex dropped with warnings, got %+v %v", opts, warn)
+	}
+
+	warn = nil
+	opts = browser.SelectOptions{Selector: "select", LabelRegex: "("}
+	warn.selectOptions(&opts)
+	if opts.LabelRegex != "(" || len(warn) != 0 {
+		t.Fatalf("expected a lone bad regex to be left for the browser to reject, got %+v %v", opts, warn)
+	}
+}
+
+func TestToolTimeoutDefaults(t *testing.T) {
+	fb := &fakeBrowser{}
+	cs := connect(t, newTestServer(t, fb, Options{ToolTimeouts: map[string]time.Duration{"browser.wait_for_selector": 45 * time.Second}}))
+	ctx := context.Background()
+	for _, args := range []map[string]any{{"selector": ".done"}, {"selector": ".done", "timeoutMs": 1000}} {
+		res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.wait_for_selector", Arguments: args})
+		if err != nil || res.IsError {
+			t.Fatalf("wait: %v %#v", err, res)
+		}
+	}
+	if fb.waits[0].TimeoutMs != 45000 || fb.timeouts[0] != 45*time.Second {
+		t.Fatalf("expected configured default when timeoutMs is omitted, got %dms / %s", fb.waits[0].TimeoutMs, fb.timeouts[0])
+	}
+	if fb.waits[1].TimeoutMs != 1000 {
+		t.Fatalf("expected explicit timeoutMs to win, got %d", fb.waits[1].TimeoutMs)
+	}
+}
+
+func TestValidateToolTimeouts(t *testing.T) {
+	cs := connect(t, newTestServer(t, nil, Options{AllowEvaluate: true}))
+	res, err := cs.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	registered := map[string]bool{}
+	for _, tool := range res.Tools {
+		registered[tool.Name] = true
+	}
+	for _, name := range timeoutTools {
+		if !registered[name] {
+			t.Fatalf("timeoutTools lists %s, which is not registered", name)
+		}
+	}
+
+	if err := ValidateToolTimeouts(map[string]time.Duration{"browser.find": time.Second}); err != nil {
+		t.Fatalf("expected known tool to pass: %v", err)
+	}
+	if err := ValidateToolTimeouts(map[string]time.Duration{"browser.teleport": time.Second}); err == nil || !strings.Contains(err.Error(), "browser.teleport") {
+		t.Fatalf("expected unknown tool to be named, got %v", err)
+	}
+}
+
+func TestGetRecordingFiltersAndPages(t *testing.T) {
+	var actions []browser.RecordedAction
+	for i, typ := range []string{"navigate", "click", "type", "click", "scroll", "click"} {
+		actions = append(actions, browser.RecordedAction{Type: typ, Timestamp: int64(100 + i), URL: "https://example.com", Payload: map[string]any{}})
+	}
+
+	clicks := filterRecording(actions, GetRecordingInput{Types: []string{"Click"}})
+	if len(clicks.Actions) != 3 || clicks.Total != 6 || clicks.HasMore || clicks.NextIndex != 6 {
+		t.Fatalf("unexpected click filter result %+v", clicks)
+	}
+
+	page1 := filterRecording(actions, GetRecordingInput{Types: []string{"click"}, Limit: 2})
+	if len(page1.Actions) != 2 || !page1.HasMore || page1.NextIndex != 5 {
+		t.Fatalf("unexpected first page %+v", page1)
+	}
+	page2 := filterRecording(actions, GetRecordingInput{Types: []string{"click"}, Limit: 2, SinceIndex: page1.NextIndex})
+	if len(page2.Actions) != 1 || page2.Actions[0].Timestamp != 105 || page2.HasMore {
+		t.Fatalf("unexpected second page %+v", page2)
+	}
+
+	if got := filterRecording(actions, GetRecordingInput{Since: 103}); len(got.Actions) != 2 || got.Actions[0].Type != "scroll" {
+		t.Fatalf("expected actions after timestamp 103, got %+v", got.Actions)
+	}
+	untimed := []browser.RecordedAction{{Type: "click"}, {Type: "type"}}
+	if got := filterRecording(untimed, GetRecordingInput{}); len(got.Actions) != 2 {
+		t.Fatalf("expected actions without a timestamp to be returned when since is unset, got %+v", got.Actions)
+	}
+	if got := filterRecording(actions, GetRecordingInput{SinceIndex: 50}); len(got.Actions) != 0 || got.NextIndex != 6 {
+		t.Fatalf("expected an index past the end to return nothing, got %+v", got)
+	}
+
+	cs := connect(t, newTestServer(t, &fakeBrowser{recording: actions}, Options{}))
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.get_recording", Arguments: map[string]any{"limit": 5000, "sinceIndex": -1}})
+	if err != nil || res.IsError {
+		t.Fatalf("get_recording: %v %#v", err, res)
+	}
+	var out RecordingOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("decode recording: %v", err)
+	}
+	if len(out.Actions) != 6 || len(out.Warnings) != 2 {
+		t.Fatalf("expected every action with clamp warnings, got %s", data)
+	}
+}
+
+func TestClearStorageForwardsFlags(t *testing.T) {
+	fb := &fakeBrowser{}
+	cs := connect(t, newTestServer(t, fb, Options{}))
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{
+		Name:      "browser.clear_storage",
+		Arguments: map[string]any{"cookies": true, "localStorage": true},
+	})
+	if err != nil || res.IsError {
+		t.Fatalf("clear_storage: %v %#v", err, res)
+	}
+	want := browser.ClearStorageOptions{Cookies: true, LocalStorage: true}
+	if len(fb.clears) != 1 || fb.clears[0] != want {
+		t.Fatalf("expected %+v to reach the browser, got %+v", want, fb.clears)
+	}
+	var out browser.ClearStorageResult
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &out); err != nil || out.Origin != "https://example.com" || len(out.Cleared) != 2 {
+		t.Fatalf("unexpected result %s (%v)", data, err)
+	}
+}
+
+func TestEvaluateIsOptIn(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts Options
+		want bool
+	}{
+		{"default", Options{}, false},
+		{"allowed", Options{AllowEvaluate: true}, true},
+		{"allowed hosts", Options{AllowEvaluate: true, AllowedHosts: []string{"example.com"}}, false},
+	} {
+		cs := connect(t, newTestServer(t, nil, tc.opts))
+		res, err := cs.ListTools(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("%s: list tools: %v", tc.name, err)
+		}
+		got := slices.ContainsFunc(res.Tools, func(tool *mcp.Tool) bool { return tool.Name == "browser.evaluate" })
+		if got != tc.want {
+			t.Fatalf("%s: browser.evaluate registered is %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestEvaluateCapsResultAndReportsExceptions(t *testing.T) {
+	cs := connect(t, newTestServer(t, &fakeBrowser{}, Options{AllowEvaluate: true}))
+	ctx := context.Background()
+	call := func(args map[string]any) (*mcp.CallToolResult, EvaluateOutput) {
+		t.Helper()
+		res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.evaluate", Arguments: args})
+		if err != nil {
+			t.Fatalf("evaluate: %v", err)
+		}
+		var out EvaluateOutput
+		data, _ := json.Marshal(res.StructuredContent)
+		_ = json.Unmarshal(data, &out)
+		return res, out
+	}
+
+	res, out := call(map[string]any{"script": "({n: 1})"})
+	if res.IsError || out.Type != "object" || out.Truncated || out.Bytes != 7 {
+		t.Fatalf("unexpected result %#v", out)
+	}
+	if m, ok := out.Value.(map[string]any); !ok || m["n"] != float64(1) {
+		t.Fatalf("expected the object value, got %#v", out.Value)
+	}
+
+	res, out = call(map[string]any{"script": "big", "maxBytes": 11})
+	if res.IsError || !out.Truncated || out.Value != nil || out.Bytes != 202 || out.Preview != `"`+strings.Repeat("é", 5) {
+		t.Fatalf("expected a truncated preview, got %#v", out)
+	}
+
+	if res, _ := call(map[string]any{"script": "throw"}); !res.IsError {
+		t.Fatalf("expected a page exception to be a tool error")
+	}
+}
+
+func TestGetTextAndAttribute(t *testing.T) {
+	cs := connect(t, newTestServer(t, &fakeBrowser{}, Options{}))
+	ctx := context.Background()
+
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.get_text", Arguments: map[string]any{"selector": "#a"}})
+	if err != nil || res.IsError {
+		t.Fatalf("get_text: %v %#v", err, res)
+	}
+	var text browser.TextResult
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &text); err != nil || text.InnerText != "A" || text.TextContent != "A hidden" {
+		t.Fatalf("unexpected text %s (%v)", data, err)
+	}
+
+	res, err = cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.get_attribute", Arguments: map[string]any{"selector": "#a", "attribute": "href"}})
+	if err != nil || res.IsError {
+		t.Fatalf("get_attribute: %v %#v", err, res)
+	}
+	var attr browser.AttributeResult
+	data, _ = json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &attr); err != nil || attr.Value != "/a" || !attr.Present {
+		t.Fatalf("unexpected attribute %s (%v)", data, err)
+	}
+
+	res, err = cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.get_attribute", Arguments: map[string]any{"selector": "#missing", "attribute": "href"}})
+	if err != nil {
+		t.Fatalf("get_attribute: %v", err)
+	}
+	if !res.IsError || res.StructuredContent != nil || len(res.Content) != 1 {
+		t.Fatalf("expected a single error content block, got %#v", res)
+	}
+	missing := errorBody(t, res)
+	if missing["error"] != "not_found" || missing["selector"] != "#missing" || missing["hint"] == nil {
+		t.Fatalf("unexpected not_found body %#v", missing)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	fb := &fakeBrowser{history: &browser.HistoryList{
+		Entries:  []browser.HistoryEntry{{URL: "https://example.com/"}, {URL: "https://example.com/a"}, {URL: "https://example.com/b"}},
+		Index:    1,
+		Length:   3,
+		Complete: true,
+	}}
+	cs := connect(t, newTestServer(t, fb, Options{}))
+	call := func() HistoryOutput {
+		t.Helper()
+		res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.history", Arguments: map[string]any{}})
+		if err != nil || res.IsError {
+			t.Fatalf("history: %v %#v", err, res)
+		}
+		var out HistoryOutput
+		data, _ := json.Marshal(res.StructuredContent)
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatalf("decode history: %v", err)
+		}
+		return out
+	}
+
+	out := call()
+	if len(out.Entries) != 3 || out.Index != 1 || !out.CanGoBack || !out.CanGoForward || len(out.Warnings) != 0 {
+		t.Fatalf("unexpected history %#v", out)
+	}
+
+	fb.history = nil
+	out = call()
+	if len(out.Entries) != 1 || out.Entries[0].URL != "https://example.com" || out.Complete || out.CanGoBack || len(out.Warnings) != 1 {
+		t.Fatalf("expected the current page only with a warning, got %#v", out)
+	}
+}
+
+func TestPressKeys(t *testing.T) {
+	fb := &fakeBrowser{}
+	cs := connect(t, newTestServer(t, fb, Options{}))
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.press_keys", Arguments: map[string]any{"keys": []string{"ctrl+a", "delete"}}})
+	if err != nil || res.IsError {
+		t.Fatalf("press_keys: %v %#v", err, res)
+	}
+	var out browser.PressKeysResult
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &out); err != nil || !slices.Equal(out.Dispatched, []string{"Control+a", "Delete"}) || !out.UsedActiveElement {
+		t.Fatalf("unexpected result %s (%v)", data, err)
+	}
+
+	res, err = cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.press_keys", Arguments: map[string]any{"selector": "#a", "keys": []string{"Control+a", "Hyper+x"}}})
+	if err != nil {
+		t.Fatalf("press_keys: %v", err)
+	}
+	if !res.IsError || !strings.Contains(res.Content[0].(*mcp.TextContent).Text, "keys[1]") {
+		t.Fatalf("expected the bad chord to be named, got %#v", res.Content)
+	}
+	if len(fb.selectors) != 1 {
+		t.Fatalf("expected nothing to be sent for an unparsable chord, got %v", fb.selectors)
+	}
+}
+
+func TestGetStorageDefaults(t *testing.T) {
+	fb := &fakeBrowser{}
+	cs := connect(t, newTestServer(t, fb, Options{}))
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.get_storage", Arguments: map[string]any{}})
+	if err != nil || res.IsError {
+		t.Fatalf("get_storage: %v %#v", err, res)
+	}
+	res, err = cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.get_storage", Arguments: map[string]any{"kind": "session", "maxBytes": 5 << 20}})
+	if err != nil || res.IsError {
+		t.Fatalf("get_storage: %v %#v", err, res)
+	}
+	var out GetStorageOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &out); err != nil || len(out.Items) != 1 || len(out.Warnings) != 1 {
+		t.Fatalf("expected the item and a clamp warning, got %s (%v)", data, err)
+	}
+	want := []browser.GetStorageOptions{
+		{Kind: browser.StorageLocal, MaxBytes: defaultStorageBytes},
+		{Kind: browser.StorageSession, MaxBytes: maxStorageBytes},
+	}
+	if !slices.Equal(fb.storage, want) {
+		t.Fatalf("unexpected options %+v", fb.storage)
+	}
+}
+
+func TestFillFormReportsEachField(t *testing.T) {
+	fb := &fakeBrowser{}
+	cs := connect(t, newTestServer(t, fb, Options{}))
+	ctx := context.Background()
+	if _, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.snapshot", Arguments: map[string]any{}}); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.fill_form", Arguments: map[string]any{"fields": []any{
+		map[string]any{"selector": "#a", "value": "one"},
+		map[string]any{"ref": "e99", "value": "two"},
+		map[string]any{"selector": "#missing", "value": "three"},
+		map[string]any{"ref": "e2", "value": "four", "pressEnter": true},
+	}}})
+	if err != nil || res.IsError {
+		t.Fatalf("fill_form: %v %#v", err, res)
+	}
+	var out browser.FillFormResult
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Succeeded != 2 || out.Failed != 2 || len(out.Fields) != 4 {
+		t.Fatalf("unexpected counts %s", data)
+	}
+	if !out.Fields[0].OK || out.Fields[1].OK || !strings.Contains(out.Fields[1].Error, "unknown ref") ||
+		out.Fields[2].OK || out.Fields[2].ErrorCode != "not_found" || !out.Fields[3].OK || out.Fields[3].Selector != "#b" {
+		t.Fatalf("unexpected fields %s", data)
+	}
+	if want := []string{"#a", "#missing", "#b"}; !slices.Equal(fb.selectors, want) {
+		t.Fatalf("selectors sent = %v, want %v", fb.selectors, want)
+	}
+}
+
+func TestCheckAndUncheckAreIdempotent(t *testing.T) {
+	cs := connect(t, newTestServer(t, &fakeBrowser{}, Options{}))
+	call := func(name, selector string) (*mcp.CallToolResult, browser.CheckedResult) {
+		t.Helper()
+		res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: name, Arguments: map[string]any{"selector": selector}})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var out browser.CheckedResult
+		data, _ := json.Marshal(res.StructuredContent)
+		_ = json.Unmarshal(data, &out)
+		return res, out
+	}
+	for i, step := range []struct {
+		tool             string
+		checked, changed bool
+	}{
+		{"browser.check", true, true},
+		{"browser.check", true, false},
+		{"browser.uncheck", false, true},
+		{"browser.uncheck", false, false},
+	} {
+		res, out := call(step.tool, "#a")
+		if res.IsError || out.Checked != step.checked || out.Changed != step.changed {
+			t.Fatalf("step %d %s: unexpected result %+v", i, step.tool, out)
+		}
+	}
+	if res, _ := call("browser.check", "#b"); !res.IsError || !strings.Contains(res.Content[0].(*mcp.TextContent).Text, "not_checkable") {
+		t.Fatalf("expected a not_checkable error, got %#v", res.Content)
+	}
+}
+
+func TestSelectForwardsBlurAfter(t *testing.T) {
+	fb := &fakeBrowser{}
+	cs := connect(t, newTestServer(t, fb, Options{}))
+	for _, blur := range []bool{true, false} {
+		res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{
+			Name:      "browser.select",
+			Arguments: map[string]any{"selector": "#size", "value": "m", "blurAfter": blur},
+		})
+		if err != nil || res.IsError {
+			t.Fatalf("select: %v %#v", err, res)
+		}
+	}
+	if len(fb.selects) != 2 || !fb.selects[0].BlurAfter || fb.selects[1].BlurAfter {
+		t.Fatalf("expected blurAfter to reach the browser, got %+v", fb.selects)
+	}
+}
+
+func TestShutdownClosesSessions(t *testing.T) {
+	s := newTestServer(t, &fakeBrowser{}, Options{})
+	ctx := context.Background()
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := s.MCPServer().Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatalf("server connect: %v", err)
+	}
+	notices := make(chan string, 1)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v0.0.1"}, &mcp.ClientOptions{
+		LoggingMessageHandler: func(_ context.Context, req *mcp.LoggingMessageRequest) {
+			msg, _ := req.Params.Data.(string)
+			notices <- msg
+		},
+	})
+	cs, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("client connect: %v", err)
+	}
+	if err := cs.SetLoggingLevel(ctx, &mcp.SetLoggingLevelParams{Level: "info"}); err != nil {
+		t.Fatalf("set logging level: %v", err)
+	}
+
+	if n := s.Shutdown(ctx); n != 1 {
+		t.Fatalf("expected one session closed, got %d", n)
+	}
+	select {
+	case msg := <-notices:
+		if msg != shutdownMessage {
+			t.Fatalf("unexpected notice %q", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected a shutdown notice")
+	}
+	done := make(chan struct{})
+	go func() { _ = cs.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected the client session to end")
+	}
+	if n := s.Shutdown(ctx); n != 0 {
+		t.Fatalf("expected no sessions left, got %d", n)
+	}
+}
+
+func TestConcurrentSnapshotsShareOneCall(t *testing.T) {
+	fb := &fakeBrowser{snapshotGate: make(chan struct{})}
+	s := newTestServer(t, fb, Options{})
+	ctx := browser.WithTarget(context.Background(), browser.Target{SessionID: "s1", TabID: 3})
+	opts := browser.SnapshotOptions{MaxElements: 10}
+
+	const callers = 5
+	var wg sync.WaitGroup
+	results := make([]page.Snapshot, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = s.sharedSnapshot(ctx, opts)
+		}(i)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for fb.snapshotCalls.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("snapshot never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// Give the other callers time to join the in-flight call.
+	time.Sleep(50 * time.Millisecond)
+	close(fb.snapshotGate)
+	wg.Wait()
+
+	if n := fb.snapshotCalls.Load(); n != 1 {
+		t.Fatalf("expected one browser snapshot for %d concurrent callers, got %d", callers, n)
+	}
+	for i := range results {
+		if errs[i] != nil || results[i].ContentHash != results[0].ContentHash {
+			t.Fatalf("caller %d: %v / hash %q", i, errs[i], results[i].ContentHash)
+		}
+	}
+
+	if _, err := s.sharedSnapshot(browser.WithTarget(context.Background(), browser.Target{SessionID: "s1", TabID: 4}), opts); err != nil {
+		t.Fatalf("snapshot of another tab: %v", err)
+	}
+	if n := fb.snapshotCalls.Load(); n != 2 {
+		t.Fatalf("expected another tab to take its own snapshot, got %d calls", n)
+	}
+}
+
+func TestSharedSnapshotSurvivesFirstCallerCancel(t *testing.T) {
+	fb := &fakeBrowser{snapshotGate: make(chan struct{})}
+	s := newTestServer(t, fb, Options{})
+	first, cancel := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := s.sharedSnapshot(first, browser.SnapshotOptions{})
+		firstErr <- err
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for fb.snapshotCalls.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("snapshot never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	second := make(chan error, 1)
+	go func() {
+		_, err := s.sharedSnapshot(context.Background(), browser.SnapshotOptions{})
+		second <- err
+	}()
+	// Give the second caller time to join the in-flight call.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-firstErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the cancelled caller to stop waiting, got %v", err)
+	}
+	close(fb.snapshotGate)
+	if err := <-second; err != nil {
+		t.Fatalf("expected the joined caller to get the snapshot, got %v", err)
+	}
+	if n := fb.snapshotCalls.Load(); n != 1 {
+		t.Fatalf("expected one browser snapshot, got %d", n)
+	}
+}
+
+func TestSharedSnapshotUsesSnapshotTimeout(t *testing.T) {
+	fb := &fakeBrowser{snapshotGate: make(chan struct{})}
+	s := newTestServer(t, fb, Options{ToolTimeouts: map[string]time.Duration{"browser.snapshot": 45 * time.Second}})
+	target := browser.Target{SessionID: "s1", TabID: 3}
+	leader := browser.WithTimeout(traceid.With(browser.WithTarget(context.Background(), target), "leader"), time.Hour)
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.sharedSnapshot(leader, browser.SnapshotOptions{})
+		done <- err
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for fb.snapshotCalls.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("snapshot never started")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// A joiner with a short override stops waiting without cancelling the
+	// shared call.
+	joiner := browser.WithTimeout(traceid.With(browser.WithTarget(context.Background(), target), "joiner"), 20*time.Millisecond)
+	if _, err := s.sharedSnapshot(joiner, browser.SnapshotOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the joiner to time out on its own override, got %v", err)
+	}
+	close(fb.snapshotGate)
+	if err := <-done; err != nil {
+		t.Fatalf("leader: %v", err)
+	}
+
+	ctx := *fb.snapshotCtx.Load()
+	if d, _ := browser.TimeoutFromContext(ctx); d != 45*time.Second {
+		t.Fatalf("expected the configured snapshot timeout, got %s", d)
+	}
+	if got, _ := browser.TargetFromContext(ctx); got != target {
+		t.Fatalf("expected target %+v, got %+v", target, got)
+	}
+	if id, _ := traceid.FromContext(ctx); id != "leader" {
+		t.Fatalf("expected the leader's trace id, got %q", id)
+	}
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatalf("expected no caller deadline on the shared call")
+	}
+}
+
+func TestSharedSnapshotDoesNotCacheErrors(t *testing.T) {
+	fb := &fakeBrowser{snapshotErr: errors.New("extension busy")}
+	s := newTestServer(t, fb, Options{})
+	ctx := context.Background()
+
+	if _, err := s.sharedSnapshot(ctx, browser.SnapshotOptions{}); err == nil {
+		t.Fatalf("expected the first snapshot to fail")
+	}
+	fb.snapshotErr = nil
+	if _, err := s.sharedSnapshot(ctx, browser.SnapshotOptions{}); err != nil {
+		t.Fatalf("expected the retry to reach the browser, got %v", err)
+	}
+	if n := fb.snapshotCalls.Load(); n != 2 {
+		t.Fatalf("expected 2 browser calls, got %d", n)
+	}
+}
+
+func TestReadSnapshotWithLimits(t *testing.T) {
+	cs := connect(t, newTestServer(t, &fakeBrowser{}, Options{}))
+	ctx := context.Background()
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.snapshot", Arguments: map[string]any{}})
+	if err != nil || res.IsError {
+		t.Fatalf("snapshot: %v %#v", err, res)
+	}
+	id := res.StructuredContent.(map[string]any)["snapshot_id"].(string)
+
+	read := func(uri string) page.Snapshot {
+		t.Helper()
+		out, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri})
+		if err != nil {
+			t.Fatalf("read %s: %v", uri, err)
+		}
+		var snap page.Snapshot
+		if err := json.Unmarshal([]byte(out.Contents[0].Text), &snap); err != nil {
+			t.Fatalf("decode %s: %v", uri, err)
+		}
+		return snap
+	}
+
+	short := read("browser://page/" + id + "?maxText=20")
+	longer := read("browser://page/" + id + "?maxText=100")
+	if len(short.Text) != 20 || !short.TextTruncated || len(longer.Text) != 100 {
+		t.Fatalf("expected 20 and 100 characters of text, got %d and %d", len(short.Text), len(longer.Text))
+	}
+	if short.ID != id || longer.ID != id {
+		t.Fatalf("expected the stored id to be kept, got %q / %q", short.ID, longer.ID)
+	}
+	if latest := read("browser://page/latest?maxElements=1"); latest.ElementsReturned != 1 || latest.ElementsTotal != 3 {
+		t.Fatalf("expected latest to be cut to 1 of 3 elements, got %d of %d", latest.ElementsReturned, latest.ElementsTotal)
+	}
+	if full := read("browser://page/latest"); len(full.Text) <= 100 || full.ElementsReturned != 3 {
+		t.Fatalf("expected the stored snapshot to stay complete, got %d chars / %d elements", len(full.Text), full.ElementsReturned)
+	}
+	if _, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: "browser://page/" + id + "?maxText=lots"}); err == nil {
+		t.Fatalf("expected an invalid maxText to be rejected")
+	}
+}
+
+func TestFindScrollTo(t *testing.T) {
+	fb := &fakeBrowser{matches: []string{"#pricing", "#faq"}}
+	cs := connect(t, newTestServer(t, fb, Options{}))
+	ctx := context.Background()
+	find := func(args map[string]any) FindOutput {
+		t.Helper()
+		res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.find", Arguments: args})
+		if err != nil || res.IsError {
+			t.Fatalf("find: %v %#v", err, res)
+		}
+		var out FindOutput
+		data, _ := json.Marshal(res.StructuredContent)
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatalf("decode find: %v", err)
+		}
+		return out
+	}
+
+	out := find(map[string]any{"text": "pricing"})
+	if out.Results[0].Selector != "" || out.Results[0].Rect != nil || out.ScrolledTo != nil || len(fb.scrolls) != 0 {
+		t.Fatalf("expected no positions or scrolling by default, got %#v", out)
+	}
+
+	out = find(map[string]any{"text": "pricing", "includePositions": true})
+	if out.Results[1].Selector != "#faq" || out.Results[1].Rect == nil || out.Results[1].Rect.Y != 2000 || len(fb.scrolls) != 0 {
+		t.Fatalf("expected positions without scrolling, got %#v", out)
+	}
+
+	out = find(map[string]any{"text": "pricing", "scrollTo": true})
+	if len(fb.scrolls) != 1 || fb.scrolls[0].Selector != "#pricing" || fb.scrolls[0].Block != "center" {
+		t.Fatalf("expected one scroll to the first match, got %#v", fb.scrolls)
+	}
+	if out.ScrolledTo == nil || out.ScrolledTo.Selector != "#pricing" || out.ScrolledTo.Rect == nil || out.ScrolledTo.Rect.Y != 1000 {
+		t.Fatalf("expected the scrolled-to match and its position, got %#v", out.ScrolledTo)
+	}
+
+	fb.matches = nil
+	out = find(map[string]any{"text": "missing", "scrollTo": true})
+	if out.ScrolledTo != nil || len(fb.scrolls) != 1 {
+		t.Fatalf("expected no scroll without a match, got %#v", fb.scrolls)
+	}
+}
+
+func TestWaitForURL(t *testing.T) {
+	fb := &fakeBrowser{}
+	cs := connect(t, newTestServer(t, fb, Options{ToolTimeouts: map[string]time.Duration{"browser.wait_for_url": 20 * time.Second}}))
+	ctx := context.Background()
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.wait_for_url", Arguments: map[string]any{"pattern": "**/success"}})
+	if err != nil || res.IsError {
+		t.Fatalf("wait_for_url: %v %#v", err, res)
+	}
+	var out browser.WaitForURLResult
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &out); err != nil || !out.Matched || out.URL != "https://example.com/done/success" {
+		t.Fatalf("unexpected result %s", data)
+	}
+	if len(fb.urlWaits) != 1 || fb.urlWaits[0].TimeoutMs != 20000 {
+		t.Fatalf("expected the configured timeout as the default, got %+v", fb.urlWaits)
+	}
+
+	for _, args := range []map[string]any{
+		{"pattern": "(unclosed", "match": "regex"},
+		{"pattern": "**/x", "match": "prefix"},
+		{"pattern": ""},
+	} {
+		res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.wait_for_url", Arguments: args})
+		if err != nil || !res.IsError {
+			t.Fatalf("%v: expected a validation error, got %v %#v", args, err, res)
+		}
+	}
+	if len(fb.urlWaits) != 1 {
+		t.Fatalf("invalid patterns reached the browser: %+v", fb.urlWaits)
+	}
+}
+
+func TestScreenshotAnnotate(t *testing.T) {
+	cs := connect(t, newTestServer(t, &fakeBrowser{}, Options{}))
+	ctx := context.Background()
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.screenshot", Arguments: map[string]any{"selector": "#a", "annotate": true}})
+	if err != nil || res.IsError {
+		t.Fatalf("screenshot: %v %#v", err, res)
+	}
+	var out ScreenshotOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Box == nil || *out.Box != (browser.Rect{X: 10, Y: 20, Width: 30, Height: 40}) || len(out.Warnings) != 0 {
+		t.Fatalf("unexpected annotated screenshot %s", data)
+	}
+
+	res, err = cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.screenshot", Arguments: map[string]any{"annotate": true}})
+	if err != nil || !res.IsError {
+		t.Fatalf("expected annotate without a selector to fail: %v %#v", err, res)
+	}
+}
+
+func TestScreenshotInline(t *testing.T) {
+	cs := connect(t, newTestServer(t, &fakeBrowser{}, Options{}))
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.screenshot", Arguments: map[string]any{"inline": true}})
+	if err != nil || res.IsError {
+		t.Fatalf("inline screenshot: %v %#v", err, res)
+	}
+	out := res.StructuredContent.(map[string]any)
+	if got, _ := out["dataUrl"].(string); !strings.HasPrefix(got, "data:image/png;base64,") || out["screenshotId"] == nil {
+		t.Fatalf("expected both dataUrl and screenshotId with inline, got %#v", out)
+	}
+}
+
+func TestScreenshotStorageDisabled(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cs := connect(t, New(&fakeBrowser{}, page.NewDisabledStore(), Options{}))
+	ctx := context.Background()
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.screenshot", Arguments: map[string]any{}})
+	if err != nil || res.IsError {
+		t.Fatalf("screenshot: %v %#v", err, res)
+	}
+	out := res.StructuredContent.(map[string]any)
+	if got, _ := out["dataUrl"].(string); !strings.HasPrefix(got, "data:image/png;base64,") || out["screenshotId"] != nil || out["warnings"] != nil {
+		t.Fatalf("expected only an inline dataUrl with storage disabled, got %#v", out)
+	}
+	if _, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: "browser://screenshot/list"}); err == nil {
+		t.Fatalf("expected browser://screenshot/list to be unavailable")
+	}
+}
+
+func TestScreenshotResources(t *testing.T) {
+	s := newTestServer(t, &fakeBrowser{}, Options{})
+	cs := connect(t, s)
+	ctx := context.Background()
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.screenshot", Arguments: map[string]any{"selector": "#chart"}})
+	if err != nil || res.IsError {
+		t.Fatalf("screenshot: %v %#v", err, res)
+	}
+	id, _ := res.StructuredContent.(map[string]any)["screenshotId"].(string)
+	if id == "" {
+		t.Fatalf("expected a screenshotId, got %#v", res.StructuredContent)
+	}
+	if _, ok := res.StructuredContent.(map[string]any)["dataUrl"]; ok {
+		t.Fatalf("expected no inline image by default, got %#v", res.StructuredContent)
+	}
+
+	out, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: "browser://screenshot/" + id})
+	if err != nil {
+		t.Fatalf("read screenshot: %v", err)
+	}
+	got := out.Contents[0]
+	if got.MIMEType != "image/png" || string(got.Blob) != "png-bytes" || got.Meta["selector"] != "#chart" {
+		t.Fatalf("unexpected screenshot resource %#v", got)
+	}
+
+	out, err = cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: "browser://screenshot/list"})
+	if err != nil {
+		t.Fatalf("read list: %v", err)
+	}
+	var list []screenshotListEntry
+	if err := json.Unmarshal([]byte(out.Contents[0].Text), &list); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(list) != 1 || list[0].ID != id || list[0].URI != "browser://screenshot/"+id || list[0].Size != len("png-bytes") || list[0].Width != 4 {
+		t.Fatalf("unexpected list %#v", list)
+	}
+
+	if _, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: "browser://screenshot/nope"}); err == nil {
+		t.Fatalf("expected an unknown screenshot to fail")
+	}
+	big := s.screenshots.Put(screenshot.Shot{MIMEType: "image/png", Data: make([]byte, maxScreenshotRead+1)})
+	if _, err := cs.ReadResource(ctx, &mcp.ReadResourceParams{URI: "browser://screenshot/" + big.ID}); err == nil || !strings.Contains(err.Error(), "read limit") {
+		t.Fatalf("expected the read limit to be enforced, got %v", err)
+	}
+}
+
+type headerTransport struct {
+	header http.Header
+	next   http.RoundTripper
+}
+
+func (h headerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	for k, v := range h.header {
+		r.Header[k] = v
+	}
+	return h.next.RoundTrip(r)
+}
+
+// connectHTTP connects over the streamable HTTP transport, identifying as
+// clientID the way mcpd's clients do.
+func connectHTTP(t *testing.T, s *Server, clientID string) *mcp.ClientSession {
+	t.Helper()
+	handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return s.MCPServer() }, nil)
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	transport := &mcp.StreamableClientTransport{
+		Endpoint: srv.URL,
+		HTTPClient: &http.Client{Transport: headerTransport{
+			header: http.Header{"X-Client-Id": {clientID}},
+			next:   http.DefaultTransport,
+		}},
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: clientID, Version: "v0.0.1"}, nil)
+	cs, err := client.Connect(context.Background(), transport, nil)
+	if err != nil {
+		t.Fatalf("client connect: %v", err)
+	}
+	t.Cleanup(func() { _ = cs.Close() })
+	return cs
+}
+
+func TestToolRateLimitPerClient(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := newTestServer(t, &fakeBrowser{}, Options{})
+	s.limiter = newRateLimiter(1, 2, func() time.Time { return now })
+	greedy := connectHTTP(t, s, "greedy")
+	polite := connectHTTP(t, s, "polite")
+	call := func(cs *mcp.ClientSession) *mcp.CallToolResult {
+		t.Helper()
+		res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.clear_target", Arguments: map[string]any{}})
+		if err != nil {
+			t.Fatalf("call clear_target: %v", err)
+		}
+		return res
+	}
+
+	for i := 0; i < 2; i++ {
+		if res := call(greedy); res.IsError {
+			t.Fatalf("call %d within the burst failed: %#v", i+1, res.Content)
+		}
+	}
+	res := call(greedy)
+	if !res.IsError || len(res.Content) != 1 {
+		t.Fatalf("expected a rate_limited error, got %#v", res)
+	}
+	out := errorBody(t, res)
+	if out["error"] != "rate_limited" || out["rate"] != 1.0 || out["burst"] != 2.0 || out["retryAfterMs"] != 1000.0 || out["traceId"] == nil {
+		t.Fatalf("unexpected rate_limited body %#v", out)
+	}
+
+	if res := call(polite); res.IsError {
+		t.Fatalf("another client was throttled: %#v", res.Content)
+	}
+	if _, err := greedy.ReadResource(context.Background(), &mcp.ReadResourceParams{URI: "browser://screenshot/list"}); err != nil {
+		t.Fatalf("resource read was throttled: %v", err)
+	}
+
+	now = now.Add(time.Second)
+	if res := call(greedy); res.IsError {
+		t.Fatalf("expected a token after a second: %#v", res.Content)
+	}
+}
+
+// switchingTransport sends whatever X-Client-Id is current, so a test can
+// change it mid-session.
+type switchingTransport struct {
+	id *atomic.Pointer[string]
+}
+
+func (s switchingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("X-Client-Id", *s.id.Load())
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestToolRateLimitIgnoresClientIDHeader(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := newTestServer(t, &fakeBrowser{}, Options{})
+	s.limiter = newRateLimiter(1, 1, func() time.Time { return now })
+	srv := httptest.NewServer(mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return s.MCPServer() }, nil))
+	t.Cleanup(srv.Close)
+	var id atomic.Pointer[string]
+	first := "first"
+	id.Store(&first)
+	transport := &mcp.StreamableClientTransport{Endpoint: srv.URL, HTTPClient: &http.Client{Transport: switchingTransport{id: &id}}}
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "switcher", Version: "v0.0.1"}, nil).Connect(context.Background(), transport, nil)
+	if err != nil {
+		t.Fatalf("client connect: %v", err)
+	}
+	t.Cleanup(func() { _ = cs.Close() })
+	call := func() *mcp.CallToolResult {
+		t.Helper()
+		res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.clear_target", Arguments: map[string]any{}})
+		if err != nil {
+			t.Fatalf("call clear_target: %v", err)
+		}
+		return res
+	}
+	if res := call(); res.IsError {
+		t.Fatalf("first call failed: %#v", res.Content)
+	}
+	second := "second"
+	id.Store(&second)
+	if res := call(); !res.IsError {
+		t.Fatalf("expected a new client id on the same session to stay rate limited")
+	}
+}
+
+func TestRateLimiterSweepsIdleBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := newRateLimiter(1, 1, func() time.Time { return now })
+	l.take("gone")
+	now = now.Add(bucketSweepInterval)
+	l.take("active")
+	if _, ok := l.buckets["gone"]; ok || len(l.buckets) != 1 {
+		t.Fatalf("expected the refilled bucket to be swept, got %v", l.buckets)
+	}
+}
+
+func TestNewRateLimiterDefaults(t *testing.T) {
+	if newRateLimiter(0, 5, nil) != nil {
+		t.Fatal("expected a zero rate to be unlimited")
+	}
+	if l := newRateLimiter(2.5, 0, nil); l.burst != 3 {
+		t.Fatalf("burst = %g, want the rate rounded up", l.burst)
+	}
+}
+
+func TestElementToolsResolveRefs(t *testing.T) {
+	fb := &fakeBrowser{}
+	s := newTestServer(t, fb, Options{})
+	cs := connect(t, s)
+	ctx := context.Background()
+	call := func(name string, args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+		if err != nil {
+			t.Fatalf("call %s: %v", name, err)
+		}
+		return res
+	}
+	errText := func(res *mcp.CallToolResult) string {
+		t.Helper()
+		if !res.IsError {
+			t.Fatalf("expected an error result, got %#v", res)
+		}
+		return res.Content[0].(*mcp.TextContent).Text
+	}
+
+	res := call("browser.snapshot", map[string]any{})
+	var snap SnapshotOutput
+	raw, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if len(snap.Elements) != 3 || snap.Elements[1].Ref != "e2" || snap.Actions[1].Ref != "e2" {
+		t.Fatalf("expected refs on elements and actions, got %+v / %+v", snap.Elements, snap.Actions)
+	}
+
+	call("browser.click", map[string]any{"ref": "e2"})
+	call("browser.hover", map[string]any{"ref": "e3", "snapshotId": snap.SnapshotID})
+	call("browser.type", map[string]any{"ref": "e1", "text": "hi"})
+	call("browser.select", map[string]any{"ref": "e3", "value": "x"})
+	call("browser.click", map[string]any{"selector": "#plain"})
+	want := []string{"#b", "#c", "#a", "#c", "#plain"}
+	if !slices.Equal(fb.selectors, want) {
+		t.Fatalf("selectors sent = %v, want %v", fb.selectors, want)
+	}
+
+	if msg := errText(call("browser.click", map[string]any{"ref": "e99"})); !strings.Contains(msg, "unknown ref") {
+		t.Fatalf("unexpected error for an unknown ref: %s", msg)
+	}
+	if msg := errText(call("browser.click", map[string]any{"ref": "e1", "selector": "#a"})); !strings.Contains(msg, "not both") {
+		t.Fatalf("unexpected error for ref and selector: %s", msg)
+	}
+	if msg := errText(call("browser.type", map[string]any{"text": "hi"})); !strings.Contains(msg, "selector or ref is required") {
+		t.Fatalf("unexpected error without a target: %s", msg)
+	}
+	if msg := errText(call("browser.hover", map[string]any{"ref": "e1", "snapshotId": "nope"})); !strings.Contains(msg, "unknown snapshot") {
+		t.Fatalf("unexpected error for an unknown snapshot: %s", msg)
+	}
+
+	// Stand in for this client taking a snapshot of a changed page.
+	next := s.store.Put(page.Snapshot{URL: "https://example.com/next"})
+	s.refsMu.Lock()
+	for key := range s.refSnapshots {
+		s.refSnapshots[key] = next
+	}
+	s.refsMu.Unlock()
+	msg := errText(call("browser.select", map[string]any{"ref": "e1", "snapshotId": snap.SnapshotID, "value": "x"}))
+	if !strings.Contains(msg, "stale ref") {
+		t.Fatalf("unexpected error for a stale snapshot: %s", msg)
+	}
+	if len(fb.selectors) != len(want) {
+		t.Fatalf("failed resolutions reached the browser: %v", fb.selectors)
+	}
+}
+
+func TestRefsResolveAgainstOwnSnapshot(t *testing.T) {
+	fb := &fakeBrowser{}
+	s := newTestServer(t, fb, Options{})
+	alice := connectHTTP(t, s, "alice")
+	bob := connectHTTP(t, s, "bob")
+	ctx := context.Background()
+	if res, err := alice.CallTool(ctx, &mcp.CallToolParams{Name: "browser.snapshot", Arguments: map[string]any{}}); err != nil || res.IsError {
+		t.Fatalf("snapshot: %v %#v", err, res)
+	}
+	res, err := bob.CallTool(ctx, &mcp.CallToolParams{Name: "browser.click", Arguments: map[string]any{"ref": "e1"}})
+	if err != nil {
+		t.Fatalf("click: %v", err)
+	}
+	if !res.IsError || !strings.Contains(res.Content[0].(*mcp.TextContent).Text, "not taken a snapshot") {
+		t.Fatalf("expected bob's ref not to resolve against alice's snapshot, got %#v", res.Content)
+	}
+	if res, err := alice.CallTool(ctx, &mcp.CallToolParams{Name: "browser.click", Arguments: map[string]any{"ref": "e1"}}); err != nil || res.IsError {
+		t.Fatalf("expected alice's ref to resolve: %v %#v", err, res)
+	}
+	if !slices.Equal(fb.selectors, []string{"#a"}) {
+		t.Fatalf("selectors sent = %v", fb.selectors)
+	}
+}
+
+func TestElementRefsNeedSnapshotStorage(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cs := connect(t, New(&fakeBrowser{}, page.NewDisabledStore(), Options{}))
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.click", Arguments: map[string]any{"ref": "e1"}})
+	if err != nil {
+		t.Fatalf("call click: %v", err)
+	}
+	if !res.IsError || !strings.Contains(res.Content[0].(*mcp.TextContent).Text, "disabled") {
+		t.Fatalf("expected a storage-disabled error, got %#v", res.Content)
+	}
+}
+
+// pageAfterClick serves one page until Click is called and another after.
+type pageAfterClick struct {
+	*fakeBrowser
+	clicked bool
+}
+
+func (b *pageAfterClick) Click(ctx context.Context, selector string) (browser.ClickResult, error) {
+	b.clicked = true
+	return b.fakeBrowser.Click(ctx, selector)
+}
+
+func (b *pageAfterClick) Snapshot(_ context.Context, opts browser.SnapshotOptions) (page.Snapshot, error) {
+	raw := page.RawPage{URL: "https://example.com/cart", HTML: `<button id="add">Add to cart</button><a id="checkout" href="/checkout">Checkout</a>`}
+	if b.clicked {
+		raw.URL = "https://example.com/checkout"
+		raw.HTML = `<button id="add">Add to cart</button><input name="email"><button id="pay">Pay</button>`
+	}
+	return opts.Reducer.Reduce(raw), nil
+}
+
+func TestActClickThenSnapshot(t *testing.T) {
+	fb := &pageAfterClick{fakeBrowser: &fakeBrowser{}}
+	reducer := page.NewReducer(page.ReduceOptions{})
+	s := newTestServer(t, fb, Options{Reducer: reducer})
+	id := s.store.Put(reducer.Reduce(page.RawPage{URL: "https://example.com/cart", HTML: `<button id="add">Add to cart</button><a id="checkout" href="/checkout">Checkout</a>`}))
+	// As if the client had taken this snapshot; an in-memory client has no
+	// session id, so its key is empty.
+	s.refSnapshots[""] = id
+	cs := connect(t, s)
+
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.act", Arguments: map[string]any{
+		"verb":     "click",
+		"ref":      "e2",
+		"settleMs": 1,
+		"snapshot": map[string]any{"maxText": 100},
+	}})
+	if err != nil {
+		t.Fatalf("call act: %v", err)
+	}
+	if res.IsError {
+		t.Fatalf("act failed: %#v", res.Content)
+	}
+	var out ActOutput
+	raw, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatalf("decode act output: %v", err)
+	}
+	if out.Verb != "click" || out.Selector != "#checkout" || !slices.Equal(fb.selectors, []string{"#checkout"}) {
+		t.Fatalf("expected a click on #checkout, got %+v (sent %v)", out, fb.selectors)
+	}
+	if out.Snapshot.URL != "https://example.com/checkout" || out.Snapshot.SnapshotID == "" {
+		t.Fatalf("expected the post-click snapshot, got %+v", out.Snapshot)
+	}
+	if latest, _ := s.store.Latest(); latest.ID != out.Snapshot.SnapshotID {
+		t.Fatal("expected the post-click snapshot to be stored for its refs")
+	}
+	d := out.Diff
+	if !d.URLChanged || d.FromURL != "https://example.com/cart" || d.AddedCount != 2 || d.RemovedCount != 1 || d.ChangedCount != 0 {
+		t.Fatalf("unexpected diff %+v", d)
+	}
+	if d.Added[0].Selector != `input[name="email"]` || d.Added[0].Ref != "e2" || d.Removed[0].Selector != "#checkout" {
+		t.Fatalf("unexpected diff elements %+v / %+v", d.Added, d.Removed)
+	}
+	if !strings.Contains(d.Summary, "navigated to https://example.com/checkout") {
+		t.Fatalf("unexpected summary %q", d.Summary)
+	}
+}
+
+func TestActRejectsUnknownVerb(t *testing.T) {
+	fb := &fakeBrowser{}
+	cs := connect(t, newTestServer(t, fb, Options{}))
+	res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.act", Arguments: map[string]any{"verb": "drag", "selector": "#a"}})
+	if err != nil {
+		t.Fatalf("call act: %v", err)
+	}
+	if !res.IsError || fb.snapshotCalls.Load() != 0 {
+		t.Fatalf("expected an error before touching the browser, got %#v", res.Content)
+	}
+}
+
+func TestSnapshotDebug(t *testing.T) {
+	cs := connect(t, newTestServer(t, &fakeBrowser{}, Options{}))
+	ctx := context.Background()
+	snapshot := func(args map[string]any) SnapshotOutput {
+		t.Helper()
+		res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.snapshot", Arguments: args})
+		if err != nil || res.IsError {
+			t.Fatalf("snapshot: %v %#v", err, res)
+		}
+		var out SnapshotOutput
+		data, _ := json.Marshal(res.StructuredContent)
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatalf("decode snapshot: %v", err)
+		}
+		return out
+	}
+
+	if out := snapshot(map[string]any{}); out.Debug != nil {
+		t.Fatalf("expected no debug info by default, got %+v", out.Debug)
+	}
+	out := snapshot(map[string]any{"debug": true})
+	if out.Debug == nil || out.Debug.ElementSource != page.ElementSourceHTML || out.Debug.HTMLBytes == 0 || out.Debug.ElementsReturned != 3 {
+		t.Fatalf("unexpected debug info %+v", out.Debug)
+	}
+}
+
+func TestIdempotencyKeyReplaysResult(t *testing.T) {
+	fb := &fakeBrowser{}
+	s := newTestServer(t, fb, Options{})
+	alice := connectHTTP(t, s, "alice")
+	bob := connectHTTP(t, s, "bob")
+	click := func(cs *mcp.ClientSession, args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		res, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.click", Arguments: args})
+		if err != nil {
+			t.Fatalf("call click: %v", err)
+		}
+		return res
+	}
+	args := map[string]any{"selector": "#submit", "idempotencyKey": "order-1"}
+
+	first := click(alice, args)
+	retry := click(alice, args)
+	if first.IsError || retry.IsError {
+		t.Fatalf("unexpected error results: %#v / %#v", first.Content, retry.Content)
+	}
+	if len(fb.selectors) != 1 {
+		t.Fatalf("expected the retry not to click again, got %d clicks", len(fb.selectors))
+	}
+	if retry.Meta["idempotentReplay"] != true || first.Meta["idempotentReplay"] != nil {
+		t.Fatalf("expected only the retry to be marked as a replay: %v / %v", first.Meta, retry.Meta)
+	}
+	var out ClickOutput
+	data, _ := json.Marshal(retry.StructuredContent)
+	if err := json.Unmarshal(data, &out); err != nil || out.Status != "ok" || out.Selector != "#submit" {
+		t.Fatalf("expected the first result to be replayed, got %s", data)
+	}
+
+	if res := click(bob, args); res.IsError || len(fb.selectors) != 2 {
+		t.Fatalf("expected another client's key to be separate, got %d clicks", len(fb.selectors))
+	}
+	if res := click(alice, map[string]any{"selector": "#cancel", "idempotencyKey": "order-1"}); !res.IsError || len(fb.selectors) != 2 {
+		t.Fatalf("expected reusing a key for other arguments to fail, got %#v", res.Content)
+	}
+	if res := click(alice, map[string]any{"selector": "#submit"}); res.IsError || len(fb.selectors) != 3 {
+		t.Fatalf("expected a call without a key to run, got %d clicks", len(fb.selectors))
+	}
+
+	fb.clickErr = errors.New("boom")
+	failing := map[string]any{"selector": "#submit", "idempotencyKey": "order-2"}
+	if res := click(alice, failing); !res.IsError {
+		t.Fatalf("expected the click to fail")
+	}
+	fb.clickErr = nil
+	if res := click(alice, failing); res.IsError || len(fb.selectors) != 5 {
+		t.Fatalf("expected a failed call to be retried, got %d clicks", len(fb.selectors))
+	}
+}
+
+func TestIdempotencyKeyExpires(t *testing.T) {
+	now := time.Unix(0, 0)
+	fb := &fakeBrowser{}
+	s := newTestServer(t, fb, Options{})
+	s.idempotency = newIdempotencyCache(time.Minute, func() time.Time { return now })
+	cs := connect(t, s)
+	args := map[string]any{"url": "https://example.com", "idempotencyKey": "k"}
+	for i := range 2 {
+		if _, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.open_tab", Arguments: args}); err != nil {
+			t.Fatalf("call %d: %v", i, err)
+		}
+	}
+	if len(fb.tabs) != 1 {
+		t.Fatalf("expected one tab within the TTL, got %d", len(fb.tabs))
+	}
+	now = now.Add(time.Minute)
+	if _, err := cs.CallTool(context.Background(), &mcp.CallToolParams{Name: "browser.open_tab", Arguments: args}); err != nil {
+		t.Fatalf("call after expiry: %v", err)
+	}
+	if len(fb.tabs) != 2 {
+		t.Fatalf("expected the key to expire, got %d tabs", len(fb.tabs))
+	}
+}
+
+func TestIdempotentToolsTakeKey(t *testing.T) {
+	cs := connect(t, newTestServer(t, nil, Options{AllowEvaluate: true}))
+	res, err := cs.ListTools(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	for _, tool := range res.Tools {
+		schema, _ := tool.InputSchema.(map[string]any)
+		props, _ := schema["properties"].(map[string]any)
+		_, hasKey := props["idempotencyKey"]
+		if hasKey != slices.Contains(idempotentTools, tool.Name) {
+			t.Fatalf("%s: idempotencyKey in schema is %v, but listed in idempotentTools is %v", tool.Name, hasKey, !hasKey)
+		}
+	}
+}
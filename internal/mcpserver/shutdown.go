@@ -0,0 +1,29 @@
+package mcpserver
+
+import (
+	"context"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// shutdownMessage is logged to each client before its session is closed.
+const shutdownMessage = "server is shutting down; reconnect to continue"
+
+// Shutdown tells each connected client that the server is going away and
+// closes its session, so the client sees its stream end cleanly instead of a
+// dropped connection. The notice is a log message, which only reaches clients
+// that have set a log level. Shutdown stops early when ctx ends and returns
+// how many sessions it closed.
+func (s *Server) Shutdown(ctx context.Context) int {
+	closed := 0
+	for ss := range s.mcpServer.Sessions() {
+		if ctx.Err() != nil {
+			break
+		}
+		_ = ss.Log(ctx, &mcp.LoggingMessageParams{Level: "warning", Logger: "surfingbro", Data: shutdownMessage})
+		if err := ss.Close(); err == nil {
+			closed++
+		}
+	}
+	return closed
+}
@@ -0,0 +1,67 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+	"github.com/adityalohuni/mcp-server/internal/page"
+	"github.com/adityalohuni/mcp-server/internal/traceid"
+)
+
+// sharedResult is what a shared snapshot hands every caller: the snapshot
+// and the trace id of the call that took it.
+type sharedResult struct {
+	snap    page.Snapshot
+	traceID string
+}
+
+// sharedSnapshot takes a snapshot, letting concurrent calls for the same
+// target and options share one extension round trip. Nothing outlives the
+// call, so a failed snapshot is retried by the next caller.
+//
+// The shared call does not run on any caller's context, so one caller giving
+// up does not fail the others. It carries the target, the first caller's
+// trace id and the configured browser.snapshot timeout (the browser's default
+// when none is set); a caller's own timeout override only bounds how long
+// that caller waits. Callers that join log the trace id of the command they
+// waited on.
+func (s *Server) sharedSnapshot(ctx context.Context, opts browser.SnapshotOptions) (page.Snapshot, error) {
+	target, _ := browser.TargetFromContext(ctx)
+	traceID, _ := traceid.FromContext(ctx)
+	key := fmt.Sprintf("%s|%d|%t|%d|%d|%t|%d|%d|%t|%p",
+		target.SessionID, target.TabID,
+		opts.IncludeHidden, opts.MaxElements, opts.MaxText,
+		opts.IncludeHTML, opts.MaxHTML, opts.MaxHTMLTokens,
+		opts.IncludeValues, opts.Reducer)
+	ch := s.snapshots.DoChan(key, func() (any, error) {
+		shared := browser.WithTarget(context.Background(), target)
+		if traceID != "" {
+			shared = traceid.With(shared, traceID)
+		}
+		if d, ok := s.toolTimeouts["browser.snapshot"]; ok {
+			shared = browser.WithTimeout(shared, d)
+		}
+		snap, err := s.browser.Snapshot(shared, opts)
+		return sharedResult{snap: snap, traceID: traceID}, err
+	})
+	if d, ok := browser.TimeoutFromContext(ctx); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	select {
+	case res := <-ch:
+		out := res.Val.(sharedResult)
+		if out.traceID != traceID {
+			log.Printf("snapshot shared: trace=%s joined trace=%s", traceID, out.traceID)
+		}
+		if res.Err != nil {
+			return page.Snapshot{}, res.Err
+		}
+		return out.snap, nil
+	case <-ctx.Done():
+		return page.Snapshot{}, ctx.Err()
+	}
+}
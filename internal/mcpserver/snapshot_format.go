@@ -0,0 +1,110 @@
+package mcpserver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adityalohuni/mcp-server/internal/page"
+)
+
+// applySnapshotFormat replaces the structured fields of out with the
+// rendering format asks for.
+func applySnapshotFormat(out *SnapshotOutput, format string) {
+	switch format {
+	case page.FormatMarkdown:
+		out.Format = format
+		out.Markdown = snapshotMarkdown(*out)
+		out.Text, out.MainText = "", ""
+		out.Elements, out.Actions = nil, nil
+	case page.FormatOutline:
+		out.Format = format
+		out.Outline = snapshotOutline(out.Elements)
+		out.Elements, out.Actions = nil, nil
+	}
+}
+
+func snapshotMarkdown(out SnapshotOutput) string {
+	var b strings.Builder
+	if out.Title != "" {
+		fmt.Fprintf(&b, "# %s\n\n", out.Title)
+	}
+	fmt.Fprintf(&b, "<%s>\n", out.URL)
+	text := out.MainText
+	if text == "" {
+		text = out.Text
+	}
+	if text != "" {
+		fmt.Fprintf(&b, "\n%s\n", text)
+	}
+	if len(out.Actions) > 0 {
+		b.WriteString("\n## Actions\n\n")
+		for _, a := range out.Actions {
+			fmt.Fprintf(&b, "- `%s` %s", a.Ref, a.Verb)
+			if a.Label != "" {
+				fmt.Fprintf(&b, " %q", a.Label)
+			}
+			if a.Hint != "" {
+				fmt.Fprintf(&b, " (%s)", a.Hint)
+			}
+			if a.Disabled {
+				b.WriteString(" [disabled]")
+			}
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+func snapshotOutline(elements []page.Element) string {
+	var b strings.Builder
+	for _, el := range elements {
+		fmt.Fprintf(&b, "%s %s", el.Ref, elementRole(el))
+		if name := elementName(el); name != "" {
+			fmt.Fprintf(&b, " %q", name)
+		}
+		if el.Href != "" {
+			fmt.Fprintf(&b, " -> %s", el.Href)
+		}
+		if el.Disabled {
+			b.WriteString(" [disabled]")
+		}
+		if el.Visible != nil && !*el.Visible {
+			b.WriteString(" [hidden]")
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// elementRole is the implicit ARIA role of the common actionable tags.
+func elementRole(el page.Element) string {
+	switch el.Tag {
+	case "a":
+		return "link"
+	case "select":
+		return "combobox"
+	case "textarea":
+		return "textbox"
+	case "input":
+		switch el.InputType {
+		case "checkbox", "radio":
+			return el.InputType
+		case "submit", "button", "reset", "image":
+			return "button"
+		default:
+			return "textbox"
+		}
+	case "":
+		return "element"
+	}
+	return el.Tag
+}
+
+func elementName(el page.Element) string {
+	for _, v := range []string{el.ARIALabel, el.Text, el.Title, el.Alt, el.Placeholder, el.Name} {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package mcpserver
+
+import (
+	"context"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+)
+
+type ClearStorageInput struct {
+	TargetInput
+	IdempotencyInput
+	Cookies        bool `json:"cookies,omitempty" jsonschema:"clear cookies for the current origin"`
+	LocalStorage   bool `json:"localStorage,omitempty" jsonschema:"clear localStorage for the current origin"`
+	SessionStorage bool `json:"sessionStorage,omitempty" jsonschema:"clear sessionStorage for the current origin"`
+	Cache          bool `json:"cache,omitempty" jsonschema:"clear the HTTP cache for the current origin"`
+}
+
+func (s *Server) clearStorage(ctx context.Context, req *mcp.CallToolRequest, input ClearStorageInput) (*mcp.CallToolResult, browser.ClearStorageResult, error) {
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	out, err := s.browser.ClearStorage(ctx, browser.ClearStorageOptions{
+		Cookies:        input.Cookies,
+		LocalStorage:   input.LocalStorage,
+		SessionStorage: input.SessionStorage,
+		Cache:          input.Cache,
+	})
+	if err != nil {
+		return nil, browser.ClearStorageResult{}, err
+	}
+	return nil, out, nil
+}
+
+const (
+	defaultStorageBytes = 64 << 10
+	maxStorageBytes     = 1 << 20
+)
+
+type GetStorageInput struct {
+	TargetInput
+	Kind     string `json:"kind,omitempty" jsonschema:"local for localStorage (default) or session for sessionStorage"`
+	Key      string `json:"key,omitempty" jsonschema:"key to read; omit to list every key and value"`
+	MaxBytes int    `json:"maxBytes,omitempty" jsonschema:"max bytes of keys and values to return (default 65536, max 1048576)"`
+}
+
+type GetStorageOutput struct {
+	browser.StorageResult
+	Warnings []string `json:"warnings,omitempty" jsonschema:"non-fatal problems with the request, such as clamped limits"`
+}
+
+func (s *Server) getStorage(ctx context.Context, req *mcp.CallToolRequest, input GetStorageInput) (*mcp.CallToolResult, GetStorageOutput, error) {
+	var warn warnings
+	limit := warn.clamp("maxBytes", input.MaxBytes, maxStorageBytes)
+	if limit == 0 {
+		limit = defaultStorageBytes
+	}
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	out, err := s.browser.GetStorage(ctx, browser.GetStorageOptions{
+		Kind:     storageKind(input.Kind),
+		Key:      input.Key,
+		MaxBytes: limit,
+	})
+	if err != nil {
+		return nil, GetStorageOutput{}, err
+	}
+	return nil, GetStorageOutput{StorageResult: out, Warnings: warn}, nil
+}
+
+type SetStorageInput struct {
+	TargetInput
+	IdempotencyInput
+	Kind   string `json:"kind,omitempty" jsonschema:"local for localStorage (default) or session for sessionStorage"`
+	Key    string `json:"key" jsonschema:"key to set or remove"`
+	Value  string `json:"value,omitempty" jsonschema:"value to store; storage only holds strings, so JSON-encode objects"`
+	Remove bool   `json:"remove,omitempty" jsonschema:"remove the key instead of setting it"`
+}
+
+func (s *Server) setStorage(ctx context.Context, req *mcp.CallToolRequest, input SetStorageInput) (*mcp.CallToolResult, browser.SetStorageResult, error) {
+	ctx = s.withTarget(ctx, req, input.TargetInput)
+	out, err := s.browser.SetStorage(ctx, browser.SetStorageOptions{
+		Kind:   storageKind(input.Kind),
+		Key:    input.Key,
+		Value:  input.Value,
+		Remove: input.Remove,
+	})
+	if err != nil {
+		return nil, browser.SetStorageResult{}, err
+	}
+	return nil, out, nil
+}
+
+// storageKind defaults an empty kind to localStorage.
+func storageKind(kind string) string {
+	if kind == "" {
+		return browser.StorageLocal
+	}
+	return kind
+}
@@ -0,0 +1,107 @@
+package mcpserver
+
+import (
+	"context"
+	"errors"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// defaultClientIDHeaders are checked, in order, to identify the calling MCP
+// client over HTTP transports when Options.ClientIDHeaders is empty. They
+// match mcpd's defaults for its registry.
+var defaultClientIDHeaders = []string{"X-Client-Id", "X-MCP-Client-Id"}
+
+// clientKey identifies the MCP client behind a tool call so per-client state
+// can be kept. It prefers a client id header, then the transport session id.
+// Stdio clients have neither and share the "" key, which is fine since a stdio
+// server only ever has one client.
+func (s *Server) clientKey(req *mcp.CallToolRequest) string {
+	if req == nil {
+		return ""
+	}
+	if req.Extra != nil && req.Extra.Header != nil {
+		for _, h := range s.idHeaders {
+			if v := req.Extra.Header.Get(h); v != "" {
+				return v
+			}
+		}
+	}
+	if req.Session != nil {
+		return req.Session.ID()
+	}
+	return ""
+}
+
+// watchClients notes the session behind each tool call. The first call on a
+// session starts a wait for it to close, after which forgetSession drops the
+// client's target and snapshot if it has no other session open.
+func (s *Server) watchClients(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if call, ok := req.(*mcp.CallToolRequest); ok && call.Session != nil {
+			s.clientsMu.Lock()
+			if _, seen := s.sessionKeys[call.Session]; !seen {
+				key := s.clientKey(call)
+				s.sessionKeys[call.Session] = key
+				s.keySessions[key]++
+				go func(ss *mcp.ServerSession) {
+					_ = ss.Wait()
+					s.forgetSession(ss)
+				}(call.Session)
+			}
+			s.clientsMu.Unlock()
+		}
+		return next(ctx, method, req)
+	}
+}
+
+func (s *Server) forgetSession(ss *mcp.ServerSession) {
+	s.clientsMu.Lock()
+	key := s.sessionKeys[ss]
+	delete(s.sessionKeys, ss)
+	s.keySessions[key]--
+	last := s.keySessions[key] <= 0
+	if last {
+		delete(s.keySessions, key)
+	}
+	s.clientsMu.Unlock()
+	if !last {
+		return
+	}
+	s.targetsMu.Lock()
+	delete(s.targets, key)
+	s.targetsMu.Unlock()
+	s.refsMu.Lock()
+	delete(s.refSnapshots, key)
+	s.refsMu.Unlock()
+}
+
+func (s *Server) defaultTarget(key string) TargetInput {
+	s.targetsMu.Lock()
+	defer s.targetsMu.Unlock()
+	return s.targets[key]
+}
+
+type UseTargetOutput struct {
+	SessionID string `json:"sessionId,omitempty"`
+	TabID     int    `json:"tabId,omitempty"`
+}
+
+func (s *Server) useTarget(ctx context.Context, req *mcp.CallToolRequest, input TargetInput) (*mcp.CallToolResult, UseTargetOutput, error) {
+	if input.SessionID == "" && input.TabID == 0 {
+		return nil, UseTargetOutput{}, errors.New("sessionId or tabId is required; use browser.clear_target to reset")
+	}
+	s.targetsMu.Lock()
+	s.targets[s.clientKey(req)] = input
+	s.targetsMu.Unlock()
+	return nil, UseTargetOutput{SessionID: input.SessionID, TabID: input.TabID}, nil
+}
+
+type ClearTargetInput struct{}
+
+func (s *Server) clearTarget(ctx context.Context, req *mcp.CallToolRequest, _ ClearTargetInput) (*mcp.CallToolResult, EmptyOutput, error) {
+	s.targetsMu.Lock()
+	delete(s.targets, s.clientKey(req))
+	s.targetsMu.Unlock()
+	return nil, EmptyOutput{}, nil
+}
@@ -0,0 +1,89 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+)
+
+// timeoutTools are the tools that wait on the browser and so accept a
+// timeout override. Keep in step with the registrations in New.
+var timeoutTools = []string{
+	"browser.click",
+	"browser.snapshot",
+	"browser.scroll",
+	"browser.hover",
+	"browser.type",
+	"browser.enter",
+	"browser.press_keys",
+	"browser.back",
+	"browser.forward",
+	"browser.history",
+	"browser.wait_for_selector",
+	"browser.wait_for_url",
+	"browser.find",
+	"browser.navigate",
+	"browser.reload",
+	"browser.select",
+	"browser.screenshot",
+	"browser.start_recording",
+	"browser.stop_recording",
+	"browser.get_recording",
+	"browser.list_tabs",
+	"browser.find_tab",
+	"browser.open_tab",
+	"browser.close_tab",
+	"browser.claim_tab",
+	"browser.release_tab",
+	"browser.set_tab_sharing",
+	"browser.clear_storage",
+	"browser.get_storage",
+	"browser.set_storage",
+	"browser.evaluate",
+	"browser.fill_form",
+	"browser.check",
+	"browser.uncheck",
+	"browser.get_attribute",
+	"browser.get_text",
+	"browser.act",
+	"workflow.save",
+}
+
+// ValidateToolTimeouts reports names that are not tools with a timeout, and
+// durations that are not positive.
+func ValidateToolTimeouts(timeouts map[string]time.Duration) error {
+	var unknown []string
+	for name, d := range timeouts {
+		if !slices.Contains(timeoutTools, name) {
+			unknown = append(unknown, name)
+			continue
+		}
+		if d <= 0 {
+			return fmt.Errorf("timeout for %s must be positive, got %s", name, d)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown tools in timeouts: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// applyToolTimeouts gives each tool call the configured timeout for its tool.
+func (s *Server) applyToolTimeouts(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		if call, ok := req.(*mcp.CallToolRequest); ok && call.Params != nil {
+			if d, ok := s.toolTimeouts[call.Params.Name]; ok {
+				ctx = browser.WithTimeout(ctx, d)
+			}
+		}
+		return next(ctx, method, req)
+	}
+}
@@ -0,0 +1,61 @@
+package mcpserver
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/traceid"
+)
+
+// traceToolCalls gives each tool call a trace id. It travels on ctx to the
+// browser command, is returned in the result's _meta.traceId, and is logged
+// with the outcome so a call can be matched to the bridge's log lines.
+func traceToolCalls(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		call, ok := req.(*mcp.CallToolRequest)
+		if !ok || call.Params == nil {
+			return next(ctx, method, req)
+		}
+		id := uuid.New().String()
+		start := time.Now()
+		res, err := next(traceid.With(ctx, id), method, req)
+		out, _ := res.(*mcp.CallToolResult)
+		switch {
+		case err != nil:
+			log.Printf("tool call failed: name=%s trace=%s duration=%s error=%v", call.Params.Name, id, time.Since(start), err)
+		case out != nil && out.IsError:
+			log.Printf("tool call error result: name=%s trace=%s duration=%s", call.Params.Name, id, time.Since(start))
+		default:
+			log.Printf("tool call: name=%s trace=%s duration=%s", call.Params.Name, id, time.Since(start))
+		}
+		if out != nil {
+			if out.Meta == nil {
+				out.Meta = mcp.Meta{}
+			}
+			out.Meta["traceId"] = id
+		}
+		return res, err
+	}
+}
+
+// traceError appends the trace id on ctx to a tool error so it shows up in
+// the text the client sees.
+func traceError(ctx context.Context, err error) error {
+	if id, ok := traceid.FromContext(ctx); ok {
+		return &tracedError{err: err, traceID: id}
+	}
+	return err
+}
+
+type tracedError struct {
+	err     error
+	traceID string
+}
+
+func (e *tracedError) Error() string { return e.err.Error() + " (trace " + e.traceID + ")" }
+
+func (e *tracedError) Unwrap() error { return e.err }
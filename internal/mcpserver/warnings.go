@@ -0,0 +1,99 @@
+package mcpserver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+)
+
+// Upper bounds for tool inputs. Larger values are clamped with a warning
+// rather than rejected.
+const (
+	maxSnapshotElements = 500
+	maxSnapshotText     = 200000
+	maxFindLimit        = 200
+	maxFindRadius       = 1000
+)
+
+var snapshotVerbs = map[string]bool{"open": true, "click": true, "type": true, "select": true, "toggle": true}
+
+// warnings collects non-fatal problems with a tool call's input. Handlers fix
+// the input up, carry on and return the list alongside the result.
+type warnings []string
+
+func (w *warnings) addf(format string, args ...any) {
+	*w = append(*w, fmt.Sprintf(format, args...))
+}
+
+// clamp bounds v to [0, hi]. A negative value falls back to 0, which the
+// browser treats as its default.
+func (w *warnings) clamp(name string, v, hi int) int {
+	switch {
+	case v < 0:
+		w.addf("%s %d is negative; using the default", name, v)
+		return 0
+	case v > hi:
+		w.addf("%s %d exceeds the maximum of %d; clamped", name, v, hi)
+		return hi
+	}
+	return v
+}
+
+// snapshotInput clamps limits and drops unknown filter verbs.
+func (w *warnings) snapshotInput(input *SnapshotOptionsInput) {
+	input.MaxElements = w.clamp("maxElements", input.MaxElements, maxSnapshotElements)
+	input.MaxText = w.clamp("maxText", input.MaxText, maxSnapshotText)
+	if input.MaxHTML < 0 {
+		input.MaxHTML = w.clamp("maxHTML", input.MaxHTML, 0)
+	}
+	if input.MaxHTMLTokens < 0 {
+		input.MaxHTMLTokens = w.clamp("maxHTMLTokens", input.MaxHTMLTokens, 0)
+	}
+	f := input.ElementFilter
+	if f == nil || len(f.Verbs) == 0 {
+		return
+	}
+	verbs := make([]string, 0, len(f.Verbs))
+	for _, v := range f.Verbs {
+		if snapshotVerbs[strings.ToLower(strings.TrimSpace(v))] {
+			verbs = append(verbs, v)
+			continue
+		}
+		w.addf("elementFilter verb %q is unknown (want open, click, type, select or toggle); ignored", v)
+	}
+	f.Verbs = verbs
+	if len(f.Verbs) == 0 && len(f.Tags) == 0 {
+		input.ElementFilter = nil
+	}
+}
+
+// findInput clamps the result limit and snippet radius.
+func (w *warnings) findInput(input *FindInput) {
+	input.Limit = w.clamp("limit", input.Limit, maxFindLimit)
+	input.Radius = w.clamp("radius", input.Radius, maxFindRadius)
+}
+
+// selectOptions ignores an unknown match mode, and a labelRegex that fails
+// browser.CheckRegex when the call names options some other way.
+func (w *warnings) selectOptions(opts *browser.SelectOptions) {
+	switch strings.ToLower(strings.TrimSpace(opts.MatchMode)) {
+	case "", "exact", "partial":
+	default:
+		w.addf("matchMode %q is unknown (want exact or partial); using exact", opts.MatchMode)
+		opts.MatchMode = ""
+	}
+	if opts.LabelRegex == "" {
+		return
+	}
+	err := browser.CheckRegex(opts.LabelRegex)
+	if err == nil {
+		return
+	}
+	otherwise := opts.Value != "" || opts.Label != "" || opts.Index != 0 ||
+		len(opts.Values) > 0 || len(opts.Labels) > 0 || len(opts.Indices) > 0
+	if otherwise {
+		w.addf("labelRegex %q is not usable (%v); ignored", opts.LabelRegex, err)
+		opts.LabelRegex = ""
+	}
+}
@@ -0,0 +1,83 @@
+package page
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// benchFixture builds a page shaped like a typical listing: a nav bar, a form,
+// items sections of paragraphs and links, and a pager. items scales it.
+func benchFixture(items int) string {
+	var b strings.Builder
+	b.WriteString(`<!doctype html><html><head><title>Catalog</title><style>.x{color:red}</style></head><body>`)
+	b.WriteString(`<header><nav class="top nav"><a href="/">Home</a> <a href="/deals?utm_source=nav">Deals</a> <a href="/help" class="muted link">Help</a></nav></header>`)
+	b.WriteString(`<form id="search"><label>Search <input name="q" placeholder="Search products"></label><select name="sort"><option value="new">Newest</option><option value="price">Price</option></select><button type="submit">Go</button></form>`)
+	b.WriteString(`<main><article>`)
+	for i := 0; i < items; i++ {
+		fmt.Fprintf(&b, `<section class="item card" data-testid="item-%d"><h2>Product %d</h2>`, i, i)
+		fmt.Fprintf(&b, "<p>Product %d is   a <b>well</b>-made thing,\n\t described here in a few words so the text has some body to it.</p>", i)
+		fmt.Fprintf(&b, `<p style="display: none">Hidden note %d</p>`, i)
+		fmt.Fprintf(&b, `<a href="/p/%d?ref=list&amp;utm_campaign=x" class="title link">View product %d</a> `, i, i)
+		b.WriteString(`<button class="btn add">Add to cart</button><span role="button">Save</span></section>`)
+	}
+	b.WriteString(`</article></main>`)
+	b.WriteString(`<nav class="pager"><a href="?page=1" rel="prev">Previous</a><a href="?page=3" rel="next">Next</a></nav>`)
+	b.WriteString(`<footer><p>© Example</p></footer></body></html>`)
+	return b.String()
+}
+
+var benchSizes = []struct {
+	name  string
+	items int
+}{
+	{"small", 5},
+	{"medium", 60},
+	{"large", 600},
+}
+
+func BenchmarkReduce(b *testing.B) {
+	reducer := NewReducer(ReduceOptions{StripTrackingParams: true})
+	for _, size := range benchSizes {
+		raw := RawPage{URL: "https://shop.example/list", Title: "Catalog", HTML: benchFixture(size.items)}
+		b.Run(size.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(raw.HTML)))
+			for b.Loop() {
+				reducer.Reduce(raw)
+			}
+		})
+	}
+}
+
+func BenchmarkReduceUniqueSelectors(b *testing.B) {
+	reducer := NewReducer(ReduceOptions{UniqueSelectors: true, IncludeMainText: true, MaxElements: 500})
+	doc := benchFixture(60)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(doc)))
+	for b.Loop() {
+		reducer.ReduceHTML(doc)
+	}
+}
+
+// TestReduceAllocations logs the allocations per Reduce for each fixture, so
+// changes to them show up in verbose test output, and checks that the text
+// helpers do not allocate on input that needs no work.
+func TestReduceAllocations(t *testing.T) {
+	reducer := NewReducer(ReduceOptions{})
+	for _, size := range benchSizes {
+		raw := RawPage{HTML: benchFixture(size.items)}
+		allocs := testing.AllocsPerRun(5, func() { reducer.Reduce(raw) })
+		t.Logf("%s (%d bytes): %.0f allocs per Reduce", size.name, len(raw.HTML), allocs)
+	}
+
+	if n := testing.AllocsPerRun(100, func() { compactWhitespace("already compact text") }); n != 0 {
+		t.Fatalf("compactWhitespace allocated %.0f times on compact input", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { firstField("  primary secondary") }); n != 0 {
+		t.Fatalf("firstField allocated %.0f times", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { refName(42) }); n != 0 {
+		t.Fatalf("refName allocated %.0f times", n)
+	}
+}
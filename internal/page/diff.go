@@ -0,0 +1,116 @@
+package page
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffListLimit caps how many elements each list in a SnapshotDiff names;
+// the counts stay exact.
+const diffListLimit = 20
+
+// SnapshotDiff summarizes what changed between two snapshots of a page.
+// Elements are matched by selector, so an element whose selector changed
+// shows up as one removed and one added.
+type SnapshotDiff struct {
+	Summary      string        `json:"summary"`
+	URLChanged   bool          `json:"urlChanged,omitempty"`
+	FromURL      string        `json:"fromUrl,omitempty"`
+	TitleChanged bool          `json:"titleChanged,omitempty"`
+	TextChanged  bool          `json:"textChanged,omitempty"`
+	AddedCount   int           `json:"addedCount"`
+	RemovedCount int           `json:"removedCount"`
+	ChangedCount int           `json:"changedCount"`
+	Added        []DiffElement `json:"added,omitempty"`
+	Removed      []DiffElement `json:"removed,omitempty"`
+	Changed      []DiffElement `json:"changed,omitempty"`
+}
+
+// DiffElement names an element in a SnapshotDiff. Ref is the element's ref in
+// the later snapshot; removed elements have none.
+type DiffElement struct {
+	Ref      string `json:"ref,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+	Selector string `json:"selector"`
+	Text     string `json:"text,omitempty"`
+}
+
+// Diff compares before with after.
+func Diff(before, after Snapshot) SnapshotDiff {
+	d := SnapshotDiff{
+		URLChanged:   before.URL != after.URL,
+		TitleChanged: before.Title != after.Title,
+		TextChanged:  before.Text != after.Text,
+	}
+	if d.URLChanged {
+		d.FromURL = before.URL
+	}
+
+	// Selectors can repeat, so match them as multisets in page order.
+	remaining := make(map[string][]Element)
+	for _, el := range before.Elements {
+		remaining[el.Selector] = append(remaining[el.Selector], el)
+	}
+	for _, el := range after.Elements {
+		prev := remaining[el.Selector]
+		if len(prev) == 0 {
+			d.AddedCount++
+			d.Added = appendDiff(d.Added, el, el.Ref)
+			continue
+		}
+		remaining[el.Selector] = prev[1:]
+		if elementChanged(prev[0], el) {
+			d.ChangedCount++
+			d.Changed = appendDiff(d.Changed, el, el.Ref)
+		}
+	}
+	for _, el := range before.Elements {
+		if rest := remaining[el.Selector]; len(rest) > 0 {
+			remaining[el.Selector] = rest[1:]
+			d.RemovedCount++
+			d.Removed = appendDiff(d.Removed, el, "")
+		}
+	}
+	d.Summary = d.summary(after.URL)
+	return d
+}
+
+func elementChanged(a, b Element) bool {
+	return a.Text != b.Text || a.Value != b.Value || a.Disabled != b.Disabled || a.Href != b.Href ||
+		(a.Visible == nil) != (b.Visible == nil) || (a.Visible != nil && *a.Visible != *b.Visible)
+}
+
+func appendDiff(list []DiffElement, el Element, ref string) []DiffElement {
+	if len(list) >= diffListLimit {
+		return list
+	}
+	return append(list, DiffElement{Ref: ref, Tag: el.Tag, Selector: el.Selector, Text: el.Text})
+}
+
+func (d SnapshotDiff) summary(url string) string {
+	var parts []string
+	if d.URLChanged {
+		parts = append(parts, "navigated to "+url)
+	} else if d.TitleChanged {
+		parts = append(parts, "title changed")
+	}
+	var counts []string
+	for _, c := range []struct {
+		n    int
+		verb string
+	}{{d.AddedCount, "added"}, {d.RemovedCount, "removed"}, {d.ChangedCount, "changed"}} {
+		if c.n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", c.n, c.verb))
+		}
+	}
+	if len(counts) > 0 {
+		parts = append(parts, "elements: "+strings.Join(counts, ", "))
+	}
+	if d.TextChanged {
+		parts = append(parts, "text changed")
+	}
+	if len(parts) == 0 {
+		return "no change"
+	}
+	return strings.Join(parts, "; ")
+}
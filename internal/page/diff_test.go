@@ -0,0 +1,27 @@
+package page
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	reducer := NewReducer(ReduceOptions{})
+	before := reducer.Reduce(RawPage{URL: "https://a.test/", Title: "A", HTML: `<li><a class="item" href="/1">One</a></li><li><a class="item" href="/2">Two</a></li><button id="more">More</button>`})
+
+	same := Diff(before, before)
+	if same.Summary != "no change" || same.AddedCount+same.RemovedCount+same.ChangedCount != 0 {
+		t.Fatalf("expected no change, got %+v", same)
+	}
+
+	// Loading more appends a third item with the same selector and relabels
+	// the button.
+	after := reducer.Reduce(RawPage{URL: "https://a.test/", Title: "A", HTML: `<li><a class="item" href="/1">One</a></li><li><a class="item" href="/2">Two</a></li><li><a class="item" href="/3">Three</a></li><button id="more">Less</button>`})
+	d := Diff(before, after)
+	if d.URLChanged || d.TitleChanged || d.AddedCount != 1 || d.RemovedCount != 0 || d.ChangedCount != 1 {
+		t.Fatalf("unexpected diff %+v", d)
+	}
+	if d.Added[0].Text != "Three" || d.Added[0].Ref != "e3" || d.Changed[0].Selector != "#more" {
+		t.Fatalf("unexpected diff elements %+v / %+v", d.Added, d.Changed)
+	}
+	if d.Summary != "elements: 1 added, 1 changed; text changed" {
+		t.Fatalf("unexpected summary %q", d.Summary)
+	}
+}
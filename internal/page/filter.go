@@ -0,0 +1,49 @@
+package page
+
+import "strings"
+
+// ElementFilter narrows a snapshot to elements whose action verb (open,
+// click, type, select, toggle) or tag is listed. An empty filter keeps
+// everything.
+type ElementFilter struct {
+	Verbs []string
+	Tags  []string
+}
+
+// Empty reports whether the filter keeps every element.
+func (f ElementFilter) Empty() bool {
+	return len(f.Verbs) == 0 && len(f.Tags) == 0
+}
+
+// Apply returns snap with Elements and Actions limited to matching elements.
+// ElementsReturned is updated; ElementsTotal still counts the whole page.
+func (f ElementFilter) Apply(snap Snapshot) Snapshot {
+	if f.Empty() {
+		return snap
+	}
+	var kept []Element
+	for _, el := range snap.Elements {
+		if f.matches(el) {
+			kept = append(kept, el)
+		}
+	}
+	snap.Elements = kept
+	snap.Actions = buildActions(kept)
+	snap.ElementsReturned = len(kept)
+	return snap
+}
+
+func (f ElementFilter) matches(el Element) bool {
+	verb := actionVerb(el)
+	for _, v := range f.Verbs {
+		if verb != "" && strings.EqualFold(strings.TrimSpace(v), verb) {
+			return true
+		}
+	}
+	for _, t := range f.Tags {
+		if strings.EqualFold(strings.TrimSpace(t), el.Tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package page
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Snapshot formats a caller can ask browser.snapshot to render, and that
+// browser.default_snapshot_format may name.
+const (
+	// FormatJSON returns text, elements and actions as structured fields
+	// (the default).
+	FormatJSON = "json"
+	// FormatMarkdown renders the title, text and actions as one markdown
+	// document in place of those fields.
+	FormatMarkdown = "markdown"
+	// FormatOutline lists each element as one line of ref, role and
+	// accessible name in place of elements and actions.
+	FormatOutline = "outline"
+)
+
+// ParseFormat normalizes a snapshot format name, ignoring case and
+// surrounding space. An empty name stays empty, leaving the choice to the
+// caller's default.
+func ParseFormat(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	switch name {
+	case "", FormatJSON, FormatMarkdown, FormatOutline:
+		return name, nil
+	}
+	return "", fmt.Errorf("unknown snapshot format %q (want %s, %s or %s)", name, FormatJSON, FormatMarkdown, FormatOutline)
+}
@@ -0,0 +1,14 @@
+package page
+
+import "testing"
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]string{"": "", " Markdown ": FormatMarkdown, "json": FormatJSON, "OUTLINE": FormatOutline} {
+		if got, err := ParseFormat(in); err != nil || got != want {
+			t.Fatalf("ParseFormat(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseFormat("yaml"); err == nil {
+		t.Fatalf("expected an unknown format to be rejected")
+	}
+}
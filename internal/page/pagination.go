@@ -0,0 +1,236 @@
+package page
+
+import (
+	"iter"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+)
+
+// Pagination points at the controls that move between pages of a listing,
+// such as search results. Either side is nil when the page has none, which
+// for Next usually means this is the last page.
+type Pagination struct {
+	Next *PageLink `json:"next,omitempty"`
+	Prev *PageLink `json:"prev,omitempty"`
+}
+
+// PageLink is one pagination control. Selector is empty for a <link
+// rel="next"> in the document head, which can only be followed by Href. Ref
+// is set when the control is among the snapshot's elements.
+type PageLink struct {
+	Ref      string `json:"ref,omitempty"`
+	Selector string `json:"selector,omitempty"`
+	Href     string `json:"href,omitempty"`
+	Text     string `json:"text,omitempty"`
+	// Source says how the control was recognised: rel, aria-label, class or
+	// text, from most to least reliable.
+	Source string `json:"source"`
+}
+
+const (
+	pageNext = iota + 1
+	pagePrev
+)
+
+// Pagination sources, weakest first; a stronger source replaces a weaker
+// candidate for the same direction. A head <link rel> ranks lowest since it
+// cannot be clicked.
+var pageSources = []string{"link", "text", "class", "aria-label", "rel"}
+
+type pageHit struct {
+	node *html.Node
+	tag  string
+	path []string
+	rank int
+}
+
+// paginationFinder keeps the best next and previous candidates seen while
+// walking a document.
+type paginationFinder struct {
+	hits [3]pageHit
+}
+
+// consider looks at n, whose text has already been collected for the
+// element list when n is actionable.
+func (f *paginationFinder) consider(tag string, n *html.Node, path []string, text string) {
+	if tag != "link" && !isActionable(tag, n) || isDisabled(n) {
+		return
+	}
+	dir, source := pageDirection(tag, n, text)
+	if dir == 0 {
+		return
+	}
+	rank := slices.Index(pageSources, source) + 1
+	if rank > f.hits[dir].rank {
+		f.hits[dir] = pageHit{node: n, tag: tag, path: slices.Clone(path), rank: rank}
+	}
+}
+
+// result builds the Pagination; all is every element node, for making
+// selectors unique when uniqueSelectors is set.
+func (f *paginationFinder) result(uniqueSelectors bool, all []*html.Node) *Pagination {
+	link := func(h pageHit) *PageLink {
+		if h.node == nil {
+			return nil
+		}
+		out := &PageLink{Href: attr(h.node, "href"), Source: pageSources[h.rank-1]}
+		if h.tag == "link" {
+			out.Source = "rel"
+			return out
+		}
+		el := Element{Tag: h.tag}
+		el.Selector, _ = selectorFromNode(h.tag, h.node, h.path)
+		if uniqueSelectors {
+			els := []Element{el}
+			uniquifySelectors(els, []*html.Node{h.node}, all)
+			el = els[0]
+		}
+		out.Selector = el.Selector
+		out.Text = compactWhitespace(nodeText(h.node))
+		return out
+	}
+	p := &Pagination{Next: link(f.hits[pageNext]), Prev: link(f.hits[pagePrev])}
+	if p.Next == nil && p.Prev == nil {
+		return nil
+	}
+	return p
+}
+
+func pageDirection(tag string, n *html.Node, text string) (int, string) {
+	if dir := relDirection(attr(n, "rel")); dir != 0 {
+		if tag == "link" {
+			return dir, "link"
+		}
+		return dir, "rel"
+	}
+	if tag == "link" {
+		return 0, ""
+	}
+	if dir := labelDirection(attr(n, "aria-label")); dir != 0 {
+		return dir, "aria-label"
+	}
+	if dir := classDirection(attr(n, "class")); dir != 0 {
+		return dir, "class"
+	}
+	if dir := textDirection(text); dir != 0 {
+		return dir, "text"
+	}
+	return 0, ""
+}
+
+func relDirection(rel string) int {
+	for v := range strings.FieldsSeq(rel) {
+		if dir := wordDir(v); dir != 0 {
+			return dir
+		}
+	}
+	return 0
+}
+
+// labelDirection matches labels such as "Next page" or "Go to previous
+// page" by whole word, so "context" is not taken for "next".
+func labelDirection(label string) int {
+	return wordDirection(words(label))
+}
+
+// classDirection matches class names such as "next", "pagination-next" or
+// "pager__prev".
+func classDirection(class string) int {
+	return wordDirection(strings.FieldsFuncSeq(class, func(r rune) bool { return unicode.IsSpace(r) || r == '-' || r == '_' }))
+}
+
+// textDirection only trusts short texts made of pagination words, like
+// "Next", "Next page" or "« Previous", since running text mentioning "next"
+// is common.
+func textDirection(text string) int {
+	for w := range words(text) {
+		if wordDir(w) == 0 && !strings.EqualFold(w, "page") {
+			return 0
+		}
+	}
+	return wordDirection(words(text))
+}
+
+// wordDirection is the direction the words name, or 0 if they name none or
+// both.
+func wordDirection(ws iter.Seq[string]) int {
+	dir := 0
+	for w := range ws {
+		d := wordDir(w)
+		if d != 0 && dir != 0 && d != dir {
+			return 0
+		}
+		if d != 0 {
+			dir = d
+		}
+	}
+	return dir
+}
+
+// wordDir is the direction a single word names, ignoring case.
+func wordDir(w string) int {
+	switch {
+	case strings.EqualFold(w, "next"):
+		return pageNext
+	case strings.EqualFold(w, "prev"), strings.EqualFold(w, "previous"):
+		return pagePrev
+	}
+	return 0
+}
+
+// words yields the runs of letters in s without allocating.
+func words(s string) iter.Seq[string] {
+	return strings.FieldsFuncSeq(s, func(r rune) bool { return !unicode.IsLetter(r) })
+}
+
+// paginationFromElements is the fallback for pages reduced without HTML: the
+// extension's elements carry no rel or class, so only labels and text count.
+func paginationFromElements(elements []Element) *Pagination {
+	var p Pagination
+	var ranks [3]int
+	for _, el := range elements {
+		if el.Disabled || el.Selector == "" {
+			continue
+		}
+		dir, source, rank := labelDirection(el.ARIALabel), "aria-label", 2
+		if dir == 0 {
+			dir, source, rank = textDirection(el.Text), "text", 1
+		}
+		if dir == 0 || rank <= ranks[dir] {
+			continue
+		}
+		ranks[dir] = rank
+		link := &PageLink{Selector: el.Selector, Href: el.Href, Text: el.Text, Source: source}
+		if dir == pageNext {
+			p.Next = link
+		} else {
+			p.Prev = link
+		}
+	}
+	if p.Next == nil && p.Prev == nil {
+		return nil
+	}
+	return &p
+}
+
+// linkPagination sets the refs of pagination controls that are among
+// elements.
+func linkPagination(p *Pagination, elements []Element) {
+	if p == nil {
+		return
+	}
+	for _, link := range []*PageLink{p.Next, p.Prev} {
+		if link == nil || link.Selector == "" {
+			continue
+		}
+		for _, el := range elements {
+			if el.Selector == link.Selector {
+				link.Ref = el.Ref
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package page
+
+import "testing"
+
+func TestReducerPaginationRel(t *testing.T) {
+	html := `<html><head><link rel="next" href="/list?page=3"></head><body>
+		<a href="/item/1">First item</a>
+		<nav><a href="/list?page=1" rel="prev">Newer</a><a class="page" href="/list?page=3" rel="next nofollow">Older</a></nav>
+	</body></html>`
+	snap := NewReducer(ReduceOptions{MaxElements: 1}).Reduce(RawPage{HTML: html})
+	p := snap.Pagination
+	if p == nil || p.Next == nil || p.Prev == nil {
+		t.Fatalf("expected next and prev controls, got %+v", p)
+	}
+	if p.Next.Source != "rel" || p.Next.Selector != "a.page" || p.Next.Href != "/list?page=3" || p.Next.Text != "Older" {
+		t.Fatalf("expected the rel=next anchor to beat the head link, got %+v", p.Next)
+	}
+	if p.Next.Ref != "" {
+		t.Fatalf("expected no ref for a control cut by maxElements, got %q", p.Next.Ref)
+	}
+	if p.Prev.Href != "/list?page=1" {
+		t.Fatalf("unexpected prev %+v", p.Prev)
+	}
+
+	snap = NewReducer(ReduceOptions{}).Reduce(RawPage{HTML: `<html><head><link rel="next" href="/p2"></head><body><p>hi</p></body></html>`})
+	if p := snap.Pagination; p == nil || p.Next == nil || p.Next.Selector != "" || p.Next.Href != "/p2" || p.Prev != nil {
+		t.Fatalf("expected a head-only next link, got %+v", p)
+	}
+}
+
+func TestReducerPaginationAriaLabel(t *testing.T) {
+	html := `<html><body>
+		<p>See the context menu for more.</p>
+		<button aria-label="Go to previous page" disabled>‹</button>
+		<button id="next" aria-label="Go to next page">›</button>
+		<a class="pager__prev" href="/p1">‹</a>
+	</body></html>`
+	snap := NewReducer(ReduceOptions{}).Reduce(RawPage{HTML: html})
+	p := snap.Pagination
+	if p == nil || p.Next == nil || p.Next.Selector != "#next" || p.Next.Source != "aria-label" || p.Next.Ref == "" {
+		t.Fatalf("expected the labelled next button with a ref, got %+v", p)
+	}
+	if p.Prev == nil || p.Prev.Source != "class" || p.Prev.Href != "/p1" {
+		t.Fatalf("expected the disabled button to be skipped for the class match, got %+v", p.Prev)
+	}
+
+	if snap := NewReducer(ReduceOptions{}).Reduce(RawPage{HTML: `<a href="/x">What happens next in the story</a>`}); snap.Pagination != nil {
+		t.Fatalf("expected running text not to count, got %+v", snap.Pagination)
+	}
+}
+
+func TestPaginationFromExtensionElements(t *testing.T) {
+	snap := NewReducer(ReduceOptions{}).Reduce(RawPage{Elements: []Element{
+		{Tag: "a", Selector: "#more", Text: "Next »", Href: "/p2"},
+		{Tag: "a", Selector: "#back", ARIALabel: "Previous page"},
+	}})
+	p := snap.Pagination
+	if p == nil || p.Next == nil || p.Next.Ref != "e1" || p.Prev == nil || p.Prev.Selector != "#back" {
+		t.Fatalf("unexpected pagination %+v", p)
+	}
+}
@@ -0,0 +1,84 @@
+package page
+
+import (
+	"strings"
+	"unicode"
+)
+
+// looksTruncated reports whether markup appears to have been cut off
+// upstream: it ends inside a tag, comment, script or style element, or opens
+// <html> without closing it. Optional end tags such as </body> are not
+// required since many valid pages omit them.
+func looksTruncated(s string) bool {
+	s = strings.TrimRightFunc(s, unicode.IsSpace)
+	if s == "" {
+		return false
+	}
+	if strings.LastIndexByte(s, '<') > strings.LastIndexByte(s, '>') {
+		return true
+	}
+	if strings.LastIndex(s, "<!--") > strings.LastIndex(s, "-->") {
+		return true
+	}
+	for _, tag := range unclosedTags {
+		if lastIndexFold(s, tag.open) > lastIndexFold(s, tag.close) {
+			return true
+		}
+	}
+	return false
+}
+
+var unclosedTags = []struct{ open, close string }{
+	{"<script", "</script"},
+	{"<style", "</style"},
+	{"<html", "</html"},
+}
+
+// lastIndexFold is strings.LastIndex ignoring ASCII case, without lowering a
+// copy of s.
+func lastIndexFold(s, sub string) int {
+	for end := len(s); ; {
+		i := strings.LastIndexByte(s[:end], sub[0])
+		if i < 0 {
+			return -1
+		}
+		if i+len(sub) <= len(s) && strings.EqualFold(s[i:i+len(sub)], sub) {
+			return i
+		}
+		end = i
+	}
+}
+
+// safeParseHTML runs parseHTML and turns a panic on degenerate input into the
+// stripped text of the document, so a bad page never takes the server down.
+func safeParseHTML(htmlText string, opts parseOptions) (parsed parsedPage, ok bool) {
+	defer func() {
+		if recover() != nil {
+			parsed, ok = parsedPage{text: stripHTML(htmlText)}, false
+		}
+	}()
+	return parseHTML(htmlText, opts), true
+}
+
+// plainID reports whether id can be used in a #id selector without escaping.
+// Ids cut short by truncation often carry quotes or markup, and ids that
+// start with a digit or contain whitespace need escaping in CSS.
+func plainID(id string) bool {
+	for i, r := range id {
+		switch {
+		case r == '-' || r == '_' || unicode.IsLetter(r):
+		case unicode.IsDigit(r) && i > 0:
+		default:
+			return false
+		}
+	}
+	return id != ""
+}
+
+// quoteAttr returns v as a double-quoted CSS attribute value.
+func quoteAttr(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `"`, `\"`)
+	v = strings.ReplaceAll(v, "\n", `\a `)
+	return `"` + v + `"`
+}
@@ -0,0 +1,128 @@
+package page
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// boilerplateTags never contribute to main content.
+var boilerplateTags = map[string]bool{
+	"nav": true, "header": true, "footer": true, "aside": true, "form": true,
+	"script": true, "style": true, "noscript": true, "template": true, "iframe": true,
+}
+
+// boilerplateHints are class/id fragments that mark ads, share bars and the like.
+var boilerplateHints = []string{"advert", "ad-", "ads", "banner", "promo", "share", "social", "related", "comment", "sidebar", "cookie", "newsletter"}
+
+// extractMain returns the text of the page's main content: the largest
+// <article>, else <main> or role="main", else the block with the most
+// non-link text. Boilerplate inside the chosen node is skipped. With
+// preserveSpace, pre, code and textarea text keeps its whitespace.
+func extractMain(doc *html.Node, preserveSpace bool) string {
+	root := largest(doc, func(n *html.Node) bool { return n.Data == "article" })
+	if root == nil {
+		root = largest(doc, func(n *html.Node) bool { return n.Data == "main" || attr(n, "role") == "main" })
+	}
+	if root == nil {
+		root = densestBlock(doc)
+	}
+	if root == nil {
+		return ""
+	}
+	if preserveSpace {
+		return strings.TrimSpace(collectText(root, isBoilerplate, true))
+	}
+	return compactWhitespace(contentText(root))
+}
+
+// largest returns the matching element with the most content text.
+func largest(doc *html.Node, match func(*html.Node) bool) *html.Node {
+	var best *html.Node
+	bestLen := 0
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && match(n) {
+			if l := len(contentText(n)); l > bestLen {
+				best, bestLen = n, l
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return best
+}
+
+// densestBlock scores div/section/td blocks by the paragraph text of their
+// direct children minus link text, a simplified readability heuristic.
+func densestBlock(doc *html.Node) *html.Node {
+	var best *html.Node
+	bestScore := 0
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if isBoilerplate(n) {
+				return
+			}
+			switch n.Data {
+			case "div", "section", "td", "body":
+				score := 0
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					if c.Type == html.ElementNode && (c.Data == "p" || c.Data == "pre" || c.Data == "blockquote") {
+						score += len(contentText(c)) - len(linkText(c))
+					}
+				}
+				if score > bestScore {
+					best, bestScore = n, score
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return best
+}
+
+func isBoilerplate(n *html.Node) bool {
+	if boilerplateTags[n.Data] {
+		return true
+	}
+	switch attr(n, "role") {
+	case "navigation", "banner", "contentinfo", "complementary":
+		return true
+	}
+	hint := strings.ToLower(attr(n, "class") + " " + attr(n, "id"))
+	for _, h := range boilerplateHints {
+		for _, word := range strings.Fields(hint) {
+			if word == h || strings.HasPrefix(word, h) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// contentText collects text below n, skipping boilerplate subtrees.
+func contentText(n *html.Node) string {
+	return collectText(n, isBoilerplate, false)
+}
+
+func linkText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode && node.Data == "a" {
+			b.WriteString(nodeText(node))
+			return
+		}
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
@@ -1,24 +1,61 @@
 package page
 
 import (
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"golang.org/x/net/html"
 )
 
 const (
-	defaultMaxText     = 4000
-	defaultMaxElements = 80
+	defaultMaxText      = 4000
+	defaultMaxElements  = 80
+	defaultMaxHTMLInput = 4 << 20
 )
 
 type ReduceOptions struct {
 	MaxText     int
 	MaxElements int
+	// MaxHTMLInput bounds the number of HTML bytes handed to the parser.
+	// Larger documents are cut at the last tag boundary before the limit.
+	MaxHTMLInput int
+	// UniqueSelectors replaces selectors of HTML-derived elements that match
+	// several nodes with an :nth-of-type path. The result is unambiguous but
+	// less readable and more sensitive to layout changes. Elements supplied
+	// directly by the extension keep their selectors.
+	UniqueSelectors bool
+	// IncludeMainText fills Snapshot.MainText with the article-like body of
+	// the page, leaving out navigation, ads and other boilerplate.
+	IncludeMainText bool
+	// StripTrackingParams removes TrackingParams from element hrefs. The
+	// original href is kept in Element.RawHref.
+	StripTrackingParams bool
+	// TrackingParams lists query parameters to strip; a trailing "*" matches
+	// by prefix. Empty means DefaultTrackingParams.
+	TrackingParams []string
+	// IncludeValues keeps form field values through reduction. Values in
+	// elements supplied by the extension are live (what the user typed) and
+	// always win; the HTML value attribute only fills in fields the
+	// extension reported without one.
+	IncludeValues bool
+	// PreserveWhitespace keeps the whitespace inside pre, code and textarea
+	// elements, newlines included, in text taken from the HTML, so scraped
+	// code and logs keep their layout. Text elsewhere is still compacted.
+	PreserveWhitespace bool
 }
 
 type Reducer struct {
-	maxText     int
-	maxElements int
+	maxText         int
+	maxElements     int
+	maxHTMLInput    int
+	uniqueSelectors bool
+	includeMainText bool
+	trackingParams  []string
+	includeValues   bool
+	preserveSpace   bool
 }
 
 func NewReducer(opts ReduceOptions) *Reducer {
@@ -30,80 +67,287 @@ func NewReducer(opts ReduceOptions) *Reducer {
 	if maxElements <= 0 {
 		maxElements = defaultMaxElements
 	}
-	return &Reducer{maxText: maxText, maxElements: maxElements}
+	maxHTMLInput := opts.MaxHTMLInput
+	if maxHTMLInput <= 0 {
+		maxHTMLInput = defaultMaxHTMLInput
+	}
+	var trackingParams []string
+	if opts.StripTrackingParams {
+		trackingParams = opts.TrackingParams
+		if len(trackingParams) == 0 {
+			trackingParams = DefaultTrackingParams
+		}
+	}
+	return &Reducer{maxText: maxText, maxElements: maxElements, maxHTMLInput: maxHTMLInput, uniqueSelectors: opts.UniqueSelectors, includeMainText: opts.IncludeMainText, trackingParams: trackingParams, includeValues: opts.IncludeValues, preserveSpace: opts.PreserveWhitespace}
+}
+
+// WithLimits returns a copy of r with MaxText and MaxElements replaced by
+// the positive values given; other options are kept.
+func (r *Reducer) WithLimits(maxText, maxElements int) *Reducer {
+	out := *r
+	if maxText > 0 {
+		out.maxText = maxText
+	}
+	if maxElements > 0 {
+		out.maxElements = maxElements
+	}
+	return &out
 }
 
+// IncludesValues reports whether the reducer was built with IncludeValues.
+func (r *Reducer) IncludesValues() bool {
+	return r.includeValues
+}
+
+// Reduce turns a captured page into a snapshot. It does no I/O and keeps no
+// state between calls, so it is safe for concurrent use and can be profiled
+// on its own; only the Debug timings vary from run to run.
 func (r *Reducer) Reduce(raw RawPage) Snapshot {
+	start := time.Now()
+	debug := &SnapshotDebug{HTMLBytes: len(raw.HTML), ExtensionElements: len(raw.Elements), ElementSource: ElementSourceNone}
 	text := strings.TrimSpace(raw.Text)
+	textFromHTML := false
 	var elements []Element
+	elementsTotal := 0
+	htmlTruncated := false
+	partial := false
+	mainText := ""
+	var pagination *Pagination
 	if raw.HTML != "" {
-		parsedText, parsedElements := parseHTML(raw.HTML, r.maxElements)
+		input := raw.HTML
+		partial = looksTruncated(input)
+		if len(input) > r.maxHTMLInput {
+			input = truncateHTML(input, r.maxHTMLInput)
+			htmlTruncated = true
+			partial = true
+		}
+		parseStart := time.Now()
+		parsed, ok := safeParseHTML(input, parseOptions{
+			maxElements:     r.maxElements,
+			uniqueSelectors: r.uniqueSelectors,
+			includeMain:     r.includeMainText,
+			preserveSpace:   r.preserveSpace,
+		})
+		debug.ParseMs = millis(time.Since(parseStart))
+		debug.ParsedElements = parsed.total
+		if !ok {
+			partial = true
+		}
+		mainText = parsed.main
+		pagination = parsed.pagination
 		if text == "" {
-			text = parsedText
+			text = parsed.text
+			textFromHTML = ok
 		}
 		if len(raw.Elements) == 0 {
-			elements = parsedElements
+			elements = parsed.elements
+			elementsTotal = parsed.total
+			if len(elements) > 0 {
+				debug.ElementSource = ElementSourceHTML
+			}
+		} else if r.includeValues {
+			elements = fillValues(raw.Elements, parsed.elements)
+			elementsTotal = len(raw.Elements)
 		}
 	}
 	if len(elements) == 0 {
 		elements = raw.Elements
+		elementsTotal = len(raw.Elements)
+	}
+	if len(raw.Elements) > 0 {
+		debug.ElementSource = ElementSourceExtension
 	}
 
-	text = compactWhitespace(text)
+	if r.preserveSpace && textFromHTML {
+		// The HTML walk already compacted everything outside the
+		// preserved elements.
+		text = strings.TrimSpace(text)
+	} else {
+		text = compactWhitespace(text)
+	}
+	textTruncated := false
 	if len(text) > r.maxText {
-		text = text[:r.maxText]
+		text = TruncateUTF8(text, r.maxText)
+		textTruncated = true
 	}
+	mainText = TruncateUTF8(mainText, r.maxText)
 	if len(elements) > r.maxElements {
 		elements = elements[:r.maxElements]
 	}
+	if len(r.trackingParams) > 0 {
+		elements = stripTracking(elements, r.trackingParams)
+	}
 
+	elements = numberElements(rateSelectors(elements))
 	actions := buildActions(elements)
+	if pagination == nil && raw.HTML == "" {
+		pagination = paginationFromElements(elements)
+	}
+	linkPagination(pagination, elements)
+
+	snap := Snapshot{
+		URL:              raw.URL,
+		Title:            raw.Title,
+		Text:             text,
+		MainText:         mainText,
+		Elements:         elements,
+		Actions:          actions,
+		HTMLTruncated:    htmlTruncated,
+		PartialParse:     partial,
+		TextTruncated:    textTruncated,
+		ElementsTotal:    elementsTotal,
+		ElementsReturned: len(elements),
+		Pagination:       pagination,
+	}
+	snap.ContentHash = ContentHash(snap)
+	snap.raw = &raw
+	debug.TextBytes = len(text)
+	debug.ElementsTotal = elementsTotal
+	debug.ElementsReturned = len(elements)
+	debug.ReduceMs = millis(time.Since(start))
+	snap.Debug = debug
+	return snap
+}
+
+// ReduceHTML reduces a bare HTML document, as a page captured without
+// extension-side elements or text would be. It is the entry point for
+// benchmarks and profiles of the parse and reduce path.
+func (r *Reducer) ReduceHTML(htmlText string) Snapshot {
+	return r.Reduce(RawPage{HTML: htmlText})
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
 
-	return Snapshot{
-		URL:      raw.URL,
-		Title:    raw.Title,
-		Text:     text,
-		Elements: elements,
-		Actions:  actions,
+// fillValues copies live elements and gives fields without a value the value
+// attribute of the parsed element with the same selector. Live values are
+// never replaced.
+func fillValues(live, parsed []Element) []Element {
+	static := make(map[string]string, len(parsed))
+	for _, el := range parsed {
+		if el.Value != "" && el.Selector != "" {
+			static[el.Selector] = el.Value
+		}
+	}
+	out := make([]Element, len(live))
+	copy(out, live)
+	for i := range out {
+		if out[i].Value == "" {
+			out[i].Value = static[out[i].Selector]
+		}
 	}
+	return out
 }
 
-func parseHTML(htmlText string, maxElements int) (string, []Element) {
+// truncateHTML cuts input to at most limit bytes, backing up to the end of the
+// last complete tag so the parser never sees half an element.
+func truncateHTML(input string, limit int) string {
+	if len(input) <= limit {
+		return input
+	}
+	cut := input[:limit]
+	if i := strings.LastIndexByte(cut, '>'); i >= 0 {
+		return cut[:i+1]
+	}
+	return cut
+}
+
+// parsedPage is what parseHTML extracts from a document.
+type parsedPage struct {
+	text     string
+	elements []Element
+	// total counts every actionable element found, including those beyond
+	// the limit.
+	total      int
+	main       string
+	pagination *Pagination
+}
+
+// parseOptions are the Reducer settings parseHTML needs.
+type parseOptions struct {
+	maxElements     int
+	uniqueSelectors bool
+	includeMain     bool
+	preserveSpace   bool
+}
+
+// parseHTML extracts page text, up to maxElements actionable elements and
+// any pagination controls. With uniqueSelectors, ambiguous selectors are made
+// unique; with includeMain, main holds the extractMain text; with
+// preserveSpace, text inside pre, code and textarea keeps its whitespace.
+func parseHTML(htmlText string, opts parseOptions) parsedPage {
 	doc, err := html.Parse(strings.NewReader(htmlText))
 	if err != nil {
-		return stripHTML(htmlText), nil
+		return parsedPage{text: stripHTML(htmlText)}
 	}
-	var elements []Element
-	var b strings.Builder
+	var out parsedPage
+	var nodes, all []*html.Node
+	var pages paginationFinder
+	var b textBuilder
+	verbatim := 0 // depth of whitespace-preserving elements around n
 	var walk func(n *html.Node, path []string)
 	walk = func(n *html.Node, path []string) {
 		if n.Type == html.ElementNode {
 			tag := strings.ToLower(n.Data)
 			path = append(path, tag)
-			if isActionable(tag, n) {
-				el := elementFromNode(tag, n, path)
+			if opts.uniqueSelectors {
+				all = append(all, n)
+			}
+			actionable := isActionable(tag, n)
+			var el Element
+			if actionable {
+				el = elementFromNode(tag, n, path)
+			}
+			// Pagination usually sits at the bottom of the page, so it is
+			// looked for past maxElements too.
+			pages.consider(tag, n, path, el.Text)
+			if actionable {
 				if el.Text != "" || el.ARIALabel != "" || el.Name != "" || el.ID != "" {
-					elements = append(elements, el)
+					out.total++
+					if opts.maxElements <= 0 || len(out.elements) < opts.maxElements {
+						out.elements = append(out.elements, el)
+						nodes = append(nodes, n)
+					}
 				}
 			}
 		}
 		if n.Type == html.TextNode {
-			text := strings.TrimSpace(n.Data)
-			if text != "" {
-				b.WriteString(text)
-				b.WriteByte(' ')
+			if verbatim > 0 {
+				b.verbatim(n.Data)
+			} else {
+				b.text(n.Data)
 			}
 		}
+		block := isBlock(n)
+		if block {
+			b.boundary()
+		}
+		keep := opts.preserveSpace && preservesSpace(n)
+		if keep {
+			verbatim++
+		}
 		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			if maxElements > 0 && len(elements) >= maxElements {
-				break
-			}
 			walk(c, path)
 		}
+		if keep {
+			verbatim--
+		}
+		if block {
+			b.boundary()
+		}
 	}
 	walk(doc, nil)
 
-	return b.String(), elements
+	if opts.uniqueSelectors {
+		uniquifySelectors(out.elements, nodes, all)
+	}
+	if opts.includeMain {
+		out.main = extractMain(doc, opts.preserveSpace)
+	}
+	out.text = b.String()
+	out.pagination = pages.result(opts.uniqueSelectors, all)
+	return out
 }
 
 func isActionable(tag string, n *html.Node) bool {
@@ -118,76 +362,117 @@ func isActionable(tag string, n *html.Node) bool {
 }
 
 func elementFromNode(tag string, n *html.Node, path []string) Element {
+	selector, quality := selectorFromNode(tag, n, path)
 	el := Element{
-		Tag:         tag,
-		Text:        nodeText(n),
-		Selector:    selectorFromNode(tag, n, path),
-		Href:        attr(n, "href"),
-		InputType:   attr(n, "type"),
-		Name:        attr(n, "name"),
-		ID:          attr(n, "id"),
-		ARIALabel:   attr(n, "aria-label"),
-		Title:       attr(n, "title"),
-		Alt:         attr(n, "alt"),
-		Value:       attr(n, "value"),
-		Placeholder: attr(n, "placeholder"),
-		Context:     contextText(n, 80),
+		Tag:             tag,
+		Text:            nodeText(n),
+		Selector:        selector,
+		SelectorQuality: quality,
+		Href:            attr(n, "href"),
+		InputType:       attr(n, "type"),
+		Name:            attr(n, "name"),
+		ID:              attr(n, "id"),
+		ARIALabel:       attr(n, "aria-label"),
+		Title:           attr(n, "title"),
+		Alt:             attr(n, "alt"),
+		Value:           attr(n, "value"),
+		Placeholder:     attr(n, "placeholder"),
+		Context:         contextText(n, 80),
+		Disabled:        isDisabled(n),
+	}
+	// Leave Visible nil for elements the markup does not hide: the HTML
+	// alone cannot prove an element is on screen.
+	if !isVisible(tag, n) {
+		hidden := false
+		el.Visible = &hidden
 	}
 	return el
 }
 
-func nodeText(n *html.Node) string {
-	var b strings.Builder
-	var walk func(*html.Node)
-	walk = func(node *html.Node) {
-		if node.Type == html.TextNode {
-			text := strings.TrimSpace(node.Data)
-			if text != "" {
-				b.WriteString(text)
-				b.WriteByte(' ')
-			}
+// isDisabled reports whether the node carries a disabled attribute, or
+// aria-disabled="true" on itself or an ancestor (ARIA applies it to the whole
+// subtree), or sits inside a disabled fieldset.
+func isDisabled(n *html.Node) bool {
+	if hasAttr(n, "disabled") {
+		return true
+	}
+	for p := n; p != nil; p = p.Parent {
+		if p.Type != html.ElementNode {
+			continue
+		}
+		if strings.EqualFold(attr(p, "aria-disabled"), "true") {
+			return true
 		}
-		for c := node.FirstChild; c != nil; c = c.NextSibling {
-			walk(c)
+		if p != n && strings.EqualFold(p.Data, "fieldset") && hasAttr(p, "disabled") {
+			return true
 		}
 	}
-	walk(n)
-	return strings.TrimSpace(b.String())
+	return false
 }
 
-func selectorFromNode(tag string, n *html.Node, path []string) string {
+// isVisible infers visibility from markup alone: the hidden attribute,
+// aria-hidden, inline display/visibility styles, and hidden inputs on the
+// node or any of its ancestors.
+func isVisible(tag string, n *html.Node) bool {
+	if tag == "input" && strings.EqualFold(attr(n, "type"), "hidden") {
+		return false
+	}
+	for p := n; p != nil; p = p.Parent {
+		if p.Type != html.ElementNode {
+			continue
+		}
+		if hasAttr(p, "hidden") || strings.EqualFold(attr(p, "aria-hidden"), "true") {
+			return false
+		}
+		style := strings.ToLower(strings.ReplaceAll(attr(p, "style"), " ", ""))
+		if strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden") {
+			return false
+		}
+	}
+	return true
+}
+
+func nodeText(n *html.Node) string {
+	return collectText(n, nil, false)
+}
+
+// selectorFromNode picks a selector for n, trying the most stable strategy
+// first, and grades it by the strategy that succeeded.
+func selectorFromNode(tag string, n *html.Node, path []string) (string, SelectorQuality) {
 	if id := attr(n, "id"); id != "" {
-		return "#" + id
+		if plainID(id) {
+			return "#" + id, SelectorHigh
+		}
+		return tag + "[id=" + quoteAttr(id) + "]", SelectorHigh
 	}
 	if v := attr(n, "data-testid"); v != "" {
-		return tag + "[data-testid=\"" + v + "\"]"
+		return tag + "[data-testid=" + quoteAttr(v) + "]", SelectorHigh
 	}
-	if v := firstDataAttr(n, []string{"data-test", "data-qa", "data-automation", "data-cy", "data-automation-id"}); v.key != "" {
-		return tag + "[" + v.key + "=\"" + v.val + "\"]"
+	if v := firstDataAttr(n, testAttrs); v.key != "" {
+		return tag + "[" + v.key + "=" + quoteAttr(v.val) + "]", SelectorHigh
 	}
 	if v := attr(n, "name"); v != "" {
-		return tag + "[name=\"" + v + "\"]"
+		return tag + "[name=" + quoteAttr(v) + "]", SelectorMedium
 	}
 	if v := attr(n, "aria-label"); v != "" {
-		return tag + "[aria-label=\"" + v + "\"]"
+		return tag + "[aria-label=" + quoteAttr(v) + "]", SelectorMedium
 	}
-	class := attr(n, "class")
-	if class != "" {
-		parts := strings.Fields(class)
-		if len(parts) > 0 {
-			return tag + "." + parts[0]
-		}
+	if class := firstField(attr(n, "class")); class != "" {
+		return tag + "." + class, SelectorLow
 	}
 	index := nthChildIndex(n)
 	if index > 0 {
-		return tag + ":nth-child(" + itoa(index) + ")"
+		return tag + ":nth-child(" + strconv.Itoa(index) + ")", SelectorFragile
 	}
 	if len(path) > 0 {
-		return strings.Join(path, " > ")
+		return strings.Join(path, " > "), SelectorFragile
 	}
-	return tag
+	return tag, SelectorLow
 }
 
+// testAttrs are the test hooks selectorFromNode uses after data-testid.
+var testAttrs = []string{"data-test", "data-qa", "data-automation", "data-cy", "data-automation-id"}
+
 func nthChildIndex(n *html.Node) int {
 	if n == nil || n.Parent == nil {
 		return 0
@@ -219,18 +504,39 @@ func firstDataAttr(n *html.Node, keys []string) dataAttr {
 	return dataAttr{}
 }
 
-func itoa(i int) string {
-	if i == 0 {
-		return "0"
+// firstField returns the first space-separated field of s.
+func firstField(s string) string {
+	for f := range strings.FieldsSeq(s) {
+		return f
 	}
-	var b [20]byte
-	pos := len(b)
-	for i > 0 {
-		pos--
-		b[pos] = byte('0' + i%10)
-		i /= 10
+	return ""
+}
+
+// refNames holds the refs of the first elements of a snapshot, so numbering
+// a typical snapshot does not allocate a string per element.
+var refNames = func() [256]string {
+	var names [256]string
+	for i := range names {
+		names[i] = "e" + strconv.Itoa(i)
+	}
+	return names
+}()
+
+// refName returns the ref of the i-th element, counting from 1.
+func refName(i int) string {
+	if i < len(refNames) {
+		return refNames[i]
 	}
-	return string(b[pos:])
+	return "e" + strconv.Itoa(i)
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return true
+		}
+	}
+	return false
 }
 
 func attr(n *html.Node, key string) string {
@@ -242,11 +548,43 @@ func attr(n *html.Node, key string) string {
 	return ""
 }
 
+// compactWhitespace trims input and collapses each run of whitespace to one
+// space. Text from the HTML walk is usually compact already and is returned
+// as is.
 func compactWhitespace(input string) string {
-	parts := strings.Fields(input)
-	return strings.Join(parts, " ")
+	if isCompact(input) {
+		return input
+	}
+	var b strings.Builder
+	b.Grow(len(input))
+	for f := range strings.FieldsSeq(input) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(f)
+	}
+	return b.String()
+}
+
+// isCompact reports whether s has no leading, trailing or repeated
+// whitespace and no whitespace other than plain spaces.
+func isCompact(s string) bool {
+	prevSpace := true
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			prevSpace = false
+			continue
+		}
+		if r != ' ' || prevSpace {
+			return false
+		}
+		prevSpace = true
+	}
+	return !prevSpace || s == ""
 }
 
+// stripHTML is the fallback when the parser fails: it drops tags and decodes
+// entities in what is left.
 func stripHTML(input string) string {
 	var b strings.Builder
 	b.Grow(len(input))
@@ -264,7 +602,21 @@ func stripHTML(input string) string {
 			}
 		}
 	}
-	return b.String()
+	return html.UnescapeString(b.String())
+}
+
+// numberElements returns a copy of elements with refs e1, e2, ... in page
+// order. Refs are resolved against the stored snapshot, so a snapshot
+// re-reduced with a lower maxElements keeps the same refs for what remains.
+func numberElements(elements []Element) []Element {
+	if len(elements) == 0 {
+		return elements
+	}
+	out := slices.Clone(elements)
+	for i := range out {
+		out[i].Ref = refName(i + 1)
+	}
+	return out
 }
 
 func buildActions(elements []Element) []Action {
@@ -277,12 +629,21 @@ func buildActions(elements []Element) []Action {
 		if verb == "" || el.Selector == "" {
 			continue
 		}
+		// A disabled field cannot accept input, so offering a type action only
+		// invites a no-op; other verbs stay listed but flagged. Hidden
+		// controls (including aria-hidden ones) cannot be used until shown,
+		// so they get no action at all.
+		if (el.Disabled && verb == "type") || (el.Visible != nil && !*el.Visible) {
+			continue
+		}
 		label := actionLabel(el)
 		actions = append(actions, Action{
 			Verb:     verb,
 			Selector: el.Selector,
+			Ref:      el.Ref,
 			Label:    label,
 			Hint:     actionHint(el),
+			Disabled: el.Disabled,
 		})
 	}
 	return actions
@@ -342,20 +703,17 @@ func contextText(n *html.Node, limit int) string {
 	if n == nil || n.Parent == nil {
 		return ""
 	}
-	var b strings.Builder
+	var b textBuilder
 	for c := n.Parent.FirstChild; c != nil; c = c.NextSibling {
 		if c == n {
+			b.boundary()
 			continue
 		}
 		if c.Type == html.TextNode {
-			text := strings.TrimSpace(c.Data)
-			if text != "" {
-				b.WriteString(text)
-				b.WriteByte(' ')
-			}
+			b.text(c.Data)
 		}
 	}
-	ctx := strings.TrimSpace(b.String())
+	ctx := b.String()
 	if limit > 0 && len(ctx) > limit {
 		ctx = ctx[:limit]
 	}
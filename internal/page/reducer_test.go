@@ -1,6 +1,9 @@
 package page
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestReducerExtractsTextAndElements(t *testing.T) {
 	reducer := NewReducer(ReduceOptions{MaxText: 50, MaxElements: 2})
@@ -16,3 +19,468 @@ func TestReducerExtractsTextAndElements(t *testing.T) {
 		t.Fatalf("expected elements to be extracted")
 	}
 }
+
+func TestReducerFlagsDisabledElements(t *testing.T) {
+	reducer := NewReducer(ReduceOptions{})
+	snap := reducer.Reduce(RawPage{
+		HTML: `<form><input id="email" type="email" disabled><button id="submit" type="submit" disabled>Submit</button><a id="help" href="/help" style="display: none">Help</a></form>`,
+	})
+	var submit *Action
+	for i := range snap.Actions {
+		switch snap.Actions[i].Selector {
+		case "#email":
+			t.Fatalf("expected type action for disabled input to be suppressed")
+		case "#submit":
+			submit = &snap.Actions[i]
+		}
+	}
+	if submit == nil || !submit.Disabled {
+		t.Fatalf("expected disabled submit action to be flagged, got %#v", snap.Actions)
+	}
+	for _, el := range snap.Elements {
+		if el.ID == "help" && (el.Visible == nil || *el.Visible) {
+			t.Fatalf("expected display:none link to be reported invisible")
+		}
+	}
+}
+
+func TestReducerActionsSkipDeadControls(t *testing.T) {
+	reducer := NewReducer(ReduceOptions{})
+	snap := reducer.Reduce(RawPage{
+		HTML: `<nav aria-disabled="true"><a id="prev" href="/page/0">Prev</a></nav>` +
+			`<a id="next" href="/page/2" aria-disabled="true">Next</a>` +
+			`<button id="ghost" aria-hidden="true">Ghost</button>` +
+			`<div aria-hidden="true"><button id="nested">Nested</button></div>` +
+			`<button id="live">Live</button>`,
+	})
+	actions := map[string]Action{}
+	for _, a := range snap.Actions {
+		actions[a.Selector] = a
+	}
+	for _, sel := range []string{"#prev", "#next"} {
+		if a, ok := actions[sel]; !ok || !a.Disabled {
+			t.Fatalf("expected %s to be listed as a disabled action, got %#v", sel, snap.Actions)
+		}
+	}
+	for _, sel := range []string{"#ghost", "#nested"} {
+		if _, ok := actions[sel]; ok {
+			t.Fatalf("expected no action for aria-hidden %s", sel)
+		}
+	}
+	if a, ok := actions["#live"]; !ok || a.Disabled {
+		t.Fatalf("expected an enabled action for #live, got %#v", snap.Actions)
+	}
+	for _, el := range snap.Elements {
+		if el.ID == "ghost" && (el.Visible == nil || *el.Visible) {
+			t.Fatalf("expected the aria-hidden button to stay listed as an invisible element")
+		}
+		if el.ID == "live" && el.Visible != nil {
+			t.Fatalf("expected visibility to be left unset for an unhidden element, got %v", *el.Visible)
+		}
+	}
+}
+
+func TestReducerBoundsHTMLInput(t *testing.T) {
+	reducer := NewReducer(ReduceOptions{MaxHTMLInput: 64})
+	body := strings.Repeat(`<p>filler</p>`, 100) + `<button id="late">Late</button>`
+	snap := reducer.Reduce(RawPage{HTML: `<html><body>` + body + `</body></html>`})
+	if !snap.HTMLTruncated {
+		t.Fatalf("expected oversized HTML to be flagged as truncated")
+	}
+	for _, el := range snap.Elements {
+		if el.ID == "late" {
+			t.Fatalf("expected content past the input bound to be dropped")
+		}
+	}
+	if got := truncateHTML(`<p>abc</p><p>def</p>`, 15); got != `<p>abc</p><p>` {
+		t.Fatalf("expected cut at tag boundary, got %q", got)
+	}
+}
+
+func TestTruncateUTF8(t *testing.T) {
+	if got := TruncateUTF8("héllo", 2); got != "h" {
+		t.Fatalf("expected the cut to back up to a rune boundary, got %q", got)
+	}
+	if got := TruncateUTF8("héllo", 3); got != "hé" {
+		t.Fatalf("expected a whole rune to be kept, got %q", got)
+	}
+	if got := TruncateUTF8("abc", 10); got != "abc" {
+		t.Fatalf("expected a short string unchanged, got %q", got)
+	}
+}
+
+func TestReducerReportsTruncation(t *testing.T) {
+	reducer := NewReducer(ReduceOptions{MaxText: 20, MaxElements: 2})
+	snap := reducer.Reduce(RawPage{
+		HTML: `<body><p>` + strings.Repeat("word ", 20) + `</p><button id="a">A</button><button id="b">B</button><button id="c">C</button></body>`,
+	})
+	if !snap.TextTruncated || len(snap.Text) != 20 {
+		t.Fatalf("expected text truncated to 20 chars, got %d (flag %t)", len(snap.Text), snap.TextTruncated)
+	}
+	if snap.ElementsTotal != 3 || snap.ElementsReturned != 2 {
+		t.Fatalf("expected 3 total / 2 returned elements, got %d / %d", snap.ElementsTotal, snap.ElementsReturned)
+	}
+
+	wide := `<body><main><p>` + strings.Repeat("é", 40) + `</p></main></body>`
+	snap = NewReducer(ReduceOptions{MaxText: 21, IncludeMainText: true}).Reduce(RawPage{HTML: wide})
+	if !snap.TextTruncated || snap.Text != strings.Repeat("é", 10) || snap.MainText != strings.Repeat("é", 10) {
+		t.Fatalf("expected text and main text cut at a rune boundary, got %q / %q", snap.Text, snap.MainText)
+	}
+
+	snap = NewReducer(ReduceOptions{}).Reduce(RawPage{Text: "short", Elements: []Element{{Tag: "a", Selector: "#x"}}})
+	if snap.TextTruncated || snap.ElementsTotal != 1 || snap.ElementsReturned != 1 {
+		t.Fatalf("expected no truncation for small page, got %#v", snap)
+	}
+}
+
+func TestReducerUniqueSelectors(t *testing.T) {
+	input := RawPage{HTML: `<body><div id="list"><button class="btn">One</button><p>x</p><button class="btn">Two</button></div><a class="solo" href="/a">Solo</a></body>`}
+
+	snap := NewReducer(ReduceOptions{}).Reduce(input)
+	if snap.Elements[0].Selector != "button.btn" || snap.Elements[1].Selector != "button.btn" {
+		t.Fatalf("expected default selectors to stay readable, got %q and %q", snap.Elements[0].Selector, snap.Elements[1].Selector)
+	}
+
+	snap = NewReducer(ReduceOptions{UniqueSelectors: true}).Reduce(input)
+	want := []string{"#list > button:nth-of-type(1)", "#list > button:nth-of-type(2)", "a.solo"}
+	for i, sel := range want {
+		if snap.Elements[i].Selector != sel {
+			t.Fatalf("element %d: selector %q, want %q", i, snap.Elements[i].Selector, sel)
+		}
+	}
+}
+
+func TestReducerMainText(t *testing.T) {
+	article := `<html><body>
+<header><nav><a href="/">Home</a><a href="/news">News</a></nav></header>
+<div class="ad-slot">Buy cheap widgets now</div>
+<div id="content">
+  <div class="share-bar"><a href="#">Share on social</a></div>
+  <p>The committee met on Tuesday to discuss the new harbour plan.</p>
+  <p>Residents raised concerns about traffic and noise during construction.</p>
+</div>
+<aside class="sidebar">Trending: celebrity gossip</aside>
+<footer>Copyright 2025 Example News</footer>
+</body></html>`
+
+	snap := NewReducer(ReduceOptions{}).Reduce(RawPage{HTML: article})
+	if snap.MainText != "" {
+		t.Fatalf("main text should be off by default, got %q", snap.MainText)
+	}
+	if !strings.Contains(snap.Text, "Copyright") {
+		t.Fatalf("full text should keep boilerplate, got %q", snap.Text)
+	}
+
+	for name, page := range map[string]string{
+		"dense block": article,
+		"article tag": strings.Replace(strings.Replace(article, `<div id="content">`, `<article>`, 1), "</div>\n<aside", "</article>\n<aside", 1),
+	} {
+		snap := NewReducer(ReduceOptions{IncludeMainText: true}).Reduce(RawPage{HTML: page})
+		if !strings.Contains(snap.MainText, "harbour plan") || !strings.Contains(snap.MainText, "traffic and noise") {
+			t.Fatalf("%s: main text missing body: %q", name, snap.MainText)
+		}
+		for _, junk := range []string{"Home", "cheap widgets", "Share on social", "celebrity", "Copyright"} {
+			if strings.Contains(snap.MainText, junk) {
+				t.Fatalf("%s: main text kept boilerplate %q: %q", name, junk, snap.MainText)
+			}
+		}
+	}
+}
+
+func TestReducerPartialParse(t *testing.T) {
+	reducer := NewReducer(ReduceOptions{})
+	cases := []struct {
+		name    string
+		html    string
+		partial bool
+	}{
+		{"complete", `<html><body><a href="/a">Home</a></body></html>`, false},
+		{"fragment", `<div><a href="/a">Home</a></div>`, false},
+		{"mid tag", `<html><body><a href="/a">Home</a><button id="go" class="pri`, true},
+		{"open script", `<html><body><a href="/a">Home</a><script>var x = "`, true},
+		{"open comment", `<body><a href="/a">Home</a><!-- nav`, true},
+		{"unclosed html", `<html><body><a href="/a">Home</a><p>more`, true},
+	}
+	for _, tc := range cases {
+		snap := reducer.Reduce(RawPage{HTML: tc.html})
+		if snap.PartialParse != tc.partial {
+			t.Fatalf("%s: expected partialParse %t, got %t", tc.name, tc.partial, snap.PartialParse)
+		}
+		if !strings.Contains(snap.Text, "Home") {
+			t.Fatalf("%s: expected text parsed before the cut, got %q", tc.name, snap.Text)
+		}
+		if len(snap.Elements) == 0 {
+			t.Fatalf("%s: expected elements parsed before the cut", tc.name)
+		}
+	}
+}
+
+func TestReducerDegenerateHTML(t *testing.T) {
+	reducer := NewReducer(ReduceOptions{UniqueSelectors: true, IncludeMainText: true})
+	inputs := []string{
+		"<",
+		"<<<>>>",
+		"</a></a></div>",
+		`<a id='x" onclick="y'>bad id</a>`,
+		`<input name="a"b"c" value=>`,
+		strings.Repeat("<div>", 5000),
+		strings.Repeat("<table><tr><td><a href=/x>x", 200),
+		"<svg><foreignObject><math><mi><a href=/m>m</a>",
+		"\x00\xff\xfe<a href=\"\x00\">nul</a>",
+	}
+	for _, in := range inputs {
+		snap := reducer.Reduce(RawPage{HTML: in})
+		for _, el := range snap.Elements {
+			if el.Selector == "" {
+				t.Fatalf("input %.30q: empty selector", in)
+			}
+		}
+	}
+
+	snap := reducer.Reduce(RawPage{HTML: `<a id='x" y' href="/a">quoted</a><button name='say "hi"'>Hi</button>`})
+	if got := snap.Elements[0].Selector; got != `a[id="x\" y"]` {
+		t.Fatalf("expected quoted id to use an escaped attribute selector, got %q", got)
+	}
+	if got := snap.Elements[1].Selector; got != `button[name="say \"hi\""]` {
+		t.Fatalf("expected escaped name selector, got %q", got)
+	}
+}
+
+func TestElementFilterLinksOnly(t *testing.T) {
+	snap := NewReducer(ReduceOptions{}).Reduce(RawPage{
+		HTML: `<body><a href="/a">Docs</a><button id="buy">Buy</button><input name="q"><a href="/b">Blog</a></body>`,
+	})
+	if snap.ElementsReturned != 4 {
+		t.Fatalf("expected 4 elements before filtering, got %d", snap.ElementsReturned)
+	}
+
+	for _, f := range []ElementFilter{{Verbs: []string{"open"}}, {Tags: []string{"A"}}} {
+		links := f.Apply(snap)
+		if len(links.Elements) != 2 || links.Elements[0].Text != "Docs" || links.Elements[1].Text != "Blog" {
+			t.Fatalf("%+v: expected only links, got %+v", f, links.Elements)
+		}
+		if len(links.Actions) != 2 || links.Actions[0].Verb != "open" {
+			t.Fatalf("%+v: expected actions rebuilt for links, got %+v", f, links.Actions)
+		}
+		if links.ElementsReturned != 2 || links.ElementsTotal != 4 {
+			t.Fatalf("%+v: expected 2 returned of 4 total, got %d / %d", f, links.ElementsReturned, links.ElementsTotal)
+		}
+	}
+	if got := (ElementFilter{}).Apply(snap); len(got.Elements) != 4 {
+		t.Fatalf("expected empty filter to keep everything, got %d", len(got.Elements))
+	}
+}
+
+func TestReducerStripsTrackingParams(t *testing.T) {
+	html := `<body>
+		<a id="promo" href="https://shop.example.com/item?id=42&utm_source=news&utm_medium=email&gclid=abc&color=red#reviews">Item</a>
+		<a id="plain" href="/about?lang=en">About</a>
+		<a id="only" href="/p?fbclid=xyz">Post</a>
+	</body>`
+
+	snap := NewReducer(ReduceOptions{}).Reduce(RawPage{HTML: html})
+	if !strings.Contains(snap.Elements[0].Href, "utm_source") || snap.Elements[0].RawHref != "" {
+		t.Fatalf("expected hrefs untouched by default, got %+v", snap.Elements[0])
+	}
+
+	snap = NewReducer(ReduceOptions{StripTrackingParams: true}).Reduce(RawPage{HTML: html})
+	want := []struct{ href, raw string }{
+		{"https://shop.example.com/item?id=42&color=red#reviews", "https://shop.example.com/item?id=42&utm_source=news&utm_medium=email&gclid=abc&color=red#reviews"},
+		{"/about?lang=en", ""},
+		{"/p", "/p?fbclid=xyz"},
+	}
+	for i, w := range want {
+		if snap.Elements[i].Href != w.href || snap.Elements[i].RawHref != w.raw {
+			t.Fatalf("element %d: href %q raw %q, want %q raw %q", i, snap.Elements[i].Href, snap.Elements[i].RawHref, w.href, w.raw)
+		}
+	}
+
+	custom := NewReducer(ReduceOptions{StripTrackingParams: true, TrackingParams: []string{"lang"}}).Reduce(RawPage{HTML: html})
+	if custom.Elements[1].Href != "/about" || !strings.Contains(custom.Elements[0].Href, "utm_source") {
+		t.Fatalf("expected only the configured params stripped, got %q / %q", custom.Elements[1].Href, custom.Elements[0].Href)
+	}
+
+	raw := []Element{{Tag: "a", Selector: "#x", Href: "/x?utm_campaign=y"}}
+	NewReducer(ReduceOptions{StripTrackingParams: true}).Reduce(RawPage{Elements: raw})
+	if raw[0].Href != "/x?utm_campaign=y" {
+		t.Fatalf("expected caller's elements to stay unmodified, got %q", raw[0].Href)
+	}
+}
+
+func TestReducerKeepsLiveValues(t *testing.T) {
+	raw := RawPage{
+		URL:  "https://example.com/form",
+		HTML: `<form><input id="email" value="old@example.com"><input id="city" value="Paris"><input id="zip"></form>`,
+		Elements: []Element{
+			{Tag: "input", Selector: "#email", ID: "email", Value: "typed@example.com"},
+			{Tag: "input", Selector: "#city", ID: "city"},
+			{Tag: "input", Selector: "#zip", ID: "zip"},
+		},
+	}
+
+	values := func(snap Snapshot) map[string]string {
+		out := map[string]string{}
+		for _, el := range snap.Elements {
+			out[el.Selector] = el.Value
+		}
+		return out
+	}
+
+	got := values(NewReducer(ReduceOptions{IncludeValues: true}).Reduce(raw))
+	if got["#email"] != "typed@example.com" {
+		t.Fatalf("live value was overwritten: %q", got["#email"])
+	}
+	if got["#city"] != "Paris" || got["#zip"] != "" {
+		t.Fatalf("expected the static value to fill only #city, got %v", got)
+	}
+	if raw.Elements[1].Value != "" {
+		t.Fatalf("reducer modified the caller's elements")
+	}
+
+	got = values(NewReducer(ReduceOptions{}).Reduce(raw))
+	if got["#email"] != "typed@example.com" || got["#city"] != "" {
+		t.Fatalf("expected extension elements unchanged without IncludeValues, got %v", got)
+	}
+}
+
+func TestReducerTextSpacing(t *testing.T) {
+	reducer := NewReducer(ReduceOptions{})
+	cases := []struct {
+		name, html, want string
+	}{
+		{"inline split word", `<p>Hel<b>lo</b>, <em>world</em>!</p>`, "Hello, world!"},
+		{"inline punctuation", `<p><strong>Price</strong>: $5</p>`, "Price: $5"},
+		{"block boundaries", `<div>Hello,</div><div>world</div><p>again</p>`, "Hello, world again"},
+		{"line break", `<p>one<br>two</p>`, "one two"},
+		{"adjacent buttons", `<button>Save</button><button>Cancel</button>`, "Save Cancel"},
+		{"whitespace runs", "<p>a  \n\t b</p>  <span> c </span>", "a b c"},
+		{"entities", `<p>Fish &amp; chips&nbsp;&mdash; &lt;today&gt; &#39;only&#39;</p>`, "Fish & chips — <today> 'only'"},
+		{"list items", `<ul><li>first</li><li>second</li></ul>`, "first second"},
+	}
+	for _, tc := range cases {
+		snap := reducer.Reduce(RawPage{HTML: tc.html})
+		if snap.Text != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, snap.Text, tc.want)
+		}
+	}
+}
+
+func TestReducerPreservesPreWhitespace(t *testing.T) {
+	doc := `<html><body><article><h1>Build log</h1>
+<p>The   step  failed:</p>
+<pre>$ go test ./...
+--- FAIL: TestX
+    x_test.go:12: want 1, got 2</pre>
+<p>Run <code>go  vet</code> next.</p>
+</article></body></html>`
+	block := "$ go test ./...\n--- FAIL: TestX\n    x_test.go:12: want 1, got 2"
+
+	snap := NewReducer(ReduceOptions{}).Reduce(RawPage{HTML: doc})
+	if strings.Contains(snap.Text, "\n") {
+		t.Fatalf("whitespace should be compacted by default, got %q", snap.Text)
+	}
+
+	snap = NewReducer(ReduceOptions{PreserveWhitespace: true, IncludeMainText: true}).Reduce(RawPage{HTML: doc})
+	want := "Build log The step failed: " + block + " Run go  vet next."
+	if snap.Text != want {
+		t.Fatalf("got text %q, want %q", snap.Text, want)
+	}
+	if !strings.Contains(snap.MainText, block) {
+		t.Fatalf("main text lost the pre block's layout: %q", snap.MainText)
+	}
+
+	// Text supplied by the extension is compacted as before.
+	snap = NewReducer(ReduceOptions{PreserveWhitespace: true}).Reduce(RawPage{Text: "a\n\n b", HTML: doc})
+	if snap.Text != "a b" {
+		t.Fatalf("expected extension text to be compacted, got %q", snap.Text)
+	}
+}
+
+func TestElementTextSpacing(t *testing.T) {
+	snap := NewReducer(ReduceOptions{}).Reduce(RawPage{
+		HTML: `<p>Read the <a id="terms" href="/terms">terms &amp; <b>cond</b>itions</a> first</p>`,
+	})
+	if len(snap.Elements) != 1 {
+		t.Fatalf("expected one element, got %#v", snap.Elements)
+	}
+	el := snap.Elements[0]
+	if el.Text != "terms & conditions" || el.Context != "Read the first" {
+		t.Fatalf("unexpected element text %q / context %q", el.Text, el.Context)
+	}
+}
+
+func TestStripHTMLDecodesEntities(t *testing.T) {
+	if got := stripHTML(`<p>a &amp; b</p>`); got != "a & b" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestSelectorQuality(t *testing.T) {
+	cases := []struct {
+		html     string
+		selector string
+		quality  SelectorQuality
+	}{
+		{`<a id="home" href="/">Home</a>`, "#home", SelectorHigh},
+		{`<a id="2nd" href="/">Home</a>`, `a[id="2nd"]`, SelectorHigh},
+		{`<button data-testid="save">Save</button>`, `button[data-testid="save"]`, SelectorHigh},
+		{`<button data-cy="save">Save</button>`, `button[data-cy="save"]`, SelectorHigh},
+		{`<input name="q">`, `input[name="q"]`, SelectorMedium},
+		{`<button aria-label="Close dialog">x</button>`, `button[aria-label="Close dialog"]`, SelectorMedium},
+		{`<button class="btn primary">Go</button>`, "button.btn", SelectorLow},
+		{`<p>x</p><button>Go</button>`, "button:nth-child(2)", SelectorFragile},
+	}
+	for _, tc := range cases {
+		snap := NewReducer(ReduceOptions{}).Reduce(RawPage{HTML: "<body>" + tc.html + "</body>"})
+		if len(snap.Elements) != 1 {
+			t.Fatalf("%s: expected one element, got %d", tc.html, len(snap.Elements))
+		}
+		el := snap.Elements[0]
+		if el.Selector != tc.selector || el.SelectorQuality != tc.quality {
+			t.Fatalf("%s: got %q (%s), want %q (%s)", tc.html, el.Selector, el.SelectorQuality, tc.selector, tc.quality)
+		}
+		// The extension's own elements carry no grade; reading the selector
+		// must give the same one.
+		if got := selectorQuality(tc.selector); got != tc.quality {
+			t.Fatalf("selectorQuality(%q) = %s, want %s", tc.selector, got, tc.quality)
+		}
+	}
+
+	snap := NewReducer(ReduceOptions{UniqueSelectors: true}).Reduce(RawPage{HTML: `<body><div id="list"><button class="btn">One</button><button class="btn">Two</button></div></body>`})
+	if q := snap.Elements[0].SelectorQuality; q != SelectorFragile {
+		t.Fatalf("expected a structural selector to be fragile, got %s", q)
+	}
+}
+
+func TestReducerRatesSuppliedElements(t *testing.T) {
+	raw := RawPage{Elements: []Element{{Tag: "a", Selector: "#home"}, {Tag: "div", Selector: "main > div"}}}
+	snap := NewReducer(ReduceOptions{}).Reduce(raw)
+	if snap.Elements[0].SelectorQuality != SelectorHigh || snap.Elements[1].SelectorQuality != SelectorFragile {
+		t.Fatalf("unexpected grades %+v", snap.Elements)
+	}
+	if raw.Elements[0].SelectorQuality != "" {
+		t.Fatal("grading modified the raw page's elements")
+	}
+}
+
+func TestReducerDebug(t *testing.T) {
+	reducer := NewReducer(ReduceOptions{MaxElements: 1})
+	html := `<html><body><a href="/a">A</a><a href="/b">B</a></body></html>`
+	snap := reducer.Reduce(RawPage{HTML: html})
+	d := snap.Debug
+	if d == nil || d.ElementSource != ElementSourceHTML || d.HTMLBytes != len(html) || d.ParsedElements != 2 || d.ElementsTotal != 2 || d.ElementsReturned != 1 {
+		t.Fatalf("unexpected debug for parsed page: %+v", d)
+	}
+
+	snap = reducer.Reduce(RawPage{Text: "hi", Elements: []Element{{Tag: "a", Selector: "#a"}}})
+	d = snap.Debug
+	if d.ElementSource != ElementSourceExtension || d.ExtensionElements != 1 || d.ParseMs != 0 || d.TextBytes != 2 {
+		t.Fatalf("unexpected debug for extension elements: %+v", d)
+	}
+
+	first, second := reducer.Reduce(RawPage{HTML: html}), reducer.Reduce(RawPage{HTML: html})
+	first.Debug.ReduceMs, second.Debug.ReduceMs = 1, 2
+	if ContentHash(first) != ContentHash(second) {
+		t.Fatal("debug timings leaked into the content hash")
+	}
+}
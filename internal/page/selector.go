@@ -0,0 +1,170 @@
+package page
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// uniquifySelectors rewrites the selector of every element that matches more
+// than one node in the document into a structural path built from
+// :nth-of-type steps. The path is anchored at the closest ancestor with a
+// unique id, or at the document root. Such selectors always resolve to exactly
+// one element but are longer and break more easily when the page layout
+// shifts, which is why the rewrite is opt-in.
+func uniquifySelectors(elements []Element, nodes []*html.Node, all []*html.Node) {
+	ids := make(map[string]int)
+	for _, m := range all {
+		if id := attr(m, "id"); id != "" {
+			ids[id]++
+		}
+	}
+	for i := range elements {
+		n := nodes[i]
+		tag := strings.ToLower(n.Data)
+		matches := 0
+		for _, m := range all {
+			if sameSelector(tag, n, m) {
+				matches++
+				if matches > 1 {
+					break
+				}
+			}
+		}
+		if matches > 1 {
+			elements[i].Selector = structuralSelector(n, ids)
+			elements[i].SelectorQuality = SelectorFragile
+		}
+	}
+}
+
+// sameSelector reports whether m would be matched by the selector that
+// selectorFromNode produces for n. Keep the branches in step with it.
+func sameSelector(tag string, n, m *html.Node) bool {
+	mtag := strings.ToLower(m.Data)
+	if id := attr(n, "id"); id != "" {
+		return attr(m, "id") == id
+	}
+	if mtag != tag {
+		return false
+	}
+	if v := attr(n, "data-testid"); v != "" {
+		return attr(m, "data-testid") == v
+	}
+	if v := firstDataAttr(n, testAttrs); v.key != "" {
+		return attr(m, v.key) == v.val
+	}
+	if v := attr(n, "name"); v != "" {
+		return attr(m, "name") == v
+	}
+	if v := attr(n, "aria-label"); v != "" {
+		return attr(m, "aria-label") == v
+	}
+	if parts := strings.Fields(attr(n, "class")); len(parts) > 0 {
+		for _, c := range strings.Fields(attr(m, "class")) {
+			if c == parts[0] {
+				return true
+			}
+		}
+		return false
+	}
+	if index := nthChildIndex(n); index > 0 {
+		return nthChildIndex(m) == index
+	}
+	return n == m
+}
+
+func structuralSelector(n *html.Node, ids map[string]int) string {
+	var steps []string
+	for cur := n; cur != nil && cur.Type == html.ElementNode; cur = cur.Parent {
+		if id := attr(cur, "id"); plainID(id) && ids[id] == 1 {
+			steps = append(steps, "#"+id)
+			break
+		}
+		tag := strings.ToLower(cur.Data)
+		if cur.Parent == nil || cur.Parent.Type != html.ElementNode {
+			steps = append(steps, tag)
+			break
+		}
+		steps = append(steps, tag+":nth-of-type("+strconv.Itoa(nthOfTypeIndex(cur))+")")
+	}
+	for i, j := 0, len(steps)-1; i < j; i, j = i+1, j-1 {
+		steps[i], steps[j] = steps[j], steps[i]
+	}
+	return strings.Join(steps, " > ")
+}
+
+func nthOfTypeIndex(n *html.Node) int {
+	idx := 0
+	for c := n.Parent.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && strings.EqualFold(c.Data, n.Data) {
+			idx++
+		}
+		if c == n {
+			return idx
+		}
+	}
+	return idx
+}
+
+// rateSelectors fills in SelectorQuality for elements that arrived without
+// one, such as those the extension collects itself, by reading the selector.
+// elements is not modified; a copy is returned when anything changes.
+func rateSelectors(elements []Element) []Element {
+	var out []Element
+	for i, el := range elements {
+		if el.SelectorQuality != "" || el.Selector == "" {
+			continue
+		}
+		if out == nil {
+			out = slices.Clone(elements)
+		}
+		out[i].SelectorQuality = selectorQuality(el.Selector)
+	}
+	if out == nil {
+		return elements
+	}
+	return out
+}
+
+// selectorQuality grades a selector by its text, matching the grades
+// selectorFromNode gives the same shapes.
+func selectorQuality(sel string) SelectorQuality {
+	switch shape := withoutAttrValues(sel); {
+	case strings.Contains(shape, ":nth-") || strings.ContainsAny(shape, " >+~"):
+		return SelectorFragile
+	case strings.HasPrefix(sel, "#") || strings.Contains(sel, "[id=") || strings.Contains(sel, "[data-testid="):
+		return SelectorHigh
+	}
+	for _, key := range testAttrs {
+		if strings.Contains(sel, "["+key+"=") {
+			return SelectorHigh
+		}
+	}
+	if strings.Contains(sel, "[name=") || strings.Contains(sel, "[aria-label=") {
+		return SelectorMedium
+	}
+	return SelectorLow
+}
+
+// withoutAttrValues drops the contents of [...] so quoted attribute values
+// are not mistaken for combinators.
+func withoutAttrValues(sel string) string {
+	var b strings.Builder
+	depth := 0
+	for _, r := range sel {
+		switch {
+		case r == '[':
+			depth++
+			b.WriteRune(r)
+		case r == ']' && depth > 0:
+			depth--
+			b.WriteRune(r)
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
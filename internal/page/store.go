@@ -1,39 +1,168 @@
 package page
 
 import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"sync"
 
 	"github.com/google/uuid"
 )
 
+// DefaultMaxBytes is the combined snapshot size a store keeps when
+// StoreOptions.MaxBytes is zero. Each snapshot holds the whole page it was
+// reduced from, so an unbounded store grows by pages.
+const DefaultMaxBytes = 64 << 20
+
+// StoreOptions bounds what a Store retains; when both are set, whichever
+// binds first evicts. Eviction drops the least recently used snapshot, where
+// Put and Get count as uses.
+type StoreOptions struct {
+	// MaxSnapshots caps how many snapshots are kept; zero is unlimited.
+	MaxSnapshots int
+	// MaxBytes caps the combined serialized size of kept snapshots, including
+	// the page each was reduced from; zero uses DefaultMaxBytes.
+	MaxBytes int64
+}
+
 type Store struct {
-	mu     sync.RWMutex
-	items  map[string]Snapshot
-	latest string
+	mu       sync.RWMutex
+	items    map[string]*list.Element // values are *storeEntry
+	latest   string
+	disabled bool
+
+	opts  StoreOptions
+	order *list.List // least recently used first
+	bytes int64
+}
+
+type storeEntry struct {
+	snapshot Snapshot
+	size     int64
 }
 
 func NewStore() *Store {
-	return &Store{items: make(map[string]Snapshot)}
+	return NewStoreWithOptions(StoreOptions{})
+}
+
+// NewStoreWithOptions returns a store that evicts its least recently used
+// snapshots once opts is exceeded. The latest snapshot is never evicted, even
+// when it alone is over MaxBytes, so Latest keeps working.
+func NewStoreWithOptions(opts StoreOptions) *Store {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultMaxBytes
+	}
+	return &Store{items: make(map[string]*list.Element), order: list.New(), opts: opts}
+}
+
+// NewStoreWithLimit returns a store that keeps at most n snapshots; n <= 0
+// is unlimited.
+func NewStoreWithLimit(n int) *Store {
+	return NewStoreWithOptions(StoreOptions{MaxSnapshots: max(n, 0)})
+}
+
+// NewDisabledStore returns a store that keeps nothing: Put returns "" and
+// Get and Latest always report not found. Use it when page content must not
+// be retained, at the cost of snapshots not being readable again by id.
+func NewDisabledStore() *Store {
+	return &Store{items: make(map[string]*list.Element), order: list.New(), disabled: true}
+}
+
+// Disabled reports whether the store was created by NewDisabledStore.
+func (s *Store) Disabled() bool {
+	return s.disabled
 }
 
+// Put stores snapshot and returns its ID. A snapshot without an ID whose
+// content matches the latest entry reuses that entry's ID instead.
 func (s *Store) Put(snapshot Snapshot) string {
+	if s.disabled {
+		return ""
+	}
+	// Hashing and sizing encode the whole page, so do both before taking the
+	// lock rather than stalling every Get behind them.
+	if snapshot.ContentHash == "" {
+		snapshot.ContentHash = ContentHash(snapshot)
+	}
+	newID := snapshot.ID == ""
+	if newID {
+		snapshot.ID = uuid.New().String()
+	}
+	size := snapshotSize(snapshot)
+	id := snapshot.ID
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	id := snapshot.ID
-	if id == "" {
-		id = uuid.New().String()
-		snapshot.ID = id
+	if elem, ok := s.items[s.latest]; ok && newID && elem.Value.(*storeEntry).snapshot.ContentHash == snapshot.ContentHash {
+		s.order.MoveToBack(elem)
+		return s.latest
 	}
-	s.items[id] = snapshot
+	if elem, ok := s.items[id]; ok {
+		s.remove(elem)
+	}
+	s.items[id] = s.order.PushBack(&storeEntry{snapshot: snapshot, size: size})
+	s.bytes += size
 	s.latest = id
+	s.evict()
 	return id
 }
 
-func (s *Store) Get(id string) (Snapshot, bool) {
+// evict drops the least recently used snapshots until the store is within
+// its limits. It runs at the end of Put, when the latest snapshot was just
+// used and so is last in order; stopping at one entry keeps it.
+func (s *Store) evict() {
+	for s.order.Len() > 1 && s.overLimit() {
+		s.remove(s.order.Front())
+	}
+}
+
+func (s *Store) overLimit() bool {
+	if s.opts.MaxSnapshots > 0 && len(s.items) > s.opts.MaxSnapshots {
+		return true
+	}
+	return s.bytes > s.opts.MaxBytes
+}
+
+func (s *Store) remove(elem *list.Element) {
+	entry := s.order.Remove(elem).(*storeEntry)
+	delete(s.items, entry.snapshot.ID)
+	s.bytes -= entry.size
+}
+
+// Bytes returns the combined size of the stored snapshots as counted
+// against StoreOptions.MaxBytes.
+func (s *Store) Bytes() int64 {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	snap, ok := s.items[id]
-	return snap, ok
+	return s.bytes
+}
+
+// snapshotSize approximates the memory a stored snapshot holds by its JSON
+// size plus that of the raw page kept for re-reduction.
+func snapshotSize(snapshot Snapshot) int64 {
+	var size int64
+	if data, err := json.Marshal(snapshot); err == nil {
+		size += int64(len(data))
+	}
+	if snapshot.raw != nil {
+		if data, err := json.Marshal(snapshot.raw); err == nil {
+			size += int64(len(data))
+		}
+	}
+	return size
+}
+
+// Get returns the snapshot stored under id and marks it recently used.
+func (s *Store) Get(id string) (Snapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.items[id]
+	if !ok {
+		return Snapshot{}, false
+	}
+	s.order.MoveToBack(elem)
+	return elem.Value.(*storeEntry).snapshot, true
 }
 
 func (s *Store) Latest() (Snapshot, bool) {
@@ -42,6 +171,22 @@ func (s *Store) Latest() (Snapshot, bool) {
 	if s.latest == "" {
 		return Snapshot{}, false
 	}
-	snap, ok := s.items[s.latest]
-	return snap, ok
+	elem, ok := s.items[s.latest]
+	if !ok {
+		return Snapshot{}, false
+	}
+	return elem.Value.(*storeEntry).snapshot, true
+}
+
+// ContentHash returns a hex SHA-256 of the snapshot with ID and ContentHash
+// cleared, so identical page content hashes the same across snapshots.
+func ContentHash(snapshot Snapshot) string {
+	snapshot.ID = ""
+	snapshot.ContentHash = ""
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,166 @@
+package page
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStoreReusesIDForIdenticalSnapshot(t *testing.T) {
+	store := NewStore()
+	reducer := NewReducer(ReduceOptions{})
+	raw := RawPage{URL: "https://example.com", Title: "Example", HTML: `<main><p>Hello</p><a href="/next">Next</a></main>`}
+
+	first := store.Put(reducer.Reduce(raw))
+	second := store.Put(reducer.Reduce(raw))
+	if first != second {
+		t.Fatalf("identical snapshots got different ids: %s, %s", first, second)
+	}
+
+	raw.Title = "Changed"
+	third := store.Put(reducer.Reduce(raw))
+	if third == first {
+		t.Fatalf("changed snapshot reused id %s", first)
+	}
+	latest, ok := store.Latest()
+	if !ok || latest.ID != third || latest.Title != "Changed" {
+		t.Fatalf("latest = %#v, want id %s", latest, third)
+	}
+}
+
+func TestDisabledStoreKeepsNothing(t *testing.T) {
+	store := NewDisabledStore()
+	reducer := NewReducer(ReduceOptions{})
+	snap := reducer.Reduce(RawPage{URL: "https://example.com", HTML: `<p>Secret</p>`})
+	snap.ID = "fixed"
+
+	if id := store.Put(snap); id != "" {
+		t.Fatalf("expected no id from a disabled store, got %q", id)
+	}
+	if _, ok := store.Get("fixed"); ok {
+		t.Fatalf("expected Get to miss on a disabled store")
+	}
+	if _, ok := store.Latest(); ok {
+		t.Fatalf("expected Latest to miss on a disabled store")
+	}
+	if len(store.items) != 0 {
+		t.Fatalf("expected no retained snapshots, got %d", len(store.items))
+	}
+}
+
+func TestStoreEvictsByBytes(t *testing.T) {
+	reducer := NewReducer(ReduceOptions{})
+	small := func(n int) Snapshot {
+		return reducer.Reduce(RawPage{URL: "https://example.com/small", Title: string(rune('a' + n)), HTML: `<p>tiny</p>`})
+	}
+	big := reducer.Reduce(RawPage{URL: "https://example.com/big", HTML: `<p>` + strings.Repeat("x", 4000) + `</p>`})
+	// Sizes as stored, with the ID and content hash Put fills in.
+	storedSize := func(snap Snapshot) int64 {
+		probe := NewStore()
+		probe.Put(snap)
+		return probe.Bytes()
+	}
+	smallSize := storedSize(small(0))
+	bigSize := storedSize(big)
+
+	store := NewStoreWithOptions(StoreOptions{MaxBytes: bigSize + 2*smallSize})
+	a := store.Put(small(0))
+	b := store.Put(small(1))
+	if store.Bytes() != 2*smallSize {
+		t.Fatalf("expected %d bytes stored, got %d", 2*smallSize, store.Bytes())
+	}
+	bigID := store.Put(big)
+	// Checked without Get, which would make a the most recently used.
+	if _, ok := store.items[a]; !ok {
+		t.Fatalf("expected the oldest small snapshot to fit alongside the big one")
+	}
+	c := store.Put(small(2))
+	if _, ok := store.Get(a); ok {
+		t.Fatalf("expected the oldest snapshot to be evicted once over budget")
+	}
+	for _, id := range []string{b, bigID, c} {
+		if _, ok := store.Get(id); !ok {
+			t.Fatalf("expected %s to be kept", id)
+		}
+	}
+	if store.Bytes() > bigSize+2*smallSize {
+		t.Fatalf("store over budget: %d bytes", store.Bytes())
+	}
+
+	huge := reducer.Reduce(RawPage{URL: "https://example.com/huge", HTML: `<p>` + strings.Repeat("y", 20000) + `</p>`})
+	hugeID := store.Put(huge)
+	if latest, ok := store.Latest(); !ok || latest.ID != hugeID {
+		t.Fatalf("expected an over-budget snapshot to still be kept as latest")
+	}
+	if len(store.items) != 1 || store.Bytes() != snapshotSize(store.items[hugeID].Value.(*storeEntry).snapshot) {
+		t.Fatalf("expected everything older evicted, have %d items / %d bytes", len(store.items), store.Bytes())
+	}
+}
+
+func TestStoreCountAndByteCapsCombine(t *testing.T) {
+	reducer := NewReducer(ReduceOptions{})
+	store := NewStoreWithOptions(StoreOptions{MaxSnapshots: 2, MaxBytes: 1 << 20})
+	var ids []string
+	for i := 0; i < 3; i++ {
+		ids = append(ids, store.Put(reducer.Reduce(RawPage{URL: "https://example.com", Title: string(rune('a' + i)), HTML: `<p>tiny</p>`})))
+	}
+	if _, ok := store.Get(ids[0]); ok || len(store.items) != 2 {
+		t.Fatalf("expected the count cap to evict the oldest, have %d items", len(store.items))
+	}
+
+	snap, _ := store.Get(ids[1])
+	replaced := reducer.Reduce(RawPage{URL: "https://example.com", HTML: `<p>` + strings.Repeat("z", 100) + `</p>`})
+	replaced.ID = snap.ID
+	store.Put(replaced)
+	if len(store.items) != 2 || store.order.Len() != 2 {
+		t.Fatalf("expected re-putting an id to replace it, have %d items / %d ordered", len(store.items), store.order.Len())
+	}
+	want := snapshotSize(store.items[ids[1]].Value.(*storeEntry).snapshot) + snapshotSize(store.items[ids[2]].Value.(*storeEntry).snapshot)
+	if store.Bytes() != want {
+		t.Fatalf("expected %d bytes after replacing, got %d", want, store.Bytes())
+	}
+}
+
+func TestStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	reducer := NewReducer(ReduceOptions{})
+	put := func(store *Store, i int) string {
+		return store.Put(reducer.Reduce(RawPage{URL: "https://example.com", Title: string(rune('a' + i)), HTML: `<p>tiny</p>`}))
+	}
+	const n = 3
+	store := NewStoreWithLimit(n)
+	var ids []string
+	for i := range n + 1 {
+		ids = append(ids, put(store, i))
+	}
+	if _, ok := store.Get(ids[0]); ok || len(store.items) != n {
+		t.Fatalf("expected the oldest of %d snapshots to be evicted, have %d items", n+1, len(store.items))
+	}
+	if latest, ok := store.Latest(); !ok || latest.ID != ids[n] {
+		t.Fatalf("expected Latest to still resolve to %s", ids[n])
+	}
+
+	// Reading ids[1] makes ids[2] the least recently used.
+	if _, ok := store.Get(ids[1]); !ok {
+		t.Fatalf("expected %s to be kept", ids[1])
+	}
+	next := put(store, n+1)
+	if _, ok := store.items[ids[2]]; ok {
+		t.Fatalf("expected the least recently used snapshot to be evicted")
+	}
+	for _, id := range []string{ids[1], ids[3], next} {
+		if _, ok := store.items[id]; !ok {
+			t.Fatalf("expected %s to be kept", id)
+		}
+	}
+
+}
+
+func TestStoreDefaultsByteBudget(t *testing.T) {
+	store := NewStore()
+	if store.opts.MaxBytes != DefaultMaxBytes {
+		t.Fatalf("expected an unset MaxBytes to default to %d, got %d", DefaultMaxBytes, store.opts.MaxBytes)
+	}
+	store = NewStoreWithOptions(StoreOptions{MaxBytes: 1 << 10})
+	if store.opts.MaxBytes != 1<<10 {
+		t.Fatalf("expected an explicit MaxBytes to be kept, got %d", store.opts.MaxBytes)
+	}
+}
@@ -0,0 +1,142 @@
+package page
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// blockTags separate words on either side of them, as their layout does in a
+// browser. Form controls are included so adjacent buttons do not run
+// together.
+var blockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"br": true, "button": true, "caption": true, "dd": true, "details": true,
+	"div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true,
+	"li": true, "main": true, "nav": true, "ol": true, "option": true,
+	"p": true, "pre": true, "section": true, "select": true, "summary": true,
+	"table": true, "td": true, "textarea": true, "th": true, "tr": true,
+	"ul": true,
+}
+
+// TruncateUTF8 cuts s to at most n bytes without splitting a rune.
+func TruncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func isBlock(n *html.Node) bool {
+	return n.Type == html.ElementNode && blockTags[strings.ToLower(n.Data)]
+}
+
+// preservesSpace reports whether n keeps its text's whitespace as written,
+// when the reducer is asked to.
+func preservesSpace(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	switch strings.ToLower(n.Data) {
+	case "pre", "code", "textarea":
+		return true
+	}
+	return false
+}
+
+// textBuilder joins text nodes the way a browser renders them: whitespace
+// within and between inline nodes collapses to one space, text split only by
+// inline tags stays joined ("Hel<b>lo</b>" is "Hello"), and block boundaries
+// always separate words. Entities are already decoded by the HTML parser.
+type textBuilder struct {
+	b     strings.Builder
+	space bool // a separator is owed before the next word
+}
+
+func (t *textBuilder) text(s string) {
+	if s == "" {
+		return
+	}
+	if r, _ := utf8.DecodeRuneInString(s); unicode.IsSpace(r) {
+		t.space = true
+	}
+	for word := range strings.FieldsSeq(s) {
+		if t.space && t.b.Len() > 0 {
+			t.b.WriteByte(' ')
+		}
+		t.b.WriteString(word)
+		t.space = true
+	}
+	if r, _ := utf8.DecodeLastRuneInString(s); !unicode.IsSpace(r) {
+		t.space = false
+	}
+}
+
+// verbatim writes s with its whitespace intact, separated from a preceding
+// word only when s does not start with whitespace of its own.
+func (t *textBuilder) verbatim(s string) {
+	if s == "" {
+		return
+	}
+	if r, _ := utf8.DecodeRuneInString(s); t.space && t.b.Len() > 0 && !unicode.IsSpace(r) {
+		t.b.WriteByte(' ')
+	}
+	t.b.WriteString(s)
+	t.space = false
+}
+
+// boundary ends the current word, as at the edge of a block element.
+func (t *textBuilder) boundary() {
+	t.space = true
+}
+
+func (t *textBuilder) String() string {
+	return t.b.String()
+}
+
+// collectText returns the text below n. skip, when set, drops element
+// subtrees other than n itself. With preserve, text inside pre, code and
+// textarea keeps its whitespace.
+func collectText(n *html.Node, skip func(*html.Node) bool, preserve bool) string {
+	var t textBuilder
+	verbatim := 0
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		if node.Type == html.ElementNode && node != n && skip != nil && skip(node) {
+			return
+		}
+		if node.Type == html.TextNode {
+			if verbatim > 0 {
+				t.verbatim(node.Data)
+			} else {
+				t.text(node.Data)
+			}
+		}
+		block := isBlock(node)
+		if block {
+			t.boundary()
+		}
+		keep := preserve && preservesSpace(node)
+		if keep {
+			verbatim++
+		}
+		for c := node.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+		if keep {
+			verbatim--
+		}
+		if block {
+			t.boundary()
+		}
+	}
+	walk(n)
+	return t.String()
+}
@@ -0,0 +1,68 @@
+package page
+
+import (
+	"net/url"
+	"strings"
+)
+
+// DefaultTrackingParams are removed by StripTrackingParams when
+// ReduceOptions.TrackingParams is empty. A trailing "*" matches by prefix.
+var DefaultTrackingParams = []string{"utm_*", "gclid", "dclid", "fbclid", "msclkid", "yclid", "mc_cid", "mc_eid", "igshid", "_ga", "_gl"}
+
+// stripTracking returns a copy of elements with matching query parameters
+// removed from each href, keeping the original in RawHref when it changes.
+// The input may be the caller's RawPage.Elements, so it is not modified.
+func stripTracking(elements []Element, params []string) []Element {
+	out := make([]Element, len(elements))
+	copy(out, elements)
+	for i := range out {
+		if cleaned, ok := stripHrefParams(out[i].Href, params); ok {
+			out[i].RawHref = out[i].Href
+			out[i].Href = cleaned
+		}
+	}
+	return out
+}
+
+// stripHrefParams returns href without query parameters named in params and
+// whether anything was removed. Hrefs that do not parse are left alone.
+func stripHrefParams(href string, params []string) (string, bool) {
+	if !strings.Contains(href, "?") {
+		return href, false
+	}
+	u, err := url.Parse(href)
+	if err != nil || u.RawQuery == "" {
+		return href, false
+	}
+	// Walk the raw query rather than url.Values so surviving parameters keep
+	// their order and encoding.
+	parts := strings.Split(u.RawQuery, "&")
+	kept := parts[:0]
+	for _, part := range parts {
+		key, _, _ := strings.Cut(part, "=")
+		if name, err := url.QueryUnescape(key); err == nil && isTrackingParam(name, params) {
+			continue
+		}
+		kept = append(kept, part)
+	}
+	if len(kept) == len(parts) {
+		return href, false
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	return u.String(), true
+}
+
+func isTrackingParam(name string, params []string) bool {
+	name = strings.ToLower(name)
+	for _, p := range params {
+		p = strings.ToLower(p)
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+	return false
+}
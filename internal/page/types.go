@@ -1,10 +1,19 @@
 package page
 
 type Element struct {
-	Tag         string `json:"tag,omitempty"`
-	Text        string `json:"text,omitempty"`
-	Selector    string `json:"selector,omitempty"`
-	Href        string `json:"href,omitempty"`
+	// Ref numbers the element within its snapshot (e1, e2, ...) so tools can
+	// act on it later by ref instead of selector.
+	Ref      string `json:"ref,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+	Text     string `json:"text,omitempty"`
+	Selector string `json:"selector,omitempty"`
+	// SelectorQuality says how likely Selector is to keep matching this
+	// element as the page changes; prefer high over fragile handles.
+	SelectorQuality SelectorQuality `json:"selectorQuality,omitempty"`
+	Href            string          `json:"href,omitempty"`
+	// RawHref is the href before tracking parameters were stripped; it is only
+	// set when stripping changed it.
+	RawHref     string `json:"rawHref,omitempty"`
 	InputType   string `json:"inputType,omitempty"`
 	Name        string `json:"name,omitempty"`
 	ID          string `json:"id,omitempty"`
@@ -14,22 +23,102 @@ type Element struct {
 	Value       string `json:"value,omitempty"`
 	Placeholder string `json:"placeholder,omitempty"`
 	Context     string `json:"context,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
+	Visible     *bool  `json:"visible,omitempty"`
 }
 
+// SelectorQuality grades a selector by the strategy that produced it.
+type SelectorQuality string
+
+const (
+	// SelectorHigh selectors use an id or a test attribute such as
+	// data-testid, which pages keep stable on purpose.
+	SelectorHigh SelectorQuality = "high"
+	// SelectorMedium selectors use a form name or aria-label, which change
+	// with the page's wording or forms.
+	SelectorMedium SelectorQuality = "medium"
+	// SelectorLow selectors use a class or just the tag, and may match other
+	// elements after a restyle.
+	SelectorLow SelectorQuality = "low"
+	// SelectorFragile selectors depend on document position (nth-child or a
+	// structural path) and break when elements are added or moved.
+	SelectorFragile SelectorQuality = "fragile"
+)
+
 type Snapshot struct {
-	ID       string    `json:"id"`
-	URL      string    `json:"url"`
-	Title    string    `json:"title,omitempty"`
-	Text     string    `json:"text,omitempty"`
-	Elements []Element `json:"elements,omitempty"`
-	Actions  []Action  `json:"actions,omitempty"`
+	ID            string    `json:"id"`
+	URL           string    `json:"url"`
+	Title         string    `json:"title,omitempty"`
+	Text          string    `json:"text,omitempty"`
+	MainText      string    `json:"mainText,omitempty"`
+	Elements      []Element `json:"elements,omitempty"`
+	Actions       []Action  `json:"actions,omitempty"`
+	HTMLTruncated bool      `json:"htmlTruncated,omitempty"`
+	// PartialParse is set when the HTML looked cut off or could not be parsed
+	// cleanly; text and elements hold whatever was recovered.
+	PartialParse bool `json:"partialParse,omitempty"`
+	// TextTruncated, ElementsTotal and ElementsReturned tell the caller how
+	// much the reducer dropped so it can ask for a narrower snapshot.
+	TextTruncated    bool `json:"textTruncated,omitempty"`
+	ElementsTotal    int  `json:"elementsTotal"`
+	ElementsReturned int  `json:"elementsReturned"`
+	// Pagination points at the page's next and previous controls, when it
+	// has any.
+	Pagination *Pagination `json:"pagination,omitempty"`
+	// ContentHash identifies the snapshot content independent of its ID so
+	// the store can recognise an unchanged page.
+	ContentHash string `json:"contentHash,omitempty"`
+	// Debug records how the snapshot was produced. It is left out of the
+	// JSON form, and so of ContentHash, since timings differ on every run.
+	Debug *SnapshotDebug `json:"-"`
+
+	// raw is the page the snapshot was reduced from, kept so a stored
+	// snapshot can be reduced again with other limits.
+	raw *RawPage
+}
+
+// Raw returns the page the snapshot was reduced from. It is false for
+// snapshots that were not produced by a Reducer.
+func (s Snapshot) Raw() (RawPage, bool) {
+	if s.raw == nil {
+		return RawPage{}, false
+	}
+	return *s.raw, true
 }
 
 type Action struct {
 	Verb     string `json:"verb"`
 	Selector string `json:"selector"`
+	Ref      string `json:"ref,omitempty"`
 	Label    string `json:"label,omitempty"`
 	Hint     string `json:"hint,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// Element sources reported in SnapshotDebug.
+const (
+	ElementSourceHTML      = "html"
+	ElementSourceExtension = "extension"
+	ElementSourceNone      = "none"
+)
+
+// SnapshotDebug breaks down where a snapshot's time went and what it was
+// built from. Durations are in milliseconds.
+type SnapshotDebug struct {
+	// ExtensionMs is the round trip to the extension, including its own DOM
+	// capture; only the browser client can fill it in.
+	ExtensionMs float64 `json:"extensionMs,omitempty"`
+	ParseMs     float64 `json:"parseMs"`
+	ReduceMs    float64 `json:"reduceMs"`
+	// ElementSource is html when elements were parsed from the page HTML and
+	// extension when the extension listed them.
+	ElementSource     string `json:"elementSource"`
+	HTMLBytes         int    `json:"htmlBytes"`
+	TextBytes         int    `json:"textBytes"`
+	ExtensionElements int    `json:"extensionElements"`
+	ParsedElements    int    `json:"parsedElements"`
+	ElementsTotal     int    `json:"elementsTotal"`
+	ElementsReturned  int    `json:"elementsReturned"`
 }
 
 type RawPage struct {
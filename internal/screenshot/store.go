@@ -0,0 +1,125 @@
+// Package screenshot keeps captured screenshots so they can be read again by
+// id without capturing the page a second time.
+package screenshot
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultMaxShots is how many screenshots a store keeps when
+// Options.MaxShots is zero.
+const DefaultMaxShots = 20
+
+// DefaultMaxBytes is the combined image size a store keeps when
+// Options.MaxBytes is zero.
+const DefaultMaxBytes = 64 << 20
+
+// Shot is a stored screenshot. Data holds the decoded image bytes.
+type Shot struct {
+	ID         string    `json:"id"`
+	MIMEType   string    `json:"mimeType"`
+	Format     string    `json:"format,omitempty"`
+	Selector   string    `json:"selector,omitempty"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	Size       int       `json:"size"`
+	CapturedAt time.Time `json:"capturedAt"`
+	Data       []byte    `json:"-"`
+}
+
+// Options bounds a Store; the oldest screenshots are evicted first.
+type Options struct {
+	// MaxShots caps how many screenshots are kept; zero uses DefaultMaxShots.
+	MaxShots int
+	// MaxBytes caps the combined image size; zero uses DefaultMaxBytes.
+	MaxBytes int64
+	Now      func() time.Time
+}
+
+type Store struct {
+	mu    sync.RWMutex
+	opts  Options
+	items map[string]Shot
+	order []string // ids, oldest first
+	bytes int64
+}
+
+func NewStore(opts Options) *Store {
+	if opts.MaxShots <= 0 {
+		opts.MaxShots = DefaultMaxShots
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultMaxBytes
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Store{opts: opts, items: make(map[string]Shot)}
+}
+
+// Put stores shot under a new id, filling in Size and CapturedAt, and
+// returns the stored copy. The newest screenshot is always kept, even when
+// it alone exceeds MaxBytes.
+func (s *Store) Put(shot Shot) Shot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	shot.ID = uuid.New().String()
+	shot.Size = len(shot.Data)
+	if shot.CapturedAt.IsZero() {
+		shot.CapturedAt = s.opts.Now()
+	}
+	s.items[shot.ID] = shot
+	s.order = append(s.order, shot.ID)
+	s.bytes += int64(shot.Size)
+	for len(s.order) > 1 && (len(s.order) > s.opts.MaxShots || s.bytes > s.opts.MaxBytes) {
+		oldest := s.order[0]
+		s.bytes -= int64(s.items[oldest].Size)
+		delete(s.items, oldest)
+		s.order = s.order[1:]
+	}
+	return shot
+}
+
+func (s *Store) Get(id string) (Shot, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	shot, ok := s.items[id]
+	return shot, ok
+}
+
+// List returns the stored screenshots, newest first, without their data.
+func (s *Store) List() []Shot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]Shot, 0, len(s.order))
+	for i := len(s.order) - 1; i >= 0; i-- {
+		shot := s.items[s.order[i]]
+		shot.Data = nil
+		out = append(out, shot)
+	}
+	return out
+}
+
+// DecodeDataURL splits a base64 data URL such as the extension returns into
+// its MIME type and bytes.
+func DecodeDataURL(dataURL string) (string, []byte, error) {
+	rest, ok := strings.CutPrefix(dataURL, "data:")
+	if !ok {
+		return "", nil, errors.New("not a data URL")
+	}
+	mimeType, encoded, ok := strings.Cut(rest, ";base64,")
+	if !ok {
+		return "", nil, errors.New("data URL is not base64")
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, err
+	}
+	return mimeType, data, nil
+}
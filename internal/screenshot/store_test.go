@@ -0,0 +1,49 @@
+package screenshot
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStoreEvictsOldest(t *testing.T) {
+	store := NewStore(Options{MaxShots: 2, MaxBytes: 10})
+	a := store.Put(Shot{Data: []byte("aaaa")})
+	b := store.Put(Shot{Data: []byte("bbbb")})
+	c := store.Put(Shot{Data: []byte("cc")})
+	if _, ok := store.Get(a.ID); ok {
+		t.Fatalf("expected the oldest screenshot to be evicted by count")
+	}
+	if got, ok := store.Get(c.ID); !ok || got.Size != 2 || !bytes.Equal(got.Data, []byte("cc")) {
+		t.Fatalf("unexpected stored screenshot %#v", got)
+	}
+	list := store.List()
+	if len(list) != 2 || list[0].ID != c.ID || list[1].ID != b.ID || list[0].Data != nil {
+		t.Fatalf("expected newest-first metadata for c and b, got %#v", list)
+	}
+
+	big := store.Put(Shot{Data: bytes.Repeat([]byte("x"), 20)})
+	if list := store.List(); len(list) != 1 || list[0].ID != big.ID {
+		t.Fatalf("expected only the over-budget newest screenshot to remain, got %#v", list)
+	}
+}
+
+func TestStoreDefaultByteCap(t *testing.T) {
+	store := NewStore(Options{})
+	first := store.Put(Shot{Data: make([]byte, DefaultMaxBytes/2+1)})
+	store.Put(Shot{Data: make([]byte, DefaultMaxBytes/2+1)})
+	if _, ok := store.Get(first.ID); ok {
+		t.Fatalf("expected the default byte cap to evict the older screenshot")
+	}
+}
+
+func TestDecodeDataURL(t *testing.T) {
+	mimeType, data, err := DecodeDataURL("data:image/png;base64,aGVsbG8=")
+	if err != nil || mimeType != "image/png" || string(data) != "hello" {
+		t.Fatalf("decode: %q %q %v", mimeType, data, err)
+	}
+	for _, bad := range []string{"hello", "data:image/png,hello", "data:image/png;base64,%%%"} {
+		if _, _, err := DecodeDataURL(bad); err == nil {
+			t.Fatalf("expected %q to fail", bad)
+		}
+	}
+}
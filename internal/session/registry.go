@@ -1,6 +1,8 @@
 package session
 
 import (
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -8,22 +10,56 @@ import (
 )
 
 type ClientInfo struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name,omitempty"`
-	Transport   string    `json:"transport,omitempty"`
-	RemoteAddr  string    `json:"remote_addr,omitempty"`
-	UserAgent   string    `json:"user_agent,omitempty"`
-	ConnectedAt time.Time `json:"connected_at"`
-	LastSeen    time.Time `json:"last_seen"`
+	ID          string            `json:"id"`
+	Name        string            `json:"name,omitempty"`
+	Transport   string            `json:"transport,omitempty"`
+	RemoteAddr  string            `json:"remote_addr,omitempty"`
+	UserAgent   string            `json:"user_agent,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	ConnectedAt time.Time         `json:"connected_at"`
+	LastSeen    time.Time         `json:"last_seen"`
+}
+
+// DefaultPruneGrace is added to the idle limit before a client is pruned, so
+// a clock adjustment or a touch racing the prune does not drop a client that
+// is just reconnecting.
+const DefaultPruneGrace = 5 * time.Second
+
+type RegistryOptions struct {
+	// Now replaces time.Now, for tests.
+	Now func() time.Time
+	// PruneGrace overrides DefaultPruneGrace; negative disables it.
+	PruneGrace time.Duration
+	// OnPrune is called for each client Prune removes, after the registry
+	// lock is released.
+	OnPrune func(ClientInfo)
 }
 
 type Registry struct {
 	mu      sync.RWMutex
 	clients map[string]*ClientInfo
+	now     func() time.Time
+	grace   time.Duration
+	onPrune func(ClientInfo)
 }
 
 func NewRegistry() *Registry {
-	return &Registry{clients: make(map[string]*ClientInfo)}
+	return NewRegistryWithOptions(RegistryOptions{})
+}
+
+func NewRegistryWithOptions(opts RegistryOptions) *Registry {
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+	grace := opts.PruneGrace
+	switch {
+	case grace == 0:
+		grace = DefaultPruneGrace
+	case grace < 0:
+		grace = 0
+	}
+	return &Registry{clients: make(map[string]*ClientInfo), now: now, grace: grace, onPrune: opts.OnPrune}
 }
 
 func (r *Registry) Register(id string, info ClientInfo) string {
@@ -32,7 +68,7 @@ func (r *Registry) Register(id string, info ClientInfo) string {
 	if id == "" {
 		id = uuid.New().String()
 	}
-	now := time.Now()
+	now := r.now()
 	info.ID = id
 	if info.ConnectedAt.IsZero() {
 		info.ConnectedAt = now
@@ -48,7 +84,7 @@ func (r *Registry) Touch(id string, info ClientInfo) {
 	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	now := time.Now()
+	now := r.now()
 	if existing, ok := r.clients[id]; ok {
 		if info.Name != "" {
 			existing.Name = info.Name
@@ -62,6 +98,9 @@ func (r *Registry) Touch(id string, info ClientInfo) {
 		if info.UserAgent != "" {
 			existing.UserAgent = info.UserAgent
 		}
+		if len(info.Labels) > 0 {
+			existing.Labels = info.Labels
+		}
 		existing.LastSeen = now
 		return
 	}
@@ -80,32 +119,122 @@ func (r *Registry) Unregister(id string) {
 	delete(r.clients, id)
 }
 
+// UnregisterAll removes every client and returns how many there were.
+func (r *Registry) UnregisterAll() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(r.clients)
+	clear(r.clients)
+	return n
+}
+
+// Get returns a copy of the client registered under id.
+func (r *Registry) Get(id string) (ClientInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.clients[id]
+	if !ok {
+		return ClientInfo{}, false
+	}
+	return *c, true
+}
+
 func (r *Registry) List() []ClientInfo {
+	return r.Filter(nil)
+}
+
+// Filter returns clients carrying every label in selector. A selector value of
+// "" only requires the key to be present.
+func (r *Registry) Filter(selector map[string]string) []ClientInfo {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	out := make([]ClientInfo, 0, len(r.clients))
 	for _, c := range r.clients {
-		out = append(out, *c)
+		if MatchLabels(c.Labels, selector) {
+			out = append(out, *c)
+		}
 	}
 	return out
 }
 
+// ParseLabels parses a comma separated label list such as "env=ci,team=search,canary".
+// Bare tags are stored with an empty value.
+func ParseLabels(s string) map[string]string {
+	var labels map[string]string
+	for _, part := range strings.Split(s, ",") {
+		key, val, _ := strings.Cut(part, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[key] = strings.TrimSpace(val)
+	}
+	return labels
+}
+
+// FormatLabels renders labels in the form accepted by ParseLabels, sorted by key.
+func FormatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if labels[k] == "" {
+			parts = append(parts, k)
+			continue
+		}
+		parts = append(parts, k+"="+labels[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+func MatchLabels(labels, selector map[string]string) bool {
+	for k, want := range selector {
+		got, ok := labels[k]
+		if !ok {
+			return false
+		}
+		if want != "" && got != want {
+			return false
+		}
+	}
+	return true
+}
+
 func (r *Registry) Count() int {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	return len(r.clients)
 }
 
-func (r *Registry) Prune(maxIdle time.Duration) {
+// Prune removes clients idle for longer than maxIdle plus the prune grace and
+// returns them. The check and removal happen under one lock, so a client
+// touched concurrently is either kept or pruned before the touch re-adds it,
+// and pruning twice removes nothing more. A LastSeen in the future (the clock
+// went back) counts as fresh.
+func (r *Registry) Prune(maxIdle time.Duration) []ClientInfo {
 	if maxIdle <= 0 {
-		return
+		return nil
 	}
-	cutoff := time.Now().Add(-maxIdle)
+	cutoff := r.now().Add(-maxIdle - r.grace)
+	var pruned []ClientInfo
 	r.mu.Lock()
-	defer r.mu.Unlock()
 	for id, c := range r.clients {
 		if c.LastSeen.Before(cutoff) {
+			pruned = append(pruned, *c)
 			delete(r.clients, id)
 		}
 	}
+	r.mu.Unlock()
+	if r.onPrune != nil {
+		for _, c := range pruned {
+			r.onPrune(c)
+		}
+	}
+	return pruned
 }
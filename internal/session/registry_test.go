@@ -0,0 +1,110 @@
+package session
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseLabels(t *testing.T) {
+	got := ParseLabels(" env=ci , team=search,canary,,=orphan")
+	if len(got) != 3 || got["env"] != "ci" || got["team"] != "search" {
+		t.Fatalf("unexpected labels: %#v", got)
+	}
+	if v, ok := got["canary"]; !ok || v != "" {
+		t.Fatalf("expected bare tag to be stored with empty value: %#v", got)
+	}
+	if ParseLabels("") != nil {
+		t.Fatalf("expected empty header to yield nil labels")
+	}
+	if s := FormatLabels(got); s != "canary,env=ci,team=search" {
+		t.Fatalf("unexpected formatted labels: %q", s)
+	}
+}
+
+func TestUnregisterAll(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register("a", ClientInfo{})
+	reg.Register("b", ClientInfo{})
+	if n := reg.UnregisterAll(); n != 2 || len(reg.List()) != 0 {
+		t.Fatalf("expected both clients removed, got %d with %d left", n, len(reg.List()))
+	}
+}
+
+func TestFilterByLabels(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register("a", ClientInfo{Labels: map[string]string{"env": "ci", "canary": ""}})
+	reg.Register("b", ClientInfo{Labels: map[string]string{"env": "prod"}})
+	reg.Register("c", ClientInfo{})
+
+	if got := reg.Filter(map[string]string{"env": "ci"}); len(got) != 1 || got[0].ID != "a" {
+		t.Fatalf("expected only client a for env=ci, got %#v", got)
+	}
+	if got := reg.Filter(map[string]string{"env": ""}); len(got) != 2 {
+		t.Fatalf("expected key-only selector to match both labelled clients, got %d", len(got))
+	}
+	if got := reg.Filter(nil); len(got) != 3 {
+		t.Fatalf("expected empty selector to match everything, got %d", len(got))
+	}
+}
+
+func TestPruneGraceBoundary(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	var pruned []string
+	reg := NewRegistryWithOptions(RegistryOptions{
+		Now:        func() time.Time { return now },
+		PruneGrace: 5 * time.Second,
+		OnPrune:    func(c ClientInfo) { pruned = append(pruned, c.ID) },
+	})
+	reg.Register("idle", ClientInfo{})
+
+	now = now.Add(time.Minute + 4*time.Second)
+	if got := reg.Prune(time.Minute); len(got) != 0 || reg.Count() != 1 {
+		t.Fatalf("expected the grace period to keep the client, pruned %v", got)
+	}
+	now = now.Add(2 * time.Second)
+	if got := reg.Prune(time.Minute); len(got) != 1 || got[0].ID != "idle" {
+		t.Fatalf("expected the client to be pruned past the grace period, got %v", got)
+	}
+	if got := reg.Prune(time.Minute); len(got) != 0 {
+		t.Fatalf("expected a second prune to remove nothing, got %v", got)
+	}
+	if len(pruned) != 1 || pruned[0] != "idle" {
+		t.Fatalf("expected one prune event, got %v", pruned)
+	}
+}
+
+func TestPruneToleratesClockGoingBack(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	reg := NewRegistryWithOptions(RegistryOptions{Now: func() time.Time { return now }})
+	reg.Register("c", ClientInfo{})
+	now = now.Add(-time.Hour)
+	if got := reg.Prune(time.Minute); len(got) != 0 {
+		t.Fatalf("expected a LastSeen in the future to count as fresh, pruned %v", got)
+	}
+}
+
+func TestPruneConcurrentWithTouch(t *testing.T) {
+	reg := NewRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				reg.Touch(fmt.Sprintf("c%d", i), ClientInfo{})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				reg.Prune(time.Minute)
+			}
+		}()
+	}
+	wg.Wait()
+	if reg.Count() != 8 {
+		t.Fatalf("expected every recently touched client to survive, got %d", reg.Count())
+	}
+}
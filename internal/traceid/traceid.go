@@ -0,0 +1,22 @@
+// Package traceid carries a request's trace id on its context, so a tool call
+// or admin request can be followed through to the extension's response and
+// the audit log.
+package traceid
+
+import "context"
+
+type key struct{}
+
+// With tags ctx with id. An empty id leaves ctx unchanged.
+func With(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, key{}, id)
+}
+
+// FromContext returns the id set by With.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(key{}).(string)
+	return id, ok
+}
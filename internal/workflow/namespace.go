@@ -0,0 +1,63 @@
+package workflow
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultNamespace holds the workflows saved without a namespace. It keeps
+// using workflows.json so existing files load unchanged.
+const DefaultNamespace = "default"
+
+var namespacePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_-]{0,63}$`)
+
+// Namespaces opens one Store per namespace, each persisted to its own file in
+// dir: workflows.json for the default namespace and workflows.<name>.json for
+// the others. Stores are opened on first use.
+type Namespaces struct {
+	mu     sync.Mutex
+	dir    string
+	stores map[string]*Store
+}
+
+// NewNamespaces returns namespaces rooted at dir; "" means the working directory.
+func NewNamespaces(dir string) *Namespaces {
+	return &Namespaces{dir: dir, stores: make(map[string]*Store)}
+}
+
+// Store returns the store for name, where "" selects DefaultNamespace.
+func (n *Namespaces) Store(name string) (*Store, error) {
+	name, err := normalizeNamespace(name)
+	if err != nil {
+		return nil, err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if s, ok := n.stores[name]; ok {
+		return s, nil
+	}
+	s := NewStore(n.path(name))
+	n.stores[name] = s
+	return s, nil
+}
+
+func (n *Namespaces) path(name string) string {
+	if name == DefaultNamespace {
+		return filepath.Join(n.dir, "workflows.json")
+	}
+	return filepath.Join(n.dir, "workflows."+name+".json")
+}
+
+func normalizeNamespace(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return DefaultNamespace, nil
+	}
+	if !namespacePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid workflow namespace %q: use letters, digits, '-' and '_'", name)
+	}
+	return name, nil
+}
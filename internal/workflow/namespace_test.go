@@ -0,0 +1,52 @@
+package workflow
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adityalohuni/mcp-server/internal/browser"
+)
+
+func TestNamespacesAreIsolated(t *testing.T) {
+	dir := t.TempDir()
+	ns := NewNamespaces(dir)
+	def, err := ns.Store("")
+	if err != nil {
+		t.Fatalf("default store: %v", err)
+	}
+	team, err := ns.Store("team")
+	if err != nil {
+		t.Fatalf("team store: %v", err)
+	}
+	steps := []browser.RecordedAction{{Type: "click"}}
+	mine := def.Add(Workflow{Name: "mine", Steps: steps})
+	for _, name := range []string{"a", "b", "c"} {
+		team.Add(Workflow{Name: name, Steps: steps})
+	}
+
+	if _, ok := team.Get(mine.ID); ok {
+		t.Fatalf("expected default workflow to be invisible in team namespace")
+	}
+	if removed, err := team.Compact(1); err != nil || removed != 2 {
+		t.Fatalf("expected team compaction to remove 2, got %d (%v)", removed, err)
+	}
+	if got := len(def.List()); got != 1 {
+		t.Fatalf("expected compaction to leave the default namespace alone, got %d workflows", got)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "workflows.json")); err != nil {
+		t.Fatalf("expected default namespace in workflows.json: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "workflows.team.json")); err != nil {
+		t.Fatalf("expected team namespace in its own file: %v", err)
+	}
+
+	reopened, err := NewNamespaces(dir).Store("team")
+	if err != nil || len(reopened.List()) != 1 {
+		t.Fatalf("expected team namespace to reload from disk, got %v (%v)", reopened, err)
+	}
+	if _, err := ns.Store("../etc"); err == nil {
+		t.Fatalf("expected path-like namespace to be rejected")
+	}
+}
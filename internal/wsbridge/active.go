@@ -0,0 +1,127 @@
+package wsbridge
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Active session strategies decide which session receives commands that do
+// not name one, and what the admin "active" alias refers to.
+const (
+	// ActiveLatest picks the most recently connected session (the default).
+	ActiveLatest = "latest"
+	// ActiveOldest picks the longest connected session.
+	ActiveOldest = "oldest"
+	// ActiveRecent picks the session that sent a message most recently.
+	ActiveRecent = "recent"
+)
+
+// ErrUnknownSession is returned by SetActive for an id with no connected
+// session.
+var ErrUnknownSession = errors.New("unknown browser session")
+
+// ValidActiveStrategy reports an error for names other than "" and the
+// Active* constants.
+func ValidActiveStrategy(name string) error {
+	switch name {
+	case "", ActiveLatest, ActiveOldest, ActiveRecent:
+		return nil
+	}
+	return fmt.Errorf("unknown active session strategy %q (want latest, oldest or recent)", name)
+}
+
+// ActiveStrategy returns the strategy in effect.
+func (b *Bridge) ActiveStrategy() string {
+	if b.strategy == "" {
+		return ActiveLatest
+	}
+	return b.strategy
+}
+
+// SetActive pins session id as the active one, overriding the strategy
+// until SetActive("") or until the session disconnects, after which the
+// strategy picks again. The session's activation time is recorded.
+func (b *Bridge) SetActive(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id == "" {
+		b.pinned = ""
+		return nil
+	}
+	s, ok := b.sessions[id]
+	if !ok {
+		return ErrUnknownSession
+	}
+	s.mu.Lock()
+	s.ActivatedAt = b.now()
+	s.mu.Unlock()
+	b.pinned = id
+	return nil
+}
+
+// PinnedSessionID returns the session pinned by SetActive, if it is still
+// connected.
+func (b *Bridge) PinnedSessionID() (string, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, ok := b.sessions[b.pinned]
+	if !ok {
+		return "", false
+	}
+	return b.pinned, true
+}
+
+// ActiveSessionID returns the pinned session, or else the one the active
+// strategy currently selects.
+func (b *Bridge) ActiveSessionID() (string, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	id := b.activeIDLocked()
+	return id, id != ""
+}
+
+// activeIDLocked returns the pinned session, or else applies the strategy to
+// the connected sessions. Ties are broken by the later activation time, then
+// by id, so the choice never depends on map order. The caller holds b.mu.
+func (b *Bridge) activeIDLocked() string {
+	if _, ok := b.sessions[b.pinned]; ok {
+		return b.pinned
+	}
+	best := ""
+	var bestSession *Session
+	for id, s := range b.sessions {
+		if bestSession == nil || b.prefer(id, s, best, bestSession) {
+			best, bestSession = id, s
+		}
+	}
+	return best
+}
+
+// prefer reports whether session a should be active rather than b.
+func (b *Bridge) prefer(aID string, a *Session, bID string, bs *Session) bool {
+	a.mu.Lock()
+	aConnected, aSeen, aActivated := a.ConnectedAt, a.LastSeen, a.ActivatedAt
+	a.mu.Unlock()
+	bs.mu.Lock()
+	bConnected, bSeen, bActivated := bs.ConnectedAt, bs.LastSeen, bs.ActivatedAt
+	bs.mu.Unlock()
+
+	switch b.ActiveStrategy() {
+	case ActiveOldest:
+		if !aConnected.Equal(bConnected) {
+			return aConnected.Before(bConnected)
+		}
+	case ActiveRecent:
+		if !aSeen.Equal(bSeen) {
+			return aSeen.After(bSeen)
+		}
+	default:
+		if !aConnected.Equal(bConnected) {
+			return aConnected.After(bConnected)
+		}
+	}
+	if !aActivated.Equal(bActivated) {
+		return aActivated.After(bActivated)
+	}
+	return aID < bID
+}
@@ -4,27 +4,103 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 
-	"github.com/adityalohuni/mcp-server/internal/protocol"
+	"github.com/adityalohuni/mcp-server/protocol"
 )
 
 var ErrNoActiveSession = errors.New("no active browser session")
 
+// ErrSessionDisconnected matches a SessionDisconnectedError with errors.Is.
+var ErrSessionDisconnected = errors.New("session_disconnected")
+
+// SessionDisconnectedError reports that the session a command was sent to
+// went away before it answered. Sent tells whether the command reached the
+// connection; if it did, the browser may have carried it out.
+type SessionDisconnectedError struct {
+	SessionID string
+	Sent      bool
+	Err       error
+}
+
+func (e *SessionDisconnectedError) Error() string {
+	msg := "session_disconnected: browser session " + e.SessionID + " disconnected"
+	if e.Sent {
+		msg += " before answering; the command may or may not have run"
+	} else {
+		msg += " before the command could be sent"
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *SessionDisconnectedError) Is(target error) bool { return target == ErrSessionDisconnected }
+
+func (e *SessionDisconnectedError) Unwrap() error { return e.Err }
+
+// ErrSessionClosing matches a SessionClosingError with errors.Is.
+var ErrSessionClosing = errors.New("session_closing")
+
+// SessionClosingError reports that the server was closing the session a
+// command was meant for, either because it was disconnected or because the
+// bridge is shutting down. Sent tells whether the command had already been
+// written; if so, the browser may have carried it out.
+type SessionClosingError struct {
+	SessionID string
+	Sent      bool
+}
+
+func (e *SessionClosingError) Error() string {
+	msg := "session_closing: browser session " + e.SessionID + " is closing"
+	if e.Sent {
+		msg += "; the command may or may not have run"
+	}
+	return msg
+}
+
+func (e *SessionClosingError) Is(target error) bool { return target == ErrSessionClosing }
+
+// ErrCommandExpired is returned, wrapped, for a command the browser did not
+// answer within Options.PendingTTL.
+var ErrCommandExpired = errors.New("command_timeout")
+
 // Bridge manages websocket sessions and command/response routing.
 type Bridge struct {
-	mu        sync.RWMutex
-	sessions  map[string]*Session
-	activeID  string
-	pending   map[string]chan protocol.Response
-	upgrader  websocket.Upgrader
-	writeWait time.Duration
+	mu       sync.RWMutex
+	sessions map[string]*Session
+	strategy string
+	// pinned is the session SetActive chose; it is ignored once that
+	// session is gone.
+	pinned     string
+	pending    map[string]*pendingCommand
+	pendingTTL time.Duration
+	upgrader   websocket.Upgrader
+	writeWait  time.Duration
+	writePerKB time.Duration
+	maxWrite   time.Duration
+	pingEvery  time.Duration
+	pongWait   time.Duration
+	idle       time.Duration
+	now        func() time.Time
+	done       chan struct{}
+	closeOnce  sync.Once
+	orphans    atomic.Uint64
+	// shutdown is set by Shutdown; new connections are refused after it.
+	shutdown atomic.Bool
+
+	subsMu sync.Mutex
+	subs   map[*subscriber]struct{}
 }
 
 // Options configures the websocket bridge.
@@ -32,21 +108,138 @@ type Options struct {
 	CheckOrigin     func(*http.Request) bool
 	ReadBufferSize  int
 	WriteBufferSize int
-	WriteWait       time.Duration
+	// WriteWait is the write deadline for an empty message; zero means 5s.
+	// WriteWaitPerKB is added for each KiB of the message (zero means 10ms),
+	// and MaxWriteWait caps the total (zero means 60s), so a large screenshot
+	// on a slow link gets more time than a small command.
+	WriteWait      time.Duration
+	WriteWaitPerKB time.Duration
+	MaxWriteWait   time.Duration
+	// PingInterval is how often each session is sent a websocket ping; zero
+	// means 30s and a negative value disables pings. A session that answers
+	// neither a ping nor with any message within PongWait (zero, or not
+	// above PingInterval, means twice PingInterval) is closed and removed,
+	// so a silently dead connection does not linger until a command fails.
+	PingInterval time.Duration
+	PongWait     time.Duration
+	// IdleTimeout closes sessions that have not sent any message for longer
+	// than this duration. It is unrelated to connection liveness: a session
+	// can answer pings and still be idle. Zero disables the sweeper.
+	IdleTimeout time.Duration
+	// PendingTTL is how long a command sent with a context that has no
+	// deadline may wait for its answer; zero means 5 minutes and a negative
+	// value disables the limit. Commands with a deadline wait until it, however
+	// long. Expired commands fail with ErrCommandExpired and are dropped within
+	// a quarter of PendingTTL, so a browser that never answers cannot grow the
+	// pending set without bound.
+	PendingTTL time.Duration
+	// ActiveStrategy selects the session used when a command names none;
+	// see ActiveLatest, ActiveOldest and ActiveRecent. Empty means ActiveLatest.
+	ActiveStrategy string
 }
 
 // Session represents a connected browser extension.
 type Session struct {
-	ID          string
-	Conn        *websocket.Conn
+	ID   string
+	Conn *websocket.Conn
+	// mu guards the fields below it. Data frames are only written by the
+	// session's writeLoop, which takes them from send in turn, so two
+	// commands can never interleave on the connection.
 	mu          sync.Mutex
 	RemoteAddr  string
 	UserAgent   string
 	ConnectedAt time.Time
 	LastSeen    time.Time
+	// ActivatedAt is when SetActive last pinned the session; zero if never.
+	ActivatedAt time.Time
+
+	send chan outbound
+
+	// closed is closed once the session has been removed from the bridge.
+	closed chan struct{}
+	// closing is closed when the server starts closing the session; see
+	// markClosing.
+	closing     chan struct{}
+	closingOnce sync.Once
+
+	lastSeq     uint64
+	seqGaps     uint64
+	seqReorders uint64
+
+	// claims holds the tabs the session has claimed or opened; see trackClaims.
+	claims map[int]struct{}
+}
+
+// pendingCommand is a sent command waiting for its response. ch receives
+// the response, or is closed without one when the command expires. expires
+// is zero for commands whose context has a deadline of its own.
+type pendingCommand struct {
+	ch      chan protocol.Response
+	expires time.Time
+}
+
+// outbound is a message queued for a session's writeLoop. The result of the
+// write is sent on written, which must have room for it.
+type outbound struct {
+	msg     []byte
+	written chan error
+}
+
+// observeSeq records a message sequence number. A jump past lastSeq+1 counts
+// as a gap and a number at or below lastSeq as a reorder; lastSeq only moves
+// forward. Zero means the extension does not send sequence numbers.
+func (s *Session) observeSeq(seq uint64) (gap, reordered bool) {
+	if seq == 0 {
+		return false, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.lastSeq == 0 || seq == s.lastSeq+1:
+	case seq > s.lastSeq+1:
+		s.seqGaps++
+		gap = true
+	default:
+		s.seqReorders++
+		return false, true
+	}
+	s.lastSeq = seq
+	return gap, false
+}
+
+// markClosing fails commands still waiting on the session, and any sent to
+// it from now on, with a SessionClosingError.
+func (s *Session) markClosing() {
+	s.closingOnce.Do(func() {
+		if s.closing != nil {
+			close(s.closing)
+		}
+	})
+}
+
+func (s *Session) isClosing() bool {
+	select {
+	case <-s.closing:
+		return true
+	default:
+		return false
+	}
 }
 
 func NewBridge(opts Options) *Bridge {
+	b := newBridge(opts)
+	if b.idle > 0 {
+		go b.sweepLoop()
+	}
+	if b.pendingTTL > 0 {
+		go b.pendingLoop()
+	}
+	return b
+}
+
+// newBridge builds a Bridge without starting its background goroutines, so
+// tests can set its clock before anything reads it.
+func newBridge(opts Options) *Bridge {
 	up := websocket.Upgrader{
 		ReadBufferSize:  opts.ReadBufferSize,
 		WriteBufferSize: opts.WriteBufferSize,
@@ -62,16 +255,143 @@ func NewBridge(opts Options) *Bridge {
 	if writeWait == 0 {
 		writeWait = 5 * time.Second
 	}
+	writePerKB := opts.WriteWaitPerKB
+	if writePerKB == 0 {
+		writePerKB = 10 * time.Millisecond
+	}
+	maxWrite := opts.MaxWriteWait
+	if maxWrite == 0 {
+		maxWrite = 60 * time.Second
+	}
+	maxWrite = max(maxWrite, writeWait)
+	pingEvery := opts.PingInterval
+	if pingEvery == 0 {
+		pingEvery = 30 * time.Second
+	}
+	pongWait := opts.PongWait
+	if pongWait <= pingEvery {
+		pongWait = 2 * pingEvery
+	}
+	pendingTTL := opts.PendingTTL
+	if pendingTTL == 0 {
+		pendingTTL = 5 * time.Minute
+	}
+
+	b := &Bridge{
+		sessions:   make(map[string]*Session),
+		pending:    make(map[string]*pendingCommand),
+		pendingTTL: pendingTTL,
+		subs:       make(map[*subscriber]struct{}),
+		upgrader:   up,
+		writeWait:  writeWait,
+		writePerKB: writePerKB,
+		maxWrite:   maxWrite,
+		pingEvery:  pingEvery,
+		pongWait:   pongWait,
+		idle:       opts.IdleTimeout,
+		strategy:   opts.ActiveStrategy,
+		now:        time.Now,
+		done:       make(chan struct{}),
+	}
+	return b
+}
+
+// Close stops background maintenance goroutines. Connected sessions are left
+// open; use DisconnectSession to drop them.
+func (b *Bridge) Close() {
+	b.closeOnce.Do(func() { close(b.done) })
+}
+
+func (b *Bridge) sweepLoop() {
+	interval := b.idle / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.sweepIdle()
+		case <-b.done:
+			return
+		}
+	}
+}
 
-	return &Bridge{
-		sessions:  make(map[string]*Session),
-		pending:   make(map[string]chan protocol.Response),
-		upgrader:  up,
-		writeWait: writeWait,
+// sweepIdle closes every session whose LastSeen is older than the idle timeout
+// and returns the ids that were closed.
+func (b *Bridge) sweepIdle() []string {
+	if b.idle <= 0 {
+		return nil
+	}
+	cutoff := b.now().Add(-b.idle)
+	b.mu.RLock()
+	var stale []*Session
+	for _, s := range b.sessions {
+		s.mu.Lock()
+		if s.LastSeen.Before(cutoff) {
+			stale = append(stale, s)
+		}
+		s.mu.Unlock()
+	}
+	b.mu.RUnlock()
+
+	ids := make([]string, 0, len(stale))
+	for _, s := range stale {
+		log.Printf("ws idle timeout: %s", s.ID)
+		b.closeSession(s, "idle timeout")
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+func (b *Bridge) pendingLoop() {
+	ticker := time.NewTicker(max(b.pendingTTL/4, 10*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.sweepPending()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// sweepPending drops the commands without a deadline that have waited longer
+// than PendingTTL and closes their channels, which fails them with ErrCommandExpired. It
+// returns how many it dropped.
+func (b *Bridge) sweepPending() int {
+	now := b.now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := 0
+	for id, p := range b.pending {
+		if !p.expires.IsZero() && now.After(p.expires) {
+			delete(b.pending, id)
+			close(p.ch)
+			n++
+		}
+	}
+	if n > 0 {
+		log.Printf("ws dropped %d command(s) unanswered after %s", n, b.pendingTTL)
 	}
+	return n
+}
+
+// PendingCount returns how many sent commands are waiting for an answer.
+func (b *Bridge) PendingCount() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.pending)
 }
 
 func (b *Bridge) HandleWS(w http.ResponseWriter, r *http.Request) {
+	if b.shutdown.Load() {
+		http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
 	conn, err := b.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("ws upgrade failed: %v", err)
@@ -79,7 +399,7 @@ func (b *Bridge) HandleWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	id := uuid.New().String()
-	now := time.Now()
+	now := b.now()
 	session := &Session{
 		ID:          id,
 		Conn:        conn,
@@ -87,26 +407,35 @@ func (b *Bridge) HandleWS(w http.ResponseWriter, r *http.Request) {
 		UserAgent:   r.UserAgent(),
 		ConnectedAt: now,
 		LastSeen:    now,
+		send:        make(chan outbound),
+		closed:      make(chan struct{}),
+		closing:     make(chan struct{}),
 	}
 
 	b.mu.Lock()
 	b.sessions[id] = session
-	b.activeID = id
 	b.mu.Unlock()
 
 	log.Printf("ws connected: %s", id)
+	go b.writeLoop(session)
+	if b.pingEvery > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(b.pongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(b.pongWait))
+		})
+		go b.pingLoop(session)
+	}
 	b.readLoop(session)
 
 	b.mu.Lock()
 	delete(b.sessions, id)
-	if b.activeID == id {
-		b.activeID = ""
-		for sid := range b.sessions {
-			b.activeID = sid
-			break
-		}
+	if b.pinned == id {
+		b.pinned = ""
+		log.Printf("ws pinned active session %s disconnected; falling back to the %s strategy", id, b.ActiveStrategy())
 	}
 	b.mu.Unlock()
+	close(session.closed)
+	b.publish(id, protocol.Event{Event: EventSessionClosed})
 
 	if err := conn.Close(); err != nil {
 		log.Printf("ws close failed: %v", err)
@@ -114,47 +443,120 @@ func (b *Bridge) HandleWS(w http.ResponseWriter, r *http.Request) {
 	log.Printf("ws disconnected: %s", id)
 }
 
+// writeLoop writes the messages queued on session.send one at a time until
+// the session is removed. Only it writes data frames to the connection;
+// pings and the close frame go through WriteControl, which may run alongside.
+func (b *Bridge) writeLoop(session *Session) {
+	for {
+		select {
+		case out := <-session.send:
+			_ = session.Conn.SetWriteDeadline(time.Now().Add(b.writeTimeout(len(out.msg))))
+			out.written <- session.Conn.WriteMessage(websocket.TextMessage, out.msg)
+		case <-session.closed:
+			return
+		}
+	}
+}
+
+// write queues msg for the session's writeLoop and waits until it has been
+// written. It fails with ErrSessionDisconnected if the session goes away
+// before taking the message.
+func (s *Session) write(msg []byte) error {
+	out := outbound{msg: msg, written: make(chan error, 1)}
+	select {
+	case s.send <- out:
+	case <-s.closed:
+		return ErrSessionDisconnected
+	}
+	return <-out.written
+}
+
+// pingLoop pings session every pingEvery until it is removed. Answers are
+// handled by the pong handler HandleWS installs.
+func (b *Bridge) pingLoop(session *Session) {
+	ticker := time.NewTicker(b.pingEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// WriteControl may run alongside writeLoop.
+			if err := session.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(b.writeWait)); err != nil {
+				debugf("ws ping failed: session=%s: %v", session.ID, err)
+			}
+		case <-session.closed:
+			return
+		}
+	}
+}
+
 func (b *Bridge) readLoop(session *Session) {
 	for {
 		_, message, err := session.Conn.ReadMessage()
 		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				log.Printf("ws no pong within %s, closing: session=%s", b.pongWait, session.ID)
+			}
 			return
 		}
+		if b.pingEvery > 0 {
+			_ = session.Conn.SetReadDeadline(time.Now().Add(b.pongWait))
+		}
 		debugf("ws recv: session=%s bytes=%d", session.ID, len(message))
 		session.mu.Lock()
-		session.LastSeen = time.Now()
+		session.LastSeen = b.now()
 		session.mu.Unlock()
 		var resp protocol.Response
 		if err := json.Unmarshal(message, &resp); err != nil {
 			log.Printf("ws invalid message: %v", err)
 			continue
 		}
+		if gap, reordered := session.observeSeq(resp.Seq); gap || reordered {
+			debugf("ws seq anomaly: session=%s seq=%d gap=%t reordered=%t", session.ID, resp.Seq, gap, reordered)
+		}
 		if resp.ID == "" {
+			var ev protocol.Event
+			if err := json.Unmarshal(message, &ev); err == nil && ev.Event != "" {
+				debugf("ws recv event: session=%s event=%s", session.ID, ev.Event)
+				b.publish(session.ID, ev)
+			}
 			continue
 		}
 		debugf("ws recv response: id=%s ok=%t error=%s", resp.ID, resp.OK, resp.Error)
-		b.deliver(resp)
+		if !b.deliver(resp) {
+			debugf("ws orphan response: session=%s id=%s body=%s", session.ID, resp.ID, snippet(message, 200))
+		}
 	}
 }
 
-func (b *Bridge) deliver(resp protocol.Response) {
+// deliver hands resp to the waiting SendCommand call. It reports false and
+// counts an orphan when no command with that id is pending, which happens for
+// duplicate responses, late responses after a timeout, or id mismatches.
+func (b *Bridge) deliver(resp protocol.Response) bool {
 	b.mu.Lock()
-	ch := b.pending[resp.ID]
-	if ch != nil {
+	p := b.pending[resp.ID]
+	if p != nil {
 		delete(b.pending, resp.ID)
 	}
 	b.mu.Unlock()
 
-	if ch != nil {
-		ch <- resp
-		close(ch)
+	if p == nil {
+		b.orphans.Add(1)
+		return false
 	}
+	p.ch <- resp
+	close(p.ch)
+	return true
+}
+
+// OrphanResponses returns how many responses arrived for unknown command ids.
+func (b *Bridge) OrphanResponses() uint64 {
+	return b.orphans.Load()
 }
 
 func (b *Bridge) activeSession() (*Session, error) {
 	b.mu.RLock()
-	id := b.activeID
-	session := b.sessions[id]
+	session := b.sessions[b.activeIDLocked()]
 	b.mu.RUnlock()
 	if session == nil {
 		return nil, ErrNoActiveSession
@@ -182,28 +584,60 @@ type SessionInfo struct {
 	ConnectedAt time.Time `json:"connected_at"`
 	LastSeen    time.Time `json:"last_seen"`
 	Active      bool      `json:"active"`
+	// Pinned reports that the session is active because SetActive chose it.
+	Pinned      bool       `json:"pinned,omitempty"`
+	ActivatedAt *time.Time `json:"activated_at,omitempty"`
+	LastSeq     uint64     `json:"last_seq,omitempty"`
+	SeqGaps     uint64     `json:"seq_gaps,omitempty"`
+	SeqReorders uint64     `json:"seq_reorders,omitempty"`
 }
 
 func (b *Bridge) ListSessions() []SessionInfo {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	out := make([]SessionInfo, 0, len(b.sessions))
+	active := b.activeIDLocked()
 	for id, s := range b.sessions {
-		s.mu.Lock()
-		info := SessionInfo{
-			ID:          id,
-			RemoteAddr:  s.RemoteAddr,
-			UserAgent:   s.UserAgent,
-			ConnectedAt: s.ConnectedAt,
-			LastSeen:    s.LastSeen,
-			Active:      id == b.activeID,
-		}
-		s.mu.Unlock()
-		out = append(out, info)
+		out = append(out, b.sessionInfo(id, s, active))
 	}
 	return out
 }
 
+// SessionInfo returns the current info for one session.
+func (b *Bridge) SessionInfo(id string) (SessionInfo, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	s, ok := b.sessions[id]
+	if !ok {
+		return SessionInfo{}, false
+	}
+	return b.sessionInfo(id, s, b.activeIDLocked()), true
+}
+
+// sessionInfo snapshots s; the caller holds b.mu.
+func (b *Bridge) sessionInfo(id string, s *Session, active string) SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var activatedAt *time.Time
+	if !s.ActivatedAt.IsZero() {
+		at := s.ActivatedAt
+		activatedAt = &at
+	}
+	return SessionInfo{
+		ID:          id,
+		RemoteAddr:  s.RemoteAddr,
+		UserAgent:   s.UserAgent,
+		ConnectedAt: s.ConnectedAt,
+		LastSeen:    s.LastSeen,
+		Active:      id == active,
+		Pinned:      id == active && id == b.pinned,
+		ActivatedAt: activatedAt,
+		LastSeq:     s.lastSeq,
+		SeqGaps:     s.seqGaps,
+		SeqReorders: s.seqReorders,
+	}
+}
+
 func (b *Bridge) Count() int {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
@@ -211,62 +645,178 @@ func (b *Bridge) Count() int {
 }
 
 // DisconnectSession closes a websocket session from the server side.
-// If id is empty, the active session is disconnected.
-func (b *Bridge) DisconnectSession(id string) error {
+// If id is empty, the active session is disconnected. The tabs the session
+// had claimed or opened are released first, so they do not stay locked in
+// the extension; it returns how many were released.
+func (b *Bridge) DisconnectSession(id string) (int, error) {
 	session, err := b.sessionByID(id)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	session.markClosing()
+	released := b.releaseClaims(session)
+	b.closeSession(session, "closed by server")
+	return released, nil
+}
+
+// Shutdown closes every session for a server shutdown. New connections are
+// refused, commands waiting on a session fail with session_closing, and
+// each session's claimed tabs are released before it is sent a close frame.
+// It waits for the sessions to go away or for ctx to end, and returns how
+// many it closed.
+func (b *Bridge) Shutdown(ctx context.Context) int {
+	b.shutdown.Store(true)
+	b.Close()
+	b.mu.RLock()
+	sessions := make([]*Session, 0, len(b.sessions))
+	for _, s := range b.sessions {
+		sessions = append(sessions, s)
+	}
+	b.mu.RUnlock()
+
+	for _, s := range sessions {
+		s.markClosing()
+		b.releaseClaims(s)
+		b.closeSession(s, "server shutting down")
+	}
+	for _, s := range sessions {
+		select {
+		case <-s.closed:
+		case <-ctx.Done():
+			return len(sessions)
+		}
 	}
+	return len(sessions)
+}
 
-	session.mu.Lock()
-	_ = session.Conn.SetWriteDeadline(time.Now().Add(b.writeWait))
+func (b *Bridge) closeSession(session *Session, reason string) {
+	session.markClosing()
+	if session.Conn == nil {
+		return
+	}
 	_ = session.Conn.WriteControl(
 		websocket.CloseMessage,
-		websocket.FormatCloseMessage(websocket.CloseNormalClosure, "closed by server"),
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason),
 		time.Now().Add(b.writeWait),
 	)
 	_ = session.Conn.Close()
-	session.mu.Unlock()
-	return nil
 }
 
-// SendCommand sends a command to the active browser session and waits for a response.
+// writeTimeout is the write deadline for a message of size bytes: the base
+// WriteWait plus WriteWaitPerKB for each started KiB, capped at MaxWriteWait.
+func (b *Bridge) writeTimeout(size int) time.Duration {
+	kb := time.Duration((size + 1023) / 1024)
+	if b.writePerKB > 0 && kb > (b.maxWrite-b.writeWait)/b.writePerKB {
+		return b.maxWrite
+	}
+	return min(b.writeWait+kb*b.writePerKB, b.maxWrite)
+}
+
+// SendCommand sends a command to the session cmd names, or else to the
+// active one, and waits for a response. The session is resolved once: if it
+// disconnects before answering, the command fails with a
+// SessionDisconnectedError rather than moving to whichever session is active
+// by then.
 func (b *Bridge) SendCommand(ctx context.Context, cmd protocol.Command) (protocol.Response, error) {
 	session, err := b.sessionByID(cmd.SessionID)
 	if err != nil {
 		return protocol.Response{}, err
 	}
+	if session.isClosing() {
+		return protocol.Response{}, &SessionClosingError{SessionID: session.ID}
+	}
 
 	msg, err := json.Marshal(cmd)
 	if err != nil {
 		return protocol.Response{}, err
 	}
-	debugf("ws send command: id=%s type=%s session=%s bytes=%d", cmd.ID, cmd.Type, cmd.SessionID, len(msg))
+	debugf("ws send command: id=%s trace=%s type=%s session=%s bytes=%d", cmd.ID, cmd.TraceID, cmd.Type, session.ID, len(msg))
 
 	ch := make(chan protocol.Response, 1)
+	entry := &pendingCommand{ch: ch}
+	if _, ok := ctx.Deadline(); !ok && b.pendingTTL > 0 {
+		entry.expires = b.now().Add(b.pendingTTL)
+	}
 	b.mu.Lock()
-	b.pending[cmd.ID] = ch
+	b.pending[cmd.ID] = entry
 	b.mu.Unlock()
 
-	session.mu.Lock()
-	_ = session.Conn.SetWriteDeadline(time.Now().Add(b.writeWait))
-	err = session.Conn.WriteMessage(websocket.TextMessage, msg)
-	session.mu.Unlock()
+	// Commands to one session are written in turn by its writeLoop; this
+	// waits for a turn, then for the write itself.
+	out := outbound{msg: msg, written: make(chan error, 1)}
+	select {
+	case session.send <- out:
+		err = <-out.written
+	case <-session.closing:
+		b.mu.Lock()
+		delete(b.pending, cmd.ID)
+		b.mu.Unlock()
+		return protocol.Response{}, &SessionClosingError{SessionID: session.ID}
+	case <-session.closed:
+		b.mu.Lock()
+		delete(b.pending, cmd.ID)
+		b.mu.Unlock()
+		return protocol.Response{}, &SessionDisconnectedError{SessionID: session.ID}
+	case <-ctx.Done():
+		b.mu.Lock()
+		delete(b.pending, cmd.ID)
+		b.mu.Unlock()
+		log.Printf("ws command abandoned before sending: id=%s trace=%s type=%s session=%s: %v", cmd.ID, cmd.TraceID, cmd.Type, session.ID, ctx.Err())
+		return protocol.Response{}, ctx.Err()
+	}
 	if err != nil {
 		b.mu.Lock()
 		delete(b.pending, cmd.ID)
 		b.mu.Unlock()
-		return protocol.Response{}, err
+		log.Printf("ws send failed: id=%s trace=%s type=%s session=%s: %v", cmd.ID, cmd.TraceID, cmd.Type, session.ID, err)
+		// A failed write leaves a websocket unusable, so the session is as
+		// good as gone even if its read loop has not noticed yet.
+		return protocol.Response{}, &SessionDisconnectedError{SessionID: session.ID, Err: err}
 	}
 
+	var resp protocol.Response
+	answered := true
 	select {
-	case resp := <-ch:
-		debugf("ws response delivered: id=%s ok=%t error=%s", resp.ID, resp.OK, resp.Error)
-		return resp, nil
+	case resp, answered = <-ch:
+	case <-session.closing:
+		// As below, an answer that beat the close still counts.
+		select {
+		case resp, answered = <-ch:
+		default:
+			b.mu.Lock()
+			delete(b.pending, cmd.ID)
+			b.mu.Unlock()
+			log.Printf("ws command dropped: id=%s trace=%s type=%s session=%s: session closing", cmd.ID, cmd.TraceID, cmd.Type, session.ID)
+			return protocol.Response{}, &SessionClosingError{SessionID: session.ID, Sent: true}
+		}
+	case <-session.closed:
+		// The read loop delivers before the session closes, so a response
+		// that arrived just ahead of the disconnect is already waiting.
+		select {
+		case resp, answered = <-ch:
+		default:
+			b.mu.Lock()
+			delete(b.pending, cmd.ID)
+			b.mu.Unlock()
+			log.Printf("ws command lost: id=%s trace=%s type=%s session=%s: session disconnected", cmd.ID, cmd.TraceID, cmd.Type, session.ID)
+			return protocol.Response{}, &SessionDisconnectedError{SessionID: session.ID, Sent: true}
+		}
 	case <-ctx.Done():
 		b.mu.Lock()
 		delete(b.pending, cmd.ID)
 		b.mu.Unlock()
+		log.Printf("ws command abandoned: id=%s trace=%s type=%s session=%s: %v", cmd.ID, cmd.TraceID, cmd.Type, session.ID, ctx.Err())
 		return protocol.Response{}, ctx.Err()
 	}
+	if !answered {
+		log.Printf("ws command expired: id=%s trace=%s type=%s session=%s: no answer within %s", cmd.ID, cmd.TraceID, cmd.Type, session.ID, b.pendingTTL)
+		return protocol.Response{}, fmt.Errorf("%w: browser session %s did not answer %s within %s", ErrCommandExpired, session.ID, cmd.Type, b.pendingTTL)
+	}
+	debugf("ws response delivered: id=%s trace=%s ok=%t error=%s", resp.ID, cmd.TraceID, resp.OK, resp.Error)
+	if resp.OK {
+		session.trackClaims(cmd, resp)
+	} else {
+		log.Printf("ws command failed: id=%s trace=%s type=%s session=%s error=%q code=%s", cmd.ID, cmd.TraceID, cmd.Type, session.ID, resp.Error, resp.ErrorCode)
+	}
+	return resp, nil
 }
@@ -2,9 +2,19 @@ package wsbridge
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/adityalohuni/mcp-server/internal/protocol"
+	"github.com/gorilla/websocket"
+
+	"github.com/adityalohuni/mcp-server/protocol"
 )
 
 func TestSendCommandWithoutSession(t *testing.T) {
@@ -14,3 +24,476 @@ func TestSendCommandWithoutSession(t *testing.T) {
 		t.Fatalf("expected error when no session is active")
 	}
 }
+
+func TestSweepIdleUsesLastSeen(t *testing.T) {
+	// newBridge leaves the sweeper stopped, so the clock and timeout can be
+	// set here and sweepIdle driven by hand.
+	b := newBridge(Options{IdleTimeout: time.Minute})
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	b.sessions["idle"] = &Session{ID: "idle", LastSeen: now.Add(-2 * time.Minute)}
+	b.sessions["busy"] = &Session{ID: "busy", LastSeen: now.Add(-10 * time.Second)}
+
+	closed := b.sweepIdle()
+	if len(closed) != 1 || closed[0] != "idle" {
+		t.Fatalf("expected only idle session to be swept, got %v", closed)
+	}
+
+	b.idle = 0
+	if closed := b.sweepIdle(); closed != nil {
+		t.Fatalf("expected zero idle timeout to disable sweeping, got %v", closed)
+	}
+}
+
+func TestDeliverCountsOrphanResponses(t *testing.T) {
+	b := NewBridge(Options{})
+	if b.deliver(protocol.Response{ID: "unknown"}) {
+		t.Fatalf("expected unknown id not to be delivered")
+	}
+	ch := make(chan protocol.Response, 1)
+	b.pending["known"] = &pendingCommand{ch: ch}
+	if !b.deliver(protocol.Response{ID: "known", OK: true}) {
+		t.Fatalf("expected pending id to be delivered")
+	}
+	if b.deliver(protocol.Response{ID: "known", OK: true}) {
+		t.Fatalf("expected duplicate response to be orphaned")
+	}
+	if got := b.OrphanResponses(); got != 2 {
+		t.Fatalf("expected 2 orphan responses, got %d", got)
+	}
+}
+
+func TestWriteTimeoutScalesWithSize(t *testing.T) {
+	b := NewBridge(Options{WriteWait: time.Second, WriteWaitPerKB: 10 * time.Millisecond, MaxWriteWait: 10 * time.Second})
+	small := b.writeTimeout(200)
+	if small != time.Second+10*time.Millisecond {
+		t.Fatalf("expected a small message to get about the base deadline, got %v", small)
+	}
+	large := b.writeTimeout(300 << 10)
+	if large != 4*time.Second {
+		t.Fatalf("expected 300KiB to get 1s + 300*10ms, got %v", large)
+	}
+	if got := b.writeTimeout(50 << 20); got != 10*time.Second {
+		t.Fatalf("expected the deadline to be capped at 10s, got %v", got)
+	}
+}
+
+func TestObserveSeqDetectsGapsAndReordering(t *testing.T) {
+	s := &Session{ID: "s"}
+	steps := []struct {
+		seq            uint64
+		gap, reordered bool
+	}{
+		{0, false, false}, // unsequenced message
+		{5, false, false}, // first seq may start anywhere
+		{6, false, false},
+		{9, true, false},
+		{7, false, true},
+		{10, false, false},
+	}
+	for _, st := range steps {
+		gap, reordered := s.observeSeq(st.seq)
+		if gap != st.gap || reordered != st.reordered {
+			t.Fatalf("seq %d: gap=%t reordered=%t, want %t/%t", st.seq, gap, reordered, st.gap, st.reordered)
+		}
+	}
+	if s.lastSeq != 10 || s.seqGaps != 1 || s.seqReorders != 1 {
+		t.Fatalf("unexpected counters last=%d gaps=%d reorders=%d", s.lastSeq, s.seqGaps, s.seqReorders)
+	}
+}
+
+func TestActiveSessionStrategies(t *testing.T) {
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		strategy string
+		want     string
+	}{
+		{"", "b"},
+		{ActiveLatest, "b"},
+		{ActiveOldest, "a"},
+		{ActiveRecent, "c"},
+	}
+	for _, tc := range cases {
+		b := NewBridge(Options{ActiveStrategy: tc.strategy})
+		if _, ok := b.ActiveSessionID(); ok {
+			t.Fatalf("%q: expected no active session on an empty bridge", tc.strategy)
+		}
+		b.sessions["a"] = &Session{ID: "a", ConnectedAt: base, LastSeen: base.Add(time.Minute)}
+		b.sessions["b"] = &Session{ID: "b", ConnectedAt: base.Add(2 * time.Minute), LastSeen: base.Add(2 * time.Minute)}
+		b.sessions["c"] = &Session{ID: "c", ConnectedAt: base.Add(time.Minute), LastSeen: base.Add(5 * time.Minute)}
+		// A tie on ConnectedAt with "b" must not make the choice depend on map order.
+		b.sessions["d"] = &Session{ID: "d", ConnectedAt: base.Add(2 * time.Minute), LastSeen: base}
+
+		for i := 0; i < 10; i++ {
+			if got, _ := b.ActiveSessionID(); got != tc.want {
+				t.Fatalf("%q: expected active session %q, got %q", tc.strategy, tc.want, got)
+			}
+		}
+		for _, info := range b.ListSessions() {
+			if info.Active != (info.ID == tc.want) {
+				t.Fatalf("%q: session %q reported active=%v", tc.strategy, info.ID, info.Active)
+			}
+		}
+	}
+	if err := ValidActiveStrategy("random"); err == nil {
+		t.Fatalf("expected unknown strategy to be rejected")
+	}
+}
+
+func TestSetActivePinsSession(t *testing.T) {
+	b := NewBridge(Options{})
+	defer b.Close()
+	srv := httptest.NewServer(http.HandlerFunc(b.HandleWS))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	var ids []string
+	for i := range 3 {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+		waitForSessions(t, b, i+1)
+		id, _ := b.ActiveSessionID()
+		ids = append(ids, id)
+		time.Sleep(2 * time.Millisecond)
+	}
+	if err := b.SetActive("nope"); !errors.Is(err, ErrUnknownSession) {
+		t.Fatalf("expected ErrUnknownSession, got %v", err)
+	}
+	if err := b.SetActive(ids[0]); err != nil {
+		t.Fatalf("set active: %v", err)
+	}
+	if got, _ := b.ActiveSessionID(); got != ids[0] {
+		t.Fatalf("expected the pinned session %s to be active, got %s", ids[0], got)
+	}
+	info, _ := b.SessionInfo(ids[0])
+	if !info.Active || !info.Pinned || info.ActivatedAt == nil {
+		t.Fatalf("expected the pinned session to report it, got %+v", info)
+	}
+
+	if _, err := b.DisconnectSession(ids[0]); err != nil {
+		t.Fatalf("disconnect: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Count() != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("pinned session never went away")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got, _ := b.ActiveSessionID(); got != ids[2] {
+		t.Fatalf("expected the most recently connected session %s after the pinned one dropped, got %s", ids[2], got)
+	}
+	if _, ok := b.PinnedSessionID(); ok {
+		t.Fatalf("expected no pinned session after it disconnected")
+	}
+
+	if err := b.SetActive(ids[1]); err != nil {
+		t.Fatalf("set active: %v", err)
+	}
+	if err := b.SetActive(""); err != nil {
+		t.Fatalf("unpin: %v", err)
+	}
+	if got, _ := b.ActiveSessionID(); got != ids[2] {
+		t.Fatalf("expected unpinning to restore the strategy, got %s", got)
+	}
+}
+
+func TestActivationBreaksTies(t *testing.T) {
+	at := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	b := NewBridge(Options{})
+	b.sessions["a"] = &Session{ID: "a", ConnectedAt: at}
+	b.sessions["b"] = &Session{ID: "b", ConnectedAt: at, ActivatedAt: at.Add(time.Minute)}
+	if got, _ := b.ActiveSessionID(); got != "b" {
+		t.Fatalf("expected the later activated session to win a tie, got %s", got)
+	}
+}
+
+func TestSendCommandSessionDisconnectsMidFlight(t *testing.T) {
+	b := NewBridge(Options{})
+	defer b.Close()
+	srv := httptest.NewServer(http.HandlerFunc(b.HandleWS))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	dialFakeExtension(t, url, "survivor", false)
+	waitForSessions(t, b, 1)
+	// The newest session is the active one; it reads the command and drops
+	// the connection without answering.
+	quitter, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	waitForSessions(t, b, 2)
+	quitterID, _ := b.ActiveSessionID()
+	go func() {
+		var cmd protocol.Command
+		_ = quitter.ReadJSON(&cmd)
+		_ = quitter.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	_, err = b.SendCommand(ctx, protocol.Command{ID: "mid", Type: protocol.CommandClick})
+	var lost *SessionDisconnectedError
+	if !errors.Is(err, ErrSessionDisconnected) || !errors.As(err, &lost) {
+		t.Fatalf("expected a session_disconnected error, got %v", err)
+	}
+	if lost.SessionID != quitterID || !lost.Sent {
+		t.Fatalf("expected the error to name the session the command was sent to, got %+v", lost)
+	}
+	if !strings.HasPrefix(err.Error(), "session_disconnected:") {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("SendCommand waited %s instead of failing on disconnect", time.Since(start))
+	}
+	b.mu.RLock()
+	pending := len(b.pending)
+	b.mu.RUnlock()
+	if pending != 0 {
+		t.Fatalf("expected the pending entry to be dropped, have %d", pending)
+	}
+}
+
+func TestConcurrentCommandsToOneSession(t *testing.T) {
+	b := NewBridge(Options{})
+	defer b.Close()
+	srv := httptest.NewServer(http.HandlerFunc(b.HandleWS))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	// The extension echoes each payload back. A frame torn by two writers
+	// would fail to decode and stop it answering.
+	go func() {
+		for {
+			var cmd protocol.Command
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			_ = conn.WriteJSON(protocol.Response{ID: cmd.ID, OK: true, Data: cmd.Payload})
+		}
+	}()
+	waitForSessions(t, b, 1)
+
+	const n = 50
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// Large payloads make each write span several frames' worth of buffer.
+	filler := strings.Repeat("x", 16<<10)
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Go(func() {
+			payload, _ := json.Marshal(map[string]any{"i": i, "filler": filler})
+			resp, err := b.SendCommand(ctx, protocol.Command{ID: fmt.Sprintf("cmd-%d", i), Type: protocol.CommandClick, Payload: payload})
+			if err != nil {
+				errs <- fmt.Errorf("command %d: %w", i, err)
+				return
+			}
+			var echo struct {
+				I int `json:"i"`
+			}
+			if err := json.Unmarshal(resp.Data, &echo); err != nil || resp.ID != fmt.Sprintf("cmd-%d", i) || echo.I != i {
+				errs <- fmt.Errorf("command %d got response %s for %d (%v)", i, resp.ID, echo.I, err)
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if orphans := b.OrphanResponses(); orphans != 0 {
+		t.Fatalf("expected every response to find its command, %d orphaned", orphans)
+	}
+}
+
+func TestPingReapsUnresponsiveSession(t *testing.T) {
+	b := NewBridge(Options{PingInterval: 20 * time.Millisecond, PongWait: 80 * time.Millisecond})
+	defer b.Close()
+	srv := httptest.NewServer(http.HandlerFunc(b.HandleWS))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	// The client answers pings only while it reads, so one that never reads
+	// looks like a dead connection.
+	dead, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer dead.Close()
+	waitForSessions(t, b, 1)
+	deadID, _ := b.ActiveSessionID()
+
+	alive, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer alive.Close()
+	go func() {
+		for {
+			if _, _, err := alive.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	waitForSessions(t, b, 2)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := b.SessionInfo(deadID); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unresponsive session was never reaped")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Well past PongWait, the session that answers pings is still there.
+	time.Sleep(200 * time.Millisecond)
+	if n := b.Count(); n != 1 {
+		t.Fatalf("expected the responsive session to stay, have %d sessions", n)
+	}
+}
+
+func waitForSessions(t *testing.T, b *Bridge, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Count() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("sessions never registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPendingCommandsExpire(t *testing.T) {
+	b := NewBridge(Options{PendingTTL: 50 * time.Millisecond})
+	defer b.Close()
+	srv := httptest.NewServer(http.HandlerFunc(b.HandleWS))
+	defer srv.Close()
+	dialFakeExtension(t, "ws"+strings.TrimPrefix(srv.URL, "http"), "silent", true)
+	waitForSessions(t, b, 1)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := b.SendCommand(context.Background(), protocol.Command{ID: "never", Type: protocol.CommandClick})
+		errs <- err
+	}()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrCommandExpired) || !strings.HasPrefix(err.Error(), "command_timeout:") {
+			t.Fatalf("expected a command_timeout error, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("command without a deadline never expired")
+	}
+	if n := b.PendingCount(); n != 0 {
+		t.Fatalf("expected the pending entry to be dropped, have %d", n)
+	}
+	// A late answer is an orphan rather than a send on a closed channel.
+	if b.deliver(protocol.Response{ID: "never", OK: true}) {
+		t.Fatalf("expected a response after expiry to be orphaned")
+	}
+}
+
+func TestPendingTTLHonoursLongerDeadline(t *testing.T) {
+	b := NewBridge(Options{PendingTTL: 20 * time.Millisecond})
+	defer b.Close()
+	srv := httptest.NewServer(http.HandlerFunc(b.HandleWS))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	// The extension answers well after PendingTTL, as a long wait_for_url
+	// would.
+	go func() {
+		var cmd protocol.Command
+		if err := conn.ReadJSON(&cmd); err != nil {
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+		_ = conn.WriteJSON(protocol.Response{ID: cmd.ID, OK: true})
+	}()
+	waitForSessions(t, b, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := b.SendCommand(ctx, protocol.Command{ID: "slow", Type: protocol.CommandWaitForURL})
+	if err != nil || !resp.OK {
+		t.Fatalf("expected the caller's deadline to outlast PendingTTL, got %+v, %v", resp, err)
+	}
+}
+
+func TestShutdownFailsCommandsWithSessionClosing(t *testing.T) {
+	b := NewBridge(Options{})
+	srv := httptest.NewServer(http.HandlerFunc(b.HandleWS))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	// A silent extension leaves the command pending until shutdown.
+	dialFakeExtension(t, url, "silent", true)
+	waitForSessions(t, b, 1)
+	id, _ := b.ActiveSessionID()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := b.SendCommand(context.Background(), protocol.Command{ID: "inflight", Type: protocol.CommandClick})
+		errs <- err
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		b.mu.RLock()
+		n := len(b.pending)
+		b.mu.RUnlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("command never became pending")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if n := b.Shutdown(ctx); n != 1 {
+		t.Fatalf("expected one session closed, got %d", n)
+	}
+	var closing *SessionClosingError
+	if err := <-errs; !errors.Is(err, ErrSessionClosing) || !errors.As(err, &closing) || closing.SessionID != id || !closing.Sent {
+		t.Fatalf("expected a session_closing error for the in-flight command, got %v", err)
+	}
+	if b.Count() != 0 {
+		t.Fatalf("expected no sessions after shutdown, have %d", b.Count())
+	}
+	if _, _, err := websocket.DefaultDialer.Dial(url, nil); err == nil {
+		t.Fatalf("expected new connections to be refused after shutdown")
+	}
+}
+
+func TestSendCommandToClosingSessionFailsFast(t *testing.T) {
+	b := NewBridge(Options{})
+	s := &Session{ID: "s", closing: make(chan struct{})}
+	b.sessions["s"] = s
+	s.markClosing()
+	s.markClosing()
+
+	_, err := b.SendCommand(context.Background(), protocol.Command{ID: "late", SessionID: "s", Type: protocol.CommandClick})
+	var closing *SessionClosingError
+	if !errors.As(err, &closing) || closing.Sent || !strings.HasPrefix(err.Error(), "session_closing:") {
+		t.Fatalf("expected an unsent session_closing error, got %v", err)
+	}
+	if len(b.pending) != 0 {
+		t.Fatalf("expected nothing pending, have %d", len(b.pending))
+	}
+}
@@ -0,0 +1,57 @@
+package wsbridge
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"github.com/adityalohuni/mcp-server/protocol"
+)
+
+// SessionResult is one session's answer to a broadcast command.
+type SessionResult struct {
+	SessionID string             `json:"session_id"`
+	Response  *protocol.Response `json:"response,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// Broadcast sends cmd to every connected session and waits for all of them
+// until ctx is done, so a deadline on ctx is shared by every session. Each
+// copy gets its own command id; cmd.SessionID is ignored. Results are sorted
+// by session id and include sessions that failed or timed out.
+func (b *Bridge) Broadcast(ctx context.Context, cmd protocol.Command) []SessionResult {
+	b.mu.RLock()
+	ids := make([]string, 0, len(b.sessions))
+	for id := range b.sessions {
+		ids = append(ids, id)
+	}
+	b.mu.RUnlock()
+	sort.Strings(ids)
+
+	base := cmd.ID
+	if base == "" {
+		base = uuid.New().String()
+	}
+	results := make([]SessionResult, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			one := cmd
+			one.ID = base + ":" + id
+			one.SessionID = id
+			results[i].SessionID = id
+			resp, err := b.SendCommand(ctx, one)
+			if err != nil {
+				results[i].Error = err.Error()
+				return
+			}
+			results[i].Response = &resp
+		}()
+	}
+	wg.Wait()
+	return results
+}
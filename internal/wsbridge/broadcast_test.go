@@ -0,0 +1,86 @@
+package wsbridge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/adityalohuni/mcp-server/protocol"
+)
+
+// dialFakeExtension connects a websocket client that answers every command
+// with ok and data {"name": name}, unless silent is set.
+func dialFakeExtension(t *testing.T, url, name string, silent bool) {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	go func() {
+		for {
+			var cmd protocol.Command
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			if silent {
+				continue
+			}
+			data, _ := json.Marshal(map[string]string{"name": name})
+			_ = conn.WriteJSON(protocol.Response{ID: cmd.ID, OK: true, Data: data})
+		}
+	}()
+}
+
+func TestBroadcastCollectsPerSessionResults(t *testing.T) {
+	b := NewBridge(Options{})
+	defer b.Close()
+	srv := httptest.NewServer(http.HandlerFunc(b.HandleWS))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	dialFakeExtension(t, url, "one", false)
+	dialFakeExtension(t, url, "two", false)
+	waitForSessions(t, b, 2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	results := b.Broadcast(ctx, protocol.Command{ID: "rec", Type: protocol.CommandStartRecording, Payload: json.RawMessage(`{}`)})
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	names := map[string]bool{}
+	for _, r := range results {
+		if r.Error != "" || r.Response == nil || !r.Response.OK {
+			t.Fatalf("session %s failed: %+v", r.SessionID, r)
+		}
+		if r.Response.ID != "rec:"+r.SessionID {
+			t.Fatalf("expected per-session command id, got %q", r.Response.ID)
+		}
+		var data map[string]string
+		_ = json.Unmarshal(r.Response.Data, &data)
+		names[data["name"]] = true
+	}
+	if !names["one"] || !names["two"] {
+		t.Fatalf("expected answers from both sessions, got %v", names)
+	}
+
+	dialFakeExtension(t, url, "mute", true)
+	waitForSessions(t, b, 3)
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	failed := 0
+	for _, r := range b.Broadcast(ctx, protocol.Command{Type: protocol.CommandStopRecording, Payload: json.RawMessage(`{}`)}) {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Fatalf("expected only the silent session to time out, got %d failures", failed)
+	}
+}
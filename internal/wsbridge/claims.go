@@ -0,0 +1,84 @@
+package wsbridge
+
+import (
+	"encoding/json"
+	"log"
+	"slices"
+
+	"github.com/google/uuid"
+
+	"github.com/adityalohuni/mcp-server/protocol"
+)
+
+// trackClaims records the tabs a session owns as it claims, opens, releases
+// and closes them. The extension keeps the real claims; this copy lets the
+// server release them when it drops the session.
+func (s *Session) trackClaims(cmd protocol.Command, resp protocol.Response) {
+	var tab struct {
+		TabID int `json:"tabId"`
+		ID    int `json:"id"`
+	}
+	var tabID int
+	switch cmd.Type {
+	case protocol.CommandClaimTab, protocol.CommandReleaseTab, protocol.CommandCloseTab:
+		if json.Unmarshal(cmd.Payload, &tab) != nil {
+			return
+		}
+		tabID = tab.TabID
+	case protocol.CommandOpenTab:
+		if json.Unmarshal(resp.Data, &tab) != nil {
+			return
+		}
+		tabID = tab.ID
+	default:
+		return
+	}
+	if tabID == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch cmd.Type {
+	case protocol.CommandClaimTab, protocol.CommandOpenTab:
+		if s.claims == nil {
+			s.claims = make(map[int]struct{})
+		}
+		s.claims[tabID] = struct{}{}
+	default:
+		delete(s.claims, tabID)
+	}
+}
+
+// claimedTabs returns the tab ids the session has claimed or opened and not yet
+// released or closed, in ascending order.
+func (s *Session) claimedTabs() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]int, 0, len(s.claims))
+	for id := range s.claims {
+		out = append(out, id)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// releaseClaims asks the extension to release every tab the session holds
+// and forgets them. The commands are written without waiting for answers,
+// since the session is about to be closed; it returns how many were sent.
+func (b *Bridge) releaseClaims(session *Session) int {
+	tabs := session.claimedTabs()
+	session.mu.Lock()
+	clear(session.claims)
+	session.mu.Unlock()
+	released := 0
+	for _, tabID := range tabs {
+		payload, _ := json.Marshal(protocol.ReleaseTabPayload{TabID: tabID})
+		msg, _ := json.Marshal(protocol.Command{ID: uuid.New().String(), Type: protocol.CommandReleaseTab, SessionID: session.ID, Payload: payload})
+		if err := session.write(msg); err != nil {
+			log.Printf("ws release claim failed: session=%s tab=%d: %v", session.ID, tabID, err)
+			break
+		}
+		released++
+	}
+	return released
+}
@@ -0,0 +1,89 @@
+package wsbridge
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/adityalohuni/mcp-server/protocol"
+)
+
+func TestDisconnectSessionReleasesClaims(t *testing.T) {
+	b := NewBridge(Options{})
+	defer b.Close()
+	srv := httptest.NewServer(http.HandlerFunc(b.HandleWS))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	released := make(chan int, 8)
+	go func() {
+		for {
+			var cmd protocol.Command
+			if err := conn.ReadJSON(&cmd); err != nil {
+				close(released)
+				return
+			}
+			var data json.RawMessage
+			switch cmd.Type {
+			case protocol.CommandOpenTab:
+				data = json.RawMessage(`{"id":7}`)
+			case protocol.CommandReleaseTab:
+				var p protocol.ReleaseTabPayload
+				_ = json.Unmarshal(cmd.Payload, &p)
+				released <- p.TabID
+			}
+			_ = conn.WriteJSON(protocol.Response{ID: cmd.ID, OK: true, Data: data})
+		}
+	}()
+	waitForSessions(t, b, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	send := func(id string, typ protocol.CommandType, payload any) {
+		t.Helper()
+		raw, _ := json.Marshal(payload)
+		if _, err := b.SendCommand(ctx, protocol.Command{ID: id, Type: typ, Payload: raw}); err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+	}
+	send("1", protocol.CommandClaimTab, protocol.ClaimTabPayload{TabID: 3})
+	send("2", protocol.CommandOpenTab, protocol.OpenTabPayload{URL: "https://example.com"})
+	send("3", protocol.CommandClaimTab, protocol.ClaimTabPayload{TabID: 4})
+	send("4", protocol.CommandReleaseTab, protocol.ReleaseTabPayload{TabID: 4})
+	// The explicit release reaches the extension too.
+	if got := <-released; got != 4 {
+		t.Fatalf("expected tab 4 to be released first, got %d", got)
+	}
+
+	id, _ := b.ActiveSessionID()
+	session, _ := b.sessionByID(id)
+	if got := session.claimedTabs(); !slices.Equal(got, []int{3, 7}) {
+		t.Fatalf("expected claims on tabs 3 and 7, got %v", got)
+	}
+	n, err := b.DisconnectSession(id)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 released claims, got %d (%v)", n, err)
+	}
+	var got []int
+	for tabID := range released {
+		got = append(got, tabID)
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, []int{3, 7}) {
+		t.Fatalf("expected the extension to be told to release tabs 3 and 7, got %v", got)
+	}
+	if claims := session.claimedTabs(); len(claims) != 0 {
+		t.Fatalf("expected no claims left, got %v", claims)
+	}
+}
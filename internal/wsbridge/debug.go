@@ -16,3 +16,10 @@ func debugf(format string, args ...any) {
 		log.Printf(format, args...)
 	}
 }
+
+func snippet(b []byte, n int) string {
+	if len(b) <= n {
+		return string(b)
+	}
+	return string(b[:n]) + "..."
+}
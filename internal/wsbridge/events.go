@@ -0,0 +1,62 @@
+package wsbridge
+
+import (
+	"time"
+
+	"github.com/adityalohuni/mcp-server/protocol"
+)
+
+// EventSessionClosed is published by the bridge itself, not the extension,
+// after a session disconnects. It is the last event for that session.
+const EventSessionClosed = "session_closed"
+
+// eventBuffer is how many events a subscriber may fall behind by before
+// further events are dropped for it.
+const eventBuffer = 64
+
+// SessionEvent is an extension event tagged with the session that sent it.
+type SessionEvent struct {
+	SessionID string
+	At        time.Time
+	protocol.Event
+}
+
+type subscriber struct {
+	sessionID string
+	ch        chan SessionEvent
+}
+
+// Subscribe returns events from sessionID, or from every session when it is
+// empty, until cancel is called. Delivery never blocks the bridge: a
+// subscriber that falls behind misses events.
+func (b *Bridge) Subscribe(sessionID string) (<-chan SessionEvent, func()) {
+	sub := &subscriber{sessionID: sessionID, ch: make(chan SessionEvent, eventBuffer)}
+	b.subsMu.Lock()
+	b.subs[sub] = struct{}{}
+	b.subsMu.Unlock()
+	cancel := func() {
+		b.subsMu.Lock()
+		defer b.subsMu.Unlock()
+		if _, ok := b.subs[sub]; ok {
+			delete(b.subs, sub)
+			close(sub.ch)
+		}
+	}
+	return sub.ch, cancel
+}
+
+func (b *Bridge) publish(sessionID string, ev protocol.Event) {
+	out := SessionEvent{SessionID: sessionID, At: b.now(), Event: ev}
+	b.subsMu.Lock()
+	defer b.subsMu.Unlock()
+	for sub := range b.subs {
+		if sub.sessionID != "" && sub.sessionID != sessionID {
+			continue
+		}
+		select {
+		case sub.ch <- out:
+		default:
+			debugf("ws event dropped: session=%s event=%s", sessionID, ev.Event)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package wsbridge
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/adityalohuni/mcp-server/protocol"
+)
+
+func TestSubscribeFiltersBySession(t *testing.T) {
+	b := NewBridge(Options{})
+	srv := httptest.NewServer(http.HandlerFunc(b.HandleWS))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("session never registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	id := b.ListSessions()[0].ID
+
+	events, cancel := b.Subscribe(id)
+	defer cancel()
+	other, cancelOther := b.Subscribe("someone-else")
+	defer cancelOther()
+
+	if err := conn.WriteJSON(protocol.Event{Event: protocol.EventTabUpdated, Data: []byte(`{"tabId":3,"title":"Inbox"}`)}); err != nil {
+		t.Fatalf("write event: %v", err)
+	}
+	next := func() SessionEvent {
+		t.Helper()
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(2 * time.Second):
+			t.Fatalf("no event received")
+		}
+		return SessionEvent{}
+	}
+	ev := next()
+	if ev.SessionID != id || ev.Event.Event != protocol.EventTabUpdated || string(ev.Data) != `{"tabId":3,"title":"Inbox"}` {
+		t.Fatalf("unexpected event %#v", ev)
+	}
+
+	_ = conn.Close()
+	if ev := next(); ev.Event.Event != EventSessionClosed || ev.SessionID != id {
+		t.Fatalf("expected session_closed after disconnect, got %#v", ev)
+	}
+	select {
+	case ev := <-other:
+		t.Fatalf("subscriber for another session got %#v", ev)
+	default:
+	}
+
+	cancel()
+	if _, ok := <-events; ok {
+		t.Fatalf("expected the channel to be closed after cancel")
+	}
+}
@@ -0,0 +1,146 @@
+// Package client is the extension side of the /ws protocol, for Go programs
+// that stand in for a browser: test fakes and non-browser targets.
+//
+// The server sends no greeting. A session exists as soon as the websocket
+// upgrade succeeds, and from then on the server sends protocol.Command
+// messages and expects one protocol.Response per command id.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/adityalohuni/mcp-server/protocol"
+)
+
+// Client is one extension connection to the bridge.
+type Client struct {
+	conn *websocket.Conn
+
+	writeMu sync.Mutex
+	seq     uint64
+}
+
+// Dial connects to a bridge websocket URL such as ws://127.0.0.1:9099/ws.
+func Dial(ctx context.Context, url string, header http.Header) (*Client, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", url, err)
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Close closes the connection; the bridge drops the session.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// ReadCommand blocks until the next command arrives.
+func (c *Client) ReadCommand() (protocol.Command, error) {
+	var cmd protocol.Command
+	if err := c.conn.ReadJSON(&cmd); err != nil {
+		return protocol.Command{}, err
+	}
+	return cmd, nil
+}
+
+// Reply answers a command successfully. data, when not nil, is sent as the
+// response data and must match what the server expects for the command, for
+// example protocol.SnapshotData for snapshot.
+func (c *Client) Reply(id string, data any) error {
+	resp := protocol.Response{ID: id, OK: true}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("encode reply data: %w", err)
+		}
+		resp.Data = raw
+	}
+	return c.write(resp)
+}
+
+// Fail answers a command with an error. code is one of the errorCode values
+// documented in the README, such as ELEMENT_NOT_FOUND; it may be empty.
+func (c *Client) Fail(id, code, message string) error {
+	return c.write(protocol.Response{ID: id, OK: false, ErrorCode: code, Error: message})
+}
+
+// Event pushes an unsolicited event such as protocol.EventTabOpened, with
+// data like protocol.TabEventData.
+func (c *Client) Event(name string, data any) error {
+	ev := protocol.Event{Event: name}
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("encode event data: %w", err)
+		}
+		ev.Data = raw
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.seq++
+	ev.Seq = c.seq
+	return c.conn.WriteJSON(ev)
+}
+
+func (c *Client) write(resp protocol.Response) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.seq++
+	resp.Seq = c.seq
+	return c.conn.WriteJSON(resp)
+}
+
+// Error is returned by a Handler to fail a command with an error code.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return e.Message
+	}
+	return e.Code + ": " + e.Message
+}
+
+// Handler answers one command. A nil error replies with data; an *Error
+// fails the command with its code, and any other error fails it with
+// COMMAND_FAILED.
+type Handler func(ctx context.Context, cmd protocol.Command) (data any, err error)
+
+// Serve reads commands and answers each with h until ctx is done or the
+// connection fails. Commands are handled one at a time, in order.
+func (c *Client) Serve(ctx context.Context, h Handler) error {
+	stop := context.AfterFunc(ctx, func() { _ = c.conn.Close() })
+	defer stop()
+	for {
+		cmd, err := c.ReadCommand()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		data, err := h(ctx, cmd)
+		if err == nil {
+			err = c.Reply(cmd.ID, data)
+		} else {
+			var cmdErr *Error
+			if errors.As(err, &cmdErr) {
+				err = c.Fail(cmd.ID, cmdErr.Code, cmdErr.Message)
+			} else {
+				err = c.Fail(cmd.ID, "COMMAND_FAILED", err.Error())
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
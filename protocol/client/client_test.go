@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"github.com/adityalohuni/mcp-server/internal/browser/wsbrowser"
+	"github.com/adityalohuni/mcp-server/internal/mcpserver"
+	"github.com/adityalohuni/mcp-server/internal/page"
+	"github.com/adityalohuni/mcp-server/internal/wsbridge"
+	"github.com/adityalohuni/mcp-server/protocol"
+)
+
+// TestDrivesMCPServer runs MCP tool calls through the bridge to a Go client
+// standing in for the extension.
+func TestDrivesMCPServer(t *testing.T) {
+	t.Chdir(t.TempDir())
+	bridge := wsbridge.NewBridge(wsbridge.Options{})
+	srv := httptest.NewServer(http.HandlerFunc(bridge.HandleWS))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer c.Close()
+
+	clicked := make(chan string, 1)
+	go c.Serve(ctx, func(_ context.Context, cmd protocol.Command) (any, error) {
+		switch cmd.Type {
+		case protocol.CommandSnapshot:
+			if _, err := Snapshot(cmd); err != nil {
+				return nil, &Error{Code: "INVALID_INPUT", Message: err.Error()}
+			}
+			return protocol.SnapshotData{
+				URL:   "https://example.com",
+				Title: "Example",
+				HTML:  `<h1>Example</h1><button id="go">Go</button>`,
+			}, nil
+		case protocol.CommandClick:
+			p, err := Click(cmd)
+			if err != nil {
+				return nil, &Error{Code: "INVALID_INPUT", Message: err.Error()}
+			}
+			if p.Selector != "#go" {
+				return nil, &Error{Code: "ELEMENT_NOT_FOUND", Message: "no element matches " + p.Selector}
+			}
+			clicked <- p.Selector
+			return nil, nil
+		}
+		return nil, &Error{Code: "UNSUPPORTED_COMMAND", Message: string(cmd.Type)}
+	})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for bridge.Count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("session never registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	store := page.NewStore()
+	reducer := page.NewReducer(page.ReduceOptions{})
+	b := wsbrowser.NewClient(bridge, reducer, store, wsbrowser.Options{})
+	server := mcpserver.New(b, store, mcpserver.Options{Reducer: reducer})
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.MCPServer().Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatalf("server connect: %v", err)
+	}
+	cs, err := mcp.NewClient(&mcp.Implementation{Name: "test-client", Version: "v0.0.1"}, nil).Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("client connect: %v", err)
+	}
+	defer cs.Close()
+
+	res, err := cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.snapshot", Arguments: map[string]any{}})
+	if err != nil || res.IsError {
+		t.Fatalf("snapshot: %v %#v", err, res)
+	}
+	var snap mcpserver.SnapshotOutput
+	data, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(data, &snap); err != nil {
+		t.Fatalf("decode snapshot: %v", err)
+	}
+	if snap.Title != "Example" || !strings.Contains(snap.Text, "Example") || snap.ElementsTotal != 1 {
+		t.Fatalf("unexpected snapshot %#v", snap)
+	}
+
+	res, err = cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.click", Arguments: map[string]any{"selector": "#go"}})
+	if err != nil || res.IsError {
+		t.Fatalf("click: %v %#v", err, res)
+	}
+	if got := <-clicked; got != "#go" {
+		t.Fatalf("expected the client to see #go, got %q", got)
+	}
+
+	res, err = cs.CallTool(ctx, &mcp.CallToolParams{Name: "browser.click", Arguments: map[string]any{"selector": "#missing"}})
+	if err != nil {
+		t.Fatalf("click missing: %v", err)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; !res.IsError || !strings.Contains(text, `"error":"not_found"`) || !strings.Contains(text, `"selector":"#missing"`) {
+		t.Fatalf("expected the client's ELEMENT_NOT_FOUND as a not_found result, got %q", text)
+	}
+}
+
+func TestDecodeChecksType(t *testing.T) {
+	cmd := protocol.Command{ID: "1", Type: protocol.CommandHover, Payload: json.RawMessage(`{"selector":"#a"}`)}
+	if _, err := Click(cmd); err == nil {
+		t.Fatalf("expected decoding a hover as a click to fail")
+	}
+	p, err := Hover(cmd)
+	if err != nil || p.Selector != "#a" {
+		t.Fatalf("hover: %#v %v", p, err)
+	}
+	if _, err := Snapshot(protocol.Command{Type: protocol.CommandSnapshot}); err != nil {
+		t.Fatalf("expected a missing payload to decode to the zero value: %v", err)
+	}
+}
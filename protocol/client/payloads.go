@@ -0,0 +1,160 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/adityalohuni/mcp-server/protocol"
+)
+
+// decode unmarshals the payload of cmd after checking it is of type want.
+// A missing payload decodes to the zero value.
+func decode[T any](cmd protocol.Command, want protocol.CommandType) (T, error) {
+	var out T
+	if cmd.Type != want {
+		return out, fmt.Errorf("command %s is %q, not %q", cmd.ID, cmd.Type, want)
+	}
+	if len(cmd.Payload) == 0 || bytes.Equal(cmd.Payload, []byte("null")) {
+		return out, nil
+	}
+	if err := json.Unmarshal(cmd.Payload, &out); err != nil {
+		return out, fmt.Errorf("decode %s payload: %w", want, err)
+	}
+	return out, nil
+}
+
+// Click decodes the payload of a click command.
+func Click(cmd protocol.Command) (protocol.ClickPayload, error) {
+	return decode[protocol.ClickPayload](cmd, protocol.CommandClick)
+}
+
+// Snapshot decodes the payload of a snapshot command.
+func Snapshot(cmd protocol.Command) (protocol.SnapshotPayload, error) {
+	return decode[protocol.SnapshotPayload](cmd, protocol.CommandSnapshot)
+}
+
+// Scroll decodes the payload of a scroll command.
+func Scroll(cmd protocol.Command) (protocol.ScrollPayload, error) {
+	return decode[protocol.ScrollPayload](cmd, protocol.CommandScroll)
+}
+
+// Hover decodes the payload of a hover command.
+func Hover(cmd protocol.Command) (protocol.HoverPayload, error) {
+	return decode[protocol.HoverPayload](cmd, protocol.CommandHover)
+}
+
+// Type decodes the payload of a type command.
+func Type(cmd protocol.Command) (protocol.TypePayload, error) {
+	return decode[protocol.TypePayload](cmd, protocol.CommandTypeText)
+}
+
+// Enter decodes the payload of a enter command.
+func Enter(cmd protocol.Command) (protocol.EnterPayload, error) {
+	return decode[protocol.EnterPayload](cmd, protocol.CommandEnter)
+}
+
+// Navigate decodes the payload of a navigate command.
+func Navigate(cmd protocol.Command) (protocol.NavigatePayload, error) {
+	return decode[protocol.NavigatePayload](cmd, protocol.CommandNavigate)
+}
+
+// Reload decodes the payload of a reload command.
+func Reload(cmd protocol.Command) (protocol.ReloadPayload, error) {
+	return decode[protocol.ReloadPayload](cmd, protocol.CommandReload)
+}
+
+// Find decodes the payload of a find command.
+func Find(cmd protocol.Command) (protocol.FindPayload, error) {
+	return decode[protocol.FindPayload](cmd, protocol.CommandFind)
+}
+
+// WaitForSelector decodes the payload of a waitForSelector command.
+func WaitForSelector(cmd protocol.Command) (protocol.WaitForSelectorPayload, error) {
+	return decode[protocol.WaitForSelectorPayload](cmd, protocol.CommandWaitFor)
+}
+
+// WaitForURL decodes the payload of a waitForUrl command.
+func WaitForURL(cmd protocol.Command) (protocol.WaitForURLPayload, error) {
+	return decode[protocol.WaitForURLPayload](cmd, protocol.CommandWaitForURL)
+}
+
+// Select decodes the payload of a select command.
+func Select(cmd protocol.Command) (protocol.SelectPayload, error) {
+	return decode[protocol.SelectPayload](cmd, protocol.CommandSelect)
+}
+
+// Screenshot decodes the payload of a screenshot command.
+func Screenshot(cmd protocol.Command) (protocol.ScreenshotPayload, error) {
+	return decode[protocol.ScreenshotPayload](cmd, protocol.CommandScreenshot)
+}
+
+// OpenTab decodes the payload of a open_tab command.
+func OpenTab(cmd protocol.Command) (protocol.OpenTabPayload, error) {
+	return decode[protocol.OpenTabPayload](cmd, protocol.CommandOpenTab)
+}
+
+// CloseTab decodes the payload of a close_tab command.
+func CloseTab(cmd protocol.Command) (protocol.CloseTabPayload, error) {
+	return decode[protocol.CloseTabPayload](cmd, protocol.CommandCloseTab)
+}
+
+// ClaimTab decodes the payload of a claim_tab command.
+func ClaimTab(cmd protocol.Command) (protocol.ClaimTabPayload, error) {
+	return decode[protocol.ClaimTabPayload](cmd, protocol.CommandClaimTab)
+}
+
+// ReleaseTab decodes the payload of a release_tab command.
+func ReleaseTab(cmd protocol.Command) (protocol.ReleaseTabPayload, error) {
+	return decode[protocol.ReleaseTabPayload](cmd, protocol.CommandReleaseTab)
+}
+
+// SetTabSharing decodes the payload of a set_tab_sharing command.
+func SetTabSharing(cmd protocol.Command) (protocol.SetTabSharingPayload, error) {
+	return decode[protocol.SetTabSharingPayload](cmd, protocol.CommandSetTabSharing)
+}
+
+// ClearStorage decodes the payload of a clear_storage command.
+func ClearStorage(cmd protocol.Command) (protocol.ClearStoragePayload, error) {
+	return decode[protocol.ClearStoragePayload](cmd, protocol.CommandClearStorage)
+}
+
+// GetStorage decodes the payload of a get_storage command.
+func GetStorage(cmd protocol.Command) (protocol.GetStoragePayload, error) {
+	return decode[protocol.GetStoragePayload](cmd, protocol.CommandGetStorage)
+}
+
+// SetStorage decodes the payload of a set_storage command.
+func SetStorage(cmd protocol.Command) (protocol.SetStoragePayload, error) {
+	return decode[protocol.SetStoragePayload](cmd, protocol.CommandSetStorage)
+}
+
+// PressKeys decodes the payload of a press_keys command.
+func PressKeys(cmd protocol.Command) (protocol.PressKeysPayload, error) {
+	return decode[protocol.PressKeysPayload](cmd, protocol.CommandPressKeys)
+}
+
+// FillForm decodes the payload of a fill_form command.
+func FillForm(cmd protocol.Command) (protocol.FillFormPayload, error) {
+	return decode[protocol.FillFormPayload](cmd, protocol.CommandFillForm)
+}
+
+// SetChecked decodes the payload of a set_checked command.
+func SetChecked(cmd protocol.Command) (protocol.SetCheckedPayload, error) {
+	return decode[protocol.SetCheckedPayload](cmd, protocol.CommandSetChecked)
+}
+
+// GetAttribute decodes the payload of a get_attribute command.
+func GetAttribute(cmd protocol.Command) (protocol.GetAttributePayload, error) {
+	return decode[protocol.GetAttributePayload](cmd, protocol.CommandGetAttribute)
+}
+
+// GetText decodes the payload of a get_text command.
+func GetText(cmd protocol.Command) (protocol.GetTextPayload, error) {
+	return decode[protocol.GetTextPayload](cmd, protocol.CommandGetText)
+}
+
+// Evaluate decodes the payload of a evaluate command.
+func Evaluate(cmd protocol.Command) (protocol.EvaluatePayload, error) {
+	return decode[protocol.EvaluatePayload](cmd, protocol.CommandEvaluate)
+}
@@ -0,0 +1,429 @@
+// Package protocol defines the JSON messages exchanged over the /ws
+// websocket: commands the bridge sends, the extension's responses, and the
+// events it pushes unprompted.
+package protocol
+
+import "encoding/json"
+
+type CommandType string
+
+const (
+	CommandClick          CommandType = "click"
+	CommandSnapshot       CommandType = "snapshot"
+	CommandScroll         CommandType = "scroll"
+	CommandHover          CommandType = "hover"
+	CommandTypeText       CommandType = "type"
+	CommandEnter          CommandType = "enter"
+	CommandBack           CommandType = "back"
+	CommandForward        CommandType = "forward"
+	CommandWaitFor        CommandType = "waitForSelector"
+	CommandWaitForURL     CommandType = "waitForUrl"
+	CommandFind           CommandType = "find"
+	CommandNavigate       CommandType = "navigate"
+	CommandReload         CommandType = "reload"
+	CommandSelect         CommandType = "select"
+	CommandScreenshot     CommandType = "screenshot"
+	CommandStartRecording CommandType = "start_recording"
+	CommandStopRecording  CommandType = "stop_recording"
+	CommandGetRecording   CommandType = "get_recording"
+	CommandListTabs       CommandType = "list_tabs"
+	CommandOpenTab        CommandType = "open_tab"
+	CommandCloseTab       CommandType = "close_tab"
+	CommandClaimTab       CommandType = "claim_tab"
+	CommandReleaseTab     CommandType = "release_tab"
+	CommandSetTabSharing  CommandType = "set_tab_sharing"
+	CommandClearStorage   CommandType = "clear_storage"
+	CommandEvaluate       CommandType = "evaluate"
+	CommandGetAttribute   CommandType = "get_attribute"
+	CommandGetText        CommandType = "get_text"
+	CommandFillForm       CommandType = "fill_form"
+	CommandSetChecked     CommandType = "set_checked"
+	CommandGetHistory     CommandType = "get_history"
+	CommandGetStorage     CommandType = "get_storage"
+	CommandSetStorage     CommandType = "set_storage"
+	CommandPressKeys      CommandType = "press_keys"
+)
+
+type Command struct {
+	ID        string          `json:"id"`
+	Type      CommandType     `json:"type"`
+	SessionID string          `json:"sessionId,omitempty"`
+	TabID     int             `json:"tabId,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+	// TraceID ties the command to the MCP tool call or admin request that
+	// issued it; the extension may log it but does not echo it back.
+	TraceID string `json:"traceId,omitempty"`
+}
+
+type Response struct {
+	ID        string          `json:"id"`
+	OK        bool            `json:"ok"`
+	Error     string          `json:"error,omitempty"`
+	ErrorCode string          `json:"errorCode,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	// Seq is an optional per-connection counter the extension increments on
+	// every message it sends, letting the server spot gaps and reordering.
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+// Event is a message the extension sends without being asked. It has no id,
+// which is how the bridge tells it apart from a Response.
+type Event struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Seq   uint64          `json:"seq,omitempty"`
+}
+
+// Tab events carry a TabEventData. For tab_updated only the fields that
+// changed are set besides TabID, like chrome.tabs.onUpdated's changeInfo.
+const (
+	EventTabOpened  = "tab_opened"
+	EventTabClosed  = "tab_closed"
+	EventTabUpdated = "tab_updated"
+)
+
+type TabEventData struct {
+	TabID int    `json:"tabId"`
+	URL   string `json:"url,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+// ErrorCodeTabLocked is reported when a command targets a tab claimed
+// exclusively by another session. Data carries a TabLockedData.
+const ErrorCodeTabLocked = "tab_locked"
+
+// ErrorCodeNotFound is reported when a command's selector matches no element.
+const ErrorCodeNotFound = "not_found"
+
+// ErrorCodeElementNotFound is the older spelling of ErrorCodeNotFound, still
+// reported by some extension builds.
+const ErrorCodeElementNotFound = "ELEMENT_NOT_FOUND"
+
+// ErrorCodeNotCheckable is reported by set_checked when the element is not a
+// checkbox or radio button, or is a radio button being unchecked.
+const ErrorCodeNotCheckable = "not_checkable"
+
+// TabLockedData describes the owner of a locked tab. OwnerSessionID is only
+// populated when the owner allows shared claims.
+type TabLockedData struct {
+	TabID          int    `json:"tabId,omitempty"`
+	OwnerSessionID string `json:"ownerSessionId,omitempty"`
+	AllowShared    bool   `json:"allowShared,omitempty"`
+}
+
+type ClickPayload struct {
+	Selector string `json:"selector"`
+}
+
+type SnapshotPayload struct {
+	IncludeHidden bool `json:"includeHidden,omitempty"`
+	MaxElements   int  `json:"maxElements,omitempty"`
+	MaxText       int  `json:"maxText,omitempty"`
+	IncludeHTML   bool `json:"includeHTML,omitempty"`
+	MaxHTML       int  `json:"maxHTML,omitempty"`
+	MaxHTMLTokens int  `json:"maxHTMLTokens,omitempty"`
+	// IncludeValues asks for the live value of form fields in the element
+	// list rather than their value attribute.
+	IncludeValues bool `json:"includeValues,omitempty"`
+}
+
+type ScrollPayload struct {
+	DeltaX   int    `json:"deltaX,omitempty"`
+	DeltaY   int    `json:"deltaY,omitempty"`
+	Selector string `json:"selector,omitempty"`
+	Behavior string `json:"behavior,omitempty"`
+	Block    string `json:"block,omitempty"`
+}
+
+type HoverPayload struct {
+	Selector string `json:"selector"`
+}
+
+type TypePayload struct {
+	Selector         string `json:"selector"`
+	Text             string `json:"text"`
+	PressEnter       bool   `json:"pressEnter,omitempty"`
+	ReportValidation bool   `json:"reportValidation,omitempty"`
+}
+
+type EnterPayload struct {
+	Selector string `json:"selector,omitempty"`
+	Key      string `json:"key,omitempty"`
+}
+
+// PressKeysPayload replays Keys in order on the element matching Selector,
+// or on the focused element when Selector is empty. Each key is a chord in
+// canonical form: modifiers from Control, Shift, Alt and Meta in that order,
+// then the key (a single character or a KeyboardEvent.key name such as
+// Enter), joined by "+". "Control++" presses plus with Control held.
+type PressKeysPayload struct {
+	Selector string   `json:"selector,omitempty"`
+	Keys     []string `json:"keys"`
+}
+
+// PressKeysData is the extension's answer to press_keys. Dispatched lists
+// the chords sent, which falls short of the payload's keys when the target
+// went away partway.
+type PressKeysData struct {
+	Dispatched        []string `json:"dispatched"`
+	UsedActiveElement bool     `json:"usedActiveElement,omitempty"`
+}
+
+type NavigatePayload struct {
+	URL string `json:"url"`
+}
+
+type ReloadPayload struct {
+	BypassCache bool `json:"bypassCache,omitempty"`
+}
+
+// NavigateData is the extension's answer to navigate and reload. Extensions
+// that watch the main-frame response (e.g. with webRequest) add its status
+// and headers; others send only the URL, and maybe the title.
+type NavigateData struct {
+	URL        string            `json:"url"`
+	Title      string            `json:"title,omitempty"`
+	StatusCode int               `json:"statusCode,omitempty"`
+	StatusText string            `json:"statusText,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+}
+
+type FindPayload struct {
+	Text          string `json:"text"`
+	Limit         int    `json:"limit,omitempty"`
+	Radius        int    `json:"radius,omitempty"`
+	CaseSensitive bool   `json:"caseSensitive,omitempty"`
+	// IncludePositions asks for a selector and document rect per match.
+	IncludePositions bool `json:"includePositions,omitempty"`
+}
+
+type WaitForSelectorPayload struct {
+	Selector     string `json:"selector"`
+	TimeoutMs    int    `json:"timeoutMs,omitempty"`
+	State        string `json:"state,omitempty"`
+	ContainsText string `json:"containsText,omitempty"`
+}
+
+// WaitForURLPayload carries the caller's pattern for logging, and Regex, the
+// server's translation of it that the extension tests the tab's URL against
+// with new RegExp(regex).
+type WaitForURLPayload struct {
+	Pattern   string `json:"pattern"`
+	Match     string `json:"match"`
+	Regex     string `json:"regex"`
+	TimeoutMs int    `json:"timeoutMs,omitempty"`
+}
+
+type WaitForURLData struct {
+	Matched bool   `json:"matched"`
+	URL     string `json:"url"`
+}
+
+type SelectPayload struct {
+	Selector   string   `json:"selector"`
+	Value      string   `json:"value,omitempty"`
+	Label      string   `json:"label,omitempty"`
+	Index      int      `json:"index,omitempty"`
+	Values     []string `json:"values,omitempty"`
+	Labels     []string `json:"labels,omitempty"`
+	Indices    []int    `json:"indices,omitempty"`
+	MatchMode  string   `json:"matchMode,omitempty"`
+	LabelRegex string   `json:"labelRegex,omitempty"`
+	Toggle     bool     `json:"toggle,omitempty"`
+	// The extension dispatches input and change after selecting, and blur
+	// as well when BlurAfter is set, and lists them in the reply's events.
+	BlurAfter bool `json:"blurAfter,omitempty"`
+}
+
+type ScreenshotPayload struct {
+	Selector  string  `json:"selector,omitempty"`
+	Padding   int     `json:"padding,omitempty"`
+	Format    string  `json:"format,omitempty"`
+	Quality   float64 `json:"quality,omitempty"`
+	MaxWidth  int     `json:"maxWidth,omitempty"`
+	MaxHeight int     `json:"maxHeight,omitempty"`
+	// Annotate asks the extension to outline the selector's element while
+	// capturing, remove the outline afterwards, and report the element's
+	// box as "box" in the reply.
+	Annotate bool `json:"annotate,omitempty"`
+}
+
+type OpenTabPayload struct {
+	URL    string `json:"url,omitempty"`
+	Active bool   `json:"active,omitempty"`
+	Pinned bool   `json:"pinned,omitempty"`
+}
+
+type CloseTabPayload struct {
+	TabID int `json:"tabId"`
+}
+
+type ClaimTabPayload struct {
+	TabID         int    `json:"tabId"`
+	Mode          string `json:"mode,omitempty"`
+	RequireActive bool   `json:"requireActive,omitempty"`
+}
+
+type ReleaseTabPayload struct {
+	TabID int `json:"tabId"`
+}
+
+type SetTabSharingPayload struct {
+	TabID       int  `json:"tabId"`
+	AllowShared bool `json:"allowShared"`
+}
+
+// ClearStoragePayload names what to clear for the target tab's origin.
+type ClearStoragePayload struct {
+	Cookies        bool `json:"cookies,omitempty"`
+	LocalStorage   bool `json:"localStorage,omitempty"`
+	SessionStorage bool `json:"sessionStorage,omitempty"`
+	Cache          bool `json:"cache,omitempty"`
+}
+
+// GetStoragePayload reads the target tab's localStorage ("local") or
+// sessionStorage ("session"): the one key when Key is set, else every key.
+// MaxBytes lets the extension stop collecting once the keys and values it
+// has read exceed it; the server enforces the same limit.
+type GetStoragePayload struct {
+	Kind     string `json:"kind"`
+	Key      string `json:"key,omitempty"`
+	MaxBytes int    `json:"maxBytes,omitempty"`
+}
+
+// SetStoragePayload sets Key to Value, or removes Key when Remove is set.
+type SetStoragePayload struct {
+	Kind   string `json:"kind"`
+	Key    string `json:"key"`
+	Value  string `json:"value,omitempty"`
+	Remove bool   `json:"remove,omitempty"`
+}
+
+// StorageData is the extension's answer to get_storage. Count is the number
+// of keys in the storage area, which exceeds len(Items) when the extension
+// stopped at maxBytes; it then sets Truncated.
+type StorageData struct {
+	Origin    string        `json:"origin,omitempty"`
+	Items     []StorageItem `json:"items,omitempty"`
+	Count     int           `json:"count,omitempty"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+type StorageItem struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// SetStorageData is the extension's answer to set_storage. Existed reports
+// whether the key was present before the change.
+type SetStorageData struct {
+	Origin  string `json:"origin,omitempty"`
+	Existed bool   `json:"existed,omitempty"`
+}
+
+// EvaluatePayload carries a JavaScript expression to evaluate in the target
+// tab. The extension replies with {value, type, error}: value is the
+// JSON-serialized result, type its typeof, and error the message when the
+// expression threw.
+type EvaluatePayload struct {
+	Script string `json:"script"`
+}
+
+// FillFormPayload fills each field in order in one round trip. A field that
+// fails does not stop the rest.
+type FillFormPayload struct {
+	Fields []FillFormField `json:"fields"`
+}
+
+type FillFormField struct {
+	Selector   string `json:"selector"`
+	Value      string `json:"value"`
+	PressEnter bool   `json:"pressEnter,omitempty"`
+}
+
+// FillFormResult is the extension's reply to fill_form, with one entry per
+// field in the order they were sent.
+type FillFormResult struct {
+	Fields []FillFieldResult `json:"fields"`
+}
+
+type FillFieldResult struct {
+	Selector  string `json:"selector"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
+}
+
+// SetCheckedPayload sets the checked state of a checkbox or radio button. The
+// extension replies with {checked, changed}, reading checked back from the
+// element, or fails with ErrorCodeNotCheckable.
+type SetCheckedPayload struct {
+	Selector string `json:"selector"`
+	Checked  bool   `json:"checked"`
+}
+
+// GetAttributePayload reads one attribute of the first element matching
+// Selector. The extension replies with {value, present}.
+type GetAttributePayload struct {
+	Selector  string `json:"selector"`
+	Attribute string `json:"attribute"`
+}
+
+// GetTextPayload reads the text of the first element matching Selector. The
+// extension replies with {innerText, textContent}.
+type GetTextPayload struct {
+	Selector string `json:"selector"`
+}
+
+type Element struct {
+	Tag         string `json:"tag,omitempty"`
+	Text        string `json:"text,omitempty"`
+	Selector    string `json:"selector,omitempty"`
+	Href        string `json:"href,omitempty"`
+	InputType   string `json:"inputType,omitempty"`
+	Name        string `json:"name,omitempty"`
+	ID          string `json:"id,omitempty"`
+	ARIALabel   string `json:"ariaLabel,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Alt         string `json:"alt,omitempty"`
+	Value       string `json:"value,omitempty"`
+	Placeholder string `json:"placeholder,omitempty"`
+	Context     string `json:"context,omitempty"`
+	Disabled    bool   `json:"disabled,omitempty"`
+	Visible     *bool  `json:"visible,omitempty"`
+}
+
+// HistoryData is the extension's answer to back and forward. Moved may be
+// omitted by extensions that only report the URLs before and after.
+type HistoryData struct {
+	Direction   string `json:"direction,omitempty"`
+	Moved       *bool  `json:"moved,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Title       string `json:"title,omitempty"`
+	PreviousURL string `json:"previousUrl,omitempty"`
+}
+
+// HistoryListData is the extension's answer to get_history. Extensions that
+// can read the tab's session history fill Entries and Index; others report
+// only the current URL and title, and Length when window.history exposes it.
+type HistoryListData struct {
+	Entries []HistoryEntry `json:"entries,omitempty"`
+	Index   *int           `json:"index,omitempty"`
+	Length  int            `json:"length,omitempty"`
+	URL     string         `json:"url,omitempty"`
+	Title   string         `json:"title,omitempty"`
+}
+
+type HistoryEntry struct {
+	URL     string `json:"url"`
+	Title   string `json:"title,omitempty"`
+	Current bool   `json:"current,omitempty"`
+}
+
+type SnapshotData struct {
+	URL      string    `json:"url"`
+	Title    string    `json:"title,omitempty"`
+	Text     string    `json:"text,omitempty"`
+	HTML     string    `json:"html,omitempty"`
+	Elements []Element `json:"elements,omitempty"`
+}